@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Games are searched by name on SteamGridDB, IGDB, URL sources and Google.
+// Non-Steam shortcuts often have short or odd names, so names are cleaned up
+// first: aliases like "tf2" become the full title, trademark signs and year
+// suffixes like "(2013)" are dropped and long vowels of romanized titles are
+// spelled plainly, like "Ōkami" as "Okami". Users add their own aliases with
+// the aliases option, which wins over the ones below:
+//
+//	aliases = "mk8=Mario Kart 8 Deluxe;smo=Super Mario Odyssey"
+
+// Aliases by lower case name.
+var defaultAliases = map[string]string{
+	"tf2":    "Team Fortress 2",
+	"hl2":    "Half-Life 2",
+	"l4d":    "Left 4 Dead",
+	"l4d2":   "Left 4 Dead 2",
+	"csgo":   "Counter-Strike: Global Offensive",
+	"cs2":    "Counter-Strike 2",
+	"gta v":  "Grand Theft Auto V",
+	"gta 5":  "Grand Theft Auto V",
+	"gtav":   "Grand Theft Auto V",
+	"rdr2":   "Red Dead Redemption 2",
+	"pubg":   "PUBG: Battlegrounds",
+	"ff7":    "Final Fantasy VII",
+	"ffvii":  "Final Fantasy VII",
+	"ff14":   "Final Fantasy XIV Online",
+	"ffxiv":  "Final Fantasy XIV Online",
+	"mgsv":   "Metal Gear Solid V: The Phantom Pain",
+	"botw":   "The Legend of Zelda: Breath of the Wild",
+	"totk":   "The Legend of Zelda: Tears of the Kingdom",
+	"oot":    "The Legend of Zelda: Ocarina of Time",
+	"sm64":   "Super Mario 64",
+	"smw":    "Super Mario World",
+	"mk8":    "Mario Kart 8 Deluxe",
+	"ssbu":   "Super Smash Bros. Ultimate",
+	"ssbm":   "Super Smash Bros. Melee",
+	"wow":    "World of Warcraft",
+	"lol":    "League of Legends",
+	"poe":    "Path of Exile",
+	"dbd":    "Dead by Daylight",
+	"ror2":   "Risk of Rain 2",
+	"dst":    "Don't Starve Together",
+	"ds3":    "Dark Souls III",
+	"sekiro": "Sekiro: Shadows Die Twice",
+}
+
+// Trademark signs and year suffixes, which rarely are part of the title on
+// the sources.
+var (
+	trademarkSigns = strings.NewReplacer("™", "", "®", "", "©", "")
+	yearSuffix     = regexp.MustCompile(`\s*[(\[](19|20)\d\d[)\]]\s*$`)
+	romanization   = strings.NewReplacer("ā", "a", "ī", "i", "ū", "u", "ē", "e", "ō", "o", "Ā", "A", "Ī", "I", "Ū", "U", "Ē", "E", "Ō", "O")
+)
+
+// Returns the aliases of the options over the default ones, by lower case
+// name.
+func getAliases(opts *Options) (map[string]string, error) {
+	aliases := make(map[string]string, len(defaultAliases))
+	for alias, name := range defaultAliases {
+		aliases[alias] = name
+	}
+	for _, entry := range strings.Split(opts.Aliases, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.New("Invalid alias " + entry + ", must be like tf2=Team Fortress 2")
+		}
+		aliases[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+	return aliases, nil
+}
+
+// Returns the name to search for a game.
+func normalizeName(name string, aliases map[string]string) string {
+	cleaned := strings.TrimSpace(trademarkSigns.Replace(name))
+	if alias, ok := aliases[strings.ToLower(cleaned)]; ok {
+		return alias
+	}
+	cleaned = yearSuffix.ReplaceAllString(cleaned, "")
+	if alias, ok := aliases[strings.ToLower(cleaned)]; ok {
+		return alias
+	}
+	return romanization.Replace(cleaned)
+}
+
+// Copy of the game with the name to search for, or the game itself if the
+// name doesn't change.
+func searchGame(game *Game, opts *Options) *Game {
+	aliases, err := getAliases(opts)
+	if err != nil || game.Name == "" {
+		return game
+	}
+	name := normalizeName(game.Name, aliases)
+	if name == game.Name {
+		return game
+	}
+	searched := *game
+	searched.Name = name
+	return &searched
+}
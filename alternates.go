@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alternates are the other images found for an artwork, kept in
+// grid/alternates when the alternates option is set. The alt command switches
+// between them without downloading anything:
+//
+//	steamgrid alt 620 --next
+//
+// The index of the image in use is stored in grid/alternates/index.json, by
+// game ID and art style suffix.
+const alternatesDirName = "alternates"
+
+// Writes the candidates of the game to the alternates directory, replacing
+// the ones of an earlier run. The first candidate is the one in use.
+func saveAlternates(gridDir string, game *Game, artStyleExtensions []string, count int) error {
+	dir := filepath.Join(gridDir, alternatesDirName)
+	err := steamFS.MkdirAll(dir)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listAlternates(dir, game, artStyleExtensions)
+	if err != nil {
+		return err
+	}
+	for _, path := range existing {
+		err = steamFS.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, candidate := range game.Candidates {
+		if i >= count {
+			break
+		}
+		name := game.ID + artStyleExtensions[0] + " " + strconv.Itoa(i) + candidate.ImageExt
+		err = steamFS.WriteFile(filepath.Join(dir, name), candidate.ImageBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return setAlternateIndex(dir, game.ID+artStyleExtensions[0], 0)
+}
+
+// Returns the alternates of an artwork, in the order they were found.
+func listAlternates(dir string, game *Game, artStyleExtensions []string) ([]string, error) {
+	prefix := game.ID + artStyleExtensions[0] + " "
+	paths, err := steamFS.Glob(filepath.Join(dir, globCharacters.Replace(prefix)+"*"))
+	if err != nil {
+		return nil, err
+	}
+	paths = filterForImages(paths)
+
+	number := func(path string) int {
+		base := strings.TrimPrefix(filepath.Base(path), prefix)
+		n, _ := strconv.Atoi(strings.TrimSuffix(base, filepath.Ext(base)))
+		return n
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return number(paths[i]) < number(paths[j])
+	})
+	return paths, nil
+}
+
+func loadAlternateIndexes(dir string) map[string]int {
+	indexes := make(map[string]int)
+	indexBytes, err := steamFS.ReadFile(filepath.Join(dir, "index.json"))
+	if err == nil {
+		json.Unmarshal(indexBytes, &indexes)
+	}
+	return indexes
+}
+
+func setAlternateIndex(dir string, key string, index int) error {
+	indexes := loadAlternateIndexes(dir)
+	indexes[key] = index
+	indexBytes, err := json.MarshalIndent(indexes, "", "\t")
+	if err != nil {
+		return err
+	}
+	return steamFS.WriteFile(filepath.Join(dir, "index.json"), indexBytes)
+}
+
+// Switches the artwork to a random alternate other than the one in use, for
+// the shuffle option. Returns false if there is no other alternate.
+func shuffleAlternate(gridDir string, game *Game, artStyleExtensions []string) (bool, error) {
+	dir := filepath.Join(gridDir, alternatesDirName)
+	paths, err := listAlternates(dir, game, artStyleExtensions)
+	if err != nil || len(paths) < 2 {
+		return false, err
+	}
+
+	key := game.ID + artStyleExtensions[0]
+	current := loadAlternateIndexes(dir)[key]
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	index := random.Intn(len(paths) - 1)
+	if index >= current {
+		index++
+	}
+
+	err = loadImage(game, "alternate", paths[index])
+	if err != nil {
+		return false, err
+	}
+	return true, setAlternateIndex(dir, key, index)
+}
+
+// Runs "steamgrid alt [flags] appid...", switching the artwork of the given
+// games to their next (or previous) alternate. Takes the same flags as a
+// normal run, so the overlays and outputs match.
+func runAltCommand(args []string) error {
+	flags := flag.NewFlagSet("alt", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	flags.Bool("next", true, "Switch to the next alternate (default)")
+	prev := flags.Bool("prev", false, "Switch to the previous alternate")
+	list := flags.Bool("list", false, "Only list the alternates")
+
+	// Allow flags after the IDs, like "alt 620 --next".
+	var gameIDs []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			break
+		}
+		gameIDs = append(gameIDs, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(gameIDs) == 0 {
+		return errors.New("Usage: steamgrid alt [-prev] [-list] [-types portrait,...] appid...")
+	}
+
+	if _, _, err := opts.splitTypes(); err != nil {
+		return err
+	}
+	artStyles := getArtStyles(&opts)
+	err := validateNameTemplates(&opts)
+	if err != nil {
+		return err
+	}
+	exports, err := getExports(&opts)
+	if err != nil {
+		return err
+	}
+	err = validateLogoPosition(&opts)
+	if err != nil {
+		return err
+	}
+
+	overlays, err := LoadOverlays(themeOverlaysDir(&opts), artStyles)
+	if err != nil {
+		return err
+	}
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
+	if err != nil {
+		return err
+	}
+	users, err := GetUsers(installationDir)
+	if err != nil {
+		return err
+	}
+	opts.severalUsers = len(users) > 1
+
+	ctx := context.Background()
+	lock, err := acquireLock(ctx, installationDir, opts.LockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	result := newResult()
+	found := false
+	for _, user := range users {
+		gridDir := filepath.Join(user.Dir, "config", "grid")
+		dir := filepath.Join(gridDir, alternatesDirName)
+		// Categories and names, without asking the Steam servers.
+		games := GetLocalGames(user, installationDir)
+
+		for _, gameID := range gameIDs {
+			game, ok := games[gameID]
+			if !ok {
+				game = &Game{ID: gameID, Tags: []string{}}
+			}
+
+			for artStyle, artStyleExtensions := range artStyles {
+				paths, err := listAlternates(dir, game, artStyleExtensions)
+				if err != nil {
+					return err
+				}
+				if len(paths) == 0 {
+					continue
+				}
+				found = true
+
+				key := game.ID + artStyleExtensions[0]
+				index := loadAlternateIndexes(dir)[key]
+				if *list {
+					for i, path := range paths {
+						marker := " "
+						if i == index {
+							marker = "*"
+						}
+						fmt.Printf("%v %v %v: %v\n", marker, user.Name, artStyle, path)
+					}
+					continue
+				}
+
+				if isLocked(gridDir, game, artStyleExtensions) {
+					fmt.Printf("%v %v: %v\n", user.Name, artStyle, errGameLocked.Error())
+					continue
+				}
+				if *prev {
+					index = (index - 1 + len(paths)) % len(paths)
+				} else {
+					index = (index + 1) % len(paths)
+				}
+
+				err = loadImage(game, "alternate", paths[index])
+				if err != nil {
+					return err
+				}
+				err = overlayAndSave(ctx, &opts, gridDir, game, artStyle, artStyleExtensions, overlays, exports, result, nil)
+				if err != nil {
+					return err
+				}
+				err = setAlternateIndex(dir, key, index)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%v %v: switched to alternate %v of %v\n", user.Name, artStyle, index+1, len(paths))
+			}
+		}
+	}
+
+	if !found {
+		return errors.New("No alternates found. Run steamgrid with -alternates first.")
+	}
+	return nil
+}
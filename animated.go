@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"math"
+
+	"github.com/kettek/apng"
+	"golang.org/x/image/draw"
+)
+
+// Choices of the animated option.
+const (
+	animatedPrefer = "prefer"
+	animatedAllow  = "allow"
+	animatedNever  = "never"
+)
+
+func validateAnimated(opts *Options) error {
+	if opts.AnimatedMaxSize < 0 {
+		return errors.New("The size limit of animated images can't be negative")
+	}
+	switch opts.Animated {
+	case animatedPrefer, animatedAllow, animatedNever:
+		return nil
+	}
+	return errors.New("Unknown animated choice " + opts.Animated + ", must be prefer, allow or never")
+}
+
+// Tells if a downloaded candidate is only a fallback with the animated
+// option: animated images, unless they are preferred, and static ones if they
+// are. Fallbacks are used when no other image is found.
+func isFallbackCandidate(candidate *Candidate, opts *Options) bool {
+	if opts.Animated == animatedPrefer {
+		return !candidate.Animated
+	}
+	return candidate.Animated
+}
+
+// Tells if the image is an APNG with more than one frame. Everything that
+// changes pixels must handle these frame by frame, or leave them alone,
+// decoding them as a single image keeps only the first frame.
+func isAnimated(imageBytes []byte) bool {
+	animation, err := apng.DecodeAll(bytes.NewBuffer(imageBytes))
+	return err == nil && len(animation.Frames) > 1
+}
+
+// Turns the frames of an APNG into full frames, the way a player shows them.
+// Frames of APNG files usually only have the part that changed, drawn over
+// what the previous frames left. Whole frames can get an overlay each without
+// it piling up from frame to frame.
+//
+// The frames of the result are the size of the animation, at offset 0 and
+// replace what was there before. The default image, which isn't part of the
+// animation, stays as it is.
+func flattenAPNG(animation *apng.APNG) {
+	if len(animation.Frames) == 0 {
+		return
+	}
+	first := animation.Frames[0]
+	size := first.Image.Bounds().Size()
+	size.X += first.XOffset
+	size.Y += first.YOffset
+	canvas := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	for i := range animation.Frames {
+		frame := &animation.Frames[i]
+		if frame.IsDefault {
+			full := image.NewRGBA(canvas.Bounds())
+			draw.Draw(full, frame.Image.Bounds().Add(image.Pt(frame.XOffset, frame.YOffset)), frame.Image, frame.Image.Bounds().Min, draw.Src)
+			frame.Image = full
+			frame.XOffset, frame.YOffset = 0, 0
+			continue
+		}
+
+		area := frame.Image.Bounds().Sub(frame.Image.Bounds().Min).Add(image.Pt(frame.XOffset, frame.YOffset))
+		var previous *image.RGBA
+		if frame.DisposeOp == apng.DISPOSE_OP_PREVIOUS {
+			previous = image.NewRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+		op := draw.Over
+		if frame.BlendOp == apng.BLEND_OP_SOURCE {
+			op = draw.Src
+		}
+		draw.Draw(canvas, area, frame.Image, frame.Image.Bounds().Min, op)
+
+		full := image.NewRGBA(canvas.Bounds())
+		copy(full.Pix, canvas.Pix)
+		frame.Image = full
+		frame.XOffset, frame.YOffset = 0, 0
+
+		switch frame.DisposeOp {
+		case apng.DISPOSE_OP_BACKGROUND:
+			draw.Draw(canvas, area, image.Transparent, image.ZP, draw.Src)
+		case apng.DISPOSE_OP_PREVIOUS:
+			canvas = previous
+		}
+		frame.DisposeOp = apng.DISPOSE_OP_NONE
+		frame.BlendOp = apng.BLEND_OP_SOURCE
+	}
+}
+
+// Shrinking steps tried on animations bigger than their budget, before
+// giving up on them.
+const maxShrinkSteps = 8
+
+// Animated images above the size budget can't be used.
+var errAnimationTooLarge = errors.New("animated image is too large")
+
+// Makes an APNG fit in the budget, in bytes: drops every other frame, while
+// there are enough of them for the animation to stay smooth, and then scales
+// the frames down. The animation keeps its length.
+func shrinkAnimation(imageBytes []byte, budget int) ([]byte, error) {
+	animation, err := apng.DecodeAll(bytes.NewBuffer(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+	flattenAPNG(&animation)
+	for step := 0; step < maxShrinkSteps && len(imageBytes) > budget; step++ {
+		if countFrames(animation) > 12 {
+			animation.Frames = dropFrames(animation.Frames)
+		} else {
+			size := animation.Frames[0].Image.Bounds().Size()
+			if size.X < 64 || size.Y < 64 {
+				break
+			}
+			for i := range animation.Frames {
+				frame := &animation.Frames[i]
+				scaled := image.NewRGBA(image.Rect(0, 0, size.X*3/4, size.Y*3/4))
+				draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), frame.Image, frame.Image.Bounds(), draw.Src, nil)
+				frame.Image = scaled
+			}
+		}
+		buf := new(bytes.Buffer)
+		if err := apng.Encode(buf, animation); err != nil {
+			return nil, err
+		}
+		imageBytes = buf.Bytes()
+	}
+	if len(imageBytes) > budget {
+		return nil, errAnimationTooLarge
+	}
+	return imageBytes, nil
+}
+
+func countFrames(animation apng.APNG) int {
+	count := 0
+	for _, frame := range animation.Frames {
+		if !frame.IsDefault {
+			count++
+		}
+	}
+	return count
+}
+
+// Drops every other frame of a flattened animation, showing the kept ones for
+// the time of both.
+func dropFrames(frames []apng.Frame) []apng.Frame {
+	var kept []apng.Frame
+	animationFrame := 0
+	for _, frame := range frames {
+		if frame.IsDefault {
+			kept = append(kept, frame)
+			continue
+		}
+		if animationFrame%2 == 0 {
+			kept = append(kept, frame)
+		} else {
+			last := &kept[len(kept)-1]
+			// In milliseconds, so any two delays add up.
+			delay := frameDelay(*last) + frameDelay(frame)
+			last.DelayNumerator, last.DelayDenominator = uint16(math.Min(delay*1000, math.MaxUint16)), 1000
+		}
+		animationFrame++
+	}
+	return kept
+}
+
+// Delay of a frame in seconds.
+func frameDelay(frame apng.Frame) float64 {
+	denominator := float64(frame.DelayDenominator)
+	if denominator == 0 {
+		// As the APNG specification says.
+		denominator = 100
+	}
+	return float64(frame.DelayNumerator) / denominator
+}
+
+// Tells if the image is a GIF, whatever its extension.
+func isGIF(imageBytes []byte) bool {
+	return bytes.HasPrefix(imageBytes, []byte("GIF8"))
+}
+
+// Converts a GIF to PNG, because Steam doesn't play GIFs in the library.
+// Animated ones become APNG with the same frames, timing and loops.
+func gifToPNG(imageBytes []byte) ([]byte, error) {
+	animation, err := gif.DecodeAll(bytes.NewBuffer(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(animation.Image) == 0 {
+		return nil, errors.New("GIF without frames")
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, animation.Config.Width, animation.Config.Height))
+	if canvas.Bounds().Empty() {
+		canvas = image.NewRGBA(animation.Image[0].Bounds())
+	}
+	if len(animation.Image) == 1 {
+		draw.Draw(canvas, animation.Image[0].Bounds(), animation.Image[0], animation.Image[0].Bounds().Min, draw.Over)
+		return encodeImage(canvas, ".png")
+	}
+
+	result := apng.APNG{}
+	switch {
+	case animation.LoopCount < 0:
+		result.LoopCount = 1
+	case animation.LoopCount > 0:
+		// GIFs count the repetitions, APNGs the plays.
+		result.LoopCount = uint(animation.LoopCount) + 1
+	}
+	for i, frame := range animation.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		full := image.NewRGBA(canvas.Bounds())
+		copy(full.Pix, canvas.Pix)
+		delay := 10
+		if i < len(animation.Delay) && animation.Delay[i] > 0 {
+			delay = animation.Delay[i]
+		}
+		result.Frames = append(result.Frames, apng.Frame{
+			Image:            full,
+			DelayNumerator:   uint16(delay),
+			DelayDenominator: 100,
+			BlendOp:          apng.BLEND_OP_SOURCE,
+		})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	buf := new(bytes.Buffer)
+	err = apng.Encode(buf, result)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The apply command processes only the given games, for other tools like a
+// script that detects new purchases:
+//
+//	steamgrid apply 620 400
+//	steamgrid apply --from-file ids.txt
+//	new-purchases | steamgrid apply
+//	steamgrid apply --exe "C:\Games\Foo\foo.exe"
+//
+// The list has one app ID per line, or several separated by spaces or
+// commas, and # starts a comment. With --exe, the non-Steam games that start
+// the file, or have it in their launch options like emulators with a ROM, are
+// processed. All the options of a full run work.
+func runApplyCommand(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	fromFile := flags.String("from-file", "", "File with the app IDs to process, or - for stdin")
+	exe := flags.String("exe", "", "Process the non-Steam games started with this file")
+	pause := flags.Bool("pause", false, "Wait for enter before closing, for the context menu entry of integrate-shell")
+
+	// Allow flags after the IDs, like "apply 620 --skiphero".
+	var gameIDs []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			break
+		}
+		gameIDs = append(gameIDs, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	// Read stdin when it's piped and no list was given.
+	if *fromFile == "" && len(gameIDs) == 0 && *exe == "" {
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+			*fromFile = "-"
+		}
+	}
+	if *fromFile != "" {
+		input := io.Reader(os.Stdin)
+		if *fromFile != "-" {
+			file, err := os.Open(*fromFile)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			input = file
+		}
+		ids, err := readGameIDs(input)
+		if err != nil {
+			return err
+		}
+		gameIDs = append(gameIDs, ids...)
+	}
+	if len(gameIDs) == 0 && *exe == "" {
+		return errors.New("Usage: steamgrid apply [options] [--from-file ids.txt] [--exe file] appid...")
+	}
+
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	opts.GameIDs = gameIDs
+	if *exe != "" {
+		opts.ShortcutTarget, err = filepath.Abs(*exe)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := Run(interruptContext(), opts)
+	if result != nil {
+		printReport(result)
+	}
+	if *pause {
+		if err != nil {
+			errorAndExit(err)
+		}
+		if interactive() {
+			fmt.Println("Open Steam to see the results!\n\nPress enter to close.")
+			bufio.NewReader(os.Stdin).ReadBytes('\n')
+		}
+	}
+	return err
+}
+
+// Reads a list of app IDs.
+func readGameIDs(input io.Reader) ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment != -1 {
+			line = line[:comment]
+		}
+		for _, id := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if !isValidGameID(id) {
+				return nil, errors.New("Invalid app ID in the list: " + id)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// Removes the games that aren't shortcuts starting the file, or with the file
+// in their launch options.
+func filterShortcuts(games map[string]*Game, target string) {
+	for id, game := range games {
+		if game.Shortcut == nil || !startsFile(*game.Shortcut, target) {
+			delete(games, id)
+		}
+	}
+}
+
+func startsFile(shortcut shortcutRecord, target string) bool {
+	samePath := func(a string, b string) bool {
+		a, b = filepath.Clean(strings.Trim(a, `"`)), filepath.Clean(b)
+		// The file systems of Windows and macOS ignore the case.
+		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+			return strings.EqualFold(a, b)
+		}
+		return a == b
+	}
+	if samePath(shortcut.Exe, target) {
+		return true
+	}
+	for _, arg := range splitLaunchOptions(shortcut.LaunchOptions) {
+		if samePath(arg, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits launch options into arguments, keeping quoted paths with spaces
+// together.
+func splitLaunchOptions(launchOptions string) []string {
+	var args []string
+	var arg strings.Builder
+	quoted := false
+	for _, c := range launchOptions {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case (c == ' ' || c == '\t') && !quoted:
+			if arg.Len() > 0 {
+				args = append(args, arg.String())
+				arg.Reset()
+			}
+		default:
+			arg.WriteRune(c)
+		}
+	}
+	if arg.Len() > 0 {
+		args = append(args, arg.String())
+	}
+	return args
+}
+
+// Removes the games that aren't in the list. IDs of games the user doesn't
+// have are ignored.
+func filterGames(games map[string]*Game, gameIDs []string) {
+	wanted := make(map[string]bool, len(gameIDs))
+	for _, id := range gameIDs {
+		wanted[id] = true
+	}
+	for id := range games {
+		if !wanted[id] {
+			delete(games, id)
+		}
+	}
+}
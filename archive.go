@@ -0,0 +1,59 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Largest file extracted from an archive. Overlays are small, anything bigger
+// is a mistake or a zip bomb.
+const maxArchiveFileSize = 50 * 1024 * 1024
+
+// Largest total of the files extracted from an archive.
+const maxArchiveSize = 200 * 1024 * 1024
+
+// Checks the name of an archive entry. Names must be relative and stay inside
+// the directory they are extracted to: no absolute paths, drive letters or ".."
+// ("zip slip").
+func checkArchivePath(name string) error {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return errors.New("invalid name")
+	}
+	// Zip files from Windows may use backslashes.
+	slashed := strings.Replace(name, `\`, "/", -1)
+	if strings.HasPrefix(slashed, "/") || (len(slashed) >= 2 && slashed[1] == ':') {
+		return errors.New("absolute path")
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return errors.New("leaves the directory")
+		}
+	}
+	return nil
+}
+
+// Checks all entries of an archive before anything is extracted, so a bad
+// archive leaves nothing behind. Links, oversized files and archives are
+// always refused. Unsafe names are refused too, unless the archive is trusted.
+func checkArchive(archive *zip.Reader, trust bool) error {
+	var total uint64
+	for _, file := range archive.File {
+		total += file.UncompressedSize64
+		if total > maxArchiveSize {
+			return fmt.Errorf("Refusing the archive: its files are bigger than %v MB", maxArchiveSize/1024/1024)
+		}
+		if file.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Refusing the archive: %q is a link", file.Name)
+		}
+		if file.UncompressedSize64 > maxArchiveFileSize {
+			return fmt.Errorf("Refusing the archive: %q is too big, %v MB", file.Name, file.UncompressedSize64/1024/1024)
+		}
+		if err := checkArchivePath(file.Name); err != nil && !trust {
+			return fmt.Errorf("Refusing the archive: unsafe path %q, %v. Pass -trust-archive if you trust its source", file.Name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"path/filepath"
+	"sort"
+)
+
+// The audit command reports what a run would fix, without writing anything:
+// no images, backups, manifest, journal or lock. It only needs read access to
+// the Steam directory, so it can run under an account that can't change
+// Steam's files, like on a shared or managed computer.
+//
+//	steamgrid audit
+//	steamgrid audit -json > audit.json
+//
+// Games and categories are read from the local files only.
+func runAuditCommand(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	asJSON := flags.Bool("json", false, "Print the discrepancies as JSON")
+	flags.Parse(args)
+	if flags.NArg() == 1 {
+		opts.SteamDir = flags.Arg(0)
+	} else if flags.NArg() > 1 {
+		return errors.New("Usage: steamgrid audit [options] [steamdir]")
+	}
+
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	discrepancies, err := audit(opts)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		output, err := json.MarshalIndent(discrepancies, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+	counts := map[string]int{}
+	for _, discrepancy := range discrepancies {
+		counts[discrepancy.Kind]++
+		name := discrepancy.Name
+		if name == "" {
+			name = "unknown game"
+		}
+		switch discrepancy.Kind {
+		case auditStaleBackup:
+			fmt.Printf("%v: stale backup %v\n", discrepancy.User, discrepancy.Path)
+		default:
+			fmt.Printf("%v: %v %v of %v (id %v)\n", discrepancy.User, discrepancy.Kind, discrepancy.ArtStyle, name, discrepancy.ID)
+		}
+	}
+	fmt.Printf("\n%v missing, %v without overlays and %v stale backups.\n", counts[auditMissing], counts[auditNotOverlaid], counts[auditStaleBackup])
+	return nil
+}
+
+// Kinds of discrepancies.
+const (
+	auditMissing     = "missing"
+	auditNotOverlaid = "not overlaid"
+	auditStaleBackup = "stale backup"
+)
+
+type auditDiscrepancy struct {
+	User     string `json:"user"`
+	Kind     string `json:"kind"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	ArtStyle string `json:"artStyle,omitempty"`
+	// Image or backup the discrepancy is about.
+	Path string `json:"path,omitempty"`
+}
+
+// Compares the grids of all users with what a run would make of them:
+//
+//   - missing: the game has no image for an art style
+//   - not overlaid: the game has categories with overlays, but the image in
+//     the grid is not one steamgrid made, or was made without them
+//   - stale backup: a backup in grid/originals that no longer belongs to the
+//     image in the grid, or to a game of the user
+func audit(opts Options) ([]auditDiscrepancy, error) {
+	artStyles, _, err := prepareOptions(&opts)
+	if err != nil {
+		return nil, err
+	}
+	overlays, err := loadOverlays(&opts, artStyles)
+	if err != nil {
+		return nil, err
+	}
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
+	if err != nil {
+		return nil, err
+	}
+	users, err := GetUsersReadOnly(installationDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, errors.New("No users found at Steam/userdata. Have you used Steam before in this computer?")
+	}
+	installed, _ := installedApps(installationDir)
+
+	var discrepancies []auditDiscrepancy
+	for _, user := range users {
+		gridDir := filepath.Join(user.Dir, "config", "grid")
+		userOpts, userArtStyles, userOverlays := &opts, artStyles, overlays
+		if opts.Config != nil && opts.Config.HasUser(user) {
+			options, err := opts.Config.Options(&user)
+			if err != nil {
+				return nil, err
+			}
+			userArtStyles, _, err = prepareOptions(&options)
+			if err != nil {
+				return nil, err
+			}
+			userOverlays, err = loadOverlays(&options, userArtStyles)
+			if err != nil {
+				return nil, err
+			}
+			userOpts = &options
+		}
+
+		games := GetLibraryGames(user, installationDir, installed)
+		if userOpts.NonSteamOnly {
+			for id, game := range games {
+				if !game.Custom {
+					delete(games, id)
+				}
+			}
+		}
+		if len(userOpts.GameIDs) > 0 {
+			filterGames(games, userOpts.GameIDs)
+		}
+		sorted, _ := sortGames(games, "appid")
+
+		add := func(kind string, game *Game, artStyle string, path string) {
+			discrepancy := auditDiscrepancy{User: user.Name, Kind: kind, ArtStyle: artStyle, Path: path}
+			if game != nil {
+				discrepancy.ID = game.ID
+				discrepancy.Name = game.Name
+			}
+			discrepancies = append(discrepancies, discrepancy)
+		}
+
+		claimed := map[string]bool{}
+		for _, game := range sorted {
+			if !isValidGameID(game.ID) {
+				continue
+			}
+			artStyleNames := make([]string, 0, len(userArtStyles))
+			for artStyle := range userArtStyles {
+				artStyleNames = append(artStyleNames, artStyle)
+			}
+			sort.Strings(artStyleNames)
+			for _, artStyle := range artStyleNames {
+				artStyleExtensions := userArtStyles[artStyle]
+				backups, _ := findBackups(gridDir, game, artStyleExtensions, userOpts.BackupName)
+				for _, backup := range backups {
+					claimed[backup] = true
+				}
+
+				images, _ := steamFS.Glob(filepath.Join(gridDir, game.ID+artStyleExtensions[0]+".*"))
+				images = filterForImages(images)
+				if len(images) == 0 {
+					add(auditMissing, game, artStyle, "")
+					for _, backup := range backups {
+						add(auditStaleBackup, game, artStyle, backup)
+					}
+					continue
+				}
+				imageBytes, err := steamFS.ReadFile(images[0])
+				if err != nil {
+					return nil, err
+				}
+
+				// The backup of the image in the grid, if steamgrid made it.
+				game.ImageExt = filepath.Ext(images[0])
+				game.OverlayImageBytes = imageBytes
+				backupPath := getBackupPath(gridDir, game, artStyleExtensions, userOpts.BackupName)
+				game.OverlayImageBytes = nil
+				game.ImageExt = ""
+				backupBytes, err := steamFS.ReadFile(backupPath)
+				made := err == nil
+
+				if hasMatchingOverlay(game, userOverlays, artStyleExtensions) && (!made || bytes.Equal(backupBytes, imageBytes)) {
+					add(auditNotOverlaid, game, artStyle, images[0])
+				}
+				for _, backup := range backups {
+					if !made || backup != backupPath {
+						add(auditStaleBackup, game, artStyle, backup)
+					}
+				}
+			}
+		}
+
+		// Backups of games that are gone, and the ones of old versions
+		// without a hash.
+		others, _ := steamFS.Glob(filepath.Join(gridDir, "originals", "*"))
+		legacy, _ := steamFS.Glob(filepath.Join(gridDir, "* (original)*"))
+		for _, path := range append(filterForImages(others), legacy...) {
+			if !claimed[path] {
+				add(auditStaleBackup, nil, "", path)
+			}
+		}
+	}
+	return discrepancies, nil
+}
+
+// Tells if a run would put an overlay on the artwork of the game.
+func hasMatchingOverlay(game *Game, overlays map[string]image.Image, artStyleExtensions []string) bool {
+	for _, tag := range game.Tags {
+		if _, ok := overlays[overlayName(tag)+artStyleExtensions[1]]; ok {
+			return true
+		}
+	}
+	return false
+}
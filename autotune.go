@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// With the autotune option, the number of workers adapts to the machine and
+// the connection, instead of fixed numbers that are too many for a Raspberry
+// Pi and too few for a desktop:
+//
+//   - Downloads of the candidates of a source start one at a time. While they
+//     stay fast and don't fail, another one may run at the same time, up to
+//     the download workers. A failure halves them, downloads taking twice as
+//     long as the fastest seen take one away.
+//   - Compositing starts on one worker. Whenever the downloads have to wait
+//     for it, another is started, up to the CPU workers, unless the images
+//     already take half as long again as with one worker, like when memory
+//     runs out.
+//
+// Without it, the download and CPU workers are used as they are.
+
+// Most downloads at the same time with autotune, if the download workers
+// aren't given.
+const maxAutotuneDownloads = 8
+
+// Weight of a new latency in the running average.
+const latencyWeight = 0.2
+
+func validateWorkers(opts *Options) error {
+	if opts.CPUWorkers < 0 || opts.DownloadWorkers < 0 {
+		return errors.New("The number of workers can't be negative")
+	}
+	return nil
+}
+
+// Limits the downloads running at the same time. Safe for concurrent use.
+type workerTuner struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	adaptive bool
+	active   int
+	limit    int
+	max      int
+	// Running average and fastest average of the latencies.
+	average  time.Duration
+	baseline time.Duration
+	// Good downloads since the limit last changed.
+	streak int
+}
+
+// Downloads of the candidates of a source. Set from the options at the start
+// of a run, one at a time until then.
+var downloadWorkers = newWorkerTuner(1, 1, false)
+
+func newWorkerTuner(start int, max int, adaptive bool) *workerTuner {
+	if max < 1 {
+		max = 1
+	}
+	if start < 1 || start > max {
+		start = max
+	}
+	t := &workerTuner{adaptive: adaptive, limit: start, max: max}
+	t.cond = sync.NewCond(&t.mutex)
+	return t
+}
+
+// Sets the download workers from the options.
+func tuneDownloads(opts *Options) {
+	max := opts.DownloadWorkers
+	if max == 0 {
+		max = 1
+		if opts.Autotune {
+			max = maxAutotuneDownloads
+		}
+	}
+	if opts.Autotune {
+		downloadWorkers = newWorkerTuner(1, max, true)
+	} else {
+		downloadWorkers = newWorkerTuner(max, max, false)
+	}
+}
+
+// Waits for a free download slot.
+func (t *workerTuner) acquire() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+}
+
+func (t *workerTuner) release() {
+	t.mutex.Lock()
+	t.active--
+	t.mutex.Unlock()
+	t.cond.Broadcast()
+}
+
+// Adjusts the limit by how long a download took and if it failed.
+func (t *workerTuner) observe(latency time.Duration, failed bool) {
+	if !t.adaptive {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	defer t.cond.Broadcast()
+
+	if failed {
+		t.limit = maxInt(1, t.limit/2)
+		t.streak = 0
+		return
+	}
+	if t.average == 0 {
+		t.average = latency
+	} else {
+		t.average = time.Duration(float64(t.average)*(1-latencyWeight) + float64(latency)*latencyWeight)
+	}
+	if t.baseline == 0 || t.average < t.baseline {
+		t.baseline = t.average
+	}
+	if t.average > 2*t.baseline {
+		t.limit = maxInt(1, t.limit-1)
+		t.streak = 0
+		return
+	}
+	t.streak++
+	if t.streak >= 2*t.limit && t.limit < t.max {
+		t.limit++
+		t.streak = 0
+	}
+}
+
+func (t *workerTuner) workers() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.limit
+}
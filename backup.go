@@ -4,46 +4,72 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"time"
 	"unicode"
 )
 
 // BackupGame if a game has a custom image, backs it up by appending "(original)" to the
-// file name.
-func BackupGame(gridDir string, game *Game, artStyleExtensions []string) error {
+// file name. Returns the path of the backup, empty if there is none.
+func BackupGame(gridDir string, game *Game, artStyleExtensions []string, backupName string) (string, error) {
 	if game.CleanImageBytes != nil {
-		return ioutil.WriteFile(getBackupPath(gridDir, game, artStyleExtensions), game.CleanImageBytes, 0666)
+		backupPath := getBackupPath(gridDir, game, artStyleExtensions, backupName)
+		err := steamFS.MkdirAll(filepath.Dir(backupPath))
+		if err != nil {
+			return "", err
+		}
+		return backupPath, steamFS.WriteFile(backupPath, game.CleanImageBytes)
 	}
-	return nil
+	return "", nil
 }
 
-func getBackupPath(gridDir string, game *Game, artStyleExtensions []string) string {
-	hash := sha256.Sum256(game.OverlayImageBytes)
+func imageHash(imageBytes []byte) string {
+	hash := sha256.Sum256(imageBytes)
 	// [:] is required to convert a fixed length byte array to a byte slice.
-	hexHash := hex.EncodeToString(hash[:])
-	return filepath.Join(gridDir, "originals", game.ID + artStyleExtensions[0] + " " + hexHash+game.ImageExt)
+	return hex.EncodeToString(hash[:])
+}
+
+func getBackupPath(gridDir string, game *Game, artStyleExtensions []string, backupName string) string {
+	hexHash := imageHash(game.OverlayImageBytes)
+	return filepath.Join(gridDir, "originals", expandNameTemplate(backupName, game, artStyleExtensions, hexHash) + game.ImageExt)
 }
 
-func RemoveExisting(gridDir string, gameId string, artStyleExtensions []string) error {
-	images, err := filepath.Glob(filepath.Join(gridDir, gameId + artStyleExtensions[0] + ".*"))
+// RemoveExisting removes the grid images of an artwork, with any extension,
+// and its backups, except the paths to keep. Saving calls it after the new
+// files are written, so a stopped run never loses the old ones.
+func RemoveExisting(gridDir string, game *Game, artStyleExtensions []string, backupName string, keep ...string) error {
+	images, err := steamFS.Glob(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + ".*"))
 	if err != nil {
 		return err
 	}
+	// Banners of shortcuts also have a Big Picture copy, which may have been
+	// left with another extension.
+	if tenfoot := tenfootID(game.ID); tenfoot != "" && artStyleExtensions[0] == "" {
+		tenfootImages, err := steamFS.Glob(filepath.Join(gridDir, tenfoot + ".*"))
+		if err != nil {
+			return err
+		}
+		images = append(images, tenfootImages...)
+	}
 	images = filterForImages(images)
 
-	backups, err := filepath.Glob(filepath.Join(gridDir, "originals", gameId + artStyleExtensions[0] + " *.*"))
+	backups, err := findBackups(gridDir, game, artStyleExtensions, backupName)
 	if err != nil {
 		return err
 	}
-	backups = filterForImages(backups)
 
+	kept := map[string]bool{}
+	for _, path := range keep {
+		kept[path] = true
+	}
 	all := append(images, backups...)
 	for _, path := range all {
-		err = os.Remove(path)
+		if kept[path] {
+			continue
+		}
+		err = steamFS.Remove(path)
 		if err != nil {
 			return err
 		}
@@ -52,8 +78,56 @@ func RemoveExisting(gridDir string, gameId string, artStyleExtensions []string)
 	return nil
 }
 
+// Recovers an artwork whose saving was interrupted. Images are written through
+// a temporary file, so the grid image is either the old or the new one, and
+// it is kept if a backup matches it; the other backups go on the next save.
+// Otherwise the grid image is removed and the newest backup becomes the grid
+// image, so LoadExisting picks it up again.
+func recoverInterrupted(gridDir string, game *Game, artStyleExtensions []string, backupName string) {
+	images, err := steamFS.Glob(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + ".*"))
+	if err != nil {
+		return
+	}
+	images = filterForImages(images)
+	for _, path := range images {
+		imageBytes, err := steamFS.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		matching := filepath.Join(gridDir, "originals", expandNameTemplate(backupName, game, artStyleExtensions, imageHash(imageBytes)) + filepath.Ext(path))
+		if _, err := steamFS.Stat(matching); err == nil {
+			return
+		}
+	}
+	for _, path := range images {
+		steamFS.Remove(path)
+	}
+
+	backups, err := findBackups(gridDir, game, artStyleExtensions, backupName)
+	if err != nil {
+		return
+	}
+	newest, newestTime := "", time.Time{}
+	for _, path := range backups {
+		if info, err := steamFS.Stat(path); err == nil && (newest == "" || info.ModTime().After(newestTime)) {
+			newest, newestTime = path, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return
+	}
+	backupBytes, err := steamFS.ReadFile(newest)
+	if err != nil {
+		return
+	}
+	// Written as is, it's a manual customization from now on and gets the
+	// overlays again.
+	steamFS.WriteFile(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + filepath.Ext(newest)), backupBytes)
+	steamFS.Remove(newest)
+}
+
 func loadImage(game *Game, sourceName string, imagePath string) error {
-	imageBytes, err := ioutil.ReadFile(imagePath)
+	imageBytes, err := steamFS.ReadFile(imagePath)
 	if err == nil {
 		game.ImageExt = filepath.Ext(imagePath)
 		game.CleanImageBytes = imageBytes
@@ -95,7 +169,7 @@ func filterForImages(paths []string) []string {
 	return matchedPaths
 }
 
-func LoadExisting(overridePath string, gridDir string, game *Game, artStyleExtensions []string) {
+func LoadExisting(overridePath string, gridDir string, game *Game, artStyleExtensions []string, backupName string) {
 	overridenIDs, _ := filepath.Glob(filepath.Join(overridePath, game.ID + artStyleExtensions[0] + ".*"))
 	if overridenIDs != nil && len(overridenIDs) > 0 {
 		loadImage(game, "local file in directory 'games'", overridenIDs[0])
@@ -114,16 +188,16 @@ func LoadExisting(overridePath string, gridDir string, game *Game, artStyleExten
 	}
 
 	// If there are any old-style backups (without hash), load them over the existing (with overlay) images.
-	oldBackups, err := filepath.Glob(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + " (original)*"))
+	oldBackups, err := steamFS.Glob(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + " (original)*"))
 	if err == nil && len(oldBackups) > 0 {
 		err = loadImage(game, "legacy backup (now converted)", oldBackups[0])
 		if err == nil {
-			os.Remove(oldBackups[0])
+			steamFS.Remove(oldBackups[0])
 			return
 		}
 	}
 
-	files, err := filepath.Glob(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + ".*"))
+	files, err := steamFS.Glob(filepath.Join(gridDir, game.ID + artStyleExtensions[0] + ".*"))
 	files = filterForImages(files)
 	if err == nil && len(files) > 0 {
 		err = loadImage(game, "manual customization", files[0])
@@ -132,7 +206,7 @@ func LoadExisting(overridePath string, gridDir string, game *Game, artStyleExten
 			game.OverlayImageBytes = game.CleanImageBytes
 
 			// See if there exists a backup image with no overlays or modifications.
-			loadImage(game, "backup", getBackupPath(gridDir, game, artStyleExtensions))
+			loadImage(game, "backup", getBackupPath(gridDir, game, artStyleExtensions, backupName))
 
 			// remove overlay
 			game.OverlayImageBytes = nil
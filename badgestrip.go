@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// Overlays are images of the size of the artwork, and several of them are
+// drawn on top of each other. That's fine for frames, but badges in the same
+// corner, like favorite, completed and a platform, hide each other. With the
+// badge strip option the badges are lined up next to each other instead,
+// starting where the first one is and going away from its corner.
+const (
+	badgeStripOff        = ""
+	badgeStripHorizontal = "horizontal"
+	badgeStripVertical   = "vertical"
+)
+
+// Set from the options at the start of a run.
+var badgeStrip struct {
+	direction string
+	// Pixels between badges, at the size of the overlays.
+	spacing int
+}
+
+func validateBadgeStrip(opts *Options) error {
+	switch strings.ToLower(opts.BadgeStrip) {
+	case badgeStripOff, badgeStripHorizontal, badgeStripVertical:
+	default:
+		return errors.New("Unknown badge strip " + opts.BadgeStrip + ", must be horizontal or vertical")
+	}
+	if opts.BadgeSpacing < 0 {
+		return errors.New("The badge spacing can't be negative")
+	}
+	return nil
+}
+
+// Strips by combination of overlays, so each one is laid out only once.
+var badgeStrips sync.Map
+
+// Returns the overlays to draw with the badges among them lined up in a
+// single image. Overlays that cover more than half the image are frames and
+// are kept as they are, below the strip.
+func badgeStripOverlays(overlays []image.Image) []image.Image {
+	if badgeStrip.direction == badgeStripOff || len(overlays) < 2 {
+		return overlays
+	}
+	key := badgeStrip.direction
+	for _, overlay := range overlays {
+		key += fmt.Sprintf(" %p", overlay)
+	}
+	if cached, ok := badgeStrips.Load(key); ok {
+		return cached.([]image.Image)
+	}
+
+	size := overlays[0].Bounds().Size()
+	type badge struct {
+		image  *image.RGBA
+		bounds image.Rectangle
+	}
+	var layers []image.Image
+	var badges []badge
+	for _, overlay := range overlays {
+		scaled := prepareOverlay(overlay, size)
+		bounds := opaqueBounds(scaled)
+		if bounds.Empty() {
+			continue
+		}
+		if bounds.Dx() > size.X/2 || bounds.Dy() > size.Y/2 {
+			layers = append(layers, overlay)
+			continue
+		}
+		badges = append(badges, badge{scaled, bounds})
+	}
+	if len(badges) < 2 {
+		return overlays
+	}
+
+	first := badges[0].bounds
+	center := first.Min.Add(first.Max).Div(2)
+	right := center.X > size.X/2
+	bottom := center.Y > size.Y/2
+	strip := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	x, y := first.Min.X, first.Min.Y
+	if right {
+		x = first.Max.X
+	}
+	if bottom {
+		y = first.Max.Y
+	}
+	for _, badge := range badges {
+		width, height := badge.bounds.Dx(), badge.bounds.Dy()
+		target := image.Rect(x, y, x+width, y+height)
+		if right {
+			target = target.Sub(image.Pt(width, 0))
+		}
+		if bottom {
+			target = target.Sub(image.Pt(0, height))
+		}
+		draw.Draw(strip, target, badge.image, badge.bounds.Min, draw.Over)
+
+		step := badgeStrip.spacing
+		if badgeStrip.direction == badgeStripHorizontal {
+			step += width
+			if right {
+				step = -step
+			}
+			x += step
+		} else {
+			step += height
+			if bottom {
+				step = -step
+			}
+			y += step
+		}
+	}
+
+	result := append(layers, strip)
+	badgeStrips.Store(key, result)
+	return result
+}
+
+// Bounds of the pixels that aren't fully transparent.
+func opaqueBounds(overlay *image.RGBA) image.Rectangle {
+	rect := overlay.Bounds()
+	minX, minY, maxX, maxY := rect.Max.X, rect.Max.Y, rect.Min.X, rect.Min.Y
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if overlay.Pix[overlay.PixOffset(x, y)+3] == 0 {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if x >= maxX {
+				maxX = x + 1
+			}
+			if y < minY {
+				minY = y
+			}
+			maxY = y + 1
+		}
+	}
+	if maxX <= minX {
+		return image.Rectangle{}
+	}
+	return image.Rect(minX, minY, maxX, maxY)
+}
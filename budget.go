@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A budget bounds a run, for metered connections: a time like "10m", or an
+// amount of downloaded data like "500MB". The run processes the most recently
+// played games first, for as long as the budget lasts, and leaves the rest in
+// the journal for the next run to resume. A game that was started is always
+// finished, so a run can go a little over.
+type runBudget struct {
+	duration time.Duration
+	bytes    int64
+	start    time.Time
+}
+
+var budgetUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KB", 1024},
+	{"MB", 1024 * 1024},
+	{"GB", 1024 * 1024 * 1024},
+	{"B", 1},
+}
+
+// Parses a budget option, nil for none.
+func parseBudget(value string) (*runBudget, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	invalid := errors.New("Invalid budget " + value + ", must be a time like 10m or a size like 500MB")
+	if duration, err := time.ParseDuration(value); err == nil {
+		if duration <= 0 {
+			return nil, invalid
+		}
+		return &runBudget{duration: duration, start: time.Now()}, nil
+	}
+	for _, unit := range budgetUnits {
+		if !strings.HasSuffix(strings.ToUpper(value), unit.suffix) {
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(value[:len(value)-len(unit.suffix)]), 64)
+		if err != nil || amount <= 0 {
+			return nil, invalid
+		}
+		return &runBudget{bytes: int64(amount * float64(unit.bytes)), start: time.Now()}, nil
+	}
+	return nil, invalid
+}
+
+func validateBudget(opts *Options) error {
+	_, err := parseBudget(opts.Budget)
+	return err
+}
+
+// Whether the budget is used up by the run so far. Nil budgets never are.
+func (budget *runBudget) usedUp(metrics *Metrics) bool {
+	if budget == nil {
+		return false
+	}
+	if budget.duration > 0 {
+		return time.Since(budget.start) >= budget.duration
+	}
+	return metrics.downloaded() >= budget.bytes
+}
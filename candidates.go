@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of images taken from a single source, like the top results
+// of SteamGridDB.
+const maxCandidatesPerSource = 5
+
+// Candidate is an image found for an artwork of a game.
+type Candidate struct {
+	// Where to download it, mirrors in order. Or a local file in Path, or
+	// already in ImageBytes for generated images.
+	URLs []string
+	Path string
+	// Description of the source for the report.
+	From string
+	// How much the source can be trusted to have the right image, from 0
+	// (search) to 1 (official artwork). Includes community votes.
+	Trust float64
+	// Nobody reviews the images of the source, for the skin check of safe mode.
+	Unmoderated bool
+
+	// Filled after downloading.
+	ImageExt   string
+	ImageBytes []byte
+	Size       image.Point
+	Score      float64
+	Animated   bool
+}
+
+// A source of candidates. Sources are only queried when needed.
+type candidateSource struct {
+	name string
+	find func() ([]*Candidate, error)
+}
+
+// Returned by sources that aren't asked with the options, with the reason.
+type sourceSkippedError string
+
+func (err sourceSkippedError) Error() string {
+	return string(err)
+}
+
+func skippedSource(name string, reason string) candidateSource {
+	return candidateSource{name, func() ([]*Candidate, error) {
+		return nil, sourceSkippedError(reason)
+	}}
+}
+
+// The candidate was downloaded but doesn't fit the art style.
+var errCandidateRejected = errors.New("image doesn't fit the artwork type")
+
+// The candidate is animated and the options don't allow it.
+var errCandidateAnimated = errors.New("image is animated")
+
+func urlCandidate(url string, from string, trust float64) []*Candidate {
+	if url == "" {
+		return nil
+	}
+	return []*Candidate{&Candidate{URLs: []string{url}, From: from, Trust: trust}}
+}
+
+// Marks candidates of sources nobody reviews.
+func unmoderated(candidates []*Candidate) []*Candidate {
+	for _, candidate := range candidates {
+		candidate.Unmoderated = true
+	}
+	return candidates
+}
+
+// Returns the first candidates that can be downloaded and fit the art style,
+// querying the sources in order until enough are found.
+func findFirstCandidates(ctx context.Context, sources []candidateSource, artStyle string, artStyleExtensions []string, opts *Options, count int, chain *sourceChain) ([]*Candidate, error) {
+	var found, fallbacks []*Candidate
+	withFallbacks := func() []*Candidate {
+		for _, fallback := range fallbacks {
+			if len(found) >= count {
+				break
+			}
+			found = append(found, fallback)
+		}
+		return found
+	}
+	for i, source := range sources {
+		candidates, err := source.find()
+		if reason, ok := err.(sourceSkippedError); ok {
+			chain.add(source.name, sourceSkipped, string(reason))
+			continue
+		}
+		before := len(found) + len(fallbacks)
+		if err != nil {
+			opts.metrics.addSource(source.name, false)
+			chain.add(source.name, sourceFailed, err.Error())
+			chain.skipRest(sources, i, "stopped at the failed source")
+			if len(found)+len(fallbacks) > 0 {
+				// Already have the image, don't lose it because of an alternate.
+				return withFallbacks(), nil
+			}
+			return nil, err
+		}
+		if len(candidates) == 0 {
+			chain.add(source.name, sourceNothing, "")
+		}
+		for _, candidate := range candidates {
+			err = downloadCandidate(ctx, candidate, artStyle, artStyleExtensions, opts)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				if opts.Verbose {
+					fmt.Printf("  %v: %v\n", candidate.From, err.Error())
+				}
+				chain.add(candidate.From, sourceRejected, err.Error())
+				continue
+			}
+			if isFallbackCandidate(candidate, opts) {
+				// Kept in case nothing better comes up.
+				fallbacks = append(fallbacks, candidate)
+				chain.add(candidate.From, sourceFallback, "animated option")
+				continue
+			}
+			found = append(found, candidate)
+			chain.add(candidate.From, sourceFound, "")
+			if len(found) >= count {
+				opts.metrics.addSource(source.name, true)
+				chain.skipRest(sources, i, "already found")
+				return found, nil
+			}
+		}
+		opts.metrics.addSource(source.name, len(found)+len(fallbacks) > before)
+	}
+	return withFallbacks(), nil
+}
+
+// Downloads the candidates of all sources and returns them sorted by score,
+// best first. Errors of single sources don't stop the search, but the first
+// one is returned along with the result.
+func findBestCandidates(ctx context.Context, sources []candidateSource, artStyle string, artStyleExtensions []string, opts *Options, chain *sourceChain) ([]*Candidate, error) {
+	var firstErr error
+	var downloaded []*Candidate
+	for _, source := range sources {
+		candidates, err := source.find()
+		if reason, ok := err.(sourceSkippedError); ok {
+			chain.add(source.name, sourceSkipped, string(reason))
+			continue
+		}
+		before := len(downloaded)
+		if err != nil {
+			opts.metrics.addSource(source.name, false)
+			chain.add(source.name, sourceFailed, err.Error())
+			fmt.Println(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(candidates) == 0 {
+			chain.add(source.name, sourceNothing, "")
+		}
+		errs := downloadCandidates(ctx, candidates, artStyle, artStyleExtensions, opts)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		for i, candidate := range candidates {
+			if err := errs[i]; err != nil {
+				if opts.Verbose {
+					fmt.Printf("  %v: %v\n", candidate.From, err.Error())
+				}
+				chain.add(candidate.From, sourceRejected, err.Error())
+				continue
+			}
+			candidate.Score = scoreCandidate(candidate, artStyleExtensions)
+			chain.add(candidate.From, sourceFound, fmt.Sprintf("%.1f points", candidate.Score))
+			downloaded = append(downloaded, candidate)
+		}
+		opts.metrics.addSource(source.name, len(downloaded) > before)
+	}
+
+	if len(downloaded) == 0 {
+		return nil, firstErr
+	}
+	// Stable, so sources earlier in the list win ties. Fallbacks of the
+	// animated option only win if there is nothing else.
+	sort.SliceStable(downloaded, func(i, j int) bool {
+		fallbackI, fallbackJ := isFallbackCandidate(downloaded[i], opts), isFallbackCandidate(downloaded[j], opts)
+		if fallbackI != fallbackJ {
+			return fallbackJ
+		}
+		return downloaded[i].Score > downloaded[j].Score
+	})
+	if opts.Verbose {
+		for _, candidate := range downloaded {
+			fmt.Printf("  %.1f points: %v, %vx%v, %v KB, trust %.2f\n", candidate.Score, candidate.From, candidate.Size.X, candidate.Size.Y, len(candidate.ImageBytes)/1024, candidate.Trust)
+		}
+	}
+	return downloaded, firstErr
+}
+
+// Downloads the candidates at the same time, as many as the download workers
+// allow, and returns the error of each.
+func downloadCandidates(ctx context.Context, candidates []*Candidate, artStyle string, artStyleExtensions []string, opts *Options) []error {
+	errs := make([]error, len(candidates))
+	// Slots are given back to the tuner they were taken from.
+	workers := downloadWorkers
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		workers.acquire()
+		if ctx.Err() != nil {
+			workers.release()
+			break
+		}
+		wg.Add(1)
+		go func(i int, candidate *Candidate) {
+			defer wg.Done()
+			defer workers.release()
+			errs[i] = downloadCandidate(ctx, candidate, artStyle, artStyleExtensions, opts)
+		}(i, candidate)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Scores a downloaded candidate from 0 to 100 by resolution, aspect ratio,
+// file size and how trustworthy the source is.
+func scoreCandidate(candidate *Candidate, artStyleExtensions []string) float64 {
+	targetWidth, _ := strconv.ParseFloat(artStyleExtensions[3], 64)
+	targetHeight, _ := strconv.ParseFloat(artStyleExtensions[4], 64)
+	width, height := float64(candidate.Size.X), float64(candidate.Size.Y)
+
+	resolution := math.Min(1, math.Min(width/targetWidth, height/targetHeight))
+
+	targetRatio := targetWidth / targetHeight
+	aspect := math.Max(0, 1-math.Abs(width/height-targetRatio)/targetRatio)
+
+	// Tiny files are usually placeholders and huge ones are suspicious.
+	fileSize := 1.0
+	if len(candidate.ImageBytes) < 5*1024 {
+		fileSize = 0
+	} else if len(candidate.ImageBytes) > 20*1024*1024 {
+		fileSize = 0.5
+	}
+
+	return 35*resolution + 25*aspect + 10*fileSize + 30*candidate.Trust
+}
+
+// Times an image is downloaded again if it arrives broken.
+const maxDownloadAttempts = 3
+
+// Largest image that is downloaded, like archive entries. The URLs may come
+// from web pages, see extension.go.
+const maxImageSize = 50 * 1024 * 1024
+
+// Downloads an image, checking that it's complete and not an error page. Some
+// CDNs answer with a web page and status 200, or cut the connection. Broken
+// downloads are fetched again. Returns nil bytes if the image doesn't exist.
+func fetchImage(ctx context.Context, url string) (imageBytes []byte, contentType string, urlPath string, err error) {
+	start, workers := time.Now(), downloadWorkers
+	defer func() {
+		workers.observe(time.Since(start), err != nil && ctx.Err() == nil)
+	}()
+	var lastErr error
+	for attempt := 0; attempt < maxDownloadAttempts; attempt++ {
+		response, err := tryDownload(ctx, url)
+		if err != nil || response == nil {
+			return nil, "", "", err
+		}
+		if response.ContentLength > maxImageSize {
+			response.Body.Close()
+			return nil, "", "", fmt.Errorf("Download of %v is too large: %v bytes", url, response.ContentLength)
+		}
+		imageBytes, err = ioutil.ReadAll(io.LimitReader(response.Body, maxImageSize+1))
+		response.Body.Close()
+		if err == nil && len(imageBytes) > maxImageSize {
+			return nil, "", "", fmt.Errorf("Download of %v is larger than %v bytes", url, maxImageSize)
+		}
+		if err == nil {
+			err = checkDownload(response, imageBytes)
+		}
+		if err == nil {
+			return imageBytes, response.Header.Get("Content-Type"), response.Request.URL.Path, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", "", ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, "", "", lastErr
+}
+
+// Checks a downloaded image for truncation and error pages.
+func checkDownload(response *http.Response, body []byte) error {
+	url := response.Request.URL.String()
+	// Unknown for compressed or chunked responses.
+	if response.ContentLength >= 0 && int64(len(body)) != response.ContentLength {
+		return fmt.Errorf("Download of %v was cut short: got %v of %v bytes", url, len(body), response.ContentLength)
+	}
+	if len(body) == 0 {
+		return errors.New("Download of " + url + " is empty")
+	}
+	sniffed := http.DetectContentType(body)
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "text/") || strings.HasPrefix(sniffed, "text/") {
+		return errors.New("Download of " + url + " is a web page, not an image")
+	}
+	return nil
+}
+
+// Downloads a candidate, trying its mirrors in order, and checks that it fits
+// the art style. Images with the wrong aspect ratio are fitted according to
+// the options.
+func downloadCandidate(ctx context.Context, candidate *Candidate, artStyle string, artStyleExtensions []string, opts *Options) error {
+	var imageBytes []byte
+	var contentType, urlPath string
+	var err error
+	if candidate.ImageBytes != nil {
+		// Generated, see media.go and theme.go, always PNG.
+		imageBytes, contentType = candidate.ImageBytes, "image/png"
+	} else if candidate.Path != "" {
+		imageBytes, err = ioutil.ReadFile(candidate.Path)
+		urlPath = filepath.ToSlash(candidate.Path)
+	} else {
+		for _, url := range candidate.URLs {
+			imageBytes, contentType, urlPath, err = fetchImage(ctx, url)
+			if err == nil && imageBytes != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if imageBytes == nil {
+		return errors.New("not found")
+	}
+
+	urlExt := filepath.Ext(urlPath)
+	if contentType != "" {
+		candidate.ImageExt = "." + strings.Split(contentType, "/")[1]
+	} else if urlExt != "" {
+		candidate.ImageExt = urlExt
+	} else {
+		// Steam is forgiving on image extensions.
+		candidate.ImageExt = "jpg"
+	}
+
+	if candidate.ImageExt == ".jpeg" {
+		// The new library ignores .jpeg
+		candidate.ImageExt = ".jpg"
+	} else if candidate.ImageExt == ".octet-stream" {
+		// Amazonaws (steamgriddb) gives us an .octet-stream
+		candidate.ImageExt = ".png"
+	}
+
+	if isGIF(imageBytes) {
+		imageBytes, err = gifToPNG(imageBytes)
+		if err != nil {
+			return err
+		}
+		candidate.ImageExt = ".png"
+	}
+
+	// catch false aspect ratios
+	img, _, err := image.Decode(bytes.NewBuffer(imageBytes))
+	if err != nil {
+		return err
+	}
+	if opts.SkinCheck && candidate.Unmoderated && looksExplicit(img) {
+		return errCandidateUnsafe
+	}
+	// Logos are drawn over the hero, one without transparency would hide it
+	// behind a box with the text baked in.
+	if opaque, ok := img.(interface{ Opaque() bool }); artStyle == "Logo" && ok && opaque.Opaque() {
+		return errCandidateRejected
+	}
+	imageSize := img.Bounds().Size()
+	fitMode := opts.fitModes[artStyle]
+	if (fitMode == fitNone || fitMode == "") && artStyle == "Banner" && imageSize.X < imageSize.Y {
+		return errCandidateRejected
+	} else if (fitMode == fitNone || fitMode == "") && artStyle == "Cover" && imageSize.X > imageSize.Y {
+		return errCandidateRejected
+	}
+
+	// Heroes come in all sizes, by default they are cropped around the
+	// interesting part.
+	if fitMode != "" && aspectRatioMismatch(imageSize, targetAspectRatio(artStyleExtensions)) {
+		imageBytes, err = fitImageBytes(imageBytes, candidate.ImageExt, targetAspectRatio(artStyleExtensions), fitMode)
+		if err != nil {
+			return err
+		}
+		config, _, err := image.DecodeConfig(bytes.NewBuffer(imageBytes))
+		if err != nil {
+			return err
+		}
+		imageSize = image.Pt(config.Width, config.Height)
+	}
+
+	candidate.Animated = isAnimated(imageBytes)
+	if candidate.Animated && opts.Animated == animatedNever {
+		return errCandidateAnimated
+	}
+	budget := opts.AnimatedMaxSize * 1024 * 1024
+	if candidate.Animated && budget > 0 && len(imageBytes) > budget {
+		imageBytes, err = shrinkAnimation(imageBytes, budget)
+		if err != nil {
+			return err
+		}
+		config, _, err := image.DecodeConfig(bytes.NewBuffer(imageBytes))
+		if err != nil {
+			return err
+		}
+		imageSize = image.Pt(config.Width, config.Height)
+	}
+	candidate.ImageBytes = imageBytes
+	candidate.Size = imageSize
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Optional styling of banners and covers after the overlays, the same for the
+// whole library: rounded corners, a border and a drop shadow. Heroes and logos
+// are left alone, they aren't shown as cards.
+//
+// Corners and shadows need transparency, so styled JPG images are written as
+// PNG. Animated images are left alone.
+
+// Darkest alpha of the shadow, at the edge of the card.
+const shadowAlpha = 160
+
+func cardStyleEnabled(opts *Options) bool {
+	return opts.Corners > 0 || opts.Border > 0 || opts.Shadow > 0
+}
+
+func validateCardStyle(opts *Options) error {
+	if opts.Corners < 0 || opts.Border < 0 || opts.Shadow < 0 {
+		return errors.New("Corners, border and shadow sizes can't be negative")
+	}
+	_, err := parseHexColor(opts.BorderColor)
+	return err
+}
+
+// Parses colors like "#fff", "#ffffff" or "#ffffff80".
+func parseHexColor(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	parsed, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.NRGBA{}, errors.New("Invalid color " + value + ", must be like #ffffff")
+	}
+	return color.NRGBA{uint8(parsed >> 24), uint8(parsed >> 16), uint8(parsed >> 8), uint8(parsed)}, nil
+}
+
+// Applies the card style of the options to the image with overlays.
+func applyCardStyle(game *Game, opts *Options, artStyle string) error {
+	if !cardStyleEnabled(opts) || (artStyle != "Banner" && artStyle != "Cover") {
+		return nil
+	}
+	imageBytes := game.OverlayImageBytes
+	if imageBytes == nil {
+		imageBytes = game.CleanImageBytes
+	}
+	if imageBytes == nil {
+		return nil
+	}
+	if isAnimated(imageBytes) {
+		return nil
+	}
+	gameImage, _, err := image.Decode(bytes.NewBuffer(imageBytes))
+	if err != nil {
+		return err
+	}
+	result, err := styleCard(gameImage, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Corners > 0 || cardShadow(opts, gameImage.Bounds().Size()) > 0 {
+		game.ImageExt = ".png"
+	}
+	game.OverlayImageBytes, err = encodeImage(result, game.ImageExt)
+	return err
+}
+
+// Draws the image as a card with the corners, border and shadow of the
+// options, at the same size.
+func styleCard(gameImage image.Image, opts *Options) (*image.NRGBA, error) {
+	borderColor, err := parseHexColor(opts.BorderColor)
+	if err != nil {
+		return nil, err
+	}
+
+	size := gameImage.Bounds().Size()
+	// The card shrinks to make room for the shadow at the bottom right.
+	shadow := cardShadow(opts, size)
+	card := image.Rect(0, 0, size.X-shadow, size.Y-shadow)
+	scaled := image.NewNRGBA(card)
+	draw.ApproxBiLinear.Scale(scaled, card, gameImage, gameImage.Bounds(), draw.Src, nil)
+
+	radius := float64(minInt(opts.Corners, minInt(card.Dx(), card.Dy())/2))
+	result := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			var pixel color.NRGBA
+			if shadow > 0 {
+				// Same shape, moved by half the shadow, fading out.
+				offset := float64(shadow) / 2
+				distance := roundedRectDistance(px-offset, py-offset, card, radius)
+				if fade := 1 - distance/offset; distance > 0 && fade > 0 {
+					pixel.A = uint8(shadowAlpha * fade * fade)
+				} else if distance <= 0 {
+					pixel.A = shadowAlpha
+				}
+			}
+			distance := roundedRectDistance(px, py, card, radius)
+			coverage := clampUnit(0.5 - distance)
+			if coverage > 0 {
+				cardPixel := scaled.NRGBAAt(x, y)
+				if opts.Border > 0 && distance > -float64(opts.Border) {
+					cardPixel = blendOver(cardPixel, borderColor, clampUnit(distance+float64(opts.Border)+0.5))
+				}
+				pixel = blendOver(pixel, cardPixel, coverage)
+			}
+			result.SetNRGBA(x, y, pixel)
+		}
+	}
+	return result, nil
+}
+
+// Size of the shadow of a card of the given size, at most a quarter of it.
+func cardShadow(opts *Options, size image.Point) int {
+	if opts.Shadow > size.X/4 || opts.Shadow > size.Y/4 {
+		return minInt(size.X, size.Y) / 4
+	}
+	return opts.Shadow
+}
+
+// Signed distance from a point to a rectangle with rounded corners, negative
+// inside.
+func roundedRectDistance(x, y float64, rect image.Rectangle, radius float64) float64 {
+	centerX := float64(rect.Min.X+rect.Max.X) / 2
+	centerY := float64(rect.Min.Y+rect.Max.Y) / 2
+	qx := math.Abs(x-centerX) - float64(rect.Dx())/2 + radius
+	qy := math.Abs(y-centerY) - float64(rect.Dy())/2 + radius
+	outside := math.Hypot(math.Max(qx, 0), math.Max(qy, 0))
+	inside := math.Min(math.Max(qx, qy), 0)
+	return outside + inside - radius
+}
+
+// Draws src over dst with the given part of its alpha, in non-premultiplied
+// colors.
+func blendOver(dst color.NRGBA, src color.NRGBA, amount float64) color.NRGBA {
+	srcAlpha := float64(src.A) / 255 * amount
+	dstAlpha := float64(dst.A) / 255
+	alpha := srcAlpha + dstAlpha*(1-srcAlpha)
+	if alpha == 0 {
+		return color.NRGBA{}
+	}
+	mix := func(s, d uint8) uint8 {
+		return uint8(math.Round((float64(s)*srcAlpha + float64(d)*dstAlpha*(1-srcAlpha)) / alpha))
+	}
+	return color.NRGBA{mix(src.R, dst.R), mix(src.G, dst.G), mix(src.B, dst.B), uint8(math.Round(alpha * 255))}
+}
+
+func clampUnit(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The library of newer Steam clients keeps the collections in the cloud
+// storage of the user, a JSON file with one entry per collection:
+//
+//	[["user-collections.uc-abc", {"key": "user-collections.uc-abc",
+//	  "value": "{\"id\":\"uc-abc\",\"name\":\"Co-op\",\"added\":[620],\"removed\":[]}"}]]
+//
+// The games in them are tagged like the categories of sharedconfig.vdf, so an
+// overlay like "co-op.cover.png" applies. Favorites have the id "favorite"
+// and get the tag "favorite", like before. Dynamic collections are filled by
+// the client from their filters and list no games, they can't be used.
+const collectionsFileName = "cloud-storage-namespace-1.json"
+
+type cloudStorageEntry struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	IsDeleted bool   `json:"is_deleted"`
+}
+
+type collection struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Added   []json.Number `json:"added"`
+	Removed []json.Number `json:"removed"`
+}
+
+// Adds the collections of the cloud storage to the tags of the games, and the
+// games in them that weren't found yet.
+func addCollectionTags(user User, games map[string]*Game) {
+	collectionsFile := filepath.Join(user.Dir, "config", "cloudstorage", collectionsFileName)
+	if _, err := steamFS.Stat(collectionsFile); err != nil {
+		return
+	}
+	collectionsBytes, err := steamFS.ReadFile(collectionsFile)
+	if err != nil {
+		return
+	}
+	var entries [][]json.RawMessage
+	if err := json.Unmarshal(collectionsBytes, &entries); err != nil {
+		fmt.Printf("Could not read collections from %v: %v\n", collectionsFile, err.Error())
+		return
+	}
+
+	for _, pair := range entries {
+		var entry cloudStorageEntry
+		if len(pair) != 2 || json.Unmarshal(pair[1], &entry) != nil {
+			continue
+		}
+		if !strings.HasPrefix(entry.Key, "user-collections.") || entry.IsDeleted || entry.Value == "" {
+			continue
+		}
+		var c collection
+		if err := json.Unmarshal([]byte(entry.Value), &c); err != nil {
+			continue
+		}
+		tag := c.Name
+		if c.ID == "favorite" || c.ID == "hidden" {
+			tag = c.ID
+		}
+		if tag == "" {
+			continue
+		}
+		removed := map[json.Number]bool{}
+		for _, id := range c.Removed {
+			removed[id] = true
+		}
+		for _, id := range c.Added {
+			gameID := id.String()
+			if removed[id] || !isValidGameID(gameID) {
+				continue
+			}
+			game, ok := games[gameID]
+			if !ok {
+				// Like the categories, games without a name yet.
+				game = &Game{ID: gameID, Tags: []string{}}
+				games[gameID] = game
+			}
+			if !hasTag(game, tag) {
+				game.Tags = append(game.Tags, tag)
+			}
+		}
+	}
+}
+
+// Tells if the game has the tag, ignoring the case like the overlays.
+func hasTag(game *Game, tag string) bool {
+	for _, existing := range game.Tags {
+		if strings.EqualFold(existing, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tags of the games with categories or in collections, by user and game ID,
+// for the watch mode to see games moving between them.
+func libraryTags(steamDir string) (map[string]string, error) {
+	users, err := GetUsersReadOnly(steamDir)
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	for _, user := range users {
+		games := map[string]*Game{}
+		addUnknownGames(user, games)
+		addCollectionTags(user, games)
+		for id, game := range games {
+			sorted := make([]string, 0, len(game.Tags))
+			for _, tag := range game.Tags {
+				sorted = append(sorted, strings.ToLower(tag))
+			}
+			sort.Strings(sorted)
+			tags[user.SteamID32+"/"+id] = strings.Join(sorted, "\n")
+		}
+	}
+	return tags, nil
+}
+
+// IDs of the games whose tags changed for any user.
+func changedTags(before map[string]string, after map[string]string) []string {
+	changed := map[string]bool{}
+	for key, tags := range after {
+		if before[key] != tags {
+			changed[key[strings.Index(key, "/")+1:]] = true
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed[key[strings.Index(key, "/")+1:]] = true
+		}
+	}
+	ids := make([]string, 0, len(changed))
+	for id := range changed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Completion status from a backlog tracker, applied as tags so overlays like
+// "completed.cover.png" don't need manually maintained categories. Neither
+// HowLongToBeat nor Backloggd have a public API, so the status is read from
+// the CSV export of the account. The first row must name the columns:
+//
+//	name (or title, game), optional appid, and either a status column with
+//	values like "Completed", or one column per status, like the
+//	HowLongToBeat export with "Playing", "Completed" and "Retired".
+//
+// Retired and abandoned games are tagged as "Dropped".
+var completionStatuses = map[string]string{
+	"completed": "Completed",
+	"beaten":    "Completed",
+	"played":    "Completed",
+	"mastered":  "Completed",
+	"playing":   "Playing",
+	"retired":   "Dropped",
+	"dropped":   "Dropped",
+	"abandoned": "Dropped",
+	"shelved":   "Dropped",
+	"backlog":   "Backlog",
+	"wishlist":  "Wishlist",
+}
+
+// Completion status by app ID and by lowercase game name.
+type completionList struct {
+	byID   map[string]string
+	byName map[string]string
+}
+
+func loadCompletion(path string) (*completionList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("Completion file " + path + " is empty")
+	}
+
+	nameColumn, idColumn, statusColumn := -1, -1, -1
+	// Columns that are a status by themselves, set when the game has it.
+	statusColumns := map[int]string{}
+	for i, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\uFEFF")))
+		switch column {
+		case "name", "title", "game":
+			nameColumn = i
+		case "appid", "app id", "steam id", "steam app id":
+			idColumn = i
+		case "status":
+			statusColumn = i
+		default:
+			if status, ok := completionStatuses[column]; ok {
+				statusColumns[i] = status
+			}
+		}
+	}
+	if nameColumn == -1 && idColumn == -1 {
+		return nil, errors.New("Completion file " + path + " needs a name or appid column")
+	}
+	if statusColumn == -1 && len(statusColumns) == 0 {
+		return nil, errors.New("Completion file " + path + " needs a status column")
+	}
+
+	list := &completionList{byID: map[string]string{}, byName: map[string]string{}}
+	field := func(record []string, column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+	for _, record := range records[1:] {
+		status := ""
+		if value := strings.ToLower(field(record, statusColumn)); value != "" {
+			status = completionStatuses[value]
+		}
+		for column, columnStatus := range statusColumns {
+			value := strings.ToLower(field(record, column))
+			if value != "" && value != "0" && value != "false" && value != "no" {
+				status = columnStatus
+			}
+		}
+		if status == "" {
+			continue
+		}
+		if id := field(record, idColumn); id != "" {
+			list.byID[id] = status
+		}
+		if name := field(record, nameColumn); name != "" {
+			list.byName[strings.ToLower(name)] = status
+		}
+	}
+	return list, nil
+}
+
+// Adds the completion status as tag to the games found in the list.
+func addCompletionTags(list *completionList, games map[string]*Game) {
+	for _, game := range games {
+		status, ok := list.byID[game.ID]
+		if !ok && game.Name != "" {
+			status, ok = list.byName[strings.ToLower(strings.TrimSpace(game.Name))]
+		}
+		if ok {
+			game.Tags = append(game.Tags, status)
+		}
+	}
+}
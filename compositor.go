@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// Compositing backends. The standard one uses the generic draw functions for
+// every image. The fast one converts and scales each overlay only once per
+// image size and blends with a loop over the pixels that skips the
+// transparent parts, which are most of a typical overlay. It's plain Go, no
+// SIMD or GPU.
+const (
+	compositorStandard = "standard"
+	compositorFast     = "fast"
+)
+
+// Backend for compositing overlays, set from the options at the start of a
+// run.
+var compositorBackend = compositorStandard
+
+func validateCompositor(opts *Options) error {
+	if opts.Compositor != compositorStandard && opts.Compositor != compositorFast {
+		return errors.New("Unknown compositor " + opts.Compositor + ", must be standard or fast")
+	}
+	return nil
+}
+
+type preparedKey struct {
+	overlay image.Image
+	size    image.Point
+}
+
+// Overlays converted to RGBA at the size they are used, shared by the workers.
+// Cleared when overlays are loaded, the old ones aren't used again.
+var preparedOverlays sync.Map
+
+func clearPreparedOverlays() {
+	preparedOverlays.Range(func(key, value interface{}) bool {
+		preparedOverlays.Delete(key)
+		return true
+	})
+}
+
+// Returns the overlay as RGBA of the given size, scaling it if needed.
+func prepareOverlay(overlay image.Image, size image.Point) *image.RGBA {
+	key := preparedKey{overlay, size}
+	if prepared, ok := preparedOverlays.Load(key); ok {
+		return prepared.(*image.RGBA)
+	}
+
+	prepared := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	if overlay.Bounds().Size() != size {
+		draw.ApproxBiLinear.Scale(prepared, prepared.Bounds(), overlay, overlay.Bounds(), draw.Src, nil)
+	} else {
+		draw.Draw(prepared, prepared.Bounds(), overlay, overlay.Bounds().Min, draw.Src)
+	}
+	preparedOverlays.Store(key, prepared)
+	return prepared
+}
+
+// Blends src over dst, both premultiplied and of the same size.
+func compositeOver(dst *image.RGBA, src *image.RGBA) {
+	width := dst.Bounds().Dx() * 4
+	height := dst.Bounds().Dy()
+	if src.Bounds().Dx()*4 < width {
+		width = src.Bounds().Dx() * 4
+	}
+	if src.Bounds().Dy() < height {
+		height = src.Bounds().Dy()
+	}
+
+	for y := 0; y < height; y++ {
+		d := dst.Pix[y*dst.Stride : y*dst.Stride+width]
+		s := src.Pix[y*src.Stride : y*src.Stride+width]
+		for i := 0; i < width; i += 4 {
+			alpha := uint32(s[i+3])
+			if alpha == 0 {
+				continue
+			}
+			if alpha == 255 {
+				d[i], d[i+1], d[i+2], d[i+3] = s[i], s[i+1], s[i+2], 255
+				continue
+			}
+			inverse := 255 - alpha
+			d[i] = uint8(uint32(s[i]) + (uint32(d[i])*inverse+127)/255)
+			d[i+1] = uint8(uint32(s[i+1]) + (uint32(d[i+1])*inverse+127)/255)
+			d[i+2] = uint8(uint32(s[i+2]) + (uint32(d[i+2])*inverse+127)/255)
+			d[i+3] = uint8(alpha + (uint32(d[i+3])*inverse+127)/255)
+		}
+	}
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default config file, next to the executable.
+const defaultConfigName = "steamgrid.conf"
+
+// The config file sets the same options as the flags, by flag name, in a
+// small subset of TOML. Flags given on the command line win over the file.
+// Profiles are named groups of options, and user sections pick a profile and
+// options for a Steam user, by persona name or user ID, so multi-user runs
+// treat every account differently. Target sections are the Steam
+// installations of "steamgrid run", see targets.go. STEAMGRID_* environment
+// variables are applied after the file, see LoadEnvironment:
+//
+//	steamgriddb = "my api key"
+//	styles = "white_logo"
+//
+//	[profile.kids]
+//	styles = "material"
+//	types = "static"
+//
+//	[user.Junior]
+//	profile = "kids"
+//	skiphero = true
+//
+//	[target.deck]
+//	steam-ssh = "deck@steamdeck:/home/deck/.local/share/Steam"
+//	device = "deck"
+type Config struct {
+	Path     string
+	Global   []ConfigSetting
+	Profiles map[string][]ConfigSetting
+	Users    map[string][]ConfigSetting
+	Targets  map[string][]ConfigSetting
+	// Target whose section applies, after the global settings and before the
+	// user sections. Empty for none.
+	Target string
+	// STEAMGRID_* variables, applied after the file, and the variable names
+	// by option for error messages.
+	Environment []ConfigSetting
+	envNames    map[string]string
+	// API keys from the keyring, applied first, see keyring.go.
+	Keyring []ConfigSetting
+	// Flags given on the command line, applied last.
+	Overrides []ConfigSetting
+}
+
+// ConfigSetting is an option from the config file. Line is 0 for settings from
+// the command line, -1 for environment variables and -2 for the keyring.
+type ConfigSetting struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// LoadConfig reads a config file. Errors include the line number.
+func LoadConfig(path string) (*Config, error) {
+	configBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(path, configBytes)
+}
+
+// ParseConfig parses the contents of a config file, path is only used for
+// the errors.
+func ParseConfig(path string, configBytes []byte) (*Config, error) {
+	config := &Config{Path: path, Profiles: map[string][]ConfigSetting{}, Users: map[string][]ConfigSetting{}, Targets: map[string][]ConfigSetting{}}
+	// Settings are added to the global options until the first section.
+	var section map[string][]ConfigSetting
+	sectionName := ""
+	// Lines of the keys in the current section, to catch duplicates.
+	keyLines := map[string]int{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(configBytes, []byte("\xEF\xBB\xBF"))))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		fail := func(message string) error {
+			return fmt.Errorf("%v line %v: %v", path, lineNumber, message)
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fail("missing ] in section header")
+			}
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			kind, name := header, ""
+			if dot := strings.Index(header, "."); dot != -1 {
+				kind, name = header[:dot], unquoteConfigName(header[dot+1:])
+			}
+			switch {
+			case name == "":
+				return nil, fail("section must be [profile.name], [user.name] or [target.name], got [" + header + "]")
+			case kind == "profile":
+				section = config.Profiles
+			case kind == "user":
+				section = config.Users
+			case kind == "target":
+				section = config.Targets
+			default:
+				return nil, fail("section must be [profile.name], [user.name] or [target.name], got [" + header + "]")
+			}
+			if _, ok := section[name]; ok {
+				return nil, fail("duplicate section [" + header + "]")
+			}
+			section[name] = []ConfigSetting{}
+			sectionName = name
+			keyLines = map[string]int{}
+			continue
+		}
+
+		equals := strings.Index(line, "=")
+		if equals == -1 {
+			return nil, fail("expected key = value, got " + line)
+		}
+		key := strings.TrimSpace(line[:equals])
+		value, err := parseConfigValue(strings.TrimSpace(line[equals+1:]))
+		if key == "" {
+			return nil, fail("missing key before =")
+		}
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		if previous, ok := keyLines[key]; ok {
+			return nil, fail(fmt.Sprintf("%v is already set on line %v", key, previous))
+		}
+		keyLines[key] = lineNumber
+		setting := ConfigSetting{key, value, lineNumber}
+		if section == nil {
+			config.Global = append(config.Global, setting)
+		} else {
+			section[sectionName] = append(section[sectionName], setting)
+		}
+	}
+	return config, scanner.Err()
+}
+
+// Removes a # comment, unless it's inside a string.
+func stripConfigComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func unquoteConfigName(name string) string {
+	name = strings.TrimSpace(name)
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return name
+}
+
+// Values are quoted strings, numbers or booleans. Literal strings with single
+// quotes have no escapes, which is handy for Windows paths.
+func parseConfigValue(value string) (string, error) {
+	switch {
+	case value == "":
+		return "", errors.New("missing value after =")
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", errors.New("invalid string " + value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", errors.New("invalid string " + value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	default:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", errors.New("value must be a quoted string, a number, true or false, got " + value)
+		}
+		return value, nil
+	}
+}
+
+// CommandLineSettings returns the flags that were set explicitly, to apply
+// them over the config file.
+func CommandLineSettings(flags *flag.FlagSet) []ConfigSetting {
+	var settings []ConfigSetting
+	flags.Visit(func(f *flag.Flag) {
+		settings = append(settings, ConfigSetting{f.Name, f.Value.String(), 0})
+	})
+	return settings
+}
+
+// Returns the user section for a Steam user, by persona name or ID.
+func (config *Config) userSettings(user *User) ([]ConfigSetting, bool) {
+	if user == nil {
+		return nil, false
+	}
+	if settings, ok := config.Users[user.Name]; ok {
+		return settings, true
+	}
+	settings, ok := config.Users[filepath.Base(user.Dir)]
+	return settings, ok
+}
+
+// HasUser tells if the config has options for the user.
+func (config *Config) HasUser(user User) bool {
+	_, ok := config.userSettings(&user)
+	return ok
+}
+
+// Options returns the options for a user, or the global options if user is
+// nil: the defaults, then the theme, the global settings, the profile, the
+// target, the user section and the command line.
+func (config *Config) Options(user *User) (Options, error) {
+	userSettings, _ := config.userSettings(user)
+	return config.options(userSettings)
+}
+
+// Check builds the options of every user and target section, to report
+// mistakes before the run starts.
+func (config *Config) Check() error {
+	if _, err := config.options(nil); err != nil {
+		return err
+	}
+	for _, settings := range config.Users {
+		if _, err := config.options(settings); err != nil {
+			return err
+		}
+	}
+	for name := range config.Targets {
+		target := *config
+		target.Target = name
+		if _, err := target.options(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (config *Config) options(userSettings []ConfigSetting) (Options, error) {
+	var opts Options
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	opts.RegisterFlags(flags)
+
+	targetSettings := config.Targets[config.Target]
+	profile := ""
+	var profileSetting ConfigSetting
+	for _, settings := range [][]ConfigSetting{config.Global, targetSettings, userSettings, config.Environment} {
+		for _, setting := range settings {
+			if setting.Key == "profile" {
+				profile, profileSetting = setting.Value, setting
+			}
+		}
+	}
+	profileSettings, ok := config.Profiles[profile]
+	if profile != "" && !ok {
+		return opts, fmt.Errorf("%v: unknown profile %v", config.location(profileSetting), profile)
+	}
+
+	// The theme goes below everything else, see theme.go.
+	themeName := ""
+	var themeSetting ConfigSetting
+	for _, settings := range [][]ConfigSetting{config.Global, profileSettings, targetSettings, userSettings, config.Environment, config.Overrides} {
+		for _, setting := range settings {
+			if setting.Key == "theme" {
+				themeName, themeSetting = setting.Value, setting
+			}
+		}
+	}
+	theme, err := loadTheme(themeName)
+	if err != nil && themeSetting.Line != 0 {
+		return opts, fmt.Errorf("%v: %v", config.location(themeSetting), err.Error())
+	} else if err != nil {
+		return opts, err
+	}
+	var themeSettings []ConfigSetting
+	if theme != nil {
+		themeSettings = theme.settings
+		opts.themeDir = theme.dir
+	}
+
+	enforced := map[string]bool{}
+	for _, settings := range [][]ConfigSetting{config.Keyring, themeSettings, config.Global, profileSettings, targetSettings, userSettings, config.Environment, config.Overrides} {
+		for _, setting := range settings {
+			if setting.Key == "profile" || enforced[setting.Key] {
+				continue
+			}
+			if flags.Lookup(setting.Key) == nil {
+				if setting.Line == 0 {
+					// Flags of the command line only, like -config.
+					continue
+				}
+				message := fmt.Sprintf("%v: unknown option %v", config.location(setting), setting.Key)
+				if suggestion := closestFlag(flags, setting.Key); suggestion != "" {
+					message += ", did you mean " + suggestion + "?"
+				}
+				return opts, errors.New(message)
+			}
+			if err := flags.Set(setting.Key, setting.Value); err != nil {
+				if setting.Line == 0 {
+					return opts, err
+				}
+				return opts, fmt.Errorf("%v: invalid value %q for %v: %v", config.location(setting), setting.Value, setting.Key, err.Error())
+			}
+			if check, ok := configChecks[setting.Key]; ok && setting.Line != 0 {
+				if err := check(&opts); err != nil {
+					return opts, fmt.Errorf("%v: invalid value %q for %v: %v", config.location(setting), setting.Value, setting.Key, err.Error())
+				}
+			}
+			// Safe mode from the file or the environment can't be disabled, see
+			// safemode.go.
+			if value, ok := enforcedOptions[setting.Key]; ok && setting.Line != 0 && flags.Lookup(setting.Key).Value.String() == value {
+				enforced[setting.Key] = true
+			}
+		}
+	}
+	opts.Config = config
+	return opts, nil
+}
+
+// Where a setting comes from, for error messages.
+func (config *Config) location(setting ConfigSetting) string {
+	if setting.Line == -2 {
+		return "the keyring"
+	} else if setting.Line < 0 {
+		return "environment variable " + config.envNames[setting.Key]
+	}
+	return fmt.Sprintf("%v line %v", config.Path, setting.Line)
+}
+
+// Prefix of the environment variables that set options.
+const envPrefix = "STEAMGRID_"
+
+// LoadEnvironment adds the options set by STEAMGRID_* variables, for
+// containers and scripts. The variable name is the option name in upper case,
+// where underscores and dashes don't matter: STEAMGRID_STEAM_DIR and
+// STEAMGRID_STEAMDIR both set -steamdir. Returns the number of variables.
+func (config *Config) LoadEnvironment(environ []string) int {
+	var opts Options
+	flags := flag.NewFlagSet("environment", flag.ContinueOnError)
+	opts.RegisterFlags(flags)
+	byName := map[string]string{}
+	flags.VisitAll(func(f *flag.Flag) {
+		byName[envKey(f.Name)] = f.Name
+	})
+
+	config.Environment = nil
+	config.envNames = map[string]string{}
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], envPrefix) {
+			continue
+		}
+		key := envKey(strings.TrimPrefix(parts[0], envPrefix))
+		if key == "config" {
+			// Read by registerConfigFlag.
+			continue
+		}
+		if name, ok := byName[key]; ok {
+			key = name
+		}
+		config.Environment = append(config.Environment, ConfigSetting{key, parts[1], -1})
+		config.envNames[key] = parts[0]
+	}
+	return len(config.Environment)
+}
+
+// Option name without separators and in lower case, to match it with a
+// variable name.
+func envKey(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// Format returns the config in the file format. Comments are lost.
+func (config *Config) Format() []byte {
+	var buffer bytes.Buffer
+	writeSettings := func(settings []ConfigSetting) {
+		for _, setting := range settings {
+			fmt.Fprintf(&buffer, "%v = %v\n", setting.Key, formatConfigValue(setting.Value))
+		}
+	}
+	writeSections := func(kind string, sections map[string][]ConfigSetting) {
+		names := make([]string, 0, len(sections))
+		for name := range sections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			header := name
+			if strings.ContainsAny(name, " .[]\"#") {
+				header = strconv.Quote(name)
+			}
+			fmt.Fprintf(&buffer, "\n[%v.%v]\n", kind, header)
+			writeSettings(sections[name])
+		}
+	}
+
+	buffer.WriteString("# steamgrid options, see steamgrid -help\n")
+	writeSettings(config.Global)
+	writeSections("profile", config.Profiles)
+	writeSections("user", config.Users)
+	writeSections("target", config.Targets)
+	return buffer.Bytes()
+}
+
+// Numbers and booleans as they are, everything else quoted.
+func formatConfigValue(value string) string {
+	if value == "true" || value == "false" {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// Checks of the options with a fixed set of values or a syntax, so mistakes
+// in the file are reported with their line. The command line is checked when
+// the run starts.
+var configChecks = map[string]func(opts *Options) error{
+	"types": func(opts *Options) error {
+		_, _, err := opts.splitTypes()
+		return err
+	},
+	"styles": validateSteamGridStyles,
+	"order": func(opts *Options) error {
+		_, err := sortGames(nil, opts.Order)
+		return err
+	},
+	"media":        validateMedia,
+	"budget":       validateBudget,
+	"compositor":   validateCompositor,
+	"badgestrip":   validateBadgeStrip,
+	"animated":     validateAnimated,
+	"sizeprofile":  validateSizeProfile,
+	"device":       validateDevice,
+	"bordercolor":  validateCardStyle,
+	"frames":       validateFrames,
+	"logoposition": validateLogoPosition,
+	"backupname":   validateNameTemplates,
+	"pngcompression": func(opts *Options) error {
+		_, err := getPNGCompression(opts)
+		return err
+	},
+	"filter": func(opts *Options) error {
+		_, err := getColorFilters(opts)
+		return err
+	},
+	"fit": func(opts *Options) error {
+		_, err := getFitModes(opts)
+		return err
+	},
+	"export": func(opts *Options) error {
+		_, err := getExports(opts)
+		return err
+	},
+	"aliases": func(opts *Options) error {
+		_, err := getAliases(opts)
+		return err
+	},
+	"urlsource": func(opts *Options) error {
+		_, err := getURLSources(opts)
+		return err
+	},
+	"familyviewtypes": func(opts *Options) error {
+		_, err := familyViewArtStyles(opts, getArtStyles(&Options{}))
+		return err
+	},
+	"cpu-workers":      validateWorkers,
+	"download-workers": validateWorkers,
+}
+
+// Returns the flag with the name closest to a misspelled one, or "" if none
+// is close.
+func closestFlag(flags *flag.FlagSet, name string) string {
+	best, bestDistance := "", 3
+	flags.VisitAll(func(f *flag.Flag) {
+		if distance := editDistance(strings.ToLower(name), f.Name); distance < bestDistance {
+			best, bestDistance = f.Name, distance
+		}
+	})
+	return best
+}
+
+// Levenshtein distance of two strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+)
+
+// With the auto contrast option, badges that would get lost on the image
+// below them, like a white crown on a snowy cover, get a scrim: a soft box
+// behind them, dark for light badges and light for dark ones. The image is
+// sampled under the badge for every game. Frames, overlays that cover most of
+// the image, are left alone.
+
+// Set from the options at the start of a run.
+var autoContrast bool
+
+// Smallest difference in brightness, 0 to 255, between a badge and the image
+// below it that is legible without a scrim.
+const minBadgeContrast = 64
+
+// Alpha of the scrim.
+const scrimAlpha = 150
+
+type overlayShape struct {
+	bounds image.Rectangle
+	// Brightness of the visible pixels, 0 to 255.
+	luminance float64
+}
+
+// Shapes by prepared overlay, they are the same for every game.
+var overlayShapes sync.Map
+
+func getOverlayShape(overlay *image.RGBA) overlayShape {
+	if cached, ok := overlayShapes.Load(overlay); ok {
+		return cached.(overlayShape)
+	}
+	shape := overlayShape{bounds: opaqueBounds(overlay)}
+	sum, weight := 0.0, 0.0
+	for y := shape.bounds.Min.Y; y < shape.bounds.Max.Y; y++ {
+		for x := shape.bounds.Min.X; x < shape.bounds.Max.X; x++ {
+			pixel := overlay.RGBAAt(x, y)
+			if pixel.A == 0 {
+				continue
+			}
+			// Premultiplied, so already weighted by the alpha.
+			sum += 0.299*float64(pixel.R) + 0.587*float64(pixel.G) + 0.114*float64(pixel.B)
+			weight += float64(pixel.A) / 255
+		}
+	}
+	if weight > 0 {
+		shape.luminance = sum / weight
+	}
+	overlayShapes.Store(overlay, shape)
+	return shape
+}
+
+// Draws a scrim into base behind where the overlay goes, if the overlay is a
+// badge that doesn't stand out from the image.
+func addContrastScrim(base *image.RGBA, overlay image.Image) {
+	if !autoContrast {
+		return
+	}
+	size := base.Bounds().Size()
+	prepared := prepareOverlay(overlay, size)
+	shape := getOverlayShape(prepared)
+	if shape.bounds.Empty() || shape.bounds.Dx() > size.X/2 || shape.bounds.Dy() > size.Y/2 {
+		return
+	}
+
+	// Brightness of the image under the visible pixels of the badge.
+	sum, weight := 0.0, 0.0
+	for y := shape.bounds.Min.Y; y < shape.bounds.Max.Y; y++ {
+		for x := shape.bounds.Min.X; x < shape.bounds.Max.X; x++ {
+			alpha := float64(prepared.RGBAAt(x, y).A) / 255
+			if alpha == 0 {
+				continue
+			}
+			pixel := base.RGBAAt(base.Bounds().Min.X+x, base.Bounds().Min.Y+y)
+			sum += alpha * (0.299*float64(pixel.R) + 0.587*float64(pixel.G) + 0.114*float64(pixel.B))
+			weight += alpha
+		}
+	}
+	if weight == 0 || math.Abs(sum/weight-shape.luminance) >= minBadgeContrast {
+		return
+	}
+
+	scrim := color.NRGBA{0, 0, 0, scrimAlpha}
+	if shape.luminance < 128 {
+		scrim = color.NRGBA{255, 255, 255, scrimAlpha}
+	}
+	padding := int(math.Max(2, float64(minInt(size.X, size.Y))/50))
+	box := shape.bounds.Inset(-padding).Intersect(image.Rect(0, 0, size.X, size.Y))
+	radius := float64(padding)
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			distance := roundedRectDistance(float64(x)+0.5, float64(y)+0.5, box, radius)
+			coverage := clampUnit(0.5 - distance)
+			if coverage == 0 {
+				continue
+			}
+			bx, by := base.Bounds().Min.X+x, base.Bounds().Min.Y+y
+			below := base.RGBAAt(bx, by)
+			mixed := blendOver(color.NRGBAModel.Convert(below).(color.NRGBA), scrim, coverage)
+			base.Set(bx, by, mixed)
+		}
+	}
+}
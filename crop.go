@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Aspect ratios closer than this are left alone.
+const aspectRatioTolerance = 0.05
+
+// Width of the downscaled image used to find the focal region. Small enough to
+// be fast, big enough to see faces and logos.
+const saliencySize = 256
+
+// Target aspect ratio of an art style, from its HQ dimensions.
+func targetAspectRatio(artStyleExtensions []string) float64 {
+	width, _ := strconv.ParseFloat(artStyleExtensions[3], 64)
+	height, _ := strconv.ParseFloat(artStyleExtensions[4], 64)
+	return width / height
+}
+
+// Checks if an image needs to be cropped or padded to fit the ratio.
+func aspectRatioMismatch(size image.Point, ratio float64) bool {
+	return math.Abs(float64(size.X)/float64(size.Y)-ratio)/ratio > aspectRatioTolerance
+}
+
+// Ways to fit an image with the wrong aspect ratio into an art style.
+const (
+	// Keep the image as it is. Banners and covers in the wrong orientation
+	// are discarded.
+	fitNone = "none"
+	// Crop around the focal region.
+	fitCrop = "crop"
+	// Pad with a blurred and darkened copy of the image.
+	fitBlur = "blur"
+	// Scale to the aspect ratio, distorting the image.
+	fitStretch = "stretch"
+)
+
+var defaultFitModes = map[string]string{
+	"Banner": fitNone,
+	"Cover":  fitNone,
+	"Hero":   fitCrop,
+	"Logo":   fitNone,
+}
+
+// Parses the fit option, formatted as "Hero=crop,Cover=blur". Art styles not
+// in the list keep their default.
+func getFitModes(opts *Options) (map[string]string, error) {
+	modes := make(map[string]string)
+	for artStyle, mode := range defaultFitModes {
+		modes[artStyle] = mode
+	}
+	for _, entry := range strings.Split(opts.Fit, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		artStyle := strings.Title(strings.ToLower(strings.TrimSpace(parts[0])))
+		if _, ok := defaultFitModes[artStyle]; !ok || len(parts) != 2 {
+			return nil, errors.New("Invalid fit " + entry + ", expected ARTSTYLE=MODE, like Hero=crop")
+		}
+		mode := strings.ToLower(strings.TrimSpace(parts[1]))
+		switch mode {
+		case fitNone, fitCrop, fitBlur, fitStretch:
+			modes[artStyle] = mode
+		default:
+			return nil, errors.New("Invalid fit mode " + mode + ", must be none, crop, blur or stretch")
+		}
+	}
+	return modes, nil
+}
+
+// Fits the encoded image to the aspect ratio with the given mode. Animated
+// images are returned as they are, changing them would lose the animation.
+func fitImageBytes(imageBytes []byte, imageExt string, ratio float64, mode string) ([]byte, error) {
+	if mode == fitNone {
+		return imageBytes, nil
+	}
+	if isAnimated(imageBytes) {
+		return imageBytes, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewBuffer(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+	if !aspectRatioMismatch(img.Bounds().Size(), ratio) {
+		return imageBytes, nil
+	}
+
+	switch mode {
+	case fitCrop:
+		img = focalCrop(img, ratio)
+	case fitBlur:
+		img = blurExtend(img, ratio)
+	case fitStretch:
+		img = stretch(img, ratio)
+	}
+	return encodeImage(img, imageExt)
+}
+
+// Size of an image extended (never shrunk) to the aspect ratio.
+func extendedSize(size image.Point, ratio float64) image.Point {
+	if float64(size.X)/float64(size.Y) > ratio {
+		return image.Pt(size.X, int(math.Round(float64(size.X)/ratio)))
+	}
+	return image.Pt(int(math.Round(float64(size.Y)*ratio)), size.Y)
+}
+
+// Centers the image over a blurred, darkened copy of itself scaled to fill
+// the aspect ratio.
+func blurExtend(img image.Image, ratio float64) image.Image {
+	bounds := img.Bounds()
+	size := extendedSize(bounds.Size(), ratio)
+	result := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	// Scale the source to cover the whole result, cutting the overflow.
+	coverScale := math.Max(float64(size.X)/float64(bounds.Dx()), float64(size.Y)/float64(bounds.Dy()))
+	coverWidth := int(math.Round(float64(bounds.Dx()) * coverScale))
+	coverHeight := int(math.Round(float64(bounds.Dy()) * coverScale))
+	coverRect := image.Rect(0, 0, coverWidth, coverHeight).Add(image.Pt((size.X-coverWidth)/2, (size.Y-coverHeight)/2))
+
+	// Downscaling a lot and scaling back up is a cheap blur.
+	tiny := image.NewRGBA(image.Rect(0, 0, maxInt(coverWidth/32, 1), maxInt(coverHeight/32, 1)))
+	draw.BiLinear.Scale(tiny, tiny.Bounds(), img, bounds, draw.Src, nil)
+	draw.BiLinear.Scale(result, coverRect, tiny, tiny.Bounds(), draw.Src, nil)
+
+	// Darken so the real image stands out.
+	shade := image.NewUniform(color.RGBA{0, 0, 0, 110})
+	draw.Draw(result, result.Bounds(), shade, image.Point{}, draw.Over)
+
+	offset := image.Pt((size.X-bounds.Dx())/2, (size.Y-bounds.Dy())/2)
+	draw.Draw(result, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Over)
+	return result
+}
+
+// Scales the image to the aspect ratio, keeping the larger dimension.
+func stretch(img image.Image, ratio float64) image.Image {
+	size := extendedSize(img.Bounds().Size(), ratio)
+	result := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.CatmullRom.Scale(result, result.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return result
+}
+
+// Crops the image to the aspect ratio around its most salient region,
+// instead of the center which frequently cuts off heads.
+func focalCrop(img image.Image, ratio float64) image.Image {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	saliency, scale := saliencyMap(img)
+
+	cropRect := bounds
+	if float64(size.X)/float64(size.Y) > ratio {
+		// Too wide, slide a window horizontally.
+		width := int(math.Round(float64(size.Y) * ratio))
+		offset := bestWindow(columnSums(saliency), float64(width)/scale)
+		x := bounds.Min.X + int(math.Round(offset*scale))
+		if x+width > bounds.Max.X {
+			x = bounds.Max.X - width
+		}
+		cropRect = image.Rect(x, bounds.Min.Y, x+width, bounds.Max.Y)
+	} else {
+		// Too tall, slide a window vertically.
+		height := int(math.Round(float64(size.X) / ratio))
+		offset := bestWindow(rowSums(saliency), float64(height)/scale)
+		y := bounds.Min.Y + int(math.Round(offset*scale))
+		if y+height > bounds.Max.Y {
+			y = bounds.Max.Y - height
+		}
+		cropRect = image.Rect(bounds.Min.X, y, bounds.Max.X, y+height)
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, cropRect.Dx(), cropRect.Dy()))
+	draw.Draw(result, result.Bounds(), img, cropRect.Min, draw.Src)
+	return result
+}
+
+// Simple saliency: gradient magnitude plus saturation on a downscaled copy.
+// Edges and colorful areas are where faces, characters and logos are, while
+// skies and backgrounds are flat. Returns the map and the scale factor back to
+// the original size.
+func saliencyMap(img image.Image) ([][]float64, float64) {
+	bounds := img.Bounds()
+	scale := math.Max(1, float64(bounds.Dx())/saliencySize)
+	width := int(float64(bounds.Dx()) / scale)
+	height := int(float64(bounds.Dy()) / scale)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	small := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+
+	luminance := make([][]float64, height)
+	saturation := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		luminance[y] = make([]float64, width)
+		saturation[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			c := small.RGBAAt(x, y)
+			r, g, b := float64(c.R), float64(c.G), float64(c.B)
+			luminance[y][x] = 0.299*r + 0.587*g + 0.114*b
+			saturation[y][x] = math.Max(r, math.Max(g, b)) - math.Min(r, math.Min(g, b))
+		}
+	}
+
+	saliency := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		saliency[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			dx := luminance[y][clampInt(x+1, 0, width-1)] - luminance[y][clampInt(x-1, 0, width-1)]
+			dy := luminance[clampInt(y+1, 0, height-1)][x] - luminance[clampInt(y-1, 0, height-1)][x]
+			saliency[y][x] = math.Sqrt(dx*dx+dy*dy) + 0.5*saturation[y][x]
+		}
+	}
+	return saliency, scale
+}
+
+func columnSums(saliency [][]float64) []float64 {
+	if len(saliency) == 0 {
+		return nil
+	}
+	sums := make([]float64, len(saliency[0]))
+	for _, row := range saliency {
+		for x, value := range row {
+			sums[x] += value
+		}
+	}
+	return sums
+}
+
+func rowSums(saliency [][]float64) []float64 {
+	sums := make([]float64, len(saliency))
+	for y, row := range saliency {
+		for _, value := range row {
+			sums[y] += value
+		}
+	}
+	return sums
+}
+
+// Returns the start of the window of the given length with the most energy.
+// A slight bias towards the center avoids jumping to a noisy border.
+func bestWindow(energy []float64, length float64) float64 {
+	window := int(math.Round(length))
+	if window >= len(energy) || window <= 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for i := 0; i < window; i++ {
+		sum += energy[i]
+	}
+	center := float64(len(energy)-window) / 2
+	best, bestScore := 0, -1.0
+	for start := 0; start+window <= len(energy); start++ {
+		if start > 0 {
+			sum += energy[start+window-1] - energy[start-1]
+		}
+		bias := 1 - 0.1*math.Abs(float64(start)-center)/math.Max(center, 1)
+		if score := sum * bias; score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	return float64(best)
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func clampInt(value int, min int, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Device profiles set the options for devices with little storage, like the
+// Steam Deck:
+//
+//	deck  artwork at the size of the Deck screen, bigger images shrunk to
+//	      it, PNG images compressed as much as possible, and no heroes for
+//	      games on the microSD card
+//
+// Options that are set keep their value, the profile only changes defaults.
+type deviceProfile struct {
+	sizeProfile string
+	// Shrink images bigger than the size profile.
+	shrink bool
+	// Removable storage is usually small and slow, its games get no hero.
+	skipRemovableHeroes bool
+}
+
+var deviceProfiles = map[string]deviceProfile{
+	"deck": {sizeProfile: "deck", shrink: true, skipRemovableHeroes: true},
+}
+
+func getDeviceProfile(opts *Options) (deviceProfile, error) {
+	if opts.Device == "" {
+		return deviceProfile{}, nil
+	}
+	profile, ok := deviceProfiles[strings.ToLower(opts.Device)]
+	if !ok {
+		return deviceProfile{}, errors.New("Unknown device " + opts.Device + ", must be deck")
+	}
+	return profile, nil
+}
+
+func validateDevice(opts *Options) error {
+	_, err := getDeviceProfile(opts)
+	return err
+}
+
+// Changes the defaults of the options to the ones of the device profile.
+func applyDeviceProfile(opts *Options) error {
+	profile, err := getDeviceProfile(opts)
+	if err != nil || opts.Device == "" {
+		return err
+	}
+	if opts.SizeProfile == "" {
+		opts.SizeProfile = profile.sizeProfile
+	}
+	if opts.PNGCompression == "default" {
+		opts.PNGCompression = "best"
+	}
+	opts.Optimize = true
+	return nil
+}
+
+// Tells if the artwork is left out for the game by the device profile.
+func skippedByDevice(opts *Options, game *Game, artStyle string) bool {
+	profile, _ := getDeviceProfile(opts)
+	return profile.skipRemovableHeroes && artStyle == "Hero" && game.OnRemovableStorage
+}
+
+// Directories removable storage is mounted in on Linux, where the Deck puts
+// its microSD card.
+var removableMountDirs = []string{"/run/media/", "/media/", "/mnt/"}
+
+// Marks the games installed in a Steam library on removable storage, by the
+// library folders of the Steam installation. Only known on Linux.
+func markRemovableStorage(installationDir string, games map[string]*Game) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	foldersBytes, err := steamFS.ReadFile(filepath.Join(installationDir, "steamapps", "libraryfolders.vdf"))
+	if err != nil {
+		return
+	}
+	folders, err := ParseTextVDF(foldersBytes)
+	if err != nil {
+		return
+	}
+	for _, folder := range folders.Get("libraryfolders").Children {
+		path := folder.String("path")
+		removable := false
+		for _, dir := range removableMountDirs {
+			removable = removable || strings.HasPrefix(path, dir)
+		}
+		if !removable {
+			continue
+		}
+		for _, app := range folder.Get("apps").Children {
+			if game, ok := games[app.Key]; ok {
+				game.OnRemovableStorage = true
+			}
+		}
+	}
+}
+
+// Shrinks the clean image of the game to the size of the art style, if the
+// device profile asks for it. Images are kept a little bigger than the size,
+// never smaller.
+func shrinkForDevice(game *Game, opts *Options, artStyleExtensions []string) error {
+	profile, err := getDeviceProfile(opts)
+	if err != nil || !profile.shrink || game.CleanImageBytes == nil || isAnimated(game.CleanImageBytes) {
+		return err
+	}
+	width, _ := strconv.Atoi(artStyleExtensions[3])
+	height, _ := strconv.Atoi(artStyleExtensions[4])
+	config, _, err := image.DecodeConfig(bytes.NewBuffer(game.CleanImageBytes))
+	if err != nil || width == 0 || height == 0 {
+		return err
+	}
+	// Covers the size, like Steam does with the image.
+	scale := math.Max(float64(width)/float64(config.Width), float64(height)/float64(config.Height))
+	if scale > 0.9 {
+		return nil
+	}
+
+	gameImage, _, err := image.Decode(bytes.NewBuffer(game.CleanImageBytes))
+	if err != nil {
+		return err
+	}
+	bounds := gameImage.Bounds()
+	shrunk := image.NewRGBA(image.Rect(0, 0, int(float64(bounds.Dx())*scale+0.5), int(float64(bounds.Dy())*scale+0.5)))
+	draw.CatmullRom.Scale(shrunk, shrunk.Bounds(), gameImage, bounds, draw.Src, nil)
+	game.CleanImageBytes, err = encodeImage(shrunk, game.ImageExt)
+	return err
+}
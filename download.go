@@ -1,18 +1,17 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"image"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // When all else fails, Google it. Uses the regular web interface. There are
@@ -25,7 +24,7 @@ var googleSearchResultPatterns = []string{`imgurl=(.+?\.(jpeg|jpg|png))&amp;imgr
 
 // Returns the first steam grid image URL found by Google search of a given
 // game name.
-func getGoogleImage(gameName string, artStyleExtensions []string) (string, error) {
+func getGoogleImage(ctx context.Context, gameName string, artStyleExtensions []string) (string, error) {
 	if gameName == "" {
 		return "", nil
 	}
@@ -33,7 +32,7 @@ func getGoogleImage(gameName string, artStyleExtensions []string) (string, error
 	url := fmt.Sprintf(googleSearchFormat, artStyleExtensions[5], artStyleExtensions[6]) + url.QueryEscape(gameName)
 
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -43,6 +42,10 @@ func getGoogleImage(gameName string, artStyleExtensions []string) (string, error
 	// Google will serve a simple HTML page without direct image links.
 	// So we have to lie.
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 6.3; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
+	// Unless we are polite, then Google's robots.txt forbids the search.
+	if !politeRequest(ctx, req) {
+		return "", nil
+	}
 	response, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -74,6 +77,7 @@ type SteamGridDBResponse struct {
 		Style string
 		Url string
 		Thumb string
+		Nsfw bool
 		Tags []string
 		Author struct {
 			Name string
@@ -96,20 +100,46 @@ type SteamGridDBSearchResponse struct {
 // Search SteamGridDB for cover image
 const SteamGridDBBaseURL = "https://www.steamgriddb.com/api/v2"
 
-func SteamGridDBGetRequest(url string, steamGridDBApiKey string) ([]byte, error) {
+func SteamGridDBGetRequest(ctx context.Context, url string, steamGridDBApiKey string) ([]byte, error) {
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", "Bearer " + steamGridDBApiKey)
+	var response *http.Response
+	for attempt := 0; ; attempt++ {
+		// Requests from the GUI go first, see priority.go, and slow down when
+		// the quota runs low, see quota.go.
+		err := waitForPriority(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = steamGridDBQuota.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer " + steamGridDBApiKey)
 
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
+		response, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		steamGridDBQuota.update(response.Header)
+		if response.StatusCode != 429 || attempt == maxRateLimitRetries {
+			break
+		}
+		response.Body.Close()
+		wait := retryAfter(response.Header, attempt)
+		fmt.Printf("SteamGridDB rate limit reached, waiting %v\n", wait.Round(time.Second))
+		if err = sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
 	}
 
-	if response.StatusCode == 401 {
+	if response.StatusCode == 429 {
+		response.Body.Close()
+		return nil, errors.New("SteamGridDB rate limit reached, try again later")
+	} else if response.StatusCode == 401 {
 		// Authorization token is missing or invalid
 		return nil, errors.New("401")
 	} else if response.StatusCode == 404 {
@@ -126,7 +156,8 @@ func SteamGridDBGetRequest(url string, steamGridDBApiKey string) ([]byte, error)
 	return responseBytes, nil
 }
 
-func getSteamGridDBImage(game *Game, artStyleExtensions []string, steamGridDBApiKey string, steamGridFilter string) (string, error) {
+// Returns the best rated SteamGridDB images for the game as candidates.
+func getSteamGridDBImages(ctx context.Context, game *Game, artStyleExtensions []string, steamGridDBApiKey string, steamGridFilter string, safeMode bool) ([]*Candidate, error) {
 	// Try for HQ, then for LQ
 	// It's possible to request both dimensions in one go but that'll give us scrambled results with no indicator which result has which size.
 	for i := 0; i < 3; i += 2 {
@@ -152,29 +183,29 @@ func getSteamGridDBImage(game *Game, artStyleExtensions []string, steamGridDBApi
 
 		// Skip requests with appID for custom games
 		if !game.Custom {
-			responseBytes, err = SteamGridDBGetRequest(url, steamGridDBApiKey)
+			responseBytes, err = SteamGridDBGetRequest(ctx, url, steamGridDBApiKey)
 		} else {
 			err = errors.New("404")
 		}
 
 		// Authorization token is missing or invalid
 	 	if err != nil && err.Error() == "401" {
-			return "", errors.New("SteamGridDB authorization token is missing or invalid")
+			return nil, errors.New("SteamGridDB authorization token is missing or invalid")
 		// Could not find game with that id
 		} else if err != nil && err.Error() == "404" {
 			// Try searching for the name…
 			url = SteamGridDBBaseURL + "/search/autocomplete/" + game.Name + filter
-			responseBytes, err = SteamGridDBGetRequest(url, steamGridDBApiKey)
+			responseBytes, err = SteamGridDBGetRequest(ctx, url, steamGridDBApiKey)
 			if err != nil && err.Error() == "401" {
-				return "", errors.New("SteamGridDB authorization token is missing or invalid")
+				return nil, errors.New("SteamGridDB authorization token is missing or invalid")
 			} else if err != nil {
-				return "", err
+				return nil, err
 			}
 
 			var jsonSearchResponse SteamGridDBSearchResponse
 			err = json.Unmarshal(responseBytes, &jsonSearchResponse)
 			if err != nil {
-				return "", errors.New("Best search match doesn't has a requested type or style")
+				return nil, errors.New("Best search match doesn't has a requested type or style")
 			}
 
 			SteamGridDBGameId := -1
@@ -184,31 +215,46 @@ func getSteamGridDBImage(game *Game, artStyleExtensions []string, steamGridDBApi
 			}
 
 			if SteamGridDBGameId == -1 {
-				return "", nil
+				return nil, nil
 			}
 
 
 			// …and get the url of the top result.
 			url = baseUrl + "/game/" + strconv.Itoa(SteamGridDBGameId) + filter
-			responseBytes, err = SteamGridDBGetRequest(url, steamGridDBApiKey)
+			responseBytes, err = SteamGridDBGetRequest(ctx, url, steamGridDBApiKey)
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 		} else if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		err = json.Unmarshal(responseBytes, &jsonResponse)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		if jsonResponse.Success && len(jsonResponse.Data) >= 1 {
-			return jsonResponse.Data[0].Url, nil
+			var candidates []*Candidate
+			for _, data := range jsonResponse.Data {
+				if len(candidates) == maxCandidatesPerSource {
+					break
+				}
+				if safeMode && isNSFW(data.Nsfw, data.Tags) {
+					continue
+				}
+				// Trust grows with the votes, but never reaches official artwork.
+				trust := 0.5
+				if data.Score > 0 {
+					trust = 0.5 + 0.4*float64(data.Score)/float64(data.Score+5)
+				}
+				candidates = append(candidates, &Candidate{URLs: []string{data.Url}, From: "SteamGridDB", Trust: trust})
+			}
+			return candidates, nil
 		}
 	}
 
-	return "", nil
+	return nil, nil
 }
 
 const IGDBImageURL = "https://images.igdb.com/igdb/image/upload/t_720p/%v.jpg"
@@ -228,14 +274,18 @@ type IGDBCover struct {
 	Image_id string
 }
 
-func IGDBPostRequest(url string, body string, IGDBApiKey string) ([]byte, error) {
+func IGDBPostRequest(ctx context.Context, url string, body string, IGDBApiKey string) ([]byte, error) {
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", url, strings.NewReader(body))
-	req.Header.Add("user-key", IGDBApiKey)
-	req.Header.Add("Accept", "application/json")
+	// Requests from the GUI go first, see priority.go.
+	if err := waitForPriority(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Add("user-key", IGDBApiKey)
+	req.Header.Add("Accept", "application/json")
 
 	response, err := client.Do(req)
 	if err != nil {
@@ -251,8 +301,8 @@ func IGDBPostRequest(url string, body string, IGDBApiKey string) ([]byte, error)
 	return responseBytes, nil
 }
 
-func getIGDBImage(gameName string, IGDBApiKey string) (string, error) {
-	responseBytes, err := IGDBPostRequest(IGDBGameURL, fmt.Sprintf(IGDBGameBody, gameName), IGDBApiKey)
+func getIGDBImage(ctx context.Context, gameName string, IGDBApiKey string) (string, error) {
+	responseBytes, err := IGDBPostRequest(ctx, IGDBGameURL, fmt.Sprintf(IGDBGameBody, gameName), IGDBApiKey)
 	if err != nil {
 		return "", err
 	}
@@ -267,7 +317,7 @@ func getIGDBImage(gameName string, IGDBApiKey string) (string, error) {
 		return "", nil
 	}
 
-	responseBytes, err = IGDBPostRequest(IGDBCoverURL, fmt.Sprintf(IGDBCoverBody, jsonGameResponse[0].Cover), IGDBApiKey)
+	responseBytes, err = IGDBPostRequest(ctx, IGDBCoverURL, fmt.Sprintf(IGDBCoverBody, jsonGameResponse[0].Cover), IGDBApiKey)
 	if err != nil {
 		return "", err
 	}
@@ -285,19 +335,37 @@ func getIGDBImage(gameName string, IGDBApiKey string) (string, error) {
 	return "", nil
 }
 
+// Does a GET request that is canceled with the context. Waits for requests
+// from the GUI first, see priority.go.
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	if err := waitForPriority(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
 // Tries to fetch a URL, returning the response only if it was positive.
-func tryDownload(url string) (*http.Response, error) {
-	response, err := http.Get(url)
+func tryDownload(ctx context.Context, url string) (*http.Response, error) {
+	return checkResponse(httpGet(ctx, url))
+}
+
+func checkResponse(response *http.Response, err error) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
 
 	if response.StatusCode == 404 {
 		// Some apps don't have an image and there's nothing we can do.
+		response.Body.Close()
 		return nil, nil
 	} else if response.StatusCode >= 400 {
 		// Other errors should be reported, though.
-		return nil, errors.New("Failed to download image " + url + ": " + response.Status)
+		response.Body.Close()
+		return nil, errors.New("Failed to download image " + response.Request.URL.String() + ": " + response.Status)
 	}
 
 	return response, nil
@@ -308,115 +376,142 @@ const akamaiURLFormat = `https://steamcdn-a.akamaihd.net/steam/apps/%v/`
 
 // The subreddit mentions this as primary, but I've found Akamai to contain
 // more images and answer faster.
-const steamCdnURLFormat = `cdn.akamai.steamstatic.com/steam/apps/%v/`
-
-// Tries to load the grid image for a game from a number of alternative
-// sources. Returns the final response received and a flag indicating if it was
-// from a Google search (useful because we want to log the lower quality
-// images).
-func getImageAlternatives(game *Game, artStyle string, artStyleExtensions []string, skipSteam bool, steamGridDBApiKey string, steamGridFilter string, IGDBApiKey string, skipGoogle bool) (response *http.Response, from string, err error) {
-	from = "steam server"
-	if !skipSteam {
-		response, err = tryDownload(fmt.Sprintf(akamaiURLFormat + artStyleExtensions[2], game.ID))
-		if err == nil && response != nil {
-			return
-		}
+const steamCdnURLFormat = `https://cdn.akamai.steamstatic.com/steam/apps/%v/`
 
-		response, err = tryDownload(fmt.Sprintf(steamCdnURLFormat + artStyleExtensions[2], game.ID))
-		if err == nil && response != nil {
-			return
-		}
+// Newer apps only have their library heroes and logos here.
+const storeAssetsURLFormat = `https://shared.akamai.steamstatic.com/store_item_assets/steam/apps/%v/`
+
+// Returns the sources to search for an artwork, in order of preference.
+// Sources left out are in the list as skipped, with the reason.
+func getCandidateSources(ctx context.Context, game *Game, artStyle string, artStyleExtensions []string, opts *Options) []candidateSource {
+	var sources []candidateSource
+	// Name-based sources search for the cleaned up name, see aliases.go.
+	searched := searchGame(game, opts)
+
+	// Media apps get generated art instead of game art.
+	if game.MediaType != "" && opts.Media == mediaCover {
+		return []candidateSource{mediaSource(game, artStyle, artStyleExtensions)}
 	}
 
-	url := ""
-	if steamGridDBApiKey != "" && url == "" {
-		from = "SteamGridDB"
-		url, err = getSteamGridDBImage(game, artStyleExtensions, steamGridDBApiKey, steamGridFilter)
-		if err != nil {
-			return
-		}
+	// Custom games and mods have no official artwork.
+	if opts.SkipSteam {
+		sources = append(sources, skippedSource("steam server", "skipsteam option"))
+	} else if game.Custom {
+		sources = append(sources, skippedSource("steam server", "not a Steam app"))
+	} else {
+		sources = append(sources, candidateSource{"steam server", func() ([]*Candidate, error) {
+			return []*Candidate{&Candidate{
+				URLs: []string{
+					fmt.Sprintf(akamaiURLFormat + artStyleExtensions[2], game.ID),
+					fmt.Sprintf(steamCdnURLFormat + artStyleExtensions[2], game.ID),
+					fmt.Sprintf(storeAssetsURLFormat + artStyleExtensions[2], game.ID),
+				},
+				From: "steam server",
+				Trust: 1,
+			}}, nil
+		}})
+	}
+
+	if opts.SteamGridDBApiKey == "" {
+		sources = append(sources, skippedSource("SteamGridDB", "no API key"))
+	} else {
+		sources = append(sources, candidateSource{"SteamGridDB", func() ([]*Candidate, error) {
+			return getSteamGridDBImages(ctx, searched, artStyleExtensions, opts.SteamGridDBApiKey, opts.steamGridFilter(), opts.SafeMode)
+		}})
 	}
 
 	// IGDB has mostly cover styles
-	if artStyle == "Cover" && IGDBApiKey != "" && url == "" {
-		from = "IGDB"
-		url, err = getIGDBImage(game.Name, IGDBApiKey)
-		if err != nil {
-			return
-		}
+	if artStyle == "Cover" && opts.IGDBApiKey != "" {
+		sources = append(sources, candidateSource{"IGDB", func() ([]*Candidate, error) {
+			url, err := getIGDBImage(ctx, searched.Name, opts.IGDBApiKey)
+			return urlCandidate(url, "IGDB", 0.5), err
+		}})
+	}
+
+	if providers := getProviders(opts); len(providers) > 0 {
+		sources = append(sources, candidateSource{"providers", func() ([]*Candidate, error) {
+			url, path, provider, err := getProviderImage(ctx, providers, game, artStyle, artStyleExtensions)
+			if path != "" {
+				return []*Candidate{&Candidate{Path: path, From: "provider " + providerName(provider), Trust: 0.5, Unmoderated: true}}, err
+			}
+			return unmoderated(urlCandidate(url, "provider " + providerName(provider), 0.5)), err
+		}})
 	}
 
-	// Skip for Covers, bad results
-	if !skipGoogle && artStyle == "Banner" && url == "" {
-		from = "search"
-		url, err = getGoogleImage(game.Name, artStyleExtensions)
-		if err != nil {
-			return
-		}
+	urlSources, _ := getURLSources(opts)
+	for _, source := range urlSources {
+		source := source
+		sources = append(sources, candidateSource{"url source", func() ([]*Candidate, error) {
+			url, err := getURLSourceImage(ctx, source, searched, artStyleExtensions)
+			return unmoderated(urlCandidate(url, "url source", 0.4)), err
+		}})
+	}
+
+	// Some community art is only found under the localized name.
+	if game.LocalizedName != "" {
+		sources = append(sources, localizedSources(ctx, game, artStyle, artStyleExtensions, opts)...)
 	}
 
-	response, err = tryDownload(url)
-	if err == nil && response != nil {
-		return
+	// Skip for Covers, bad results
+	if opts.SkipGoogle {
+		sources = append(sources, skippedSource("search", "skipgoogle option"))
+	} else if artStyle != "Banner" {
+		sources = append(sources, skippedSource("search", "only for banners"))
+	} else {
+		sources = append(sources, candidateSource{"search", func() ([]*Candidate, error) {
+			url, err := getGoogleImage(ctx, searched.Name, artStyleExtensions)
+			return unmoderated(urlCandidate(url, "search", 0)), err
+		}})
+		if game.LocalizedName != "" {
+			sources = append(sources, candidateSource{"search localized", func() ([]*Candidate, error) {
+				url, err := getGoogleImage(ctx, game.LocalizedName, artStyleExtensions)
+				return unmoderated(urlCandidate(url, "search (" + game.LocalizedName + ")", 0)), err
+			}})
+		}
 	}
 
-	return nil, "", nil
+	return sources
 }
 
 // DownloadImage tries to download the game images, saving it in game.ImageBytes. Returns
-// flags indicating if the operation succeeded and if the image downloaded was
-// from a search.
-func DownloadImage(gridDir string, game *Game, artStyle string, artStyleExtensions []string, skipSteam bool, steamGridDBApiKey string, steamGridFilter string, IGDBApiKey string, skipGoogle bool) (string, error) {
-	response, from, err := getImageAlternatives(game, artStyle, artStyleExtensions, skipSteam, steamGridDBApiKey, steamGridFilter, IGDBApiKey, skipGoogle)
-	if response == nil || err != nil {
-		return "", err
-	}
-
-	contentType := response.Header.Get("Content-Type")
-	urlExt := filepath.Ext(response.Request.URL.Path)
-	if contentType != "" {
-		game.ImageExt = "." + strings.Split(contentType, "/")[1]
-	} else if urlExt != "" {
-		game.ImageExt = urlExt
+// where the image was found, or "" if there was none.
+func DownloadImage(ctx context.Context, game *Game, artStyle string, artStyleExtensions []string, opts *Options) (string, error) {
+	chain := &game.SourceChain
+	sources := getCandidateSources(ctx, game, artStyle, artStyleExtensions, opts)
+
+	var candidates []*Candidate
+	var err error
+	if opts.BestPick {
+		candidates, err = findBestCandidates(ctx, sources, artStyle, artStyleExtensions, opts, chain)
 	} else {
-		// Steam is forgiving on image extensions.
-		game.ImageExt = "jpg"
-	}
-
-	if game.ImageExt == ".jpeg" {
-		// The new library ignores .jpeg
-		game.ImageExt = ".jpg"
-	} else if game.ImageExt == ".octet-stream" {
-		// Amazonaws (steamgriddb) gives us an .octet-stream
-		game.ImageExt = ".png"
+		// Keep looking for alternates after the first one, if requested.
+		candidates, err = findFirstCandidates(ctx, sources, artStyle, artStyleExtensions, opts, maxInt(opts.Alternates, 1), chain)
+	}
+	// The theme may have a placeholder for artworks nobody has.
+	if len(candidates) == 0 {
+		placeholder := themePlaceholder(game, artStyle, artStyleExtensions, opts)
+		if placeholder != nil && downloadCandidate(ctx, placeholder, artStyle, artStyleExtensions, opts) == nil {
+			candidates = []*Candidate{placeholder}
+		}
 	}
-
-	imageBytes, err := ioutil.ReadAll(response.Body)
-	response.Body.Close()
-
-	// catch false aspect ratios
-	image, _, err := image.Decode(bytes.NewBuffer(imageBytes))
-	if err != nil {
+	if len(candidates) == 0 {
 		return "", err
 	}
-	imageSize := image.Bounds().Max
-	if (artStyle == "Banner" && imageSize.X < imageSize.Y) {
-		return "", nil
-	} else if (artStyle == "Cover" && imageSize.X > imageSize.Y) {
-		return "", nil
-	}
-
-	game.ImageSource = from;
 
-	game.CleanImageBytes = imageBytes
-	return from, nil
+	candidate := candidates[0]
+	chain.add(candidate.From, sourceChosen, "")
+	game.Candidates = candidates
+	game.ImageExt = candidate.ImageExt
+	game.ImageSource = candidate.From
+	game.CleanImageBytes = candidate.ImageBytes
+	return candidate.From, err
 }
 
 // Get game name from SteamDB as last resort.
 const steamDBFormat = `https://steamdb.info/app/%v`
 
-func GetGameName(gameId string) string {
-	response, err := tryDownload(fmt.Sprintf(steamDBFormat, gameId))
+func GetGameName(ctx context.Context, gameId string) string {
+	response, err := scrapeDownload(ctx, fmt.Sprintf(steamDBFormat, gameId))
 	if err != nil || response == nil {
 		return ""
 	}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Naming templates of other frontends, by art style name extension. The
+// templates are relative to the directory given for the export.
+var exportLayouts = map[string]map[string]string{
+	// Playnite has Cover and Background images, logos are used by the Extra
+	// Metadata Loader add-on.
+	"playnite": map[string]string{
+		".banner": "{name}/Banner",
+		".cover":  "{name}/Cover",
+		".hero":   "{name}/Background",
+		".logo":   "{name}/Logo",
+	},
+	// LaunchBox looks for images by title in Images/<platform>/<image type>.
+	"launchbox": map[string]string{
+		".banner": "Images/Windows/Banner/{name}-01",
+		".cover":  "Images/Windows/Box - Front/{name}-01",
+		".hero":   "Images/Windows/Fanart - Background/{name}-01",
+		".logo":   "Images/Windows/Clear Logo/{name}-01",
+	},
+}
+
+// An export target: a frontend layout and the directory to write it to.
+type export struct {
+	layout string
+	dir    string
+}
+
+// Parses the exports option, formatted as "playnite=DIR,launchbox=DIR".
+func getExports(opts *Options) ([]export, error) {
+	var exports []export
+	for _, entry := range strings.Split(opts.Export, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		layout := strings.ToLower(strings.TrimSpace(parts[0]))
+		if _, ok := exportLayouts[layout]; !ok || len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			var names []string
+			for name := range exportLayouts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, errors.New("Invalid export " + entry + ", expected LAYOUT=DIR with one of these layouts: " + strings.Join(names, ", "))
+		}
+		exports = append(exports, export{layout, strings.TrimSpace(parts[1])})
+	}
+	return exports, nil
+}
+
+// Writes the final image for all configured frontend exports.
+func writeExports(exports []export, game *Game, artStyleExtensions []string) error {
+	for _, target := range exports {
+		template, ok := exportLayouts[target.layout][artStyleExtensions[1]]
+		if !ok {
+			continue
+		}
+		exportPath := filepath.Join(target.dir, expandNameTemplate(template, game, artStyleExtensions, "")+game.ImageExt)
+		err := writeRunOutput(exportPath, game.OverlayImageBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Browser extensions, like one adding an "Apply to Steam" button next to the
+// images of art sites, send the image the user picked to the serve command:
+//
+//	POST /api/extension/apply
+//	     Authorization: Bearer <token>
+//	     {"game": "620", "type": "cover", "url": "https://...", "user": "1234"}
+//	     {"users": ["me"], "source": "cdn.example"}
+//
+// The type is banner, cover, hero or logo, and the user, by ID or name, is
+// optional: without it every user with the game gets the image, like the
+// steamgrid: links of uri.go. Other endpoints are unchanged by it.
+//
+// Any web page can send requests to localhost, so the endpoint needs the
+// token, made on the first start of the server in the file set with
+// -extension-token. Paste it in the settings of the extension. Pages of
+// extensions may call it from the browser, other pages only get a 403.
+type extensionApplyRequest struct {
+	Game string `json:"game"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	User string `json:"user"`
+}
+
+// Token file next to the executable, like the config file.
+func defaultExtensionTokenPath() string {
+	return filepath.Join(filepath.Dir(os.Args[0]), "steamgrid-extension-token")
+}
+
+// Reads the token, making a random one if the file doesn't exist yet.
+func loadExtensionToken(path string) (string, error) {
+	tokenBytes, err := ioutil.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(tokenBytes))
+		if token == "" {
+			return "", errors.New("The extension token file " + path + " is empty, delete it to make a new token")
+		}
+		return token, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	// Only readable by the user, it allows changing the artwork.
+	err = ioutil.WriteFile(path, []byte(token+"\n"), 0600)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Pages of browser extensions, which can't be made by web sites.
+func isExtensionOrigin(origin string) bool {
+	for _, scheme := range []string{"chrome-extension://", "moz-extension://", "safari-web-extension://"} {
+		if strings.HasPrefix(origin, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Answers with 401 unless the request has the token.
+func (s *server) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.extensionToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.extensionToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("Missing or wrong token, see the extension token file of steamgrid serve"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *server) handleExtensionApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Use POST"))
+		return
+	}
+	var request extensionApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	link := applyLink{request.Game, request.Type, request.URL, request.User}
+	if err := link.check(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	users, games, artStyle, err := s.linkTargets(link)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	ctx, done := withPriority(r.Context())
+	defer done()
+	candidate, err := s.downloadLinkImage(ctx, link, artStyle)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	applied := []string{}
+	for i, user := range users {
+		err = s.applyCandidate(ctx, user, games[i], artStyle, candidate)
+		if err == errGameLocked {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		applied = append(applied, user.Name)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": applied, "source": candidate.From})
+}
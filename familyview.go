@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Family View settings of a user, from localconfig.vdf:
+//
+//	"UserLocalConfigStore" { "ParentalSettings" { "settings" "<hex>" } }
+//
+// The settings are a hex encoded ParentalSettings protobuf message, of which
+// only these fields are read:
+//
+//	repeated ParentalApp applist_base = 4;
+//	repeated ParentalApp applist_custom = 5;
+//	optional bool is_enabled = 9;
+//
+// with ParentalApp { uint32 appid = 1; bool is_allowed = 2; }.
+type familyView struct {
+	// Steam games allowed in Family View. Empty if the library isn't
+	// restricted.
+	allowed map[string]bool
+}
+
+// Returns the Family View settings of the user, or nil if it's off.
+func getFamilyView(user User) (*familyView, error) {
+	localConfBytes, err := steamFS.ReadFile(filepath.Join(user.Dir, "config", "localconfig.vdf"))
+	if err != nil {
+		return nil, err
+	}
+	localConf, err := ParseTextVDF(localConfBytes)
+	if err != nil {
+		return nil, err
+	}
+	settings := localConf.String("UserLocalConfigStore", "ParentalSettings", "settings")
+	if settings == "" {
+		return nil, nil
+	}
+	settingsBytes, err := hex.DecodeString(settings)
+	if err != nil {
+		return nil, errors.New("Invalid Family View settings of " + user.Name + ": " + err.Error())
+	}
+	return parseParentalSettings(settingsBytes)
+}
+
+func parseParentalSettings(message []byte) (*familyView, error) {
+	view := &familyView{allowed: map[string]bool{}}
+	enabled := false
+	err := readProtobuf(message, func(field int, value uint64, data []byte) error {
+		switch field {
+		case 4, 5:
+			var appID uint64
+			allowed := false
+			err := readProtobuf(data, func(field int, value uint64, data []byte) error {
+				if field == 1 {
+					appID = value
+				} else if field == 2 {
+					allowed = value != 0
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if allowed {
+				view.allowed[strconv.FormatUint(appID, 10)] = true
+			}
+		case 9:
+			enabled = value != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("Invalid Family View settings: " + err.Error())
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return view, nil
+}
+
+// Calls fn for every field of a protobuf message, with the value of numeric
+// fields or the bytes of length delimited ones.
+func readProtobuf(message []byte, fn func(field int, value uint64, data []byte) error) error {
+	readVarint := func() (uint64, error) {
+		var value uint64
+		for shift := uint(0); shift < 64; shift += 7 {
+			if len(message) == 0 {
+				return 0, errors.New("unexpected end of message")
+			}
+			b := message[0]
+			message = message[1:]
+			value |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				return value, nil
+			}
+		}
+		return 0, errors.New("varint too long")
+	}
+
+	for len(message) > 0 {
+		key, err := readVarint()
+		if err != nil {
+			return err
+		}
+		field, wireType := int(key>>3), key&7
+		var value uint64
+		var data []byte
+		switch wireType {
+		case 0:
+			value, err = readVarint()
+		case 1, 5:
+			size := 8
+			if wireType == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return errors.New("unexpected end of message")
+			}
+			for i := size - 1; i >= 0; i-- {
+				value = value<<8 | uint64(message[i])
+			}
+			message = message[size:]
+		case 2:
+			var length uint64
+			length, err = readVarint()
+			if err == nil && length > uint64(len(message)) {
+				err = errors.New("unexpected end of message")
+			}
+			if err == nil {
+				data, message = message[:length], message[length:]
+			}
+		default:
+			return fmt.Errorf("unknown wire type %v", wireType)
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(field, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restricts the options for a user in Family View: safe mode, only the art
+// styles of the familyviewtypes option and only the allowed games. Non-Steam
+// games aren't covered by Family View and are kept.
+func applyFamilyView(opts *Options, view *familyView, artStyles map[string][]string, games map[string]*Game) (*Options, map[string][]string, error) {
+	restricted := *opts
+	if opts.FamilyView {
+		restricted.SafeMode = true
+		if len(view.allowed) > 0 {
+			for id, game := range games {
+				if !game.Custom && !view.allowed[id] {
+					delete(games, id)
+				}
+			}
+		}
+	}
+
+	allowedStyles, err := familyViewArtStyles(opts, artStyles)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &restricted, allowedStyles, nil
+}
+
+// Returns the art styles of the familyviewtypes option.
+func familyViewArtStyles(opts *Options, artStyles map[string][]string) (map[string][]string, error) {
+	if opts.FamilyViewTypes == "" {
+		return artStyles, nil
+	}
+	allowedStyles := make(map[string][]string)
+	for _, value := range strings.Split(opts.FamilyViewTypes, ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		artStyle, ok := artTypeNames[value]
+		if !ok {
+			return nil, errors.New("Unknown Family View type " + value + ", must be banner, portrait, hero or logo")
+		}
+		if extensions, ok := artStyles[artStyle]; ok {
+			allowedStyles[artStyle] = extensions
+		}
+	}
+	return allowedStyles, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// How images are written, set from the options at the start of a run.
+var fileOptions struct {
+	// Scratch space for files being written, empty for the directory of the
+	// file itself.
+	tmpDir string
+	// Flush files to disk before going on, so a power loss doesn't leave a
+	// corrupted grid behind. Slower, especially on SD cards.
+	fsync bool
+}
+
+// Writes a local file, like a report, an export or the config, through a
+// temporary file. Files in the Steam directory are written with
+// steamFS.WriteFile instead, which may be simulated or on another machine, see
+// steamfs.go.
+func writeFile(path string, data []byte) error {
+	return writeFileAtomic(path, data)
+}
+
+// Writes a local file only the owner can read, like a config file that may
+// have API keys.
+func writePrivateFile(path string, data []byte) error {
+	return writeFileMode(path, data, 0600)
+}
+
+// Writes a file a run makes besides the Steam files, like an output copy, an
+// export or a report, making its directory. Simulated runs keep it in memory
+// with the Steam files, and list it with them at the end.
+func writeRunOutput(path string, data []byte) error {
+	if simulation, ok := steamFS.(*memoryFS); ok {
+		if err := simulation.MkdirAll(filepath.Dir(path)); err != nil {
+			return err
+		}
+		return simulation.WriteFile(path, data)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// Writes a file through a temporary file, so a stopped run doesn't leave half
+// written images behind. The temporary file is in the scratch directory if
+// configured, which may be on a faster drive than the Steam library.
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileMode(path, data, 0644)
+}
+
+func writeFileMode(path string, data []byte, mode os.FileMode) error {
+	dir := fileOptions.tmpDir
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	tmp, err := ioutil.TempFile(dir, ".steamgrid-*.tmp")
+	if err != nil {
+		return err
+	}
+	// Temporary files are only readable by the owner, written files get the
+	// mode.
+	err = tmp.Chmod(mode)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil && fileOptions.fsync {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil && fileOptions.tmpDir != "" {
+		// Different drives, the file has to be copied. Copied next to the
+		// target first, a copy cut short would be half written too.
+		err = copyNextTo(tmp.Name(), path, mode)
+	}
+	os.Remove(tmp.Name())
+	if err == nil && fileOptions.fsync {
+		syncDir(filepath.Dir(path))
+	}
+	return err
+}
+
+// Flushes the directory entries, so a renamed file survives a power loss.
+// Not supported on Windows, where the rename is durable on its own.
+func syncDir(dir string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+// Copies a file to a temporary file in the directory of path and renames it
+// into place.
+func copyNextTo(from string, path string, mode os.FileMode) error {
+	local, err := ioutil.TempFile(filepath.Dir(path), ".steamgrid-*.tmp")
+	if err != nil {
+		return err
+	}
+	local.Close()
+	err = copyFile(from, local.Name())
+	if err == nil {
+		err = os.Chmod(local.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(local.Name(), path)
+	}
+	if err != nil {
+		os.Remove(local.Name())
+	}
+	return err
+}
+
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	if err == nil && fileOptions.fsync {
+		err = target.Sync()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Color filters applied to every image after the overlays, so artwork from
+// many different sources looks like it belongs together. They are given as a
+// comma separated list and applied in that order:
+//
+//	desaturate               gray scale
+//	desaturate=0.5           halfway to gray scale
+//	duotone=#1b2838:#66c0f4  dark parts to the first color, light ones to the second
+//	normalize                stretch the brightness to the full range
+//	brightness=1.1           multiply the brightness
+//	contrast=1.2             multiply the contrast around the middle gray
+//
+// Logos are left alone, they are drawn over the hero. So are animated images.
+type colorFilter func(img *image.NRGBA)
+
+func getColorFilters(opts *Options) ([]colorFilter, error) {
+	var filters []colorFilter
+	for _, part := range strings.Split(opts.Filter, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := strings.ToLower(part), ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = strings.ToLower(strings.TrimSpace(part[:i])), strings.TrimSpace(part[i+1:])
+		}
+
+		number := func(fallback float64) (float64, error) {
+			if value == "" {
+				return fallback, nil
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				return 0, errors.New("Invalid value " + value + " of filter " + name + ", must be a positive number")
+			}
+			return parsed, nil
+		}
+		switch name {
+		case "desaturate":
+			amount, err := number(1)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, func(img *image.NRGBA) {
+				mapPixels(img, func(pixel color.NRGBA) color.NRGBA {
+					gray := luminance(pixel)
+					return color.NRGBA{mixChannel(pixel.R, gray, amount), mixChannel(pixel.G, gray, amount), mixChannel(pixel.B, gray, amount), pixel.A}
+				})
+			})
+		case "duotone":
+			colors := strings.Split(value, ":")
+			if len(colors) != 2 {
+				return nil, errors.New("Invalid duotone " + value + ", must be two colors like #1b2838:#66c0f4")
+			}
+			dark, err := parseHexColor(colors[0])
+			if err != nil {
+				return nil, err
+			}
+			light, err := parseHexColor(colors[1])
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, func(img *image.NRGBA) {
+				mapPixels(img, func(pixel color.NRGBA) color.NRGBA {
+					amount := float64(luminance(pixel)) / 255
+					return color.NRGBA{mixChannel(dark.R, light.R, amount), mixChannel(dark.G, light.G, amount), mixChannel(dark.B, light.B, amount), pixel.A}
+				})
+			})
+		case "normalize":
+			filters = append(filters, normalizeBrightness)
+		case "brightness", "contrast":
+			factor, err := number(1)
+			if err != nil {
+				return nil, err
+			}
+			contrast := name == "contrast"
+			filters = append(filters, func(img *image.NRGBA) {
+				mapPixels(img, func(pixel color.NRGBA) color.NRGBA {
+					adjust := func(channel uint8) uint8 {
+						if contrast {
+							return clampChannel((float64(channel)-128)*factor + 128)
+						}
+						return clampChannel(float64(channel) * factor)
+					}
+					return color.NRGBA{adjust(pixel.R), adjust(pixel.G), adjust(pixel.B), pixel.A}
+				})
+			})
+		default:
+			return nil, errors.New("Unknown filter " + name + ", must be desaturate, duotone, normalize, brightness or contrast")
+		}
+	}
+	return filters, nil
+}
+
+// Applies the color filters of the options to the image with overlays.
+func applyColorFilters(game *Game, opts *Options, artStyle string) error {
+	if opts.Filter == "" || artStyle == "Logo" {
+		return nil
+	}
+	filters, err := getColorFilters(opts)
+	if err != nil || len(filters) == 0 {
+		return err
+	}
+	imageBytes := game.OverlayImageBytes
+	if imageBytes == nil {
+		imageBytes = game.CleanImageBytes
+	}
+	if imageBytes == nil {
+		return nil
+	}
+	if isAnimated(imageBytes) {
+		return nil
+	}
+	gameImage, _, err := image.Decode(bytes.NewBuffer(imageBytes))
+	if err != nil {
+		return err
+	}
+	game.OverlayImageBytes, err = encodeImage(filterImage(gameImage, filters), game.ImageExt)
+	return err
+}
+
+// Applies the filters in order to a copy of the image.
+func filterImage(gameImage image.Image, filters []colorFilter) *image.NRGBA {
+	bounds := gameImage.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), gameImage, bounds.Min, draw.Src)
+	for _, filter := range filters {
+		filter(result)
+	}
+	return result
+}
+
+// Stretches the brightness so the darkest and lightest percent of the pixels
+// become black and white.
+func normalizeBrightness(img *image.NRGBA) {
+	var histogram [256]int
+	total := 0
+	mapPixels(img, func(pixel color.NRGBA) color.NRGBA {
+		if pixel.A > 0 {
+			histogram[luminance(pixel)]++
+			total++
+		}
+		return pixel
+	})
+	if total == 0 {
+		return
+	}
+	percentile := func(fraction float64) int {
+		target := int(fraction * float64(total))
+		values := make([]int, 256)
+		sum := 0
+		for i, count := range histogram {
+			sum += count
+			values[i] = sum
+		}
+		return sort.SearchInts(values, target+1)
+	}
+	low, high := percentile(0.01), percentile(0.99)
+	if high <= low {
+		return
+	}
+	scale := 255 / float64(high-low)
+	mapPixels(img, func(pixel color.NRGBA) color.NRGBA {
+		stretch := func(channel uint8) uint8 {
+			return clampChannel((float64(channel) - float64(low)) * scale)
+		}
+		return color.NRGBA{stretch(pixel.R), stretch(pixel.G), stretch(pixel.B), pixel.A}
+	})
+}
+
+func mapPixels(img *image.NRGBA, f func(pixel color.NRGBA) color.NRGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.SetNRGBA(x, y, f(img.NRGBAAt(x, y)))
+		}
+	}
+}
+
+// Perceived brightness of a pixel, 0 to 255.
+func luminance(pixel color.NRGBA) uint8 {
+	return clampChannel(0.299*float64(pixel.R) + 0.587*float64(pixel.G) + 0.114*float64(pixel.B))
+}
+
+// Goes from a to b by the given amount, 0 to 1.
+func mixChannel(a uint8, b uint8, amount float64) uint8 {
+	return clampChannel(float64(a) + (float64(b)-float64(a))*math.Min(amount, 1))
+}
+
+func clampChannel(value float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(value))))
+}
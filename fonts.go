@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Text of the built-in badges and the generated covers is drawn with the Go
+// Bold font, which comes with the program. A TTF or OTF font of the user goes
+// first, and characters missing in both, like emoji, are taken from an emoji
+// font. Only fonts with outlines work: color emoji fonts made of bitmaps,
+// like Noto Color Emoji or Apple Color Emoji, can't be drawn.
+
+// Places of emoji fonts with outlines, used if none is given.
+var systemEmojiFonts = map[string][]string{
+	"windows": {`C:\Windows\Fonts\seguiemj.ttf`, `C:\Windows\Fonts\seguisym.ttf`},
+	"linux": {
+		"/usr/share/fonts/truetype/noto/NotoEmoji-Regular.ttf",
+		"/usr/share/fonts/noto/NotoEmoji-Regular.ttf",
+		"/usr/share/fonts/truetype/ancient-scripts/Symbola_hint.ttf",
+		"/usr/share/fonts/TTF/Symbola.ttf",
+	},
+}
+
+// Fonts in the order they are tried for each character. Set from the options
+// at the start of a run, or with the defaults on first use.
+var textFonts struct {
+	sync.Mutex
+	fonts []*sfnt.Font
+}
+
+// Loads the fonts of the options. An empty path is the default.
+func loadTextFonts(opts *Options) error {
+	var fonts []*sfnt.Font
+	if opts.Font != "" {
+		userFont, err := loadFontFile(opts.Font)
+		if err != nil {
+			return err
+		}
+		fonts = append(fonts, userFont)
+	}
+	defaultFont, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return err
+	}
+	fonts = append(fonts, defaultFont)
+
+	if opts.EmojiFont != "" {
+		emojiFont, err := loadFontFile(opts.EmojiFont)
+		if err != nil {
+			return err
+		}
+		fonts = append(fonts, emojiFont)
+	} else {
+		for _, path := range systemEmojiFonts[runtime.GOOS] {
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if emojiFont, err := loadFontFile(path); err == nil {
+				fonts = append(fonts, emojiFont)
+				break
+			}
+		}
+	}
+
+	textFonts.Lock()
+	textFonts.fonts = fonts
+	textFonts.Unlock()
+	return nil
+}
+
+// Reads a TTF or OTF font, or the first font of a collection.
+func loadFontFile(path string) (*sfnt.Font, error) {
+	fontBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := opentype.Parse(fontBytes)
+	if err == nil {
+		return parsed, nil
+	}
+	collection, collectionErr := opentype.ParseCollection(fontBytes)
+	if collectionErr != nil || collection.NumFonts() == 0 {
+		return nil, errors.New("Can't read the font " + filepath.Base(path) + ": " + err.Error())
+	}
+	return collection.Font(0)
+}
+
+func getTextFonts() []*sfnt.Font {
+	textFonts.Lock()
+	fonts := textFonts.fonts
+	textFonts.Unlock()
+	if fonts == nil {
+		if err := loadTextFonts(&Options{}); err != nil {
+			return nil
+		}
+		return getTextFonts()
+	}
+	return fonts
+}
+
+// A face that draws every character with the first font that has it. Not
+// safe for concurrent use, like the faces it's made of.
+type fallbackFace struct {
+	fonts  []*sfnt.Font
+	faces  []font.Face
+	buffer sfnt.Buffer
+}
+
+func newFallbackFace(size float64) (*fallbackFace, error) {
+	fonts := getTextFonts()
+	if len(fonts) == 0 {
+		return nil, errors.New("No font to draw text with")
+	}
+	face := &fallbackFace{fonts: fonts}
+	for _, textFont := range fonts {
+		opentypeFace, err := opentype.NewFace(textFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+		face.faces = append(face.faces, opentypeFace)
+	}
+	return face, nil
+}
+
+func (face *fallbackFace) pick(r rune) font.Face {
+	for i, textFont := range face.fonts {
+		if index, err := textFont.GlyphIndex(&face.buffer, r); err == nil && index != 0 {
+			return face.faces[i]
+		}
+	}
+	return face.faces[0]
+}
+
+func (face *fallbackFace) Close() error {
+	for _, f := range face.faces {
+		f.Close()
+	}
+	return nil
+}
+
+func (face *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return face.pick(r).Glyph(dot, r)
+}
+
+func (face *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return face.pick(r).GlyphBounds(r)
+}
+
+func (face *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return face.pick(r).GlyphAdvance(r)
+}
+
+func (face *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	first := face.pick(r0)
+	if first != face.pick(r1) {
+		return 0
+	}
+	return first.Kern(r0, r1)
+}
+
+func (face *fallbackFace) Metrics() font.Metrics {
+	return face.faces[0].Metrics()
+}
+
+// Draws a line of text about the given height in pixels, on a transparent
+// image just big enough for it. Returns nil for empty text.
+func renderText(text string, height int, textColor color.Color) *image.RGBA {
+	if text == "" || height <= 0 {
+		return nil
+	}
+	face, err := newFallbackFace(float64(height))
+	if err != nil {
+		return nil
+	}
+	// The font size is the size of the letters, the line is a bit higher.
+	metrics := face.Metrics()
+	lineHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	if lineHeight > height {
+		face.Close()
+		face, err = newFallbackFace(math.Max(1, float64(height)*float64(height)/float64(lineHeight)))
+		if err != nil {
+			return nil
+		}
+		metrics = face.Metrics()
+	}
+	defer face.Close()
+
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		return nil
+	}
+	line := image.NewRGBA(image.Rect(0, 0, width, (metrics.Ascent + metrics.Descent).Ceil()))
+	drawer := font.Drawer{
+		Dst:  line,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	drawer.DrawString(text)
+	return line
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// With the frames option, banners and covers of games in categories and
+// collections get a colored frame, drawn on the fly, so no overlay images are
+// needed:
+//
+//	--frames all
+//	--frames "favorite=#ffcc00,co-op,backlog=#4080ff"
+//
+// "all" frames every category, or only the listed ones are. A color after =
+// is used for the category, others get a color made from their name, the
+// same on every run. Categories with an overlay keep it instead. Games in
+// several of them get nested frames, in the order of their categories.
+
+// Set from the options at the start of a run.
+var frameSettings struct {
+	enabled bool
+	all     bool
+	// By overlay name, with ok false for a color from the name.
+	colors map[string]frameColor
+}
+
+type frameColor struct {
+	color color.NRGBA
+	ok    bool
+}
+
+// At most this many frames are nested, more would cover the picture.
+const maxFrames = 4
+
+// Frames by art style and combination of colors, each one is drawn once.
+var frameOverlays sync.Map
+
+func parseFrames(value string) (all bool, colors map[string]frameColor, err error) {
+	colors = map[string]frameColor{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.ToLower(entry) == "all" {
+			all = true
+			continue
+		}
+		name, hex := entry, ""
+		if equals := strings.Index(entry, "="); equals != -1 {
+			name, hex = strings.TrimSpace(entry[:equals]), entry[equals+1:]
+		}
+		if name == "" {
+			return false, nil, errors.New("Missing category before = in frames " + value)
+		}
+		frame := frameColor{}
+		if hex != "" {
+			frame.color, err = parseHexColor(hex)
+			if err != nil {
+				return false, nil, err
+			}
+			frame.ok = true
+		}
+		colors[overlayName(name)] = frame
+	}
+	return all, colors, nil
+}
+
+func validateFrames(opts *Options) error {
+	_, _, err := parseFrames(opts.Frames)
+	return err
+}
+
+// Color of a category made from its name: a bright hue picked by the hash.
+func hashedFrameColor(name string) color.NRGBA {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	hue := float64(hash.Sum32()%360) / 60
+	// HSV with saturation 0.75 and value 0.95.
+	value, chroma := 0.95, 0.95*0.75
+	x := chroma * (1 - math.Abs(math.Mod(hue, 2)-1))
+	var r, g, b float64
+	switch int(hue) {
+	case 0:
+		r, g = chroma, x
+	case 1:
+		r, g = x, chroma
+	case 2:
+		g, b = chroma, x
+	case 3:
+		g, b = x, chroma
+	case 4:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+	m := value - chroma
+	return color.NRGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 255}
+}
+
+// Colors of the frames of a game: the categories without an overlay that
+// get a frame, once each.
+func frameColors(tags []string, overlays map[string]image.Image, artStyleExtensions []string) []color.NRGBA {
+	var colors []color.NRGBA
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		name := overlayName(tag)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, ok := overlays[name+artStyleExtensions[1]]; ok {
+			continue
+		}
+		frame, listed := frameSettings.colors[name]
+		if !listed && !frameSettings.all {
+			continue
+		}
+		if !frame.ok {
+			frame.color = hashedFrameColor(name)
+		}
+		colors = append(colors, frame.color)
+		if len(colors) == maxFrames {
+			break
+		}
+	}
+	return colors
+}
+
+// The frame overlay of a game, at the size of the art style, or nil if it
+// gets none. Only banners and covers have frames, heroes and logos have no
+// edge to frame.
+func frameOverlay(tags []string, overlays map[string]image.Image, artStyleExtensions []string) image.Image {
+	if !frameSettings.enabled || (artStyleExtensions[1] != ".banner" && artStyleExtensions[1] != ".cover") {
+		return nil
+	}
+	colors := frameColors(tags, overlays, artStyleExtensions)
+	if len(colors) == 0 {
+		return nil
+	}
+	width, _ := strconv.Atoi(artStyleExtensions[3])
+	height, _ := strconv.Atoi(artStyleExtensions[4])
+	key := artStyleExtensions[1] + " " + strconv.Itoa(width) + "x" + strconv.Itoa(height)
+	for _, c := range colors {
+		key += " " + colorHex(c)
+	}
+	if cached, ok := frameOverlays.Load(key); ok {
+		return cached.(image.Image)
+	}
+	frame := drawFrames(width, height, colors)
+	frameOverlays.Store(key, frame)
+	return frame
+}
+
+func colorHex(c color.NRGBA) string {
+	return strconv.FormatUint(uint64(c.R)<<24|uint64(c.G)<<16|uint64(c.B)<<8|uint64(c.A), 16)
+}
+
+// Draws nested frames over a transparent image, the first color outside.
+func drawFrames(width int, height int, colors []color.NRGBA) *image.RGBA {
+	thickness := width
+	if height < width {
+		thickness = height
+	}
+	thickness /= 40
+	if thickness < 3 {
+		thickness = 3
+	}
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, c := range colors {
+		outer := frame.Bounds().Inset(i * thickness)
+		inner := outer.Inset(thickness)
+		if inner.Empty() {
+			break
+		}
+		fill := image.NewUniform(c)
+		for _, side := range []image.Rectangle{
+			image.Rect(outer.Min.X, outer.Min.Y, outer.Max.X, inner.Min.Y),
+			image.Rect(outer.Min.X, inner.Max.Y, outer.Max.X, outer.Max.Y),
+			image.Rect(outer.Min.X, inner.Min.Y, inner.Min.X, inner.Max.Y),
+			image.Rect(inner.Max.X, inner.Min.Y, outer.Max.X, inner.Max.Y),
+		} {
+			draw.Draw(frame, side, fill, image.ZP, draw.Src)
+		}
+	}
+	return frame
+}
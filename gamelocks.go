@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Users and other tools can lock the artwork of a game, so SteamGrid never
+// changes it: no downloads, overlays, backups, alternates, relinking or
+// pruning. Either for the whole game, with a file named after it in the grid
+// directory:
+//
+//	grid/620.lock
+//
+// or for one artwork, with "locked": true in its entry of the manifest.
+const gameLockExt = ".lock"
+
+var errGameLocked = errors.New("The artwork of this game is locked")
+
+type gameLocks struct {
+	// By game ID, from the lock files.
+	games map[string]bool
+	// By game ID and ID extension, from the manifest.
+	artworks map[string]bool
+	// Names of the locked games known from the manifest, by game ID.
+	names map[string]string
+}
+
+func loadGameLocks(gridDir string) gameLocks {
+	locks := gameLocks{games: map[string]bool{}, artworks: map[string]bool{}, names: map[string]string{}}
+	files, _ := steamFS.ReadDir(gridDir)
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), gameLockExt)
+		if !file.IsDir() && id != file.Name() && isValidGameID(id) {
+			locks.games[id] = true
+		}
+	}
+	for key, entry := range loadManifest(gridDir).Artworks {
+		if entry.Locked {
+			locks.artworks[key] = true
+		}
+		if entry.Locked || locks.games[entry.ID] {
+			locks.names[entry.ID] = entry.Name
+		}
+	}
+	return locks
+}
+
+// Whether the artwork is locked. Without art style, whether the whole game
+// is.
+func (locks gameLocks) has(gameID string, artStyleExtensions []string) bool {
+	if locks.games[gameID] {
+		return true
+	}
+	return artStyleExtensions != nil && locks.artworks[gameID+artStyleExtensions[0]]
+}
+
+// Whether any artwork of the game is locked.
+func (locks gameLocks) hasAny(gameID string) bool {
+	_, ok := locks.names[gameID]
+	return ok || locks.games[gameID]
+}
+
+func isLocked(gridDir string, game *Game, artStyleExtensions []string) bool {
+	return loadGameLocks(gridDir).has(game.ID, artStyleExtensions)
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"hash/crc32"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Game in a steam library. May or may not be installed.
@@ -26,8 +29,28 @@ type Game struct {
 	OverlayImageBytes []byte
 	// Description of where the image was found (backup, official, search).
 	ImageSource string
-	// Is custom shortcut?
+	// Is custom shortcut, Source mod or other ID without official artwork?
+	// These are searched by name only.
 	Custom bool
+	// All images found for the current artwork, the chosen one first.
+	Candidates []*Candidate
+	// Installed on a microSD card or other removable storage, see device.go.
+	OnRemovableStorage bool
+	// Target of non-Steam shortcuts, to follow them when renamed. See
+	// relink.go.
+	Shortcut *shortcutRecord
+	// Sources tried for the current artwork, see sourcechain.go.
+	SourceChain sourceChain
+	// Hash of the name and tags in the library before the run added any, see
+	// update.go.
+	LibraryHash string
+	// When the game was last played, zero if never or unknown.
+	LastPlayed time.Time
+	// Name in the language of the options, if different. See localnames.go.
+	LocalizedName string
+	// "Soundtrack" or "Video" for media apps, if the media option is set.
+	// See media.go.
+	MediaType string
 }
 
 // Pattern of game declarations in the public profile. It's actually JSON
@@ -37,8 +60,8 @@ const profileGamePattern = `\{"appid":\s*(\d+),\s*"name":\s*"(.+?)"`
 // Fetches the list of games from the public user profile. This is better than
 // looking locally because the profiles give the full game name, which can be
 // used for image searches later on.
-func addGamesFromProfile(user User, games map[string]*Game) (err error) {
-	profile, err := GetProfile(user)
+func addGamesFromProfile(ctx context.Context, user User, games map[string]*Game) (err error) {
+	profile, err := GetProfile(ctx, user)
 	if err != nil {
 		return
 	}
@@ -49,7 +72,7 @@ func addGamesFromProfile(user User, games map[string]*Game) (err error) {
 		gameID := groups[1]
 		gameName := groups[2]
 		tags := []string{""}
-		games[gameID] = &Game{gameID, gameName, tags, "", nil, nil, "", false}
+		games[gameID] = &Game{ID: gameID, Name: gameName, Tags: tags}
 	}
 
 	return
@@ -60,26 +83,33 @@ func addGamesFromProfile(user User, games map[string]*Game) (err error) {
 func addUnknownGames(user User, games map[string]*Game) {
 	// Fetch game categories from local file.
 	sharedConfFile := filepath.Join(user.Dir, "7", "remote", "sharedconfig.vdf")
-	if _, err := os.Stat(sharedConfFile); err != nil {
+	if _, err := steamFS.Stat(sharedConfFile); err != nil {
 		// No categories file found, skipping this part.
 		return
 	}
-	sharedConfBytes, err := ioutil.ReadFile(sharedConfFile)
+	sharedConfBytes, err := steamFS.ReadFile(sharedConfFile)
 	if err != nil {
 		return
 	}
 
-	sharedConf := string(sharedConfBytes)
-	// VDF pattern: "steamid" { "tags { "0" "category" } }
-	gamePattern := regexp.MustCompile(`"([0-9]+)"\s*{[^}]+?"tags"\s*{([^}]+?)}`)
-	tagsPattern := regexp.MustCompile(`"[0-9]+"\s*"(.+?)"`)
-	for _, gameGroups := range gamePattern.FindAllStringSubmatch(sharedConf, -1) {
-		gameID := gameGroups[1]
-		tagsText := gameGroups[2]
+	sharedConf, err := ParseTextVDF(sharedConfBytes)
+	if err != nil {
+		fmt.Printf("Could not read categories from %v: %v\n", sharedConfFile, err.Error())
+		return
+	}
 
-		for _, tagGroups := range tagsPattern.FindAllStringSubmatch(tagsText, -1) {
-			tag := tagGroups[1]
+	// VDF structure: "apps" { "steamid" { "tags" { "0" "category" } } }
+	apps := sharedConf.Get("UserRoamingConfigStore", "Software", "Valve", "Steam", "apps")
+	if apps == nil {
+		apps = sharedConf.Find("apps")
+	}
+	if apps == nil {
+		return
+	}
+	for _, app := range apps.Children {
+		gameID := app.Key
 
+		for _, tag := range app.Get("tags").Values() {
 			game, ok := games[gameID]
 			if ok {
 				game.Tags = append(game.Tags, tag)
@@ -87,7 +117,7 @@ func addUnknownGames(user User, games map[string]*Game) {
 				// If for some reason it wasn't included in the profile, create a new
 				// entry for it now. Unfortunately we don't have a name.
 				gameName := ""
-				games[gameID] = &Game{gameID, gameName, []string{tag}, "", nil, nil, "", false}
+				games[gameID] = &Game{ID: gameID, Name: gameName, Tags: []string{tag}}
 			}
 		}
 	}
@@ -96,49 +126,250 @@ func addUnknownGames(user User, games map[string]*Game) {
 // Adds non-Steam games that have been registered locally.
 // This information is in the file config/shortcuts.vdf, in binary format.
 // It contains the non-Steam games with names, target (exe location) and
-// tags/categories. To create a grid image we must compute the Steam ID, which
-// is just crc32(target + label) + "02000000", using IEEE standard polynomials.
+// tags/categories. Current clients store the ID of the grid images as appid,
+// and keep it when the shortcut is renamed. Older files have none, the ID is
+// then computed like Steam did: crc32(target + label) + "02000000", using IEEE
+// standard polynomials.
 func addNonSteamGames(user User, games map[string]*Game) {
 	shortcutsVdf := filepath.Join(user.Dir, "config", "shortcuts.vdf")
-	if _, err := os.Stat(shortcutsVdf); err != nil {
+	if _, err := steamFS.Stat(shortcutsVdf); err != nil {
+		return
+	}
+	shortcutBytes, err := steamFS.ReadFile(shortcutsVdf)
+	if err != nil {
 		return
 	}
-	shortcutBytes, err := ioutil.ReadFile(shortcutsVdf)
+
+	shortcuts, err := ParseBinaryVDF(shortcutBytes)
 	if err != nil {
+		fmt.Printf("Could not read non-Steam games from %v: %v\n", shortcutsVdf, err.Error())
 		return
 	}
 
-	// The actual binary format is known, but using regexes is way easier than
-	// parsing the entire file. If I run into any problems I'll replace this.
-	gamePattern := regexp.MustCompile("(?i)\x00\x01appname\x00([^\x08]+?)\x00\x01exe\x00([^\x08]+?)\x00\x01[^\x08]+?\x00tags\x00(?:\x01([^\x08]+?)|)\x08\x08")
-	tagsPattern := regexp.MustCompile("\\d\x00([^\x00\x01\x08]+?)\x00")
-	for _, gameGroups := range gamePattern.FindAllSubmatch(shortcutBytes, -1) {
-		gameName := gameGroups[1]
-		target := gameGroups[2]
-		uniqueName := bytes.Join([][]byte{target, gameName}, []byte(""))
-		// Does IEEE CRC32 of target concatenated with gameName. No idea why Steam chose this operation.
-		gameID := strconv.FormatUint(uint64(crc32.ChecksumIEEE(uniqueName)) | 0x80000000, 10)
-		game := Game{gameID, string(gameName), []string{}, "", nil, nil, "", true}
+	// VDF structure: "shortcuts" { "0" { "appname" "..." "exe" "..." "tags" { "0" "category" } } }
+	for _, shortcut := range shortcuts.Get("shortcuts").Children {
+		gameName := shortcut.String("appname")
+		target := shortcut.String("exe")
+		if gameName == "" && target == "" {
+			continue
+		}
+		var gameID string
+		// Stored as a signed 32 bit number.
+		storedID, err := strconv.ParseInt(shortcut.String("appid"), 10, 32)
+		hasStoredID := err == nil && storedID != 0
+		if hasStoredID {
+			gameID = strconv.FormatUint(uint64(uint32(storedID)), 10)
+		} else {
+			uniqueName := target + gameName
+			// Does IEEE CRC32 of target concatenated with gameName. No idea why Steam chose this operation.
+			gameID = strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(uniqueName))) | 0x80000000, 10)
+		}
+		game := Game{ID: gameID, Name: gameName, Tags: []string{}, Custom: true}
+		game.Shortcut = &shortcutRecord{Name: gameName, Exe: target, LaunchOptions: shortcut.String("LaunchOptions"), storedID: hasStoredID}
 		games[gameID] = &game
 
-		tagsText := gameGroups[3]
-		for _, tagGroups := range tagsPattern.FindAllSubmatch(tagsText, -1) {
-			tag := tagGroups[1]
-			game.Tags = append(game.Tags, string(tag))
+		game.Tags = append(game.Tags, shortcut.Get("tags").Values()...)
+		if lastPlayed, err := strconv.ParseInt(shortcut.String("LastPlayTime"), 10, 64); err == nil && lastPlayed > 0 {
+			game.LastPlayed = time.Unix(lastPlayed, 0)
+		}
+		if platform := detectPlatform(target, shortcut.String("StartDir"), shortcut.String("LaunchOptions")); platform != "" {
+			game.Tags = append(game.Tags, platform)
+		}
+	}
+}
+
+// Source mods and tools show up in the categories with 64 bit game IDs instead
+// of app IDs. The lower 24 bits are the base app, the next 8 bits the type
+// (1 for mods, 2 for shortcuts) and the upper 32 bits the mod ID. Shortcuts
+// use 32 bit IDs with the high bit set. None of these exist on Steam servers.
+func isCustomID(gameID string) bool {
+	id, err := strconv.ParseUint(gameID, 10, 64)
+	return err == nil && id > 0x7FFFFFFF
+}
+
+// Big Picture and the Steam Deck show the banners of shortcuts under their 64
+// bit game ID, the shortcut ID shifted up with the type 2 below. Returns an
+// empty string for other games, apps and mods have a single name.
+func tenfootID(gameID string) string {
+	id, err := strconv.ParseUint(gameID, 10, 64)
+	if err != nil || id <= 0x7FFFFFFF || id > 0xFFFFFFFF {
+		return ""
+	}
+	return strconv.FormatUint(id<<32|0x02000000, 10)
+}
+
+// Checks if a game ID could be a real app, shortcut or mod. Corrupted configs
+// sometimes have entries with ID 0 or random numbers that would only result in
+// weird downloads.
+func isValidGameID(gameID string) bool {
+	id, err := strconv.ParseUint(gameID, 10, 64)
+	if err != nil || id == 0 {
+		return false
+	}
+	if id > 0xFFFFFFFF {
+		// Only mods and shortcuts have 64 bit IDs.
+		idType := (id >> 24) & 0xFF
+		return idType == 1 || idType == 2
+	}
+	// App IDs have 24 bits, shortcuts have the high bit set.
+	return id <= 0xFFFFFF || id > 0x7FFFFFFF
+}
+
+// Fills in the names of games that didn't get one from the profile, using the
+// local appmanifest files for apps and the gameinfo.txt of Source mods. Games
+// with custom IDs are marked as such so they are searched by name.
+func addLocalNames(installationDir string, games map[string]*Game) {
+	steamappsDir := filepath.Join(installationDir, "steamapps")
+
+	// Steam identifies mods by the CRC32 of their directory name, with the
+	// high bit set.
+	modNames := make(map[uint64]string)
+	mods, _ := steamFS.ReadDir(filepath.Join(steamappsDir, "sourcemods"))
+	for _, mod := range mods {
+		gameinfo, err := steamFS.ReadFile(filepath.Join(steamappsDir, "sourcemods", mod.Name(), "gameinfo.txt"))
+		if err != nil {
+			continue
+		}
+		info, err := ParseTextVDF(gameinfo)
+		if err != nil || info.String("GameInfo", "game") == "" {
+			continue
+		}
+		modID := uint64(crc32.ChecksumIEEE([]byte(mod.Name())) | 0x80000000)
+		modNames[modID] = info.String("GameInfo", "game")
+	}
+
+	for gameID, game := range games {
+		if isCustomID(gameID) {
+			game.Custom = true
+			id, _ := strconv.ParseUint(gameID, 10, 64)
+			if game.Name == "" && id>>32 != 0 {
+				game.Name = modNames[id>>32]
+			}
+			continue
+		}
+		if game.Name != "" {
+			continue
+		}
+
+		manifest, err := steamFS.ReadFile(filepath.Join(steamappsDir, "appmanifest_" + gameID + ".acf"))
+		if err != nil {
+			continue
+		}
+		if appState, err := ParseTextVDF(manifest); err == nil {
+			game.Name = appState.String("AppState", "name")
+		}
+	}
+}
+
+// Reads when the Steam games were last played from localconfig.vdf.
+func addLastPlayed(user User, games map[string]*Game) {
+	localConfBytes, err := steamFS.ReadFile(filepath.Join(user.Dir, "config", "localconfig.vdf"))
+	if err != nil {
+		return
+	}
+	localConf, err := ParseTextVDF(localConfBytes)
+	if err != nil {
+		return
+	}
+
+	// VDF structure: "apps" { "steamid" { "LastPlayed" "1577836800" } }
+	apps := localConf.Get("UserLocalConfigStore", "Software", "Valve", "Steam", "apps")
+	if apps == nil {
+		return
+	}
+	for _, app := range apps.Children {
+		game, ok := games[app.Key]
+		if !ok {
+			continue
+		}
+		if lastPlayed, err := strconv.ParseInt(app.String("LastPlayed"), 10, 64); err == nil && lastPlayed > 0 {
+			game.LastPlayed = time.Unix(lastPlayed, 0)
 		}
 	}
 }
 
 // GetGames returns all games from a given user, using both the public profile and local
 // files to gather the data. Returns a map of game by ID.
-func GetGames(user User, nonSteamOnly bool) map[string]*Game {
+func GetGames(ctx context.Context, user User, installationDir string, nonSteamOnly bool) map[string]*Game {
 	games := make(map[string]*Game, 0)
 
 	if !nonSteamOnly {
-		addGamesFromProfile(user, games)
+		addGamesFromProfile(ctx, user, games)
 		addUnknownGames(user, games)
+		addCollectionTags(user, games)
 	}
 	addNonSteamGames(user, games)
+	addLocalNames(installationDir, games)
+	addLastPlayed(user, games)
 
 	return games
 }
+
+// GetLocalGames returns the games of a user that can be found without network
+// access: the ones with categories and the non-Steam games.
+func GetLocalGames(user User, installationDir string) map[string]*Game {
+	games := make(map[string]*Game, 0)
+	addUnknownGames(user, games)
+	addCollectionTags(user, games)
+	addNonSteamGames(user, games)
+	addLocalNames(installationDir, games)
+	addLastPlayed(user, games)
+	return games
+}
+
+// Like GetLocalGames, with the installed apps that have no category, which
+// are in the library too.
+func GetLibraryGames(user User, installationDir string, installed map[string]bool) map[string]*Game {
+	games := GetLocalGames(user, installationDir)
+	for id := range installed {
+		if _, ok := games[id]; !ok {
+			games[id] = &Game{ID: id, Tags: []string{}}
+		}
+	}
+	addLocalNames(installationDir, games)
+	return games
+}
+
+// Returns the games in the given order: "name", "appid" or "recent" for the
+// last played first.
+func sortGames(games map[string]*Game, order string) ([]*Game, error) {
+	sorted := make([]*Game, 0, len(games))
+	for _, game := range games {
+		sorted = append(sorted, game)
+	}
+
+	// Ties are broken by ID, so the order is always the same.
+	byID := func(i, j int) bool {
+		a, errA := strconv.ParseUint(sorted[i].ID, 10, 64)
+		b, errB := strconv.ParseUint(sorted[j].ID, 10, 64)
+		if errA != nil || errB != nil {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return a < b
+	}
+	var less func(i, j int) bool
+	switch order {
+	case "appid":
+		less = byID
+	case "name":
+		less = func(i, j int) bool {
+			a, b := strings.ToLower(sorted[i].Name), strings.ToLower(sorted[j].Name)
+			if a != b {
+				return a < b
+			}
+			return byID(i, j)
+		}
+	case "recent":
+		less = func(i, j int) bool {
+			a, b := sorted[i].LastPlayed, sorted[j].LastPlayed
+			if !a.Equal(b) {
+				return a.After(b)
+			}
+			return byID(i, j)
+		}
+	default:
+		return nil, errors.New("Unknown order " + order + ", must be name, appid or recent")
+	}
+	sort.Slice(sorted, less)
+	return sorted, nil
+}
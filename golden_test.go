@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Compositing is made of pure functions over images, so the overlays,
+// positioning and formats can be checked against golden files: for every
+// case the result is compared with a PNG in testdata/golden, made from the
+// same generated images. After an intended change to the output, the golden
+// files are written again with
+//
+//	go test -run TestGolden -update
+//
+// and the differences reviewed like code. A case that doesn't match is
+// written next to its golden file as <case>.got.png.
+
+var updateGolden = flag.Bool("update", false, "Write the golden files instead of comparing with them")
+
+// Largest difference of a channel that still matches, for rounding in other
+// versions of the draw package.
+const goldenTolerance = 2
+
+type goldenCase struct {
+	name string
+	// Settings of the run, set for the case and reset after it.
+	compositor   string
+	autoContrast bool
+	badgeStrip   string
+	render       func() (image.Image, error)
+}
+
+var goldenCases = []goldenCase{
+	{name: "frame", render: func() (image.Image, error) {
+		return compositeOverlays(goldenBase(100, 150), []image.Image{goldenFrame(100, 150)}), nil
+	}},
+	{name: "frame-scaled", render: func() (image.Image, error) {
+		return compositeOverlays(goldenBase(60, 80), []image.Image{goldenFrame(100, 150)}), nil
+	}},
+	{name: "frame-fast", compositor: compositorFast, render: func() (image.Image, error) {
+		return compositeOverlays(goldenBase(100, 150), []image.Image{goldenFrame(100, 150), goldenBadge(100, 150, color.NRGBA{255, 255, 255, 255})}), nil
+	}},
+	{name: "generated-frames", render: func() (image.Image, error) {
+		frames := drawFrames(100, 150, []color.NRGBA{{255, 204, 0, 255}, hashedFrameColor("co-op")})
+		return compositeOverlays(goldenBase(100, 150), []image.Image{frames, goldenBadge(100, 150, color.NRGBA{255, 255, 255, 255})}), nil
+	}},
+	{name: "badges", render: func() (image.Image, error) {
+		return compositeOverlays(goldenBase(100, 150), []image.Image{goldenBadge(100, 150, color.NRGBA{255, 0, 0, 255}), goldenBadge(100, 150, color.NRGBA{0, 0, 255, 200})}), nil
+	}},
+	{name: "badge-strip", badgeStrip: badgeStripHorizontal, render: func() (image.Image, error) {
+		return compositeOverlays(goldenBase(100, 150), []image.Image{goldenBadge(100, 150, color.NRGBA{255, 0, 0, 255}), goldenBadge(100, 150, color.NRGBA{0, 0, 255, 200})}), nil
+	}},
+	{name: "auto-contrast", autoContrast: true, render: func() (image.Image, error) {
+		white := image.NewRGBA(image.Rect(0, 0, 100, 150))
+		draw.Draw(white, white.Bounds(), image.White, image.ZP, draw.Src)
+		return compositeOverlays(white, []image.Image{goldenBadge(100, 150, color.NRGBA{250, 250, 250, 255})}), nil
+	}},
+	{name: "last-played", render: func() (image.Image, error) {
+		return stampLastPlayed(goldenBase(200, 300), time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)), nil
+	}},
+	{name: "filters", render: func() (image.Image, error) {
+		filters, err := getColorFilters(&Options{Filter: "desaturate=0.5,duotone=#202060:#f0c080"})
+		if err != nil {
+			return nil, err
+		}
+		return filterImage(goldenBase(100, 150), filters), nil
+	}},
+	{name: "card", render: func() (image.Image, error) {
+		return styleCard(goldenBase(100, 150), &Options{Corners: 12, Border: 3, BorderColor: "#ffffffc0", Shadow: 8})
+	}},
+	{name: "fit-blur", render: func() (image.Image, error) {
+		return blurExtend(goldenBase(150, 150), 2.0/3), nil
+	}},
+	{name: "fit-crop", render: func() (image.Image, error) {
+		return focalCrop(goldenBase(200, 150), 2.0/3), nil
+	}},
+}
+
+func TestGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "golden")
+	for _, c := range goldenCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkGoldenCase(c, dir, *updateGolden); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func checkGoldenCase(c goldenCase, dir string, update bool) error {
+	previousCompositor, previousContrast, previousStrip := compositorBackend, autoContrast, badgeStrip
+	defer func() {
+		compositorBackend, autoContrast, badgeStrip = previousCompositor, previousContrast, previousStrip
+	}()
+	compositorBackend = compositorStandard
+	if c.compositor != "" {
+		compositorBackend = c.compositor
+	}
+	autoContrast = c.autoContrast
+	badgeStrip.direction, badgeStrip.spacing = c.badgeStrip, 0
+
+	got, err := c.render()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, c.name+".png")
+	if update {
+		err = os.MkdirAll(dir, 0777)
+		if err != nil {
+			return err
+		}
+		return writeGoldenImage(path, got)
+	}
+
+	goldenBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	golden, err := png.Decode(bytes.NewReader(goldenBytes))
+	if err != nil {
+		return err
+	}
+	if mismatch := compareImages(golden, got); mismatch != "" {
+		writeGoldenImage(filepath.Join(dir, c.name+".got.png"), got)
+		return errors.New(mismatch)
+	}
+	return nil
+}
+
+func writeGoldenImage(path string, img image.Image) error {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// Describes the first difference between the images, empty if they match.
+func compareImages(want image.Image, got image.Image) string {
+	if want.Bounds().Size() != got.Bounds().Size() {
+		return fmt.Sprintf("Size is %v, want %v", got.Bounds().Size(), want.Bounds().Size())
+	}
+	wantMin, gotMin := want.Bounds().Min, got.Bounds().Min
+	for y := 0; y < want.Bounds().Dy(); y++ {
+		for x := 0; x < want.Bounds().Dx(); x++ {
+			w := color.NRGBAModel.Convert(want.At(wantMin.X+x, wantMin.Y+y)).(color.NRGBA)
+			g := color.NRGBAModel.Convert(got.At(gotMin.X+x, gotMin.Y+y)).(color.NRGBA)
+			// Colors of transparent pixels don't show.
+			if w.A == 0 && g.A == 0 {
+				continue
+			}
+			if channelDiff(w.R, g.R) > goldenTolerance || channelDiff(w.G, g.G) > goldenTolerance || channelDiff(w.B, g.B) > goldenTolerance || channelDiff(w.A, g.A) > goldenTolerance {
+				return fmt.Sprintf("Pixel %v,%v is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+	return ""
+}
+
+func channelDiff(a uint8, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// A diagonal gradient with a bright spot at a third, so scaling, cropping
+// and filters all show.
+func goldenBase(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	spotX, spotY := width/3, height/3
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixel := color.RGBA{uint8(255 * x / width), uint8(255 * y / height), 128, 255}
+			if dx, dy := x-spotX, y-spotY; dx*dx+dy*dy < width*width/100 {
+				pixel = color.RGBA{255, 255, 200, 255}
+			}
+			img.SetRGBA(x, y, pixel)
+		}
+	}
+	return img
+}
+
+// A frame overlay, a half transparent border around the image.
+func goldenFrame(width int, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	border := width / 12
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < border || y < border || x >= width-border || y >= height-border {
+				img.SetNRGBA(x, y, color.NRGBA{20, 20, 20, 160})
+			}
+		}
+	}
+	return img
+}
+
+// A badge overlay, a square in the top right corner.
+func goldenBadge(width int, height int, badgeColor color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	size, margin := width/5, width/20
+	square := image.Rect(width-margin-size, margin, width-margin, margin+size)
+	draw.Draw(img, square, &image.Uniform{badgeColor}, image.ZP, draw.Src)
+	return img
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The gui command is the serve command with a page for people who don't use
+// the terminal, opened in the browser: browse the library with the current
+// artwork, pick from the candidates, manage the overlays and start a full run.
+// It uses the API of serve.go, plus:
+//
+//	GET    /api/image?user=1234&game=620&type=cover   the current grid image
+//	GET    /api/overlays                              ["favorites.cover.png"]
+//	POST   /api/overlays                              upload, multipart "file"
+//	DELETE /api/overlays?name=favorites.cover.png
+//	GET    /api/run                                   state of the last run
+//	POST   /api/run                                   start a full run
+func runGUICommand(args []string) error {
+	return runServer("gui", args, true)
+}
+
+// Directory of the overlay images, next to the executable.
+func overlaysDir() string {
+	return filepath.Join(filepath.Dir(os.Args[0]), "overlays by category")
+}
+
+// State of the full run started from the GUI.
+type runState struct {
+	Running    bool      `json:"running"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Downloaded int       `json:"downloaded"`
+	NotFound   int       `json:"notFound"`
+	Error      string    `json:"error"`
+}
+
+func (s *server) registerGUI(mux *http.ServeMux) {
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/api/image", s.handleImage)
+	mux.HandleFunc("/api/overlays", s.handleOverlays)
+	mux.HandleFunc("/api/run", s.handleRun)
+}
+
+func (s *server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	guiTemplate.Execute(w, nil)
+}
+
+func (s *server) handleImage(w http.ResponseWriter, r *http.Request) {
+	user, game, artStyle, err := s.findArtwork(r.FormValue("user"), r.FormValue("game"), r.FormValue("type"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	imageBytes := readGridImage(filepath.Join(user.Dir, "config", "grid"), game, s.artStyles[artStyle])
+	if imageBytes == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(imageBytes)
+}
+
+func (s *server) handleOverlays(w http.ResponseWriter, r *http.Request) {
+	dir := overlaysDir()
+	switch r.Method {
+	case http.MethodGet:
+		files, _ := ioutil.ReadDir(dir)
+		names := []string{}
+		for _, file := range files {
+			if !file.IsDir() {
+				names = append(names, file.Name())
+			}
+		}
+		sort.Strings(names)
+		writeJSON(w, http.StatusOK, names)
+		return
+	case http.MethodPost:
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer file.Close()
+		name, err := overlayFileName(header.Filename)
+		if err == nil {
+			err = os.MkdirAll(dir, 0777)
+		}
+		var imageBytes []byte
+		if err == nil {
+			imageBytes, err = ioutil.ReadAll(io.LimitReader(file, 50*1024*1024))
+		}
+		if err == nil {
+			err = writeFile(filepath.Join(dir, name), imageBytes)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	case http.MethodDelete:
+		name, err := overlayFileName(r.FormValue("name"))
+		if err == nil {
+			err = os.Remove(filepath.Join(dir, name))
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Use GET, POST or DELETE"))
+		return
+	}
+
+	overlays, err := loadOverlays(&s.opts, s.artStyles)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.mutex.Lock()
+	s.overlays = overlays
+	s.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+// Checks the name of an uploaded overlay, which must not leave the overlay
+// directory.
+func overlayFileName(name string) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	extension := strings.ToLower(filepath.Ext(name))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return "", errors.New("Missing overlay name")
+	}
+	if extension != ".png" && extension != ".jpg" && extension != ".jpeg" && extension != ".gif" {
+		return "", errors.New("Overlays must be png, jpg or gif images, got " + name)
+	}
+	return name, nil
+}
+
+func (s *server) handleRun(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if r.Method == http.MethodPost {
+		if s.run.Running {
+			writeError(w, http.StatusConflict, errors.New("A run is already going on"))
+			return
+		}
+		s.run = runState{Running: true, Started: time.Now()}
+		go s.fullRun()
+	}
+	writeJSON(w, http.StatusOK, s.run)
+}
+
+// Runs steamgrid on the whole library, with the options the server was
+// started with.
+func (s *server) fullRun() {
+	result, err := Run(s.ctx, s.runOpts)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.run.Running = false
+	s.run.Finished = time.Now()
+	if result != nil {
+		s.run.Downloaded = result.Downloaded
+		for _, games := range result.NotFound {
+			s.run.NotFound += len(games)
+		}
+	}
+	if err != nil {
+		s.run.Error = err.Error()
+	}
+	fmt.Printf("Run finished: %v downloaded, %v not found\n", s.run.Downloaded, s.run.NotFound)
+}
+
+var guiTemplate = template.Must(template.New("gui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SteamGrid</title>
+<style>
+body { font-family: sans-serif; background: #1b2838; color: #c7d5e0; margin: 0 20px; }
+button { background: #66c0f4; border: 0; padding: 6px 12px; cursor: pointer; }
+.bar { display: flex; gap: 12px; align-items: center; padding: 12px 0; border-bottom: 1px solid #2a475e; }
+.games { display: flex; flex-wrap: wrap; gap: 12px; padding-top: 12px; }
+.game { width: 150px; cursor: pointer; }
+.game img, .game .none { width: 150px; height: 225px; object-fit: cover; background: #2a475e; display: block; }
+.candidates img { height: 200px; margin: 6px; cursor: pointer; }
+.hidden { display: none; }
+small { color: #8f98a0; }
+</style>
+</head>
+<body>
+<div class="bar">
+<h2>SteamGrid</h2>
+<select id="user"></select>
+<select id="type"><option value="cover">Cover</option><option value="banner">Banner</option><option value="hero">Hero</option><option value="logo">Logo</option></select>
+<label><input type="checkbox" id="missing"> Only missing</label>
+<input id="filter" placeholder="Search">
+<button id="run">Run on the whole library</button>
+<span id="status"></span>
+</div>
+
+<div id="picker" class="hidden">
+<h3 id="pickerTitle"></h3>
+<p id="pickerState"></p>
+<div class="candidates" id="candidates"></div>
+<button id="close">Back</button>
+</div>
+
+<div id="library" class="games"></div>
+
+<h3>Overlays</h3>
+<p><small>Named after a category and the artwork type, like favorites.cover.png.</small></p>
+<ul id="overlays"></ul>
+<input type="file" id="overlayFile"> <button id="upload">Upload</button>
+
+<script>
+const $ = id => document.getElementById(id);
+let games = [];
+
+async function api(path, options) {
+	const response = await fetch(path, options);
+	const body = await response.json();
+	if (body && body.error) throw new Error(body.error);
+	return body;
+}
+
+function query() {
+	return "user=" + encodeURIComponent($("user").value) + "&type=" + $("type").value;
+}
+
+async function loadUsers() {
+	for (const user of await api("/api/users")) {
+		$("user").add(new Option(user.name, user.id));
+	}
+	await loadGames();
+}
+
+async function loadGames() {
+	games = await api("/api/games?" + query() + "&missing=" + $("missing").checked);
+	showGames();
+}
+
+function showGames() {
+	const filter = $("filter").value.toLowerCase();
+	const type = $("type").selectedOptions[0].text;
+	$("library").innerHTML = "";
+	for (const game of games) {
+		if (filter && !(game.name || game.id).toLowerCase().includes(filter)) continue;
+		const missing = game.missing.includes(type);
+		if ($("missing").checked && !missing) continue;
+		const item = document.createElement("div");
+		item.className = "game";
+		const picture = document.createElement(missing ? "div" : "img");
+		picture.className = missing ? "none" : "";
+		if (!missing) picture.src = "/api/image?" + query() + "&game=" + game.id + "&t=" + Date.now();
+		const name = document.createElement("div");
+		name.textContent = game.name || game.id;
+		item.append(picture, name);
+		item.onclick = () => pick(game);
+		$("library").append(item);
+	}
+}
+
+async function pick(game) {
+	$("picker").classList.remove("hidden");
+	$("pickerTitle").textContent = game.name || game.id;
+	$("pickerState").textContent = "Searching all sources...";
+	$("candidates").innerHTML = "";
+	try {
+		const candidates = await api("/api/candidates?" + query() + "&game=" + game.id);
+		$("pickerState").textContent = candidates.length ? "Click an image to use it." : "Nothing found.";
+		for (const candidate of candidates) {
+			const img = document.createElement("img");
+			img.src = candidate.thumbnail;
+			img.title = candidate.from + ", " + candidate.width + "x" + candidate.height + ", " + candidate.score.toFixed(1) + " points";
+			img.onclick = () => apply(game, candidate.index);
+			$("candidates").append(img);
+		}
+	} catch (error) {
+		$("pickerState").textContent = error.message;
+	}
+}
+
+async function apply(game, index) {
+	$("pickerState").textContent = "Saving...";
+	try {
+		await api("/api/apply", {method: "POST", headers: {"Content-Type": "application/json"},
+			body: JSON.stringify({user: $("user").value, game: game.id, type: $("type").value, index: index})});
+		$("picker").classList.add("hidden");
+		await loadGames();
+	} catch (error) {
+		$("pickerState").textContent = error.message;
+	}
+}
+
+async function loadOverlays() {
+	$("overlays").innerHTML = "";
+	for (const name of await api("/api/overlays")) {
+		const item = document.createElement("li");
+		const remove = document.createElement("button");
+		remove.textContent = "Delete";
+		remove.onclick = async () => { await api("/api/overlays?name=" + encodeURIComponent(name), {method: "DELETE"}); loadOverlays(); };
+		item.append(name + " ", remove);
+		$("overlays").append(item);
+	}
+}
+
+async function upload() {
+	const data = new FormData();
+	data.append("file", $("overlayFile").files[0]);
+	await api("/api/overlays", {method: "POST", body: data});
+	loadOverlays();
+}
+
+async function showRun(state) {
+	if (state.running) {
+		$("status").textContent = "Running...";
+		setTimeout(async () => showRun(await api("/api/run")), 2000);
+	} else if (state.finished && !state.finished.startsWith("0001")) {
+		$("status").textContent = state.error || ("Last run: " + state.downloaded + " downloaded, " + state.notFound + " not found");
+		loadGames();
+	}
+}
+
+$("user").onchange = $("type").onchange = $("missing").onchange = loadGames;
+$("filter").oninput = showGames;
+$("close").onclick = () => $("picker").classList.add("hidden");
+$("upload").onclick = upload;
+$("run").onclick = async () => showRun(await api("/api/run", {method: "POST"}));
+loadUsers();
+loadOverlays();
+api("/api/run").then(showRun);
+</script>
+</body>
+</html>
+`))
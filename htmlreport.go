@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// Height of the thumbnails in the HTML report.
+const thumbnailHeight = 120
+
+// An artwork in the HTML report, with thumbnails as data URLs so the report
+// is a single file.
+type reportEntry struct {
+	Order         int
+	Name          string
+	ID            string
+	ArtStyle      string
+	Source        string
+	LowConfidence bool
+	Before        template.URL
+	After         template.URL
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SteamGrid report</title>
+<style>
+body { font-family: sans-serif; background: #1b2838; color: #c7d5e0; }
+table { border-collapse: collapse; }
+td, th { padding: 6px 12px; border-bottom: 1px solid #2a475e; text-align: left; vertical-align: middle; }
+img { height: {{.Height}}px; }
+.low { background: #4a2b1b; }
+.none { color: #66c0f4; }
+</style>
+</head>
+<body>
+<h1>SteamGrid report</h1>
+<p>{{len .Entries}} artworks. Highlighted rows were found by name and may not be accurate.</p>
+<table>
+<tr><th>Game</th><th>Artwork</th><th>Source</th><th>Before</th><th>After</th></tr>
+{{range .Entries}}<tr{{if .LowConfidence}} class="low"{{end}}>
+<td>{{.Name}}<br><small>{{.ID}}</small></td>
+<td>{{.ArtStyle}}</td>
+<td>{{if .Source}}{{.Source}}{{else}}<span class="none">not found</span>{{end}}</td>
+<td>{{if .Before}}<img src="{{.Before}}">{{else}}<span class="none">none</span>{{end}}</td>
+<td>{{if .After}}<img src="{{.After}}">{{else}}<span class="none">none</span>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Returns a small JPEG of the image as data URL, or "" if it can't be read.
+func thumbnail(imageBytes []byte) template.URL {
+	if imageBytes == nil {
+		return ""
+	}
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil || img.Bounds().Dy() == 0 {
+		return ""
+	}
+	size := img.Bounds().Size()
+	width := size.X * thumbnailHeight / size.Y
+	if width == 0 {
+		width = 1
+	}
+	small := image.NewRGBA(image.Rect(0, 0, width, thumbnailHeight))
+	// Dark background for transparent logos.
+	draw.Draw(small, small.Bounds(), image.NewUniform(image.Black), image.ZP, draw.Src)
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Over, nil)
+
+	buf := new(bytes.Buffer)
+	if jpeg.Encode(buf, small, &jpeg.Options{Quality: 80}) != nil {
+		return ""
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// Returns the image in the grid for an artwork, before the run changes it.
+func readGridImage(gridDir string, game *Game, artStyleExtensions []string) []byte {
+	images, err := steamFS.Glob(filepath.Join(gridDir, game.ID+artStyleExtensions[0]+".*"))
+	if err != nil {
+		return nil
+	}
+	images = filterForImages(images)
+	if len(images) == 0 {
+		return nil
+	}
+	imageBytes, _ := steamFS.ReadFile(images[0])
+	return imageBytes
+}
+
+// Adds what is known about an artwork to its report entry. Only called if
+// the HTML report is enabled.
+func (result *Result) reportArtwork(gridDir string, game *Game, artStyle string, artStyleExtensions []string, update func(entry *reportEntry)) {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+	if result.report == nil {
+		result.report = map[string]*reportEntry{}
+	}
+	key := filepath.Join(gridDir, game.ID+artStyleExtensions[0])
+	entry, ok := result.report[key]
+	if !ok {
+		entry = &reportEntry{Order: len(result.report), Name: game.Name, ID: game.ID, ArtStyle: artStyle}
+		result.report[key] = entry
+	}
+	update(entry)
+}
+
+func writeHTMLReport(path string, result *Result) error {
+	result.mutex.Lock()
+	entries := make([]*reportEntry, 0, len(result.report))
+	for _, entry := range result.report {
+		entries = append(entries, entry)
+	}
+	result.mutex.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Order < entries[j].Order
+	})
+
+	buf := new(bytes.Buffer)
+	err := htmlReportTemplate.Execute(buf, struct {
+		Height  int
+		Entries []*reportEntry
+	}{thumbnailHeight, entries})
+	if err != nil {
+		return err
+	}
+	return writeRunOutput(path, buf.Bytes())
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Keeps the answers to GET requests on disk while it is installed, so runs
+// on several Steam installations download everything only once, see
+// targets.go. Only the downloads during the runs are kept, the directory is
+// removed when done.
+type cachingTransport struct {
+	base http.RoundTripper
+	dir  string
+
+	mutex    sync.Mutex
+	requests int
+	hits     int
+}
+
+// Responses worth keeping. Errors and rate limits are asked for again.
+func cacheableStatus(status int) bool {
+	return status == 200 || status == 404 || status == 410 || (status >= 300 && status < 400)
+}
+
+// What is kept of a response, next to its body.
+type cachedResponse struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+}
+
+// Puts a cache under the default transport, below the download counting, so
+// cached responses don't count as network.
+func startHTTPCache() (*cachingTransport, error) {
+	dir, err := ioutil.TempDir("", "steamgrid-cache")
+	if err != nil {
+		return nil, err
+	}
+	countDownloads(nil)
+	counting := http.DefaultTransport.(*countingTransport)
+	cache := &cachingTransport{base: counting.base, dir: dir}
+	counting.base = cache
+	return cache, nil
+}
+
+func (t *cachingTransport) stop() {
+	counting := http.DefaultTransport.(*countingTransport)
+	counting.base = t.base
+	os.RemoveAll(t.dir)
+}
+
+// Requests for the same URL with different headers, like API keys, are
+// different entries.
+func cacheKey(req *http.Request) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(req.Method + " " + req.URL.String() + "\n")
+	req.Header.Write(&buffer)
+	hash := sha256.Sum256(buffer.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		return t.base.RoundTrip(req)
+	}
+	path := filepath.Join(t.dir, cacheKey(req))
+	t.mutex.Lock()
+	t.requests++
+	t.mutex.Unlock()
+
+	if response, ok := t.load(req, path); ok {
+		t.mutex.Lock()
+		t.hits++
+		t.mutex.Unlock()
+		return response, nil
+	}
+
+	response, err := t.base.RoundTrip(req)
+	if err != nil || !cacheableStatus(response.StatusCode) {
+		return response, err
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+
+	cached, err := json.Marshal(cachedResponse{response.Status, response.StatusCode, response.Header})
+	if err == nil {
+		err = writeFileAtomic(path, body)
+	}
+	if err == nil {
+		writeFileAtomic(path+".json", cached)
+	}
+	return response, nil
+}
+
+func (t *cachingTransport) load(req *http.Request, path string) (*http.Response, bool) {
+	cachedBytes, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedResponse
+	if json.Unmarshal(cachedBytes, &cached) != nil {
+		return nil, false
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return &http.Response{
+		Status:        cached.Status,
+		StatusCode:    cached.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cached.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, true
+}
+
+func (t *cachingTransport) stats() (requests int, hits int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.requests, t.hits
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The journal records the artworks finished in a run, so a run that was
+// killed, or stopped by its budget, can be resumed without redoing them. Artworks that were being saved
+// when the run stopped are marked as begun but not done, and are checked
+// against their backups, see recoverInterrupted. The journal is append-only
+// and removed when a run finishes.
+//
+//	begin 620p
+//	done 620p
+const journalFileName = "steamgrid.journal"
+
+type journal struct {
+	mutex   sync.Mutex
+	file    appendFile
+	path    string
+	begun   map[string]bool
+	done    map[string]bool
+	resumed bool
+}
+
+// Opens the journal of a grid directory, reading the entries of an
+// interrupted run if there was one.
+func openJournal(gridDir string) (*journal, error) {
+	j := &journal{
+		path:  filepath.Join(gridDir, journalFileName),
+		begun: map[string]bool{},
+		done:  map[string]bool{},
+	}
+
+	if existing, err := steamFS.ReadFile(j.path); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(existing))
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), " ", 2)
+			if len(fields) != 2 {
+				// Last line cut in the middle of writing.
+				continue
+			}
+			switch fields[0] {
+			case "begin":
+				j.begun[fields[1]] = true
+			case "done":
+				j.done[fields[1]] = true
+			}
+		}
+		j.resumed = len(j.begun) > 0 || len(j.done) > 0
+	}
+
+	file, err := steamFS.OpenAppend(j.path)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	return j, nil
+}
+
+func (j *journal) write(entry string, key string) error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	_, err := io.WriteString(j.file, entry+" "+key+"\n")
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Marks the start of saving an artwork.
+func (j *journal) begin(key string) error {
+	return j.write("begin", key)
+}
+
+// Marks an artwork as completely saved.
+func (j *journal) finish(key string) error {
+	err := j.write("done", key)
+	if j != nil {
+		j.mutex.Lock()
+		j.done[key] = true
+		j.mutex.Unlock()
+	}
+	return err
+}
+
+// Whether the artwork was finished by the interrupted run.
+func (j *journal) isDone(key string) bool {
+	if j == nil {
+		return false
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.done[key]
+}
+
+// Whether the interrupted run stopped while saving the artwork.
+func (j *journal) isInterrupted(key string) bool {
+	if j == nil {
+		return false
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.begun[key] && !j.done[key]
+}
+
+// Closes the journal. If the run was complete it's removed, so the next run
+// starts from scratch.
+func (j *journal) close(complete bool) error {
+	if j == nil {
+		return nil
+	}
+	err := j.file.Close()
+	if complete {
+		err = steamFS.Remove(j.path)
+	}
+	return err
+}
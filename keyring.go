@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// API keys can be kept in the credential store of the system instead of the
+// config file: DPAPI on Windows, the keychain on macOS and the secret service
+// on Linux (with secret-tool). See keyring_windows.go and keyring_other.go.
+//
+//	steamgrid login steamgriddb
+//
+// Keys from the keyring are used when no config file, variable or flag sets
+// them.
+
+// Name of the entries in the keyring.
+const keyringService = "steamgrid"
+
+// Lookups can hang if the keyring asks to be unlocked and nobody is there.
+const keyringTimeout = 5 * time.Second
+
+// Sources with an API key, by the name of their option.
+var keyringSources = map[string]string{
+	"steamgriddb": "SteamGridDB API key",
+	"igdb":        "IGDB API key",
+}
+
+// Pages where the API keys are shown, opened by the login command.
+// SteamGridDB has no OAuth or device flow for apps, the API key of the account
+// is the only login, so the best we can do is open the page with it and check
+// the key before saving.
+var keyringPages = map[string]string{
+	"steamgriddb": "https://www.steamgriddb.com/profile/preferences/api",
+	"igdb":        "https://api.igdb.com/signup",
+}
+
+// The login command asks for the API key of a source and stores it in the
+// keyring. With -forget it removes it.
+func runLoginCommand(args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	forget := flags.Bool("forget", false, "Remove the key from the keyring")
+	browser := flags.Bool("browser", interactive(), "Open the page with the key in the browser")
+	flags.Parse(args)
+
+	var sources []string
+	for source := range keyringSources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	if flags.NArg() != 1 || keyringSources[flags.Arg(0)] == "" {
+		return errors.New("Usage: steamgrid login [-forget] " + strings.Join(sources, "|"))
+	}
+	source := flags.Arg(0)
+
+	if *forget {
+		err := keyringDelete(source)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Removed the " + source + " key from the keyring.")
+		return nil
+	}
+
+	if *browser {
+		fmt.Println("Opening " + keyringPages[source] + ", log in and copy the key.")
+		if err := openBrowser(keyringPages[source]); err != nil {
+			fmt.Println(err.Error())
+		}
+	} else {
+		fmt.Println("Get the key from " + keyringPages[source])
+	}
+	fmt.Print(keyringSources[source] + ": ")
+	key, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return errors.New("No key given, nothing changed")
+	}
+	if source == "steamgriddb" {
+		err = checkSteamGridDBKey(interruptContext(), key)
+		if err != nil {
+			return err
+		}
+	}
+	err = keyringSet(source, key)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Saved the " + source + " key to the keyring. Remove it from the config file if it's there.")
+	return nil
+}
+
+// LoadKeyring adds the API keys of the keyring as the lowest layer of options,
+// for the keys not set globally by the file, the environment or the command
+// line. Returns the number of keys found.
+func (config *Config) LoadKeyring() int {
+	set := map[string]bool{}
+	for _, settings := range [][]ConfigSetting{config.Global, config.Environment, config.Overrides} {
+		for _, setting := range settings {
+			set[setting.Key] = true
+		}
+	}
+	config.Keyring = nil
+	for source := range keyringSources {
+		if set[source] {
+			continue
+		}
+		key, err := keyringGet(source)
+		if err != nil {
+			fmt.Println("Keyring: " + err.Error())
+			continue
+		}
+		if key != "" {
+			config.Keyring = append(config.Keyring, ConfigSetting{source, key, -2})
+		}
+	}
+	return len(config.Keyring)
+}
+
+// Makes a search with the key, to catch copy and paste mistakes before saving.
+// Only a rejected key is an error, the network may be down.
+func checkSteamGridDBKey(ctx context.Context, key string) error {
+	_, err := SteamGridDBGetRequest(ctx, SteamGridDBBaseURL+"/search/autocomplete/portal", key)
+	if err != nil && err.Error() == "401" {
+		return errors.New("SteamGridDB rejected the key, check that it was copied completely")
+	} else if err != nil {
+		fmt.Println("Could not check the key: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// No keyring tool is installed.
+var errNoKeyring = errors.New("No keyring found, install secret-tool (libsecret)")
+
+// Runs the keyring tool of the system: security on macOS, secret-tool on the
+// others.
+func runKeyringTool(stdin string, args ...string) (string, error) {
+	tool := "secret-tool"
+	if runtime.GOOS == "darwin" {
+		tool = "security"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", errNoKeyring
+	}
+	if ctx.Err() != nil {
+		return "", errors.New(tool + " timed out, is the keyring locked?")
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v failed: %w %v", tool, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Returns the key of a source, or "" if there's none.
+func keyringGet(source string) (string, error) {
+	var key string
+	var err error
+	if runtime.GOOS == "darwin" {
+		key, err = runKeyringTool("", "find-generic-password", "-s", keyringService, "-a", source, "-w")
+	} else {
+		key, err = runKeyringTool("", "lookup", "service", keyringService, "source", source)
+	}
+	var exitErr *exec.ExitError
+	if err == errNoKeyring || errors.As(err, &exitErr) {
+		// Both tools fail when the key isn't there.
+		return "", nil
+	}
+	return key, err
+}
+
+func keyringSet(source string, key string) error {
+	var err error
+	if runtime.GOOS == "darwin" {
+		// Read as a command from stdin by the interactive mode, to keep the
+		// secret out of the process list. -U updates an existing entry.
+		if strings.ContainsAny(key, "\r\n") {
+			return errors.New("Keys can't have line breaks")
+		}
+		quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		command := fmt.Sprintf("add-generic-password -U -s \"%v\" -a \"%v\" -w \"%v\"\n", quote.Replace(keyringService), quote.Replace(source), quote.Replace(key))
+		_, err = runKeyringTool(command, "-i")
+	} else {
+		// The secret is read from stdin, to keep it out of the process list.
+		_, err = runKeyringTool(key, "store", "--label=steamgrid "+source, "service", keyringService, "source", source)
+	}
+	return err
+}
+
+func keyringDelete(source string) error {
+	var err error
+	if runtime.GOOS == "darwin" {
+		_, err = runKeyringTool("", "delete-generic-password", "-s", keyringService, "-a", source)
+	} else {
+		_, err = runKeyringTool("", "clear", "service", keyringService, "source", source)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Windows has no keyring to ask by name, so keys are encrypted with DPAPI for
+// the current user and saved in %APPDATA%\steamgrid\<source>.key. Other users
+// and other computers can't decrypt them.
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = syscall.NewLazyDLL("kernel32.dll").NewProc("LocalFree")
+)
+
+// DATA_BLOB of the DPAPI calls.
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+// Don't show any prompt.
+const cryptProtectUIForbidden = 0x1
+
+// Calls CryptProtectData or CryptUnprotectData, which take the same arguments.
+func dpapi(proc *syscall.LazyProc, input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return nil, errors.New("Nothing to encrypt or decrypt")
+	}
+	in := dataBlob{uint32(len(input)), &input[0]}
+	var out dataBlob
+	result, _, err := proc.Call(uintptr(unsafe.Pointer(&in)), 0, 0, 0, 0, cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if result == 0 {
+		return nil, err
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.data)))
+	return append([]byte(nil), unsafe.Slice(out.data, out.size)...), nil
+}
+
+func keyringPath(source string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, keyringService, source+".key"), nil
+}
+
+// Returns the key of a source, or "" if there's none.
+func keyringGet(source string) (string, error) {
+	path, err := keyringPath(source)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return "", errors.New("Corrupted key file " + path + ": " + err.Error())
+	}
+	key, err := dpapi(procCryptUnprotectData, encrypted)
+	if err != nil {
+		return "", errors.New("Could not decrypt " + path + ": " + err.Error())
+	}
+	return string(key), nil
+}
+
+func keyringSet(source string, key string) error {
+	path, err := keyringPath(source)
+	if err != nil {
+		return err
+	}
+	encrypted, err := dpapi(procCryptProtectData, []byte(key))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, []byte(base64.StdEncoding.EncodeToString(encrypted)))
+}
+
+func keyringDelete(source string) error {
+	path, err := keyringPath(source)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
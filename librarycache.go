@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// Steam keeps the official artwork of Steam apps in appcache/librarycache.
+// Older clients name the files after the app, like 620_library_600x900.jpg,
+// newer ones put them in a directory per app, sometimes in a subdirectory
+// named after a hash. Some views of newer clients show the cached files
+// instead of the custom artwork of the grid. With the library cache option
+// the artwork is also written over the cached files, again on every run
+// because Steam refreshes its cache now and then.
+//
+// Only files already in the cache are replaced, apps Steam hasn't cached yet
+// show the grid artwork anyway. Steam reads the images by their content, so a
+// PNG in a .jpg file works. Deleting the files makes Steam download the
+// official artwork again.
+//
+// The cache is shared by all users of the installation, while the grid is
+// not: the artwork of one user would be written over that of the others, and
+// the last run would win. So the cache is only written when the installation
+// has a single user.
+
+// Names of the artwork in the library cache.
+var libraryCacheNames = map[string]string{
+	"Banner": "header.jpg",
+	"Cover":  "library_600x900.jpg",
+	"Hero":   "library_hero.jpg",
+	"Logo":   "logo.png",
+}
+
+// The library cache of the Steam installation the grid directory is in,
+// userdata/<user>/config/grid.
+func libraryCacheDir(gridDir string) string {
+	return filepath.Join(gridDir, "..", "..", "..", "..", "appcache", "librarycache")
+}
+
+// Finds the cached files of an artwork of the game, in both layouts.
+func findLibraryCacheFiles(cacheDir string, game *Game, artStyle string) []string {
+	name, ok := libraryCacheNames[artStyle]
+	if !ok || game.Custom || isCustomID(game.ID) {
+		return nil
+	}
+	var paths []string
+	if _, err := steamFS.Stat(filepath.Join(cacheDir, game.ID+"_"+name)); err == nil {
+		paths = append(paths, filepath.Join(cacheDir, game.ID+"_"+name))
+	}
+	for _, pattern := range []string{filepath.Join(cacheDir, game.ID, name), filepath.Join(cacheDir, game.ID, "*", name)} {
+		matches, _ := steamFS.Glob(pattern)
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+// Writes the final image over the cached files of the artwork, if the option
+// is set and the installation has a single user.
+func writeLibraryCache(opts *Options, gridDir string, game *Game, artStyle string) error {
+	if !opts.LibraryCache || opts.severalUsers {
+		return nil
+	}
+	for _, path := range findLibraryCacheFiles(libraryCacheDir(gridDir), game, artStyle) {
+		err := steamFS.WriteFile(path, game.OverlayImageBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
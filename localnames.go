@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Names of games in the language of the Steam client. Community art of some
+// games is tagged only under their original title, like Japanese games, so
+// the sources that search by name also try the localized name.
+
+// Basic store details in the given language, like "japanese" or "schinese".
+const steamLocalizedDetailsFormat = `https://store.steampowered.com/api/appdetails?appids=%v&l=%v&filters=basic`
+
+// Returns the language option, detecting the Steam client language for
+// "auto", see registry.go. English names are already known, so they give "".
+func getLanguage(opts *Options) string {
+	language := strings.ToLower(strings.TrimSpace(opts.Language))
+	if language == "auto" {
+		steamDir, _ := GetSteamInstallation(opts.SteamDir)
+		language = steamLanguage(steamDir)
+	}
+	if language == "english" {
+		return ""
+	}
+	return language
+}
+
+// Returns the name of a Steam game in the given language, or "" if the store
+// has none.
+func getLocalizedName(ctx context.Context, gameID string, language string) (string, error) {
+	response, err := tryDownload(ctx, fmt.Sprintf(steamLocalizedDetailsFormat, gameID, language))
+	if err != nil || response == nil {
+		return "", err
+	}
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	var jsonResponse map[string]struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(responseBytes, &jsonResponse)
+	if err != nil {
+		return "", err
+	}
+	entry := jsonResponse[gameID]
+	if !entry.Success {
+		return "", nil
+	}
+	return strings.TrimSpace(entry.Data.Name), nil
+}
+
+// Sets game.LocalizedName if the game has another name in the language.
+func addLocalizedName(ctx context.Context, game *Game, language string) error {
+	if language == "" || game.Custom || isCustomID(game.ID) {
+		return nil
+	}
+	name, err := getLocalizedName(ctx, game.ID, language)
+	if err != nil {
+		return err
+	}
+	if name != "" && !strings.EqualFold(name, game.Name) {
+		game.LocalizedName = name
+	}
+	return nil
+}
+
+// Copy of the game under its localized name, for the sources that search by
+// name. It's marked as custom so SteamGridDB searches by name instead of
+// asking for the app ID again.
+func localizedGame(game *Game) *Game {
+	localized := *game
+	localized.Name = game.LocalizedName
+	localized.Custom = true
+	return &localized
+}
+
+// The sources that search by name again, with the localized name.
+func localizedSources(ctx context.Context, game *Game, artStyle string, artStyleExtensions []string, opts *Options) []candidateSource {
+	var sources []candidateSource
+	localized := localizedGame(game)
+
+	if opts.SteamGridDBApiKey != "" {
+		sources = append(sources, candidateSource{"SteamGridDB localized", func() ([]*Candidate, error) {
+			candidates, err := getSteamGridDBImages(ctx, localized, artStyleExtensions, opts.SteamGridDBApiKey, opts.steamGridFilter(), opts.SafeMode)
+			for _, candidate := range candidates {
+				candidate.From = "SteamGridDB (" + game.LocalizedName + ")"
+			}
+			return candidates, err
+		}})
+	}
+
+	if artStyle == "Cover" && opts.IGDBApiKey != "" {
+		sources = append(sources, candidateSource{"IGDB localized", func() ([]*Candidate, error) {
+			url, err := getIGDBImage(ctx, localized.Name, opts.IGDBApiKey)
+			return urlCandidate(url, "IGDB ("+game.LocalizedName+")", 0.5), err
+		}})
+	}
+
+	urlSources, _ := getURLSources(opts)
+	for _, source := range urlSources {
+		source := source
+		if !strings.Contains(source.template, "{name}") {
+			continue
+		}
+		sources = append(sources, candidateSource{"url source localized", func() ([]*Candidate, error) {
+			url, err := getURLSourceImage(ctx, source, localized, artStyleExtensions)
+			return unmoderated(urlCandidate(url, "url source ("+game.LocalizedName+")", 0.4)), err
+		}})
+	}
+	return sources
+}
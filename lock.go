@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Only one run at a time may change the grid directories of a Steam
+// installation, or a scheduled run and a manual one would overwrite each
+// other's images and backups. The lock is a file in the Steam directory with
+// the process that holds it. The holder touches it regularly, so the lock of a
+// crashed run goes stale and is taken over, without having to ask the system
+// if the process is still alive. The contents tell the holders apart: a run
+// only refreshes or removes the lock while it still has its contents, and a
+// stale lock is moved away and checked before it's taken over, so two waiters
+// can't remove each other's new lock.
+const lockFileName = "steamgrid.lock"
+
+const (
+	lockRefresh = 10 * time.Second
+	lockStale   = time.Minute
+)
+
+// A held lock, released with release.
+type runLock struct {
+	path   string
+	holder []byte
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Takes the lock of a Steam installation. If another run holds it, waits up
+// to the given time for it to finish.
+func acquireLock(ctx context.Context, installationDir string, wait time.Duration) (*runLock, error) {
+	path := filepath.Join(installationDir, lockFileName)
+	deadline := time.Now().Add(wait)
+	waiting := false
+	for {
+		hostname, _ := os.Hostname()
+		holder := []byte(fmt.Sprintf("pid %v on %v since %v\n", os.Getpid(), hostname, time.Now().Format(time.RFC3339Nano)))
+		err := steamFS.CreateExclusive(path, holder)
+		if err == nil {
+			lock := &runLock{path, holder, make(chan struct{}), make(chan struct{})}
+			go lock.refresh()
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		stat, err := steamFS.Stat(path)
+		if err == nil && time.Since(stat.ModTime()) > lockStale {
+			if takeOverLock(path) {
+				fmt.Println("Took over the lock of a run that stopped without releasing it")
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			holder, _ := steamFS.ReadFile(path)
+			return nil, errors.New("Another steamgrid run (" + strings.TrimSpace(string(holder)) + ") is changing " + installationDir + ". Wait for it to finish, or pass -lockwait 10m to wait for it")
+		}
+		if !waiting {
+			fmt.Println("Waiting for another steamgrid run to finish...")
+			waiting = true
+		}
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Moves a stale lock away, so the next try can create a new one. If another
+// waiter was faster and the lock moved away is already its new one, it's put
+// back. Returns if the stale lock was removed.
+func takeOverLock(path string) bool {
+	stale, err := steamFS.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	moved := fmt.Sprintf("%v.%v-%v.stale", path, os.Getpid(), time.Now().UnixNano())
+	if err = steamFS.Rename(path, moved); err != nil {
+		// Someone else moved it first.
+		return false
+	}
+	movedBytes, err := steamFS.ReadFile(moved)
+	if err == nil && !bytes.Equal(movedBytes, stale) {
+		steamFS.Rename(moved, path)
+		return false
+	}
+	steamFS.Remove(moved)
+	return err == nil
+}
+
+// Tells if the lock file still has our contents.
+func (lock *runLock) held() bool {
+	holder, err := steamFS.ReadFile(lock.path)
+	return err == nil && bytes.Equal(holder, lock.holder)
+}
+
+// Keeps the lock from going stale until it's released.
+func (lock *runLock) refresh() {
+	defer close(lock.done)
+	ticker := time.NewTicker(lockRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			if !lock.held() {
+				fmt.Println("The lock of this run was taken over by another run")
+				return
+			}
+			// Written again for a new modification time, works remotely too.
+			steamFS.WriteFile(lock.path, lock.holder)
+		}
+	}
+}
+
+func (lock *runLock) release() {
+	close(lock.stop)
+	<-lock.done
+	if lock.held() {
+		steamFS.Remove(lock.path)
+	}
+}
+
+// A lock of an installation shared by the runs and applies of one process,
+// like a server that starts full runs and applies single images meanwhile.
+// The file lock is taken by the first one and released by the last one, so
+// an apply doesn't wait for the run it interrupts.
+type sharedLock struct {
+	installationDir string
+	wait            time.Duration
+	mutex           sync.Mutex
+	lock            *runLock
+	users           int
+}
+
+func newSharedLock(installationDir string, wait time.Duration) *sharedLock {
+	return &sharedLock{installationDir: installationDir, wait: wait}
+}
+
+// Takes the lock, or shares it if the process already holds it. The lock
+// is held until every acquire is released.
+func (shared *sharedLock) acquire(ctx context.Context) (func(), error) {
+	shared.mutex.Lock()
+	defer shared.mutex.Unlock()
+	if shared.lock == nil {
+		lock, err := acquireLock(ctx, shared.installationDir, shared.wait)
+		if err != nil {
+			return nil, err
+		}
+		shared.lock = lock
+	}
+	shared.users++
+	var once sync.Once
+	return func() {
+		once.Do(shared.release)
+	}, nil
+}
+
+func (shared *sharedLock) release() {
+	shared.mutex.Lock()
+	defer shared.mutex.Unlock()
+	shared.users--
+	if shared.users == 0 {
+		shared.lock.release()
+		shared.lock = nil
+	}
+}
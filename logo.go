@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Steam reads the position of the logo over the hero from <appid>.json in
+// the grid directory. Without it the logo is centered, which usually covers
+// the most interesting part of the hero.
+type logoPositionFile struct {
+	Version      int          `json:"nVersion"`
+	LogoPosition logoPosition `json:"logoPosition"`
+}
+
+type logoPosition struct {
+	PinnedPosition string  `json:"pinnedPosition"`
+	WidthPct       float64 `json:"nWidthPct"`
+	HeightPct      float64 `json:"nHeightPct"`
+}
+
+// Positions supported by the Steam client.
+var logoPinnedPositions = []string{"BottomLeft", "UpperLeft", "CenterCenter", "UpperCenter", "BottomCenter"}
+
+func validateLogoPosition(opts *Options) error {
+	for _, position := range logoPinnedPositions {
+		if strings.EqualFold(position, opts.LogoPosition) {
+			opts.LogoPosition = position
+			if opts.LogoWidth <= 0 || opts.LogoWidth > 100 || opts.LogoHeight <= 0 || opts.LogoHeight > 100 {
+				return errors.New("Logo width and height must be percentages between 0 and 100")
+			}
+			return nil
+		}
+	}
+	return errors.New("Invalid logo position " + opts.LogoPosition + ", must be one of " + strings.Join(logoPinnedPositions, ", "))
+}
+
+// Writes the logo position for a game, unless it already has one (made by the
+// user in the Steam client or by a previous run). A <appid>.json in the
+// directory 'games' overrides the options.
+func writeLogoPosition(opts *Options, overridePath string, gridDir string, game *Game) error {
+	positionPath := filepath.Join(gridDir, game.ID+".json")
+
+	override, err := ioutil.ReadFile(filepath.Join(overridePath, game.ID+".json"))
+	if err == nil {
+		return steamFS.WriteFile(positionPath, override)
+	}
+
+	if _, err := steamFS.Stat(positionPath); err == nil {
+		return nil
+	}
+
+	positionBytes, err := json.Marshal(logoPositionFile{1, logoPosition{opts.LogoPosition, opts.LogoWidth, opts.LogoHeight}})
+	if err != nil {
+		return err
+	}
+	return steamFS.WriteFile(positionPath, positionBytes)
+}
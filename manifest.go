@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The manifest in grid/steamgrid.json records the state of every artwork
+// after a run, so the next run can tell what changed.
+const manifestFileName = "steamgrid.json"
+
+// Artwork states in the manifest.
+const (
+	artworkOK      = "ok"
+	artworkMissing = "missing"
+	artworkFailed  = "failed"
+	// Waiting for approval, see quarantine.go.
+	artworkQuarantined = "quarantined"
+)
+
+type manifestEntry struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ArtStyle string `json:"artStyle"`
+	Status   string `json:"status"`
+	Source   string `json:"source,omitempty"`
+	// Hash of the image in the grid.
+	Hash string `json:"hash,omitempty"`
+	// Sources tried in this run, if it searched for the image.
+	Chain sourceChain `json:"chain,omitempty"`
+	// Hash of the game in the library, see update.go.
+	Library string `json:"library,omitempty"`
+	// Set by users or other tools to keep the artwork as it is, see
+	// gamelocks.go.
+	Locked bool `json:"locked,omitempty"`
+}
+
+type manifest struct {
+	Version  int                      `json:"version"`
+	Time     time.Time                `json:"time"`
+	Artworks map[string]manifestEntry `json:"artworks"`
+}
+
+// Changes compared to the previous run, by artwork.
+type ManifestChange struct {
+	Game     string
+	ID       string
+	ArtStyle string
+	// "new", "replaced" or "failing".
+	Kind string
+}
+
+func loadManifest(gridDir string) *manifest {
+	m := &manifest{Version: 1, Artworks: map[string]manifestEntry{}}
+	manifestBytes, err := steamFS.ReadFile(filepath.Join(gridDir, manifestFileName))
+	if err == nil {
+		json.Unmarshal(manifestBytes, m)
+	}
+	if m.Artworks == nil {
+		m.Artworks = map[string]manifestEntry{}
+	}
+	return m
+}
+
+// Records the state of an artwork in the result, for the manifest of the
+// grid directory.
+func (result *Result) recordArtwork(gridDir string, game *Game, artStyle string, artStyleExtensions []string, status string) {
+	entry := manifestEntry{ID: game.ID, Name: game.Name, ArtStyle: artStyle, Status: status, Source: game.ImageSource, Chain: game.SourceChain, Library: game.LibraryHash}
+	if status == artworkOK {
+		entry.Hash = imageHash(game.OverlayImageBytes)
+	}
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+	if result.artworks == nil {
+		result.artworks = map[string]map[string]manifestEntry{}
+	}
+	if result.artworks[gridDir] == nil {
+		result.artworks[gridDir] = map[string]manifestEntry{}
+	}
+	result.artworks[gridDir][game.ID+artStyleExtensions[0]] = entry
+}
+
+// Compares the artworks of this run with the manifest, adds the changes to
+// the result and writes the updated manifest. Artworks not processed in this
+// run keep their previous state.
+func (result *Result) updateManifest(gridDir string) error {
+	previous := loadManifest(gridDir)
+	updated := &manifest{Version: 1, Time: time.Now(), Artworks: map[string]manifestEntry{}}
+	for key, entry := range previous.Artworks {
+		updated.Artworks[key] = entry
+	}
+
+	result.mutex.Lock()
+	current := result.artworks[gridDir]
+	keys := make([]string, 0, len(current))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := current[key]
+		before, existed := previous.Artworks[key]
+		kind := ""
+		switch {
+		case entry.Status == artworkOK && (!existed || before.Status != artworkOK):
+			kind = "new"
+		case entry.Status == artworkOK && before.Hash != entry.Hash:
+			kind = "replaced"
+		case entry.Status != artworkOK && existed && before.Status == artworkOK:
+			kind = "failing"
+		}
+		if kind != "" {
+			result.Changes = append(result.Changes, ManifestChange{entry.Name, entry.ID, entry.ArtStyle, kind})
+		}
+		updated.Artworks[key] = entry
+	}
+	result.mutex.Unlock()
+	return updated.save(gridDir)
+}
+
+func (m *manifest) save(gridDir string) error {
+	manifestBytes, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return steamFS.WriteFile(filepath.Join(gridDir, manifestFileName), manifestBytes)
+}
+
+func printChanges(changes []ManifestChange) {
+	if len(changes) == 0 {
+		return
+	}
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Kind]++
+	}
+	fmt.Printf("Compared to the last run: %v new, %v replaced and %v newly failing.\n", counts["new"], counts["replaced"], counts["failing"])
+	for _, change := range changes {
+		fmt.Printf("%v %v (id %v, %v)\n", map[string]string{"new": "+", "replaced": "~", "failing": "-"}[change.Kind], change.Game, change.ID, change.ArtStyle)
+	}
+	fmt.Printf("\n\n")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Soundtracks and videos are apps too, and clutter the results with game art
+// or search junk. The media option skips them, or gives them a simple
+// generated cover like album art instead of searching.
+const (
+	mediaSkip  = "skip"
+	mediaCover = "cover"
+)
+
+// Kinds of media by store app type.
+var mediaTypes = map[string]string{
+	"music":   "Soundtrack",
+	"video":   "Video",
+	"series":  "Video",
+	"episode": "Video",
+}
+
+// Soundtracks without store details still have it in the name.
+var soundtrackNamePattern = regexp.MustCompile(`(?i)\b(soundtrack|ost)\b`)
+
+// Sets game.MediaType from the store app type, or the name.
+func classifyMedia(game *Game, appType string) {
+	if kind, ok := mediaTypes[appType]; ok {
+		game.MediaType = kind
+	} else if soundtrackNamePattern.MatchString(game.Name) {
+		game.MediaType = mediaTypes["music"]
+	}
+}
+
+func validateMedia(opts *Options) error {
+	switch opts.Media {
+	case "", mediaSkip, mediaCover:
+		return nil
+	}
+	return errors.New("Unknown media handling " + opts.Media + ", must be skip or cover")
+}
+
+// Source with a generated image for media apps, instead of all the others.
+func mediaSource(game *Game, artStyle string, artStyleExtensions []string) candidateSource {
+	return candidateSource{"generated", func() ([]*Candidate, error) {
+		width, _ := strconv.Atoi(artStyleExtensions[3])
+		height, _ := strconv.Atoi(artStyleExtensions[4])
+		imageBytes, err := encodeImage(drawMediaCover(templateName(game), game.MediaType, width, height, artStyle == "Logo"), ".png")
+		if err != nil {
+			return nil, err
+		}
+		return []*Candidate{&Candidate{ImageBytes: imageBytes, From: "generated " + strings.ToLower(game.MediaType) + " art", Trust: 1}}, nil
+	}}
+}
+
+// Draws an album art style image: a dark background colored by the name, a
+// record, and the name with the kind of media. Logos only have the text.
+func drawMediaCover(name string, kind string, width int, height int, logo bool) image.Image {
+	cover := image.NewRGBA(image.Rect(0, 0, width, height))
+	if !logo {
+		hash := fnv.New32a()
+		hash.Write([]byte(name))
+		hue := float64(hash.Sum32()%360) / 360
+		top, bottom := hslColor(hue, 0.45, 0.28), hslColor(hue, 0.5, 0.1)
+		for y := 0; y < height; y++ {
+			t := float64(y) / float64(height)
+			rowColor := color.RGBA{
+				uint8(float64(top.R)*(1-t) + float64(bottom.R)*t),
+				uint8(float64(top.G)*(1-t) + float64(bottom.G)*t),
+				uint8(float64(top.B)*(1-t) + float64(bottom.B)*t),
+				255,
+			}
+			for x := 0; x < width; x++ {
+				cover.SetRGBA(x, y, rowColor)
+			}
+		}
+		if kind == mediaTypes["music"] {
+			drawRecord(cover, hslColor(hue, 0.6, 0.55))
+		}
+	}
+
+	// Name in the lower part, kind of media below it. Wide images have the
+	// record on the right and the text on the left.
+	textTop, textCenter, textWidth := height*2/3, width/2, width*9/10
+	if logo {
+		textTop = height / 3
+	} else if width > height {
+		textTop, textCenter, textWidth = height*2/5, width*3/8, width*2/3
+	}
+	nameHeight := drawCenteredText(cover, name, textCenter, textTop, textWidth, height/10, color.White)
+	drawCenteredText(cover, strings.ToUpper(kind), textCenter, textTop+nameHeight+height/40, textWidth*2/3, height/20, color.RGBA{200, 200, 200, 255})
+	return cover
+}
+
+// Draws a record with grooves and a colored label, centered in the upper part
+// of portrait images and on the right of wide ones.
+func drawRecord(img *image.RGBA, label color.RGBA) {
+	size := img.Bounds().Size()
+	centerX, centerY := float64(size.X)/2, float64(size.Y)/3
+	radius := math.Min(float64(size.X), float64(size.Y)) * 0.3
+	if size.X > size.Y {
+		centerX, centerY = float64(size.X)*0.75, float64(size.Y)/2
+		radius = float64(size.Y) * 0.4
+	}
+	for y := int(centerY - radius); y <= int(centerY+radius); y++ {
+		for x := int(centerX - radius); x <= int(centerX+radius); x++ {
+			distance := math.Hypot(float64(x)-centerX, float64(y)-centerY) / radius
+			switch {
+			case distance > 1:
+				continue
+			case distance < 0.05:
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			case distance < 0.35:
+				img.SetRGBA(x, y, label)
+			case int(distance*60)%3 == 0:
+				img.SetRGBA(x, y, color.RGBA{40, 40, 40, 255})
+			default:
+				img.SetRGBA(x, y, color.RGBA{15, 15, 15, 255})
+			}
+		}
+	}
+}
+
+// Draws a line of text centered horizontally at center, scaled to fit
+// maxWidth and at most maxHeight. Returns the height of the text drawn.
+func drawCenteredText(img *image.RGBA, text string, center int, top int, maxWidth int, maxHeight int, textColor color.Color) int {
+	line := renderText(text, maxHeight, textColor)
+	if line == nil {
+		return 0
+	}
+	size := line.Bounds().Size()
+	scale := math.Min(1, float64(maxWidth)/float64(size.X))
+	scaledWidth := int(float64(size.X) * scale)
+	scaledHeight := int(float64(size.Y) * scale)
+	left := center - scaledWidth/2
+	draw.ApproxBiLinear.Scale(img, image.Rect(left, top, left+scaledWidth, top+scaledHeight), line, line.Bounds(), draw.Over, nil)
+	return scaledHeight
+}
+
+// Converts hue, saturation and lightness, all from 0 to 1, to RGB.
+func hslColor(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h*6, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch int(h * 6) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 255}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics of a run, for the summary. Safe for concurrent use.
+type Metrics struct {
+	mutex sync.Mutex
+
+	Requests        int
+	BytesDownloaded int64
+	// Artworks with an existing image (backup, override or customization)
+	// versus ones that had to be searched.
+	CacheHits   int
+	CacheMisses int
+	// Times each source was asked and found an image, by source name.
+	SourceTried map[string]int
+	SourceFound map[string]int
+	// Total time spent in each stage. Stages done by several workers add up
+	// their times.
+	StageTimes map[string]time.Duration
+	// Time spent waiting for the network by stage, see profiling.go.
+	NetworkTimes map[string]time.Duration
+	// Print where the time went, see profiling.go.
+	Profile bool
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		SourceTried:  map[string]int{},
+		SourceFound:  map[string]int{},
+		StageTimes:   map[string]time.Duration{},
+		NetworkTimes: map[string]time.Duration{},
+	}
+}
+
+// The methods do nothing on nil metrics.
+
+func (m *Metrics) addStage(stage string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.StageTimes[stage] += time.Since(start)
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) addSource(source string, found bool) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.SourceTried[source]++
+	if found {
+		m.SourceFound[source]++
+	}
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) addCache(hit bool) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	if hit {
+		m.CacheHits++
+	} else {
+		m.CacheMisses++
+	}
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) downloaded() int64 {
+	if m == nil {
+		return 0
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.BytesDownloaded
+}
+
+func (m *Metrics) addDownload(bytes int64, request bool) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.BytesDownloaded += bytes
+	if request {
+		m.Requests++
+	}
+	m.mutex.Unlock()
+}
+
+// Counts the requests and downloaded bytes of all HTTP clients.
+type countingTransport struct {
+	base    http.RoundTripper
+	mutex   sync.Mutex
+	metrics *Metrics
+}
+
+// Starts counting the downloads of the default transport into the metrics.
+func countDownloads(metrics *Metrics) {
+	counting, ok := http.DefaultTransport.(*countingTransport)
+	if !ok {
+		counting = &countingTransport{base: http.DefaultTransport}
+		http.DefaultTransport = counting
+	}
+	counting.mutex.Lock()
+	counting.metrics = metrics
+	counting.mutex.Unlock()
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	metrics := t.metrics
+	t.mutex.Unlock()
+
+	start := time.Now()
+	response, err := t.base.RoundTrip(req)
+	metrics.addDownload(0, true)
+	if err != nil {
+		metrics.addNetwork(stageOf(req.Context()), start)
+	} else {
+		response.Body = &countingReader{ReadCloser: response.Body, metrics: metrics, stage: stageOf(req.Context()), start: start}
+	}
+	return response, err
+}
+
+// Counts the bytes of a response body, and the time until it was read.
+type countingReader struct {
+	io.ReadCloser
+	metrics *Metrics
+	stage   string
+	start   time.Time
+	once    sync.Once
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.metrics.addDownload(int64(n), false)
+	if err != nil {
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	r.finish()
+	return r.ReadCloser.Close()
+}
+
+func (r *countingReader) finish() {
+	r.once.Do(func() {
+		r.metrics.addNetwork(r.stage, r.start)
+	})
+}
+
+func printMetrics(m *Metrics) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Printf("%v requests, %.1f MB downloaded.\n", m.Requests, float64(m.BytesDownloaded)/1024/1024)
+	if total := m.CacheHits + m.CacheMisses; total > 0 {
+		fmt.Printf("%v of %v artworks (%.0f%%) already had an image.\n", m.CacheHits, total, 100*float64(m.CacheHits)/float64(total))
+	}
+
+	var sources []string
+	for source := range m.SourceTried {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		tried, found := m.SourceTried[source], m.SourceFound[source]
+		fmt.Printf("* %v: found %v of %v (%.0f%%)\n", source, found, tried, 100*float64(found)/float64(tried))
+	}
+
+	var stages []string
+	for stage := range m.StageTimes {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		if network := m.NetworkTimes[stage]; m.Profile && network > 0 {
+			fmt.Printf("* %v: %v, %v of it waiting for the network\n", stage, m.StageTimes[stage].Round(time.Millisecond), network.Round(time.Millisecond))
+			continue
+		}
+		fmt.Printf("* %v: %v\n", stage, m.StageTimes[stage].Round(time.Millisecond))
+	}
+	if m.Profile {
+		printBottleneck(m)
+	}
+	fmt.Printf("\n\n")
+}
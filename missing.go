@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Search page on SteamGridDB, to request or upload missing artwork.
+const steamGridDBSearchFormat = "https://www.steamgriddb.com/search/grids?term=%v"
+
+// At most this many pages are opened with the open missing option, so a big
+// library doesn't flood the browser.
+const maxOpenedMissing = 10
+
+// Names of the art styles on SteamGridDB.
+var steamGridDBTypeNames = map[string]string{
+	"Banner": "grid",
+	"Cover":  "grid (portrait)",
+	"Hero":   "hero",
+	"Logo":   "logo",
+}
+
+type missingArt struct {
+	ID    string
+	Name  string
+	Types []string
+}
+
+// Games with artwork that couldn't be found, with the missing types in
+// SteamGridDB's names.
+func collectMissing(result *Result) []missingArt {
+	byID := map[string]*missingArt{}
+	for artStyle, games := range result.NotFound {
+		for _, game := range games {
+			missing, ok := byID[game.ID]
+			if !ok {
+				missing = &missingArt{ID: game.ID, Name: game.Name}
+				byID[game.ID] = missing
+			}
+			missing.Types = append(missing.Types, steamGridDBTypeNames[artStyle])
+		}
+	}
+
+	list := make([]missingArt, 0, len(byID))
+	for _, missing := range byID {
+		sort.Strings(missing.Types)
+		list = append(list, *missing)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func missingLink(missing missingArt) string {
+	return fmt.Sprintf(steamGridDBSearchFormat, url.QueryEscape(missing.Name))
+}
+
+// Writes the games with missing artwork as CSV: appid, name, the missing
+// types and a link to search the game on SteamGridDB.
+func writeMissingList(path string, list []missingArt) error {
+	buf := new(bytes.Buffer)
+	writer := csv.NewWriter(buf)
+	writer.Write([]string{"appid", "name", "missing", "link"})
+	for _, missing := range list {
+		writer.Write([]string{missing.ID, missing.Name, strings.Join(missing.Types, ", "), missingLink(missing)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return writeRunOutput(path, buf.Bytes())
+}
+
+// Opens the SteamGridDB pages of the first games with missing artwork.
+func openMissing(list []missingArt) {
+	for i, missing := range list {
+		if i == maxOpenedMissing {
+			fmt.Printf("Opened the first %v of %v games with missing artwork.\n", maxOpenedMissing, len(list))
+			break
+		}
+		if missing.Name == "" {
+			continue
+		}
+		if err := openBrowser(missingLink(missing)); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
+}
+
+// Opens an URL in the default browser.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Default template for backups in grid/originals. The hash is required to
+// know if the image in the grid is still the one we made from the backup.
+const defaultBackupName = "{appid}{suffix} {hash}"
+
+// Default template for the alternate output layout.
+const defaultOutputName = "{name}/{type}"
+
+// Characters that can't be used in file names on Windows.
+var invalidNameCharacters = strings.NewReplacer("<", "-", ">", "-", ":", "-", "\"", "-", "/", "-", "\\", "-", "|", "-", "?", "-", "*", "-")
+
+// Characters with special meaning in filepath.Glob.
+var globCharacters = strings.NewReplacer("*", "?", "[", "?", "]", "?", "\\", "?")
+
+// Expands a naming template. Supported placeholders are:
+//
+//	{appid}  the game ID
+//	{name}   the game name, or the ID if it has no name
+//	{type}   the art style: banner, cover, hero or logo
+//	{suffix} the suffix Steam uses for the art style: "", "p", "_hero" or "_logo"
+//	{hash}   hash of the image with overlays
+//
+// Slashes in the template create directories. The image extension is not part
+// of the template and is appended by the caller.
+func expandNameTemplate(template string, game *Game, artStyleExtensions []string, hash string) string {
+	return expandTemplate(template, game.ID, templateName(game), artStyleExtensions, hash)
+}
+
+// Like expandNameTemplate, but returns a glob pattern matching any hash.
+func globNameTemplate(template string, game *Game, artStyleExtensions []string) string {
+	return expandTemplate(template, globCharacters.Replace(game.ID), globCharacters.Replace(templateName(game)), artStyleExtensions, "*")
+}
+
+// Game name usable in file names.
+func templateName(game *Game) string {
+	if game.Name == "" {
+		return game.ID
+	}
+	return strings.TrimSpace(invalidNameCharacters.Replace(game.Name))
+}
+
+func expandTemplate(template string, id string, name string, artStyleExtensions []string, hash string) string {
+	replacer := strings.NewReplacer(
+		"{appid}", id,
+		"{name}", name,
+		"{type}", strings.TrimPrefix(artStyleExtensions[1], "."),
+		"{suffix}", artStyleExtensions[0],
+		"{hash}", hash,
+	)
+	return filepath.FromSlash(replacer.Replace(template))
+}
+
+// Placeholders of the naming templates, to find the literal text between them.
+var namePlaceholders = strings.NewReplacer("{appid}", "", "{name}", "", "{type}", "", "{suffix}", "", "{hash}", "")
+
+// Checks the naming templates of the options for obvious mistakes. Backups of
+// different games and art styles must never get the same name, and the hash
+// must be told apart from the game, or cleaning up one artwork would remove the
+// backups of another.
+func validateNameTemplates(opts *Options) error {
+	template := opts.BackupName
+	if !strings.Contains(template, "{hash}") {
+		return errors.New("The backup name template must contain {hash}, got: " + template)
+	}
+	if !strings.Contains(template, "{appid}") && !strings.Contains(template, "{name}") {
+		return errors.New("The backup name template must contain {appid} or {name}, got: " + template)
+	}
+	if !strings.Contains(template, "{type}") && !strings.Contains(template, "{suffix}") {
+		return errors.New("The backup name template must contain {type} or {suffix}, got: " + template)
+	}
+	hash := strings.Index(template, "{hash}")
+	for _, placeholder := range []string{"{appid}", "{name}"} {
+		position := strings.Index(template, placeholder)
+		if position == -1 {
+			continue
+		}
+		between := template[position+len(placeholder) : hash]
+		if hash < position {
+			between = template[hash+len("{hash}") : position]
+		}
+		if namePlaceholders.Replace(between) == "" {
+			return errors.New("The backup name template needs a separator like a space between " + placeholder + " and {hash}, got: " + template)
+		}
+	}
+	return nil
+}
+
+// Returns the backups of an artwork in grid/originals. The glob of the
+// template can match the backups of other games too, like "Portal *" those
+// of Portal 2, so every match is checked against the template.
+func findBackups(gridDir string, game *Game, artStyleExtensions []string, backupName string) ([]string, error) {
+	backups, err := steamFS.Glob(filepath.Join(gridDir, "originals", globNameTemplate(backupName, game, artStyleExtensions)+".*"))
+	if err != nil {
+		return nil, err
+	}
+	// Remote file systems may give other separators, the directory is matched
+	// from originals on.
+	separators := strings.NewReplacer(`\\`, `[\\/]`, "/", `[\\/]`)
+	parts := strings.Split(expandNameTemplate(backupName, game, artStyleExtensions, "\x00"), "\x00")
+	for i, part := range parts {
+		parts[i] = separators.Replace(regexp.QuoteMeta(part))
+	}
+	pattern := `(^|[\\/])originals[\\/]` + strings.Join(parts, "[0-9a-f]+") + `\.[^.]+$`
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		// Like the glob, the file system ignores the case.
+		pattern = "(?i)" + pattern
+	}
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matching []string
+	for _, backup := range filterForImages(backups) {
+		if matcher.MatchString(backup) {
+			matching = append(matching, backup)
+		}
+	}
+	return matching, nil
+}
+
+// Writes a copy of the final image in the alternate output layout, if enabled.
+func writeOutputCopy(opts *Options, game *Game, artStyleExtensions []string) error {
+	if opts.OutputDir == "" {
+		return nil
+	}
+	outputPath := filepath.Join(opts.OutputDir, expandNameTemplate(opts.OutputName, game, artStyleExtensions, imageHash(game.OverlayImageBytes))+game.ImageExt)
+	return writeRunOutput(outputPath, game.OverlayImageBytes)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// Shrinks a PNG like pngquant does: the colors are reduced to a palette of
+// 256 with median cut and the image is dithered to it. Images that already
+// fit in a palette lose nothing. The smaller of the optimized and the
+// original bytes is returned, animated images are left alone.
+func optimizePNG(imageBytes []byte) []byte {
+	config, format, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+	// The apng package registers itself for all PNG images.
+	if err != nil || (format != "png" && format != "apng") || config.Width == 0 || config.Height == 0 {
+		return imageBytes
+	}
+	if isAnimatedPNG(imageBytes) {
+		return imageBytes
+	}
+	img, err := png.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return imageBytes
+	}
+
+	var paletted *image.Paletted
+	palette := exactPalette(img, 256)
+	if palette != nil {
+		paletted = image.NewPaletted(img.Bounds(), palette)
+		draw.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min, draw.Src)
+	} else {
+		paletted = image.NewPaletted(img.Bounds(), medianCut(img, 256))
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min)
+	}
+
+	buf := new(bytes.Buffer)
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if encoder.Encode(buf, paletted) != nil || buf.Len() >= len(imageBytes) {
+		return imageBytes
+	}
+	return buf.Bytes()
+}
+
+// Whether the PNG has an animation control chunk before the image data.
+func isAnimatedPNG(imageBytes []byte) bool {
+	idat := bytes.Index(imageBytes, []byte("IDAT"))
+	actl := bytes.Index(imageBytes, []byte("acTL"))
+	return actl != -1 && (idat == -1 || actl < idat)
+}
+
+// Returns the colors of the image if there are at most max, otherwise nil.
+func exactPalette(img image.Image, max int) color.Palette {
+	seen := make(map[color.NRGBA]bool)
+	var palette color.Palette
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if seen[c] {
+				continue
+			}
+			if len(palette) == max {
+				return nil
+			}
+			seen[c] = true
+			palette = append(palette, c)
+		}
+	}
+	return palette
+}
+
+// Reduces the colors of the image to a palette with median cut: the box of
+// colors with the widest channel is split at its median until there are
+// enough boxes, and each box becomes its average color.
+func medianCut(img image.Image, size int) color.Palette {
+	bounds := img.Bounds()
+	// Sample big images, the palette doesn't need every pixel.
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > 250000 {
+		step++
+	}
+	var pixels []color.NRGBA
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			pixels = append(pixels, color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA))
+		}
+	}
+
+	channel := func(c color.NRGBA, i int) uint8 {
+		return [4]uint8{c.R, c.G, c.B, c.A}[i]
+	}
+	// Channel with the widest range in the box, and the range.
+	widest := func(box []color.NRGBA) (int, int) {
+		best, bestRange := 0, -1
+		for i := 0; i < 4; i++ {
+			low, high := 255, 0
+			for _, c := range box {
+				v := int(channel(c, i))
+				if v < low {
+					low = v
+				}
+				if v > high {
+					high = v
+				}
+			}
+			if high-low > bestRange {
+				best, bestRange = i, high-low
+			}
+		}
+		return best, bestRange
+	}
+
+	boxes := [][]color.NRGBA{pixels}
+	for len(boxes) < size {
+		// Split the box with the widest range.
+		split, splitChannel, splitRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			c, r := widest(box)
+			if r > splitRange {
+				split, splitChannel, splitRange = i, c, r
+			}
+		}
+		if split == -1 {
+			break
+		}
+		box := boxes[split]
+		sort.Slice(box, func(i, j int) bool {
+			return channel(box[i], splitChannel) < channel(box[j], splitChannel)
+		})
+		middle := len(box) / 2
+		boxes[split] = box[:middle]
+		boxes = append(boxes, box[middle:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b, a int
+		for _, c := range box {
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			a += int(c.A)
+		}
+		n := len(box)
+		if n == 0 {
+			continue
+		}
+		palette = append(palette, color.NRGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)})
+	}
+	return palette
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a run. The zero value is not useful, use DefaultOptions
+// or RegisterFlags to get the defaults.
+type Options struct {
+	// Path to the Steam installation, empty for auto detection.
+	SteamDir string
+
+	// Sources.
+	SteamGridDBApiKey string
+	IGDBApiKey        string
+	SkipSteam         bool
+	SkipGoogle        bool
+	// External provider executables, comma separated. See provider.go.
+	Providers string
+	// Custom sources from URL templates, semicolon separated. See urlsource.go.
+	URLSources string
+	// Names to search for games by their name, "alias=name" pairs separated
+	// by semicolons. See aliases.go.
+	Aliases string
+	// Honor robots.txt and space requests to scraped sites, see polite.go.
+	Polite bool
+	// Cookie file for sources that require a login, see cookies.go.
+	Cookies string
+
+	// Download the images of all sources and pick the best one, instead of
+	// taking the first found.
+	BestPick bool
+	// Number of images to keep in grid/alternates for the alt command.
+	Alternates int
+	// Switch every artwork to a random one of its alternates.
+	ShuffleAlternates bool
+
+	// Never use images marked as NSFW, see safemode.go.
+	SafeMode bool
+	// Also reject images of unmoderated sources that show too much skin.
+	SkinCheck bool
+
+	// For users in Steam Family View: use safe mode and only process the
+	// allowed games, and only these artwork types. See familyview.go.
+	FamilyView      bool
+	FamilyViewTypes string
+
+	// Steam language for searching by localized names too, like "japanese",
+	// or "auto" for the language of the Steam client. See localnames.go.
+	Language string
+
+	// Filters for SteamGridDB, comma separated.
+	SteamGridStyles string
+	SteamGridTypes  string
+
+	// Art styles and games to process.
+	SkipBanner   bool
+	SkipCover    bool
+	SkipHero     bool
+	SkipLogo     bool
+	NonSteamOnly bool
+	// Only process the games with these IDs, all if empty. See apply.go.
+	GameIDs []string
+	// Only process the non-Steam games started with this file. See apply.go.
+	ShortcutTarget string
+	// Only process the games that changed in the library since the last
+	// run. See update.go.
+	Incremental bool
+	// Soundtracks and videos: skip, cover for generated art, or empty to
+	// process them like games. See media.go.
+	Media string
+	// Order of the games: name, appid or recent.
+	Order string
+
+	// Use the built-in badges for platforms of non-Steam games without an
+	// overlay, see platform.go.
+	PlatformBadges bool
+	// Tag games with VR support as "VR", with a built-in badge if there is no
+	// overlay for it. See store.go.
+	VRBadge bool
+	// Tag Early Access games and preorders as "Early Access" and "Coming Soon".
+	ReleaseState bool
+	// Tag wishlisted games that are discounted, or owned games with
+	// discounted DLC, right now. sale is loaded for every user, see store.go.
+	SaleBadge bool
+	sale      *saleInfo
+	// Tag games with their store genres, like "Action" or "RPG".
+	GenreTags bool
+	// Stamp banners and covers with the year the game was last played.
+	LastPlayedStamp bool
+	// CSV export of a backlog tracker, see completion.go.
+	Completion string
+
+	// Scratch directory for files being written, see files.go.
+	TmpDir string
+	// Flush written images to disk, safer on power loss but slower.
+	Fsync bool
+	// How long to wait for another run on the same Steam installation to
+	// finish, see lock.go.
+	LockWait time.Duration
+	// Longest time to spend downloading the artworks of one game, 0 for no
+	// limit.
+	GameTimeout time.Duration
+	// Time or downloaded data a run may use, see budget.go.
+	Budget string
+
+	// Naming templates, see naming.go.
+	BackupName string
+	OutputDir  string
+	OutputName string
+	// Frontend exports, like "playnite=DIR,launchbox=DIR". See export.go.
+	Export string
+	// Also write the artwork over the cached official one, see
+	// librarycache.go.
+	LibraryCache bool
+	// Set when the installation has more than one user, who share the
+	// library cache.
+	severalUsers bool
+
+	// Default logo position over the hero, see logo.go.
+	LogoPosition string
+	LogoWidth    float64
+	LogoHeight   float64
+
+	// How to fit images with the wrong aspect ratio, like "Hero=crop,Cover=blur".
+	Fit      string
+	fitModes map[string]string
+
+	// Collected during a run, see metrics.go.
+	metrics *Metrics
+	// Set when the package was already set up for these options, by a
+	// server that runs steamgrid while it answers requests. Run leaves the
+	// package settings alone then, see applyGlobalOptions.
+	globalsApplied bool
+	// Lock of the installation the server shares with its runs, nil for the
+	// lock file of the installation. See sharedLock.
+	lock *sharedLock
+
+	// Number of goroutines compositing and encoding images.
+	CPUWorkers int
+	// Downloads at the same time, 0 for the default. See autotune.go.
+	DownloadWorkers int
+	// Adapt the workers to the machine and connection, see autotune.go.
+	Autotune bool
+	// PNG compression level: default, fast, best or none.
+	PNGCompression string
+	// Reduce written PNGs to 256 colors, see optimize.go.
+	Optimize bool
+	// Compositing backend: standard or fast, see compositor.go.
+	Compositor string
+	// Line up badges horizontal or vertical instead of drawing them on top
+	// of each other, see badgestrip.go.
+	BadgeStrip   string
+	BadgeSpacing int
+	// Resolutions to look for, see sizeprofile.go.
+	SizeProfile string
+	// Defaults for a device with little storage, see device.go.
+	Device string
+	// Animated artwork: prefer, allow (static first) or never. See animated.go.
+	Animated string
+	// Largest size of animated images in MB, 0 for no limit.
+	AnimatedMaxSize int
+	// Leave animated images without overlays.
+	SkipAnimatedOverlays bool
+	// Put a scrim behind badges that don't stand out from the image, see
+	// contrast.go.
+	AutoContrast bool
+	// Colored frames for categories without an overlay, see frames.go.
+	Frames string
+	// Rounded corners, border and drop shadow of banners and covers, in
+	// pixels. See cardstyle.go.
+	Corners     int
+	Border      int
+	BorderColor string
+	Shadow      int
+	// TTF or OTF fonts for the text of badges and generated covers, see
+	// fonts.go. Empty for the built-in font and a system emoji font.
+	Font      string
+	EmojiFont string
+	// Color filters after the overlays, like "desaturate,contrast=1.2". See
+	// filters.go.
+	Filter string
+	// Theme with options, overlays and placeholders, see theme.go. themeDir
+	// is its directory, set with the options, empty for built-in themes.
+	Theme    string
+	themeDir string
+
+	// Write an HTML report with thumbnails to this file, see htmlreport.go.
+	HTMLReport string
+	// Put low-confidence images in grid/quarantine, see quarantine.go.
+	Quarantine bool
+	// Write the games with missing artwork to this CSV file, and open their
+	// SteamGridDB pages. See missing.go.
+	MissingList string
+	OpenMissing bool
+
+	// Print details like the candidate scores.
+	Verbose bool
+	// Tell where the time of the run went, and the address of the pprof
+	// endpoints of the daemon modes. See profiling.go.
+	PerfProfile bool
+	Pprof       string
+	// Only pretend to change the Steam directory, see steamfs.go.
+	Simulate bool
+	// Run on a copy of the Steam directory in this directory, or apply the
+	// changes of the copy with Commit. See sandbox.go.
+	Sandbox string
+	Commit  bool
+	// Steam directory on another machine, user@host:/path. See remote.go.
+	SteamSSH string
+
+	// Config file with per-user profiles, see config.go. Nil if there is none.
+	Config *Config
+
+	// Hooks for embedding steamgrid, all optional.
+	Hooks Hooks
+}
+
+// Hooks are called during a run to report progress, for example to a GUI.
+// They are called one at a time, but the images are written by several
+// workers, so OnArtwork may come after OnGame of the next games.
+type Hooks struct {
+	// Called before a game is processed.
+	OnGame func(game *Game, current int, total int)
+	// Called after an artwork of a game was processed. err is
+	// ErrArtworkNotFound if no image was found, with an empty source, or the
+	// error if the image couldn't be overlaid or written.
+	OnArtwork func(game *Game, artStyle string, source string, err error)
+}
+
+// ErrArtworkNotFound is passed to Hooks.OnArtwork for artwork no source had.
+var ErrArtworkNotFound = errors.New("Artwork not found")
+
+// Keeps the hooks from being called at the same time.
+var hooksMutex sync.Mutex
+
+func (hooks Hooks) game(game *Game, current int, total int) {
+	if hooks.OnGame != nil {
+		hooksMutex.Lock()
+		defer hooksMutex.Unlock()
+		hooks.OnGame(game, current, total)
+	}
+}
+
+func (hooks Hooks) artwork(game *Game, artStyle string, source string, err error) {
+	if hooks.OnArtwork != nil {
+		hooksMutex.Lock()
+		defer hooksMutex.Unlock()
+		hooks.OnArtwork(game, artStyle, source, err)
+	}
+}
+
+// DefaultOptions returns the options used when no flags are given.
+func DefaultOptions() Options {
+	var opts Options
+	opts.RegisterFlags(flag.NewFlagSet("defaults", flag.ContinueOnError))
+	return opts
+}
+
+// RegisterFlags binds the options to flags of the given set, setting the
+// default values.
+func (opts *Options) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&opts.SteamGridDBApiKey, "steamgriddb", "", "Your personal SteamGridDB api key, get one here: https://www.steamgriddb.com/profile/preferences")
+	flags.StringVar(&opts.IGDBApiKey, "igdb", "", "Your personal IGDB api key, get one here: https://api.igdb.com/signup")
+	flags.StringVar(&opts.SteamDir, "steamdir", "", "Path to your steam installation")
+	// "alternate" "blurred" "white_logo" "material" "no_logo"
+	flags.StringVar(&opts.SteamGridStyles, "styles", "alternate", "Comma seperated list of styles to download from SteamGridDB.\nExample: \"white_logo,material\"")
+	// "static" "animated", and the artwork types "banner" "portrait" "hero" "logo"
+	flags.StringVar(&opts.SteamGridTypes, "types", "static", "Comma seperated list of types to download from SteamGridDB, and artwork types to process.\nArtwork types: banner, portrait (or cover), hero, logo. Default are all.\nExample: \"static,animated\" or \"portrait,hero\"")
+	flags.BoolVar(&opts.SkipSteam, "skipsteam", false, "Skip downloads from Steam servers")
+	flags.BoolVar(&opts.SkipGoogle, "skipgoogle", false, "Skip search and downloads from google")
+	flags.StringVar(&opts.Providers, "providers", "", "Comma seperated list of external programs to use as image sources and overlay deciders")
+	flags.StringVar(&opts.Aliases, "aliases", "", "Names to search for games with short or odd names, semicolon separated, over the built-in ones.\nExample: \"mk8=Mario Kart 8 Deluxe;smo=Super Mario Odyssey\"")
+	flags.StringVar(&opts.URLSources, "urlsource", "", "Custom image sources from URL templates, semicolon separated, with an optional selector for web pages.\nExample: \"https://mycdn/{appid}{suffix}.png;https://site/?q={name} img.cover@src\"")
+	flags.BoolVar(&opts.Polite, "polite", false, "Honor robots.txt and crawl delays of scraped sites and identify as steamgrid. Disables the Google search")
+	flags.StringVar(&opts.Cookies, "cookies", "", "Cookie file (Netscape format, as exported by browsers) for image sources that require a login")
+	flags.BoolVar(&opts.SafeMode, "safemode", false, "Never use images marked as NSFW on SteamGridDB. Can't be turned off by the command line if the config file enables it")
+	flags.BoolVar(&opts.SkinCheck, "skincheck", false, "Reject images of search, URL sources and providers that show too much skin. A rough heuristic, rejects some harmless images too")
+	flags.BoolVar(&opts.FamilyView, "familyview", false, "For users in Steam Family View, only process the games allowed in Family View and use safe mode")
+	flags.StringVar(&opts.FamilyViewTypes, "familyviewtypes", "", "Comma seperated artwork types to process for users in Steam Family View, like \"portrait,hero\". Default are all")
+	flags.StringVar(&opts.Language, "language", "", "Also search images by the game names in this Steam language, like \"japanese\" or \"schinese\". \"auto\" uses the language of the Steam client")
+	flags.BoolVar(&opts.BestPick, "bestpick", false, "Download images from all sources and pick the best by resolution, aspect ratio, size and votes")
+	flags.IntVar(&opts.Alternates, "alternates", 0, "Keep this many images per artwork in grid/alternates, to switch between them with \"steamgrid alt\"")
+	flags.BoolVar(&opts.ShuffleAlternates, "shuffle-alternates", false, "Switch every artwork to a different random image from grid/alternates, without downloading")
+	flags.IntVar(&opts.CPUWorkers, "cpu-workers", runtime.GOMAXPROCS(0), "Number of images to composite and encode at the same time")
+	flags.IntVar(&opts.DownloadWorkers, "download-workers", 0, "Number of images of a source to download at the same time with -bestpick. 0 for one, or up to 8 with -autotune")
+	flags.BoolVar(&opts.Autotune, "autotune", false, "Start with one download and CPU worker and add more while downloads stay fast and the CPU keeps up, up to -download-workers and -cpu-workers")
+	flags.StringVar(&opts.PNGCompression, "pngcompression", "default", "Compression of PNG images with overlays: default, fast, best or none. Fast is much quicker for large libraries, with bigger files")
+	flags.BoolVar(&opts.Optimize, "optimize", false, "Shrink written PNG images by reducing them to 256 colors, like pngquant. Costs CPU")
+	flags.StringVar(&opts.Compositor, "compositor", compositorStandard, "Backend for compositing overlays: standard, or fast for slow machines like the Steam Deck. Fast prepares each overlay once and skips its transparent pixels, in plain Go without SIMD or GPU")
+	flags.StringVar(&opts.BadgeStrip, "badgestrip", "", "Line up the badges of games with several overlays next to each other: horizontal or vertical. Default is to draw them on top of each other")
+	flags.IntVar(&opts.BadgeSpacing, "badgespacing", 4, "Pixels between badges in the badge strip, at the size of the overlays")
+	flags.StringVar(&opts.Device, "device", "", "Defaults for a device with little storage: deck for smaller, compressed images and no heroes for games on the microSD card")
+	flags.StringVar(&opts.SizeProfile, "sizeprofile", "", "Resolutions of the artwork for the screen of the library: 1080p, or 4k for Big Picture on a TV. Empty for the sizes Steam uses")
+	flags.StringVar(&opts.Animated, "animated", animatedAllow, "Animated artwork: prefer to use it when there is some, allow it when there is no static image, or never use it, like to save the battery of a Steam Deck")
+	flags.IntVar(&opts.AnimatedMaxSize, "animatedmaxsize", 0, "Largest size of animated images in MB, bigger ones get fewer frames and a smaller size, or are skipped for a static image. 0 for no limit")
+	flags.BoolVar(&opts.SkipAnimatedOverlays, "skipanimatedoverlays", false, "Don't put overlays on animated images, keep them as they are")
+	flags.BoolVar(&opts.AutoContrast, "autocontrast", false, "Put a soft dark or light box behind badges that would be hard to see on the image below them")
+	flags.StringVar(&opts.Frames, "frames", "", "Draw colored frames around banners and covers for the categories and collections without an overlay: all of them, or the ones listed separated by commas. A color like favorite=#ffcc00 is used for the category, the others get one made from the name")
+	flags.IntVar(&opts.Corners, "corners", 0, "Round the corners of banners and covers with this radius in pixels. Written as PNG")
+	flags.IntVar(&opts.Border, "border", 0, "Draw a border of this many pixels around banners and covers")
+	flags.StringVar(&opts.BorderColor, "bordercolor", "#ffffff", "Color of the border, like #ffffff or #ffffff80 with alpha")
+	flags.IntVar(&opts.Shadow, "shadow", 0, "Drop a shadow of this many pixels at the bottom right of banners and covers, shrinking the image to make room. Written as PNG")
+	flags.StringVar(&opts.Font, "font", "", "TTF or OTF font for the text of badges and generated covers. Default is the built-in Go Bold")
+	flags.StringVar(&opts.EmojiFont, "emojifont", "", "TTF or OTF font for emoji and other characters missing in the font. Must have outlines, color bitmap fonts don't work. Default is a system emoji font if there is one")
+	flags.StringVar(&opts.Theme, "theme", "", "Theme to restyle the library with: neon, noir, or the name or path of a directory in 'themes' with theme.conf, overlays and placeholders. Its options go below the config file and the command line")
+	flags.StringVar(&opts.Filter, "filter", "", "Color filters for all images after the overlays, comma seperated: desaturate, duotone=#dark:#light, normalize, brightness=1.1, contrast=1.2")
+	flags.StringVar(&opts.HTMLReport, "htmlreport", "", "Write a report with before and after thumbnails of every artwork to this HTML file")
+	flags.BoolVar(&opts.Quarantine, "quarantine", false, "Put images that may not be the right game, from SteamGridDB, IGDB or a search, in grid/quarantine until they are approved with \"steamgrid approve\"")
+	flags.StringVar(&opts.MissingList, "missinglist", "", "Write the games with missing artwork to this CSV file, to request or upload them on SteamGridDB")
+	flags.BoolVar(&opts.OpenMissing, "openmissing", false, "Open SteamGridDB in the browser for the first games with missing artwork")
+	flags.BoolVar(&opts.Verbose, "verbose", false, "Print details, like the scores of the images found")
+	flags.BoolVar(&opts.PerfProfile, "perfprofile", false, "Tell in the summary if the run was slowed down by the network, the CPU or the disk")
+	flags.BoolVar(&opts.Simulate, "simulate", false, "Run without changing anything, only listing the files a run would write and remove. Uses a synthetic Steam installation if none is found")
+	flags.StringVar(&opts.Sandbox, "sandbox", "", "Run on a copy of the Steam directory in this directory, made on the first run with it, to look at the results before changing Steam")
+	flags.BoolVar(&opts.Commit, "commit", false, "Apply the changes made in the sandbox to the Steam directory, instead of running")
+	flags.StringVar(&opts.SteamSSH, "steam-ssh", "", "Steam directory on another machine, like user@htpc:/home/user/.steam/steam, read and written over SFTP with the ssh program")
+	flags.StringVar(&opts.Pprof, "pprof", "", "Address to answer Go's pprof endpoints on in the watch and serve modes, like 127.0.0.1:6060. Off by default")
+	flags.BoolVar(&opts.SkipBanner, "skipbanner", false, "Skip search and processing banner artwork")
+	flags.BoolVar(&opts.SkipCover, "skipcover", false, "Skip search and processing cover artwork")
+	flags.BoolVar(&opts.SkipHero, "skiphero", false, "Skip search and processing hero artwork")
+	flags.BoolVar(&opts.SkipLogo, "skiplogo", false, "Skip search and processing logo artwork")
+	flags.BoolVar(&opts.NonSteamOnly, "nonsteamonly", false, "Only search artwork for Non-Steam-Games")
+	flags.StringVar(&opts.Media, "media", "", "Soundtracks and videos: skip them, or cover to give them generated album-like art instead of searching")
+	flags.StringVar(&opts.Order, "order", "appid", "Order to process the games in: name, appid or recent (last played first)")
+	flags.BoolVar(&opts.PlatformBadges, "platformbadges", false, "Add a built-in badge to non-Steam games of platforms without an overlay, like GOG, Epic, SNES or PS2")
+	flags.BoolVar(&opts.VRBadge, "vrbadge", false, "Tag games with VR support from the Steam store as \"VR\" and add a badge, unless there is an overlay for it")
+	flags.BoolVar(&opts.ReleaseState, "releasestate", false, "Tag Early Access games and unreleased preorders as \"Early Access\" and \"Coming Soon\" and add a badge, unless there is an overlay for it")
+	flags.BoolVar(&opts.SaleBadge, "salebadge", false, "Tag wishlisted games and non-Steam games on sale, or owned games with DLC on sale, as \"Sale\" and \"DLC Sale\" and add a badge. Removed by the next run after the sale")
+	flags.BoolVar(&opts.GenreTags, "genretags", false, "Tag games with their genres from the Steam store, like \"Action\" or \"RPG\", for overlays like rpg.cover.png without a category")
+	flags.BoolVar(&opts.LastPlayedStamp, "lastplayed", false, "Stamp banners and covers with the year the game was last played, like \"last played: 2023\"")
+	flags.StringVar(&opts.Completion, "completion", "", "CSV export of a backlog tracker like HowLongToBeat or Backloggd. Tags games as Completed, Playing, Dropped or Backlog")
+	flags.StringVar(&opts.Fit, "fit", "", "How to fit images with the wrong aspect ratio per artwork type: none, crop, blur or stretch.\nDefault: \"Banner=none,Cover=none,Hero=crop,Logo=none\"")
+	flags.StringVar(&opts.LogoPosition, "logoposition", "BottomLeft", "Position of logos over the hero: BottomLeft, UpperLeft, CenterCenter, UpperCenter or BottomCenter")
+	flags.Float64Var(&opts.LogoWidth, "logowidth", 30, "Maximum width of logos over the hero, in percent")
+	flags.Float64Var(&opts.LogoHeight, "logoheight", 50, "Maximum height of logos over the hero, in percent")
+	flags.StringVar(&opts.TmpDir, "tmp-dir", "", "Directory for temporary files, for example on a faster drive than the Steam library")
+	flags.BoolVar(&opts.Fsync, "fsync", false, "Flush every written image to disk before going on. Safer on power loss, but slower")
+	flags.StringVar(&opts.Budget, "budget", "", "Time like 10m or downloaded data like 500MB the run may use, for metered connections. Recently played games go first, the next run resumes the rest")
+	flags.DurationVar(&opts.GameTimeout, "gametimeout", 0, "Longest time to spend on the downloads of one game, with all sources and retries, like 5m. The game is tried again on the next run")
+	flags.DurationVar(&opts.LockWait, "lockwait", 0, "How long to wait for another run on the same Steam installation to finish, like 10m. Default is to stop right away")
+	flags.StringVar(&opts.BackupName, "backupname", defaultBackupName, "File name template for backups in grid/originals.\nPlaceholders: {appid} {name} {type} {suffix} {hash}")
+	flags.BoolVar(&opts.LibraryCache, "librarycache", false, "Also write the artwork of Steam games over the official artwork in Steam's library cache, for the views of newer clients that show it")
+	flags.StringVar(&opts.OutputDir, "outputdir", "", "Also write the final images to this directory, named with -outputname")
+	flags.StringVar(&opts.Export, "export", "", "Also write the final images for other frontends, comma seperated.\nExample: \"playnite=C:\\Playnite\\Art,launchbox=C:\\LaunchBox\"")
+	flags.StringVar(&opts.OutputName, "outputname", defaultOutputName, "File name template for images in -outputdir, slashes create directories.\nPlaceholders: {appid} {name} {type} {suffix} {hash}")
+}
+
+// Names accepted in the types option for each art style.
+var artTypeNames = map[string]string{
+	"banner":     "Banner",
+	"grid":       "Banner",
+	"horizontal": "Banner",
+	"cover":      "Cover",
+	"portrait":   "Cover",
+	"vertical":   "Cover",
+	"hero":       "Hero",
+	"logo":       "Logo",
+}
+
+// The types option has both SteamGridDB types and artwork types to process,
+// this splits them. artTypes is empty if all art styles should be processed.
+func (opts *Options) splitTypes() (artTypes map[string]bool, steamGridTypes []string, err error) {
+	artTypes = make(map[string]bool)
+	for _, value := range strings.Split(opts.SteamGridTypes, ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		if artStyle, ok := artTypeNames[value]; ok {
+			artTypes[artStyle] = true
+		} else if value == "static" || value == "animated" {
+			steamGridTypes = append(steamGridTypes, value)
+		} else {
+			return nil, nil, errors.New("Unknown type " + value + ", must be static, animated, banner, portrait, hero or logo")
+		}
+	}
+	if len(steamGridTypes) == 0 {
+		steamGridTypes = []string{"static"}
+	}
+	return artTypes, steamGridTypes, nil
+}
+
+// Styles of SteamGridDB images.
+var steamGridStyles = []string{"alternate", "blurred", "white_logo", "material", "no_logo"}
+
+func validateSteamGridStyles(opts *Options) error {
+	for _, style := range strings.Split(opts.SteamGridStyles, ",") {
+		style = strings.TrimSpace(style)
+		known := style == ""
+		for _, steamGridStyle := range steamGridStyles {
+			known = known || style == steamGridStyle
+		}
+		if !known {
+			return errors.New("Unknown style " + style + ", must be " + strings.Join(steamGridStyles, ", "))
+		}
+	}
+	return nil
+}
+
+// Query string for SteamGridDB requests.
+func (opts *Options) steamGridFilter() string {
+	_, steamGridTypes, _ := opts.splitTypes()
+	// Animated grids are searched when they are preferred, and never when
+	// they aren't allowed.
+	hasAnimated := false
+	var static []string
+	for _, steamGridType := range steamGridTypes {
+		hasAnimated = hasAnimated || steamGridType == "animated"
+		if steamGridType != "animated" {
+			static = append(static, steamGridType)
+		}
+	}
+	if opts.Animated == animatedNever {
+		steamGridTypes = static
+	} else if opts.Animated == animatedPrefer && !hasAnimated {
+		steamGridTypes = append(steamGridTypes, "animated")
+	}
+	if len(steamGridTypes) == 0 {
+		steamGridTypes = []string{"static"}
+	}
+	filter := "?styles=" + opts.SteamGridStyles + "&types=" + strings.Join(steamGridTypes, ",")
+	if opts.SafeMode {
+		filter += "&nsfw=false"
+	}
+	return filter
+}
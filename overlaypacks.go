@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Overlay packs are zip files with overlay images, installed into the overlay
+// directory with:
+//
+//	steamgrid overlays install https://example.com/pack.zip
+//
+// Packs are checked before anything is extracted. The SHA-256 of the zip must
+// be given with -sha256 or published next to it, as pack.zip.sha256 in the
+// format of sha256sum. With -pubkey the pack must also be signed: pack.zip.sig
+// has the Ed25519 signature of the zip, raw or in base64. A checksum from the
+// same server only catches damaged downloads, the signature also proves who
+// made the pack. The entries are checked too, see archive.go.
+func runOverlaysCommand(args []string) error {
+	if len(args) == 0 || args[0] != "install" {
+		return errors.New("Usage: steamgrid overlays install [-sha256 <hex>] [-pubkey <key>] <url or file>")
+	}
+	flags := flag.NewFlagSet("overlays install", flag.ExitOnError)
+	checksum := flags.String("sha256", "", "Expected SHA-256 of the pack, instead of the published .sha256 file")
+	publicKey := flags.String("pubkey", "", "Ed25519 public key of the publisher, in hex or base64. Requires a .sig file next to the pack")
+	trust := flags.Bool("trust-archive", false, "Install packs with absolute paths or \"..\" in their entries. They are still extracted into the overlay directory only")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		return errors.New("Usage: steamgrid overlays install [-sha256 <hex>] [-pubkey <key>] <url or file>")
+	}
+
+	ctx := interruptContext()
+	location := flags.Arg(0)
+	pack, err := readPackFile(ctx, location)
+	if err != nil {
+		return err
+	}
+	if pack == nil {
+		return errors.New("Overlay pack not found: " + location)
+	}
+	err = verifyPack(ctx, location, pack, *checksum, *publicKey)
+	if err != nil {
+		return err
+	}
+	installed, err := extractOverlayPack(pack, overlaysDir(), *trust)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %v overlays into %v\n", len(installed), overlaysDir())
+	return nil
+}
+
+// Reads a file of a pack from an URL or the disk. Returns nil if it doesn't
+// exist.
+func readPackFile(ctx context.Context, location string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		response, err := tryDownload(ctx, location)
+		if err != nil || response == nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		return ioutil.ReadAll(response.Body)
+	}
+	data, err := ioutil.ReadFile(location)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Checks the checksum and, with a public key, the signature of a pack.
+func verifyPack(ctx context.Context, location string, pack []byte, checksum string, publicKey string) error {
+	if checksum == "" {
+		manifest, err := readPackFile(ctx, location+".sha256")
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			return errors.New("The pack has no " + location + ".sha256, pass its checksum with -sha256")
+		}
+		// "<hex>  pack.zip"
+		fields := strings.Fields(string(manifest))
+		if len(fields) == 0 {
+			return errors.New("Empty checksum file " + location + ".sha256")
+		}
+		checksum = fields[0]
+	}
+	sum := sha256.Sum256(pack)
+	if !strings.EqualFold(checksum, hex.EncodeToString(sum[:])) {
+		return errors.New("Checksum mismatch for " + location + ", the pack was changed or damaged. Not installing")
+	}
+
+	if publicKey == "" {
+		return nil
+	}
+	key, err := decodeKey(publicKey, ed25519.PublicKeySize)
+	if err != nil {
+		return errors.New("Invalid public key: " + err.Error())
+	}
+	signature, err := readPackFile(ctx, location+".sig")
+	if err != nil {
+		return err
+	}
+	if signature == nil {
+		return errors.New("The pack is not signed, " + location + ".sig doesn't exist")
+	}
+	if len(signature) != ed25519.SignatureSize {
+		signature, err = decodeKey(strings.TrimSpace(string(signature)), ed25519.SignatureSize)
+		if err != nil {
+			return errors.New("Invalid signature file " + location + ".sig: " + err.Error())
+		}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), pack, signature) {
+		return errors.New("Invalid signature for " + location + ", the pack was not signed with this key. Not installing")
+	}
+	return nil
+}
+
+// Decodes a key or signature of the given size from hex or base64.
+func decodeKey(text string, size int) ([]byte, error) {
+	if decoded, err := hex.DecodeString(text); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != size {
+		return nil, fmt.Errorf("expected %v bytes, got %v", size, len(decoded))
+	}
+	return decoded, nil
+}
+
+// Copies the images of a verified pack into the overlay directory, which is
+// flat, so folders inside the pack are ignored. Packs with the same name in
+// two folders are refused, one would overwrite the other. Returns the names
+// of the installed overlays.
+func extractOverlayPack(pack []byte, dir string, trust bool) ([]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(pack), int64(len(pack)))
+	if err != nil {
+		return nil, errors.New("The overlay pack is not a zip file: " + err.Error())
+	}
+	err = checkArchive(archive, trust)
+	if err != nil {
+		return nil, err
+	}
+	// Lower case, the overlay directory may not tell case apart.
+	entries := map[string]string{}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if name, err := overlayFileName(file.Name); err == nil {
+			if other, ok := entries[strings.ToLower(name)]; ok {
+				return nil, fmt.Errorf("Refusing the archive: %q and %q are both the overlay %v", other, file.Name, name)
+			}
+			entries[strings.ToLower(name)] = file.Name
+		}
+	}
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []string
+	// The sizes in the headers may lie.
+	var total int
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name, err := overlayFileName(file.Name)
+		if err != nil {
+			fmt.Println("Skipping " + file.Name + ": " + err.Error())
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return installed, err
+		}
+		// The size in the header may lie.
+		data, err := ioutil.ReadAll(io.LimitReader(reader, maxArchiveFileSize+1))
+		reader.Close()
+		if err != nil {
+			return installed, err
+		}
+		total += len(data)
+		if len(data) > maxArchiveFileSize || total > maxArchiveSize {
+			return installed, errors.New("Refusing " + file.Name + ", it's bigger than its header says")
+		}
+		err = writeFile(filepath.Join(dir, name), data)
+		if err != nil {
+			return installed, err
+		}
+		installed = append(installed, name)
+	}
+	return installed, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"image"
 	// "image/draw"
 	"image/jpeg"
@@ -9,7 +10,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/image/draw"
 	"github.com/kettek/apng"
@@ -73,94 +77,199 @@ func ApplyOverlay(game *Game, overlays map[string]image.Image, artStyleExtension
 		return nil
 	}
 
-	isApng := false
-	var gameImage image.Image
+	// Without a matching overlay the original bytes are written as they are,
+	// there's no need to decode and encode them again.
+	var matching []image.Image
+	// Frames drawn for the categories without an overlay go under the badges.
+	if frame := frameOverlay(game.Tags, overlays, artStyleExtensions); frame != nil {
+		matching = append(matching, frame)
+	}
+	for _, tag := range game.Tags {
+		if overlayImage, ok := overlays[overlayName(tag)+artStyleExtensions[1]]; ok {
+			matching = append(matching, overlayImage)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+
 	apngImage, err := apng.DecodeAll(bytes.NewBuffer(game.CleanImageBytes))
-	if err == nil {
-		if len(apngImage.Frames) > 1 {
-			isApng = true
-		} else {
-			gameImage = apngImage.Frames[0].Image
+	if err == nil && len(apngImage.Frames) > 1 {
+		// Each frame gets the overlay once, over the whole picture.
+		flattenAPNG(&apngImage)
+		compositeAnimation(&apngImage, matching)
+		buf := new(bytes.Buffer)
+		err = apng.Encode(buf, apngImage)
+		if err != nil {
+			return err
 		}
+		game.OverlayImageBytes = buf.Bytes()
+		return nil
+	}
+
+	var gameImage image.Image
+	if err == nil {
+		gameImage = apngImage.Frames[0].Image
 	} else {
 		gameImage, _, err = image.Decode(bytes.NewBuffer(game.CleanImageBytes))
 		if err != nil {
 			return err
 		}
 	}
+	game.OverlayImageBytes, err = encodeImage(compositeOverlays(gameImage, matching), game.ImageExt)
+	return err
+}
 
-	applied := false
-	for _, tag := range game.Tags {
-		// Normalize tag name by lower-casing it and remove trailing "s" from
-		// plurals. Also, <, > and / are replaced with - because you can't have
-		// them in Windows paths.
-		tagName := strings.TrimRight(strings.ToLower(tag), "s")
-		tagName = strings.Replace(tagName, "<", "-", -1)
-		tagName = strings.Replace(tagName, ">", "-", -1)
-		tagName = strings.Replace(tagName, "/", "-", -1)
-
-		overlayImage, ok := overlays[tagName + artStyleExtensions[1]]
-		if !ok {
-			continue
-		}
-
+// Draws the overlays over the image, with the compositor and badge strip of
+// the run. The result has the size of the overlays, images of another size
+// are scaled to it.
+func compositeOverlays(gameImage image.Image, overlays []image.Image) *image.RGBA {
+	var result *image.RGBA
+	for _, overlayImage := range badgeStripOverlays(overlays) {
+		originalSize := gameImage.Bounds().Max
 		overlaySize := overlayImage.Bounds().Max
 
-		if isApng {
-			originalSize := apngImage.Frames[0].Image.Bounds().Max
+		// We expect overlays in the correct format so we have to scale the image if it doesn't fit
+		result = image.NewRGBA(image.Rect(0, 0, overlaySize.X, overlaySize.Y))
+		if (originalSize.X != overlaySize.X && originalSize.Y != overlaySize.Y) {
+			// scale to fit overlay
+			// https://godoc.org/golang.org/x/image/draw#Kernel.Scale
+			draw.ApproxBiLinear.Scale(result, result.Bounds(), gameImage, gameImage.Bounds(), draw.Over, nil)
+		} else {
+			draw.Draw(result, result.Bounds(), gameImage, image.ZP, draw.Src)
+		}
+		addContrastScrim(result, overlayImage)
+		if compositorBackend == compositorFast {
+			compositeOver(result, prepareOverlay(overlayImage, overlaySize))
+		} else {
+			draw.Draw(result, result.Bounds(), overlayImage, image.Point{0, 0}, draw.Over)
+		}
+		gameImage = result
+	}
+	if result == nil {
+		result = image.NewRGBA(gameImage.Bounds())
+		draw.Draw(result, result.Bounds(), gameImage, gameImage.Bounds().Min, draw.Src)
+	}
+	return result
+}
 
-			for i, frame := range apngImage.Frames {
+// Draws the overlays over every frame of a flattened animation, scaled to the
+// size of the frames.
+func compositeAnimation(apngImage *apng.APNG, overlays []image.Image) {
+	originalSize := apngImage.Frames[0].Image.Bounds().Max
+	for _, overlayImage := range badgeStripOverlays(overlays) {
+		overlaySize := overlayImage.Bounds().Max
+		for i, frame := range apngImage.Frames {
+			result := image.NewRGBA(image.Rect(0, 0, originalSize.X, originalSize.Y))
+			draw.Draw(result, result.Bounds(), frame.Image, image.ZP, draw.Src)
+			addContrastScrim(result, overlayImage)
+			if compositorBackend == compositorFast {
+				compositeOver(result, prepareOverlay(overlayImage, originalSize))
+			} else {
 				// Scale overlay to imageSize so the images won't get that huge…
 				overlayScaled := image.NewRGBA(image.Rect(0, 0, originalSize.X, originalSize.Y))
-				result := image.NewRGBA(image.Rect(0, 0, originalSize.X, originalSize.Y))
 				if (originalSize.X != overlaySize.X && originalSize.Y != overlaySize.Y) {
 					// https://godoc.org/golang.org/x/image/draw#Kernel.Scale
 					draw.ApproxBiLinear.Scale(overlayScaled, overlayScaled.Bounds(), overlayImage, overlayImage.Bounds(), draw.Over, nil)
 				} else {
 					draw.Draw(overlayScaled, overlayScaled.Bounds(), overlayImage, image.ZP, draw.Src)
 				}
-				// No idea why these offsets are negative:
-				draw.Draw(result, result.Bounds(), frame.Image, image.Point{0 - frame.XOffset, 0 - frame.YOffset}, draw.Over)
 				draw.Draw(result, result.Bounds(), overlayScaled, image.Point{0, 0}, draw.Over)
-				apngImage.Frames[i].Image = result
-				apngImage.Frames[i].XOffset = 0
-				apngImage.Frames[i].YOffset = 0
-				apngImage.Frames[i].BlendOp = apng.BLEND_OP_OVER
 			}
-			applied = true
-		} else {
-			originalSize := gameImage.Bounds().Max
-
-			// We expect overlays in the correct format so we have to scale the image if it doesn't fit
-			result := image.NewRGBA(image.Rect(0, 0, overlaySize.X, overlaySize.Y))
-			if (originalSize.X != overlaySize.X && originalSize.Y != overlaySize.Y) {
-				// scale to fit overlay
-				// https://godoc.org/golang.org/x/image/draw#Kernel.Scale
-				draw.ApproxBiLinear.Scale(result, result.Bounds(), gameImage, gameImage.Bounds(), draw.Over, nil)
-			} else {
-				draw.Draw(result, result.Bounds(), gameImage, image.ZP, draw.Src)
-			}
-			draw.Draw(result, result.Bounds(), overlayImage, image.Point{0, 0}, draw.Over)
-			gameImage = result
-			applied = true
+			apngImage.Frames[i].Image = result
 		}
 	}
+}
+
+// Normalize tag name by lower-casing it and remove trailing "s" from plurals.
+// Also, <, > and / are replaced with - because you can't have them in Windows
+// paths.
+func overlayName(tag string) string {
+	tagName := strings.TrimRight(strings.ToLower(tag), "s")
+	tagName = strings.Replace(tagName, "<", "-", -1)
+	tagName = strings.Replace(tagName, ">", "-", -1)
+	tagName = strings.Replace(tagName, "/", "-", -1)
+	return tagName
+}
 
-	if !applied {
+// Stamps when the game was last played in the bottom left corner, over the
+// overlays. Animated images are left alone.
+func applyLastPlayedStamp(game *Game) error {
+	imageBytes := game.OverlayImageBytes
+	if imageBytes == nil {
+		imageBytes = game.CleanImageBytes
+	}
+	if imageBytes == nil {
 		return nil
 	}
-
-	buf := new(bytes.Buffer)
-	if game.ImageExt == ".jpg" || game.ImageExt == ".jpeg" {
-		err = jpeg.Encode(buf, gameImage, &jpeg.Options{95})
-	} else if game.ImageExt == ".png" && isApng {
-		err = apng.Encode(buf, apngImage)
-	} else if game.ImageExt == ".png" {
-		err = png.Encode(buf, gameImage)
+	if isAnimated(imageBytes) {
+		return nil
 	}
+	gameImage, _, err := image.Decode(bytes.NewBuffer(imageBytes))
 	if err != nil {
 		return err
 	}
-	game.OverlayImageBytes = buf.Bytes()
-	return nil
+	game.OverlayImageBytes, err = encodeImage(stampLastPlayed(gameImage, game.LastPlayed), game.ImageExt)
+	return err
+}
+
+// Draws the last played stamp over the image, zero for never played.
+func stampLastPlayed(gameImage image.Image, lastPlayed time.Time) *image.RGBA {
+	text := "never played"
+	if !lastPlayed.IsZero() {
+		text = "last played: " + strconv.Itoa(lastPlayed.Year())
+	}
+	size := gameImage.Bounds().Size()
+	result := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(result, result.Bounds(), gameImage, gameImage.Bounds().Min, draw.Src)
+	draw.Draw(result, result.Bounds(), drawBadge(text, size.X, size.Y, true), image.ZP, draw.Over)
+	return result
+}
+
+// Encoder for PNG images, set from the options at the start of a run. PNG
+// encoding takes most of the time of a run, a faster compression level helps
+// with large libraries.
+var pngEncoder = png.Encoder{CompressionLevel: png.DefaultCompression, BufferPool: &pngBufferPool{}}
+
+// Reuses the buffers of the PNG encoder between images.
+type pngBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	buffer, _ := p.pool.Get().(*png.EncoderBuffer)
+	return buffer
+}
+
+func (p *pngBufferPool) Put(buffer *png.EncoderBuffer) {
+	p.pool.Put(buffer)
+}
+
+// PNG compression levels by option value.
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+	"none":    png.NoCompression,
+}
+
+func getPNGCompression(opts *Options) (png.CompressionLevel, error) {
+	level, ok := pngCompressionLevels[opts.PNGCompression]
+	if !ok {
+		return 0, errors.New("Unknown PNG compression " + opts.PNGCompression + ", must be default, fast, best or none")
+	}
+	return level, nil
+}
+
+// Encodes a static image in the format of the extension. Images are only
+// encoded when something was drawn on them, unchanged ones keep their bytes.
+func encodeImage(img image.Image, imageExt string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var err error
+	if imageExt == ".jpg" || imageExt == ".jpeg" {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 95})
+	} else {
+		err = pngEncoder.Encode(buf, img)
+	}
+	return buf.Bytes(), err
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Platforms of non-Steam games, detected from the launcher or emulator in the
+// shortcut. The platform is added as a tag, so an overlay like
+// "snes.cover.png" is applied to all SNES games.
+var platformPatterns = []struct {
+	platform string
+	patterns []string
+}{
+	// Launchers first, they may start emulators themselves.
+	{"GOG", []string{"galaxyclient", "gog galaxy", "gog games", "goggalaxy://"}},
+	{"Epic", []string{"epicgameslauncher", "com.epicgames.launcher", "epic games"}},
+	{"Origin", []string{"origin://", "origin.exe", "eadesktop", "ea games"}},
+	{"Ubisoft", []string{"uplay://", "upc.exe", "ubisoft game launcher"}},
+	{"Battle.net", []string{"battle.net", "battlenet://"}},
+	{"itch.io", []string{"itch.io", "itch://", "\\itch\\"}},
+	{"Xbox", []string{"xemu"}},
+	{"Xbox 360", []string{"xenia"}},
+	{"PS1", []string{"duckstation", "epsxe", "pcsx_rearmed", "beetle_psx", "mednafen_psx", "swanstation"}},
+	{"PS2", []string{"pcsx2"}},
+	{"PS3", []string{"rpcs3"}},
+	{"PSP", []string{"ppsspp"}},
+	{"NES", []string{"nestopia", "fceumm", "mesen", "quicknes", ".nes"}},
+	{"SNES", []string{"snes9x", "bsnes", "higan", ".sfc", ".smc"}},
+	{"N64", []string{"project64", "mupen64", "parallel_n64", ".z64", ".n64", ".v64"}},
+	{"GameCube", []string{"dolphin", ".gcm", ".rvz"}},
+	{"Wii U", []string{"cemu"}},
+	{"Switch", []string{"yuzu", "ryujinx", ".nsp", ".xci"}},
+	{"GBA", []string{"mgba", "visualboyadvance", "vba-m", "vbam", ".gba"}},
+	{"DS", []string{"desmume", "melonds", ".nds"}},
+	{"3DS", []string{"citra", ".3ds", ".cia"}},
+	{"Genesis", []string{"genesis_plus_gx", "kega", "blastem", "picodrive", ".md", ".gen"}},
+	{"Dreamcast", []string{"redream", "flycast", "reicast", ".cdi", ".gdi"}},
+	{"Arcade", []string{"mame", "fbneo", "finalburn"}},
+	{"DOS", []string{"dosbox"}},
+}
+
+// Returns the platform of a non-Steam game from its shortcut, or "" if it
+// can't be detected.
+func detectPlatform(exe string, startDir string, launchOptions string) string {
+	haystack := strings.ToLower(exe + " " + startDir + " " + launchOptions)
+	for _, platform := range platformPatterns {
+		for _, pattern := range platform.patterns {
+			if strings.HasPrefix(pattern, ".") {
+				// ROM extensions, only at the end of a word.
+				if strings.Contains(haystack, pattern+"\"") || strings.Contains(haystack, pattern+" ") || strings.HasSuffix(haystack, pattern) {
+					return platform.platform
+				}
+			} else if strings.Contains(haystack, pattern) {
+				return platform.platform
+			}
+		}
+	}
+	return ""
+}
+
+// Adds the built-in badges for the platforms that have no overlay in
+// "overlays by category".
+func addPlatformBadges(overlays map[string]image.Image, artStyles map[string][]string) {
+	for _, platform := range platformPatterns {
+		addBadge(overlays, artStyles, platform.platform, platform.platform)
+	}
+}
+
+// Adds a built-in badge as overlay for the tag, unless there already is an
+// overlay for it. Badges are drawn in the bottom right corner.
+func addBadge(overlays map[string]image.Image, artStyles map[string][]string, tag string, text string) {
+	name := overlayName(tag)
+	for _, artStyleExtensions := range artStyles {
+		if _, ok := overlays[name+artStyleExtensions[1]]; ok {
+			continue
+		}
+		width, _ := strconv.Atoi(artStyleExtensions[3])
+		height, _ := strconv.Atoi(artStyleExtensions[4])
+		overlays[name+artStyleExtensions[1]] = drawBadge(text, width, height, false)
+	}
+}
+
+// Draws a text badge over a transparent image of the given size, in the
+// bottom right corner or the bottom left one.
+func drawBadge(text string, width int, height int, left bool) image.Image {
+	// About a tenth of the image height.
+	badgeHeight := height / 10
+	if badgeHeight < 19 {
+		badgeHeight = 19
+	}
+	padding := badgeHeight * 3 / 19
+	margin := height / 40
+
+	overlay := image.NewRGBA(image.Rect(0, 0, width, height))
+	line := renderText(text, badgeHeight-2*padding, image.White)
+	if line == nil {
+		return overlay
+	}
+	badgeWidth := line.Bounds().Dx() + 2*padding
+	target := image.Rect(width-badgeWidth-margin, height-badgeHeight-margin, width-margin, height-margin)
+	if left {
+		target = image.Rect(margin, height-badgeHeight-margin, margin+badgeWidth, height-margin)
+	}
+	draw.Draw(overlay, target, image.NewUniform(color.RGBA{0, 0, 0, 200}), image.ZP, draw.Src)
+	textTarget := image.Rect(target.Min.X+padding, target.Min.Y+padding, target.Max.X-padding, target.Max.Y-padding)
+	draw.Draw(overlay, textTarget, line, image.ZP, draw.Over)
+	return overlay
+}
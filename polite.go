@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In polite mode the scraped sites (Google search, SteamDB and custom URL
+// sources with a selector) are treated like a well behaved crawler would:
+// robots.txt is honored, including the crawl delay, requests to the same
+// host are spaced with some jitter, and the tool identifies itself. APIs and
+// image downloads aren't affected.
+const politeUserAgent = "steamgrid (+https://github.com/boppreh/steamgrid)"
+
+// Time between requests to the same host if robots.txt has no crawl delay.
+const politeMinDelay = time.Second
+
+// Set from the options at the start of a run.
+var politeMode bool
+
+type robotsRule struct {
+	allow   bool
+	pattern *regexp.Regexp
+	length  int
+}
+
+type politeHost struct {
+	mutex       sync.Mutex
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	lastRequest time.Time
+}
+
+var politeHosts = struct {
+	sync.Mutex
+	hosts map[string]*politeHost
+}{hosts: map[string]*politeHost{}}
+
+// Parses the rules of robots.txt that apply to us: the group for steamgrid
+// if there is one, otherwise the one for all crawlers.
+func parseRobots(robots string) ([]robotsRule, time.Duration) {
+	type group struct {
+		rules []robotsRule
+		delay time.Duration
+	}
+	groups := map[string]*group{}
+	var current []*group
+	inRules := false
+
+	scanner := bufio.NewScanner(strings.NewReader(robots))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment != -1 {
+			line = line[:comment]
+		}
+		colon := strings.Index(line, ":")
+		if colon == -1 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+
+		switch key {
+		case "user-agent":
+			// A user agent after rules starts a new group.
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			agent := strings.ToLower(value)
+			if groups[agent] == nil {
+				groups[agent] = &group{}
+			}
+			current = append(current, groups[agent])
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			pattern := "^" + strings.Replace(regexp.QuoteMeta(value), `\*`, ".*", -1)
+			if strings.HasSuffix(pattern, `\$`) {
+				pattern = strings.TrimSuffix(pattern, `\$`) + "$"
+			}
+			rule := robotsRule{key == "allow", regexp.MustCompile(pattern), len(value)}
+			for _, g := range current {
+				g.rules = append(g.rules, rule)
+			}
+		case "crawl-delay":
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				for _, g := range current {
+					g.delay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	for agent, g := range groups {
+		if agent != "*" && agent != "" && strings.Contains("steamgrid", agent) {
+			return g.rules, g.delay
+		}
+	}
+	if g, ok := groups["*"]; ok {
+		return g.rules, g.delay
+	}
+	return nil, 0
+}
+
+// Whether the path may be crawled. The longest matching rule wins, allow
+// wins ties.
+func robotsAllowed(rules []robotsRule, path string) bool {
+	allowed, length := true, -1
+	for _, rule := range rules {
+		if rule.pattern.MatchString(path) && (rule.length > length || (rule.length == length && rule.allow)) {
+			allowed, length = rule.allow, rule.length
+		}
+	}
+	return allowed
+}
+
+func getPoliteHost(ctx context.Context, target *url.URL) *politeHost {
+	politeHosts.Lock()
+	host, ok := politeHosts.hosts[target.Host]
+	if !ok {
+		// Locked before others can find it, they wait for the rules.
+		host = &politeHost{}
+		host.mutex.Lock()
+		politeHosts.hosts[target.Host] = host
+	}
+	politeHosts.Unlock()
+	if ok {
+		return host
+	}
+	defer host.mutex.Unlock()
+	robotsURL := target.Scheme + "://" + target.Host + "/robots.txt"
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return host
+	}
+	req.Header.Set("User-Agent", politeUserAgent)
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return host
+	}
+	defer response.Body.Close()
+	if response.StatusCode == 200 {
+		var robots strings.Builder
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			robots.WriteString(scanner.Text() + "\n")
+		}
+		host.rules, host.crawlDelay = parseRobots(robots.String())
+	}
+	host.lastRequest = time.Now()
+	return host
+}
+
+// Prepares a request to a scraped site. Returns false if robots.txt forbids
+// it in polite mode, otherwise waits for the host's turn and sets our user
+// agent. Does nothing outside of polite mode.
+func politeRequest(ctx context.Context, req *http.Request) bool {
+	if !politeMode {
+		return true
+	}
+	host := getPoliteHost(ctx, req.URL)
+	host.mutex.Lock()
+	defer host.mutex.Unlock()
+	if !robotsAllowed(host.rules, req.URL.RequestURI()) {
+		return false
+	}
+
+	delay := host.crawlDelay
+	if delay < politeMinDelay {
+		delay = politeMinDelay
+	}
+	// Up to half the delay more, so the requests don't look like a bot's.
+	delay += time.Duration(rand.Int63n(int64(delay/2) + 1))
+	if wait := time.Until(host.lastRequest.Add(delay)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	host.lastRequest = time.Now()
+	req.Header.Set("User-Agent", politeUserAgent)
+	return true
+}
+
+// Like tryDownload, for pages that are scraped. Returns nil without error if
+// robots.txt forbids the page in polite mode.
+func scrapeDownload(ctx context.Context, pageURL string) (*http.Response, error) {
+	if err := waitForPriority(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !politeRequest(ctx, req) {
+		return nil, nil
+	}
+	return checkResponse(http.DefaultClient.Do(req))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Runs the CPU bound part of saving artworks, decoding, compositing and
+// encoding, on a bounded number of goroutines. Downloads stay on the main
+// goroutine, so the network isn't hammered by the workers. A nil pool runs the
+// jobs right away.
+//
+// An adaptive pool starts with one worker and adds more up to the maximum,
+// see autotune.go.
+type cpuPool struct {
+	jobs chan func() error
+	wg   sync.WaitGroup
+
+	mutex    sync.Mutex
+	firstErr error
+
+	adaptive bool
+	workers  int
+	max      int
+	// Running average of the job times, and the one with a single worker.
+	average time.Duration
+	single  time.Duration
+}
+
+func newCPUPool(workers int, adaptive bool) *cpuPool {
+	if workers <= 1 {
+		return nil
+	}
+	pool := &cpuPool{jobs: make(chan func() error), adaptive: adaptive, max: workers}
+	if adaptive {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		pool.startWorker()
+	}
+	return pool
+}
+
+func (pool *cpuPool) startWorker() {
+	pool.workers++
+	go func() {
+		for job := range pool.jobs {
+			start := time.Now()
+			err := job()
+			pool.mutex.Lock()
+			if err != nil && pool.firstErr == nil {
+				pool.firstErr = err
+			}
+			pool.observe(time.Since(start))
+			pool.mutex.Unlock()
+			pool.wg.Done()
+		}
+	}()
+}
+
+// Adds a job time to the average. Called with the mutex held.
+func (pool *cpuPool) observe(duration time.Duration) {
+	if !pool.adaptive {
+		return
+	}
+	if pool.average == 0 {
+		pool.average = duration
+	} else {
+		pool.average = time.Duration(float64(pool.average)*(1-latencyWeight) + float64(duration)*latencyWeight)
+	}
+	if pool.workers == 1 {
+		pool.single = pool.average
+	}
+}
+
+// Queues a job, blocking while all workers are busy. Returns the first error
+// of the jobs so far.
+func (pool *cpuPool) submit(job func() error) error {
+	if pool == nil {
+		return job()
+	}
+	pool.wg.Add(1)
+	if pool.adaptive {
+		select {
+		case pool.jobs <- job:
+			return pool.err()
+		default:
+		}
+		// All workers are busy, the downloads are ahead.
+		pool.mutex.Lock()
+		if pool.workers < pool.max && pool.single > 0 && pool.average <= pool.single*3/2 {
+			pool.startWorker()
+		}
+		pool.mutex.Unlock()
+	}
+	pool.jobs <- job
+	return pool.err()
+}
+
+func (pool *cpuPool) err() error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.firstErr
+}
+
+// Number of workers, which adaptive pools may have raised.
+func (pool *cpuPool) size() int {
+	if pool == nil {
+		return 1
+	}
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.workers
+}
+
+// Waits for the queued jobs and stops the workers. Returns the first error of
+// the jobs.
+func (pool *cpuPool) close() error {
+	if pool == nil {
+		return nil
+	}
+	pool.wg.Wait()
+	close(pool.jobs)
+	return pool.err()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Requests of a user waiting in the GUI or a frontend go ahead of a full run
+// in the background. While one is going on, the downloads of the run wait,
+// so the request gets the bandwidth and the API quota. Their contexts are
+// marked with withPriority.
+
+type priorityKey struct{}
+
+var priorityRequests struct {
+	sync.Mutex
+	active int
+	// Closed when the last priority request ends.
+	done chan struct{}
+}
+
+// Marks the context of an interactive request. The returned function must be
+// called when it's done.
+func withPriority(ctx context.Context) (context.Context, func()) {
+	priorityRequests.Lock()
+	priorityRequests.active++
+	if priorityRequests.done == nil {
+		priorityRequests.done = make(chan struct{})
+	}
+	priorityRequests.Unlock()
+
+	var once sync.Once
+	return context.WithValue(ctx, priorityKey{}, true), func() {
+		once.Do(func() {
+			priorityRequests.Lock()
+			defer priorityRequests.Unlock()
+			priorityRequests.active--
+			if priorityRequests.active == 0 {
+				close(priorityRequests.done)
+				priorityRequests.done = nil
+			}
+		})
+	}
+}
+
+// Waits until no priority request is going on, unless ctx is one. Returns the
+// context error if it ends meanwhile.
+func waitForPriority(ctx context.Context) error {
+	if ctx.Value(priorityKey{}) != nil {
+		return nil
+	}
+	for {
+		priorityRequests.Lock()
+		done := priorityRequests.done
+		priorityRequests.Unlock()
+		if done == nil {
+			return ctx.Err()
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// With the perfprofile option, the summary tells if a slow run was held up
+// by the network, the CPU or the disk, and what to try about it:
+//
+//	network  time waiting for HTTP responses, by the stage of the request
+//	CPU      compositing and encoding the images
+//	disk     reading the existing images and backups, and saving the new ones
+//
+// Times of several workers add up, like the stage times. The daemon modes
+// can also answer Go's pprof endpoints for a closer look, with the pprof
+// option.
+
+// Stage of the requests made with a context, for the network times.
+type stageKey struct{}
+
+func withStage(ctx context.Context, stage string) context.Context {
+	return context.WithValue(ctx, stageKey{}, stage)
+}
+
+func stageOf(ctx context.Context) string {
+	if stage, ok := ctx.Value(stageKey{}).(string); ok {
+		return stage
+	}
+	return "other"
+}
+
+func (m *Metrics) addNetwork(stage string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.NetworkTimes[stage] += time.Since(start)
+	m.mutex.Unlock()
+}
+
+// Prints which of network, CPU and disk took the most time. Called with the
+// mutex held.
+func printBottleneck(m *Metrics) {
+	var network time.Duration
+	for _, duration := range m.NetworkTimes {
+		network += duration
+	}
+	cpu := m.StageTimes["compositing"]
+	disk := m.StageTimes["loading existing"] + m.StageTimes["saving"]
+	total := network + cpu + disk
+	if total == 0 {
+		return
+	}
+
+	bound, advice := "network", "try --autotune, or --download-workers with --bestpick"
+	switch {
+	case cpu >= network && cpu >= disk:
+		bound, advice = "CPU", "try --compositor fast, --pngcompression fast or more --cpu-workers"
+	case disk >= network:
+		bound, advice = "disk", "try --tmp-dir on a faster drive, and leave --fsync off"
+	}
+	percent := func(duration time.Duration) float64 {
+		return 100 * float64(duration) / float64(total)
+	}
+	fmt.Printf("Network %v (%.0f%%), CPU %v (%.0f%%), disk %v (%.0f%%).\n", network.Round(time.Millisecond), percent(network), cpu.Round(time.Millisecond), percent(cpu), disk.Round(time.Millisecond), percent(disk))
+	fmt.Printf("The run was mostly %v-bound, %v.\n", bound, advice)
+}
+
+// Answers the pprof endpoints at /debug/pprof/ on the address, until the
+// context ends. Nothing for an empty address.
+func servePprof(ctx context.Context, address string) error {
+	if address == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	go httpServer.Serve(listener)
+	fmt.Println("Answering pprof on http://" + listener.Addr().String() + "/debug/pprof/")
+	return nil
+}
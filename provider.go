@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// External providers are executables that act as image sources or decide
+// which overlays to apply, without having to recompile steamgrid. For every
+// request the provider is started, gets a single JSON object on stdin and
+// must write a single JSON object to stdout before exiting.
+//
+// Image request:
+//
+//	{"version": 1, "action": "image", "artStyle": "Cover", "width": 600, "height": 900,
+//	 "game": {"id": "620", "name": "Portal 2", "tags": ["Favorites"], "custom": false}}
+//
+// Response, with an URL or a local path, or neither if nothing was found:
+//
+//	{"url": "https://..."} or {"path": "/home/me/art/620p.png"}
+//
+// Overlay request:
+//
+//	{"version": 1, "action": "overlays", "artStyle": "Cover", "game": {...}}
+//
+// Response with the list of overlay names (categories) to apply instead of
+// the game tags, or no list to keep the tags:
+//
+//	{"overlays": ["favorites", "vr"]}
+//
+// Either response may contain {"error": "message"} instead. Providers that
+// don't implement an action should answer with an empty object.
+const providerProtocolVersion = 1
+
+type providerGame struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags"`
+	Custom bool     `json:"custom"`
+}
+
+type providerRequest struct {
+	Version  int          `json:"version"`
+	Action   string       `json:"action"`
+	ArtStyle string       `json:"artStyle"`
+	Width    int          `json:"width,omitempty"`
+	Height   int          `json:"height,omitempty"`
+	Game     providerGame `json:"game"`
+}
+
+type providerResponse struct {
+	URL      string   `json:"url"`
+	Path     string   `json:"path"`
+	Overlays []string `json:"overlays"`
+	Error    string   `json:"error"`
+}
+
+// Returns the provider executables from the comma separated option.
+func getProviders(opts *Options) []string {
+	var providers []string
+	for _, provider := range strings.Split(opts.Providers, ",") {
+		provider = strings.TrimSpace(provider)
+		if provider != "" {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// Name of a provider for the report.
+func providerName(provider string) string {
+	return strings.TrimSuffix(filepath.Base(provider), filepath.Ext(provider))
+}
+
+func callProvider(ctx context.Context, provider string, request providerRequest) (*providerResponse, error) {
+	request.Version = providerProtocolVersion
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, provider)
+	cmd.Stdin = bytes.NewReader(requestBytes)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("Provider " + providerName(provider) + " failed: " + err.Error() + " " + strings.TrimSpace(stderr.String()))
+	}
+
+	var response providerResponse
+	err = json.Unmarshal(output, &response)
+	if err != nil {
+		return nil, errors.New("Provider " + providerName(provider) + " returned invalid JSON: " + err.Error())
+	}
+	if response.Error != "" {
+		return nil, errors.New("Provider " + providerName(provider) + ": " + response.Error)
+	}
+	return &response, nil
+}
+
+func newProviderGame(game *Game) providerGame {
+	return providerGame{game.ID, game.Name, game.Tags, game.Custom}
+}
+
+// Asks each provider for an image, returning the URL or local path of the
+// first one found. Providers that fail are reported and skipped, an error is
+// only returned if all of them failed.
+func getProviderImage(ctx context.Context, providers []string, game *Game, artStyle string, artStyleExtensions []string) (url string, path string, provider string, err error) {
+	width, _ := strconv.Atoi(artStyleExtensions[3])
+	height, _ := strconv.Atoi(artStyleExtensions[4])
+	failed := 0
+	for _, provider := range providers {
+		response, err := callProvider(ctx, provider, providerRequest{
+			Action:   "image",
+			ArtStyle: artStyle,
+			Width:    width,
+			Height:   height,
+			Game:     newProviderGame(game),
+		})
+		if err != nil {
+			failed++
+			if failed == len(providers) {
+				return "", "", provider, err
+			}
+			fmt.Println(err.Error())
+			continue
+		}
+		if response.URL != "" || response.Path != "" {
+			return response.URL, response.Path, provider, nil
+		}
+	}
+	return "", "", "", nil
+}
+
+// Asks the providers which overlays to apply. Returns the game tags if no
+// provider decides. Like getProviderImage, failed providers are skipped.
+func getProviderOverlays(ctx context.Context, providers []string, game *Game, artStyle string) ([]string, error) {
+	failed := 0
+	for _, provider := range providers {
+		response, err := callProvider(ctx, provider, providerRequest{
+			Action:   "overlays",
+			ArtStyle: artStyle,
+			Game:     newProviderGame(game),
+		})
+		if err != nil {
+			failed++
+			if failed == len(providers) {
+				return game.Tags, err
+			}
+			fmt.Println(err.Error())
+			continue
+		}
+		if response.Overlays != nil {
+			return response.Overlays, nil
+		}
+	}
+	return game.Tags, nil
+}
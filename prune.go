@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// The prune command removes the files of games that are no longer in the
+// library of a user: grid images, Big Picture copies, backups, alternates,
+// quarantined images and logo positions. They are packed into a zip first,
+// unless -o is empty:
+//
+//	steamgrid prune -dryrun
+//	steamgrid prune -o pruned.zip
+//
+// The library is what a full run writes artwork for: the games of the Steam
+// profile, then what the local files tell, games with a category or played
+// on this computer, installed apps and non-Steam shortcuts. Without the
+// profile, owned games that aren't installed would look removed, so prune
+// stops unless -nonsteamonly keeps it to the local files. Files that don't
+// look like they belong to a game are left alone, like backups whose name
+// doesn't start with an app ID.
+func runPruneCommand(args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	output := flags.String("o", "steamgrid-pruned-"+time.Now().Format("20060102-150405")+".zip", "Zip file to pack the removed files into, empty to not keep them")
+	dryRun := flags.Bool("dryrun", false, "Only list the files that would be removed")
+	flags.Parse(args)
+	if flags.NArg() == 1 {
+		opts.SteamDir = flags.Arg(0)
+	} else if flags.NArg() > 1 {
+		return errors.New("Usage: steamgrid prune [-dryrun] [-o file.zip] [steamdir]")
+	}
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
+	if err != nil {
+		return err
+	}
+	users, err := GetUsers(installationDir)
+	if err != nil {
+		return err
+	}
+	installed, _ := installedApps(installationDir)
+	ctx := interruptContext()
+
+	var paths []string
+	for _, user := range users {
+		gridDir := filepath.Join(user.Dir, "config", "grid")
+		games := GetLibraryGames(user, installationDir, installed)
+		if !opts.NonSteamOnly {
+			owned := map[string]*Game{}
+			err = addGamesFromProfile(ctx, user, owned)
+			if err == nil && len(owned) == 0 {
+				err = errors.New("The profile lists no games, the game details may be private")
+			}
+			if err != nil {
+				return errors.New("Could not load the games of " + user.Name + " from the Steam profile, prune would remove the artwork of owned games that aren't installed: " + err.Error() + ". Use -nonsteamonly to only keep the games found in the local files")
+			}
+			for id, game := range owned {
+				if games[id] == nil {
+					games[id] = game
+				}
+			}
+		}
+		if len(games) == 0 {
+			// More likely unreadable than empty, don't remove everything.
+			fmt.Printf("No games found for %v, skipping\n", user.Name)
+			continue
+		}
+		orphans, err := findOrphans(gridDir, games, opts.BackupName)
+		if err != nil {
+			return err
+		}
+		for _, path := range orphans {
+			fmt.Printf("%v: %v\n", user.Name, path)
+		}
+		paths = append(paths, orphans...)
+	}
+
+	size := int64(0)
+	for _, path := range paths {
+		if info, err := steamFS.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	if *dryRun || len(paths) == 0 {
+		fmt.Printf("\n%v files of games no longer in the library, %.1f MB.\n", len(paths), float64(size)/1024/1024)
+		return nil
+	}
+
+	lock, err := acquireLock(context.Background(), installationDir, opts.LockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	if *output != "" {
+		err = zipFiles(*output, installationDir, paths)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\nSaved the removed files to " + *output)
+	}
+	for _, path := range paths {
+		err = steamFS.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %v files of games no longer in the library, %.1f MB.\n", len(paths), float64(size)/1024/1024)
+	return nil
+}
+
+// Names of the files of a game, with the game ID first. Alternates have a
+// number after a space.
+var (
+	gridFilePattern = regexp.MustCompile(`^(\d+)(p|_hero|_logo)?( \d+)?\.(png|jpg|jpeg)$`)
+	positionPattern = regexp.MustCompile(`^(\d+)\.json$`)
+	// Backups named after the app ID, like "620p 1a2b.png" by the default
+	// template. Others, like by name, can't be told apart from the backups
+	// of a renamed game.
+	backupIDPattern = regexp.MustCompile(`^(\d+)(p|_hero|_logo)?[^0-9a-zA-Z]`)
+)
+
+// Returns the files in the grid directory of games that aren't in games.
+func findOrphans(gridDir string, games map[string]*Game, backupName string) ([]string, error) {
+	// Locked games keep their files, even if they are gone from the library.
+	locks := loadGameLocks(gridDir)
+	kept := map[string]*Game{}
+	for id, game := range games {
+		kept[id] = game
+	}
+	for id, name := range locks.names {
+		if kept[id] == nil {
+			kept[id] = &Game{ID: id, Name: name, Tags: []string{}}
+		}
+	}
+	for id := range locks.games {
+		if kept[id] == nil {
+			kept[id] = &Game{ID: id, Tags: []string{}}
+		}
+	}
+	games = kept
+
+	known := map[string]bool{}
+	for id := range games {
+		known[id] = true
+		if tenfoot := tenfootID(id); tenfoot != "" {
+			known[tenfoot] = true
+		}
+	}
+
+	var orphans []string
+	for _, dir := range []string{gridDir, filepath.Join(gridDir, alternatesDirName), filepath.Join(gridDir, quarantineDirName)} {
+		files, err := steamFS.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			match := gridFilePattern.FindStringSubmatch(file.Name())
+			if match == nil && dir == gridDir {
+				match = positionPattern.FindStringSubmatch(file.Name())
+			}
+			if match != nil && !known[match[1]] {
+				orphans = append(orphans, filepath.Join(dir, file.Name()))
+			}
+		}
+	}
+
+	// Backups are named by a template, they belong to a game if they match
+	// its name for one of the art styles.
+	claimed := map[string]bool{}
+	for _, game := range games {
+		for _, artStyleExtensions := range getArtStyles(&Options{}) {
+			backups, _ := steamFS.Glob(filepath.Join(gridDir, "originals", globNameTemplate(backupName, game, artStyleExtensions)+".*"))
+			for _, backup := range backups {
+				claimed[backup] = true
+			}
+		}
+	}
+	backups, _ := steamFS.Glob(filepath.Join(gridDir, "originals", "*"))
+	for _, backup := range filterForImages(backups) {
+		// Unclaimed backups may be of games in the library, made with another
+		// template or before a rename. Only the ones of an app that is gone
+		// are removed.
+		match := backupIDPattern.FindStringSubmatch(filepath.Base(backup))
+		if !claimed[backup] && match != nil && isValidGameID(match[1]) && !known[match[1]] {
+			orphans = append(orphans, backup)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// Packs the files into a zip, by their path in the Steam directory.
+func zipFiles(zipPath string, baseDir string, paths []string) error {
+	file, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(file)
+	for _, path := range paths {
+		name, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			name = filepath.Base(path)
+		}
+		contents, err := steamFS.ReadFile(path)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer, err := archive.Create(filepath.ToSlash(name))
+		if err == nil {
+			_, err = writer.Write(contents)
+		}
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// With the quarantine option, images that may not be the right game (found
+// on SteamGridDB, IGDB or by searching) go to grid/quarantine instead of the
+// grid, and are listed at the end of the run. The approve command moves them
+// to the grid with the overlays:
+//
+//	steamgrid approve 620 400
+//	steamgrid approve -all
+//	steamgrid approve -reject 620
+//
+// Artworks waiting in quarantine aren't searched again. Rejected ones are
+// searched again on the next run.
+const quarantineDirName = "quarantine"
+
+// Tells if an image from this source is a low-confidence match.
+func isLowConfidence(from string) bool {
+	return from == "IGDB" || from == "SteamGridDB" || from == "search"
+}
+
+// Writes the clean image of the game to the quarantine directory.
+func saveQuarantined(gridDir string, game *Game, artStyleExtensions []string) error {
+	dir := filepath.Join(gridDir, quarantineDirName)
+	err := steamFS.MkdirAll(dir)
+	if err != nil {
+		return err
+	}
+	return steamFS.WriteFile(filepath.Join(dir, game.ID+artStyleExtensions[0]+game.ImageExt), game.CleanImageBytes)
+}
+
+func (result *Result) addQuarantined(gridDir string, game *Game, artStyle string, artStyleExtensions []string) {
+	result.Quarantined[artStyle] = append(result.Quarantined[artStyle], game)
+	result.recordArtwork(gridDir, game, artStyle, artStyleExtensions, artworkQuarantined)
+}
+
+// Returns the image of the artwork waiting in quarantine, or "" if none.
+func findQuarantined(gridDir string, game *Game, artStyleExtensions []string) string {
+	paths, err := steamFS.Glob(filepath.Join(gridDir, quarantineDirName, globCharacters.Replace(game.ID+artStyleExtensions[0])+".*"))
+	if err != nil {
+		return ""
+	}
+	paths = filterForImages(paths)
+	if len(paths) == 0 {
+		return ""
+	}
+	return paths[0]
+}
+
+// Runs "steamgrid approve [flags] appid...", moving quarantined images of the
+// given games to the grid, or deleting them with -reject. Takes the same flags
+// as a normal run, so the overlays and outputs match.
+func runApproveCommand(args []string) error {
+	flags := flag.NewFlagSet("approve", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	all := flags.Bool("all", false, "Approve all quarantined images")
+	reject := flags.Bool("reject", false, "Delete the images instead, so they are searched again")
+	list := flags.Bool("list", false, "Only list the quarantined images")
+
+	// Allow flags after the IDs, like "approve 620 -reject".
+	var gameIDs []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			break
+		}
+		gameIDs = append(gameIDs, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(gameIDs) == 0 && !*all && !*list {
+		return errors.New("Usage: steamgrid approve [-reject] [-list] [-all] [-types portrait,...] appid...")
+	}
+
+	if _, _, err := opts.splitTypes(); err != nil {
+		return err
+	}
+	artStyles := getArtStyles(&opts)
+	err := validateNameTemplates(&opts)
+	if err != nil {
+		return err
+	}
+	exports, err := getExports(&opts)
+	if err != nil {
+		return err
+	}
+	err = validateLogoPosition(&opts)
+	if err != nil {
+		return err
+	}
+
+	overlays, err := LoadOverlays(themeOverlaysDir(&opts), artStyles)
+	if err != nil {
+		return err
+	}
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
+	if err != nil {
+		return err
+	}
+	users, err := GetUsers(installationDir)
+	if err != nil {
+		return err
+	}
+	opts.severalUsers = len(users) > 1
+
+	ctx := context.Background()
+	lock, err := acquireLock(ctx, installationDir, opts.LockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	result := newResult()
+	found := false
+	for _, user := range users {
+		gridDir := filepath.Join(user.Dir, "config", "grid")
+		// Categories and names, without asking the Steam servers.
+		games := GetLocalGames(user, installationDir)
+
+		ids := gameIDs
+		if *all || (*list && len(gameIDs) == 0) {
+			ids = nil
+			for id := range games {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+		}
+		for _, gameID := range ids {
+			game, ok := games[gameID]
+			if !ok {
+				game = &Game{ID: gameID, Tags: []string{}}
+			}
+
+			for artStyle, artStyleExtensions := range artStyles {
+				path := findQuarantined(gridDir, game, artStyleExtensions)
+				if path == "" {
+					continue
+				}
+				found = true
+
+				if *list {
+					fmt.Printf("%v %v %v (id %v): %v\n", user.Name, artStyle, game.Name, game.ID, path)
+					continue
+				}
+				if !*reject && isLocked(gridDir, game, artStyleExtensions) {
+					fmt.Printf("%v %v (id %v): %v\n", user.Name, artStyle, game.ID, errGameLocked.Error())
+					continue
+				}
+				if !*reject {
+					err = loadImage(game, "approved", path)
+					if err != nil {
+						return err
+					}
+					err = overlayAndSave(ctx, &opts, gridDir, game, artStyle, artStyleExtensions, overlays, exports, result, nil)
+					if err != nil {
+						return err
+					}
+				}
+				err = steamFS.Remove(path)
+				if err != nil {
+					return err
+				}
+				if *reject {
+					fmt.Printf("%v %v %v: rejected\n", user.Name, artStyle, game.Name)
+				} else {
+					fmt.Printf("%v %v %v: approved\n", user.Name, artStyle, game.Name)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return errors.New("No quarantined images found. Run steamgrid with -quarantine first.")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The SteamGridDB API limits the requests per API key. The remaining quota
+// comes with the responses, in X-RateLimit-* or RateLimit-* headers. When it
+// runs low the requests are spaced out to last until the reset, instead of
+// failing the rest of the run with 429 Too Many Requests. A 429 is retried
+// after the time the server asks for.
+
+// Spacing starts below this part of the quota.
+const quotaLowFraction = 0.1
+
+// Times a request is retried after a 429.
+const maxRateLimitRetries = 3
+
+// Wait after a 429 without Retry-After, and longest wait for a reset.
+const (
+	defaultRetryAfter = 5 * time.Second
+	maxQuotaWait      = 10 * time.Minute
+)
+
+type apiQuota struct {
+	mutex     sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+var steamGridDBQuota apiQuota
+
+// Reads the quota from the headers of a response, if it has them.
+func (quota *apiQuota) update(header http.Header) {
+	get := func(name string) (int, bool) {
+		for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+			if value, err := strconv.Atoi(header.Get(prefix + name)); err == nil {
+				return value, true
+			}
+		}
+		return 0, false
+	}
+	remaining, ok := get("Remaining")
+	if !ok {
+		return
+	}
+	quota.mutex.Lock()
+	defer quota.mutex.Unlock()
+	quota.known = true
+	quota.remaining = remaining
+	if limit, ok := get("Limit"); ok {
+		quota.limit = limit
+	}
+	if reset, ok := get("Reset"); ok {
+		// Either a Unix time or seconds from now.
+		if int64(reset) > time.Now().Unix()-24*60*60 {
+			quota.reset = time.Unix(int64(reset), 0)
+		} else {
+			quota.reset = time.Now().Add(time.Duration(reset) * time.Second)
+		}
+	}
+}
+
+// How long to wait before the next request to keep some quota until the
+// reset.
+func (quota *apiQuota) delay() time.Duration {
+	quota.mutex.Lock()
+	defer quota.mutex.Unlock()
+	if !quota.known || quota.reset.IsZero() {
+		return 0
+	}
+	untilReset := time.Until(quota.reset)
+	if untilReset <= 0 {
+		return 0
+	}
+	if quota.remaining <= 0 {
+		return minDuration(untilReset, maxQuotaWait)
+	}
+	if quota.limit > 0 && float64(quota.remaining) >= quotaLowFraction*float64(quota.limit) {
+		return 0
+	}
+	// Spread what's left over the time until the reset.
+	return minDuration(untilReset/time.Duration(quota.remaining+1), maxQuotaWait)
+}
+
+// Waits for the turn of the next request. Returns the context error if it's
+// canceled meanwhile.
+func (quota *apiQuota) wait(ctx context.Context) error {
+	return sleepContext(ctx, quota.delay())
+}
+
+// Describes the quota for the verbose output and the report, or "" if the
+// server doesn't send it.
+func (quota *apiQuota) String() string {
+	quota.mutex.Lock()
+	defer quota.mutex.Unlock()
+	if !quota.known {
+		return ""
+	}
+	text := strconv.Itoa(quota.remaining)
+	if quota.limit > 0 {
+		text += fmt.Sprintf(" of %v", quota.limit)
+	}
+	text += " requests left"
+	if !quota.reset.IsZero() {
+		text += ", resets at " + quota.reset.Format("15:04:05")
+	}
+	return text
+}
+
+// Time to wait after a 429, from Retry-After in seconds or as a date.
+func retryAfter(header http.Header, attempt int) time.Duration {
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return minDuration(time.Duration(seconds)*time.Second, maxQuotaWait)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return minDuration(time.Until(date), maxQuotaWait)
+	}
+	return defaultRetryAfter << uint(attempt)
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(duration):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func minDuration(a time.Duration, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// The Steam client keeps some state in the Windows registry, at
+// HKCU\Software\Valve\Steam, and in registry.vdf on the other systems, with
+// the same keys under "Registry" { "HKCU" { "Software" { "Valve" { "Steam" }}}}.
+
+const steamRegistryKey = `HKCU\Software\Valve\Steam`
+
+// Reads the registry.vdf of Linux and macOS. It's next to the Steam directory,
+// which is the only place to look for it when the home directory isn't the
+// user's, like in containers.
+func readRegistryVDF(steamDir string) (*VDFNode, error) {
+	var paths []string
+	if steamDir != "" {
+		paths = append(paths, filepath.Join(filepath.Dir(steamDir), "registry.vdf"), filepath.Join(steamDir, "registry.vdf"))
+	}
+	if home := homeDir(); home != "" {
+		paths = append(paths,
+			filepath.Join(home, ".steam", "registry.vdf"),
+			filepath.Join(home, "Library", "Application Support", "Steam", "registry.vdf"),
+		)
+	}
+	for _, path := range paths {
+		registryBytes, err := steamFS.ReadFile(path)
+		if err == nil {
+			registry, err := ParseTextVDF(registryBytes)
+			if err != nil {
+				return nil, err
+			}
+			return registry.Get("Registry", "HKCU", "Software", "Valve", "Steam"), nil
+		}
+	}
+	return nil, errors.New("Could not find the Steam registry.vdf")
+}
+
+// Language of the Steam client. Returns "" if unknown.
+func steamLanguage(steamDir string) string {
+	if runtime.GOOS == "windows" {
+		output, err := exec.Command("reg", "query", steamRegistryKey, "/v", "Language").Output()
+		if err != nil {
+			return ""
+		}
+		// "    Language    REG_SZ    japanese"
+		matches := regexp.MustCompile(`REG_SZ\s+(\S+)`).FindSubmatch(output)
+		if matches == nil {
+			return ""
+		}
+		return string(matches[1])
+	}
+
+	registry, err := readRegistryVDF(steamDir)
+	if err != nil {
+		return ""
+	}
+	return registry.String("language")
+}
+
+// Returns the IDs of the installed Steam games, from
+// "Apps" { "620" { "Installed" "1" } }. Without a registry, like in a container
+// with only the Steam directory mounted, from the app manifests.
+func installedApps(steamDir string) (map[string]bool, error) {
+	installed := make(map[string]bool)
+	if runtime.GOOS == "windows" {
+		output, err := exec.Command("reg", "query", steamRegistryKey+`\Apps`, "/s", "/v", "Installed").Output()
+		if err != nil {
+			return nil, err
+		}
+		// HKEY_CURRENT_USER\Software\Valve\Steam\Apps\620
+		//     Installed    REG_DWORD    0x1
+		appID := ""
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "HKEY_") {
+				appID = line[strings.LastIndex(line, `\`)+1:]
+			} else if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "Installed" && fields[2] == "0x1" {
+				installed[appID] = true
+			}
+		}
+		return installed, nil
+	}
+
+	registry, err := readRegistryVDF(steamDir)
+	if err != nil {
+		if steamDir == "" {
+			return nil, err
+		}
+		return installedManifests(steamDir)
+	}
+	if apps := registry.Get("apps"); apps != nil {
+		for _, app := range apps.Children {
+			if app.String("Installed") == "1" {
+				installed[app.Key] = true
+			}
+		}
+	}
+	return installed, nil
+}
+
+// Returns the IDs of the games with a steamapps/appmanifest_<id>.acf, which
+// Steam creates when an install starts.
+func installedManifests(steamDir string) (map[string]bool, error) {
+	if _, err := steamFS.Stat(filepath.Join(steamDir, "steamapps")); err != nil {
+		return nil, err
+	}
+	manifests, err := steamFS.Glob(filepath.Join(steamDir, "steamapps", "appmanifest_*.acf"))
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]bool)
+	for _, manifest := range manifests {
+		name := strings.TrimSuffix(filepath.Base(manifest), ".acf")
+		installed[strings.TrimPrefix(name, "appmanifest_")] = true
+	}
+	return installed, nil
+}
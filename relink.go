@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// In older clients the ID of a shortcut comes from its target and name, so
+// renaming it in Steam gives it a new ID and leaves its artwork behind under
+// the old one. Current clients store the ID in shortcuts.vdf and keep it, those
+// shortcuts are never relinked.
+// The shortcuts of every run are kept in grid/shortcuts.json. When a shortcut
+// is gone and a new one has the same target and launch options, it's the same
+// game renamed: its grid images and backups are moved to the new ID, and the
+// files left under the old ID are removed.
+const shortcutsRecordName = "shortcuts.json"
+
+type shortcutRecord struct {
+	Name          string `json:"name"`
+	Exe           string `json:"exe"`
+	LaunchOptions string `json:"launchOptions,omitempty"`
+	// The ID is stored in shortcuts.vdf, it doesn't change with the name.
+	storedID bool
+}
+
+func (record shortcutRecord) target() string {
+	return record.Exe + "\x00" + record.LaunchOptions
+}
+
+func loadShortcutRecords(gridDir string) map[string]shortcutRecord {
+	records := map[string]shortcutRecord{}
+	recordBytes, err := steamFS.ReadFile(filepath.Join(gridDir, shortcutsRecordName))
+	if err == nil {
+		json.Unmarshal(recordBytes, &records)
+	}
+	return records
+}
+
+// Moves the artwork of renamed shortcuts to their new IDs and records the
+// shortcuts for the next run. Errors are printed, they shouldn't stop a run.
+func relinkShortcuts(gridDir string, games map[string]*Game, backupName string) {
+	previous := loadShortcutRecords(gridDir)
+	current := map[string]shortcutRecord{}
+	for id, game := range games {
+		if game.Shortcut != nil && !game.Shortcut.storedID {
+			current[id] = *game.Shortcut
+		}
+	}
+
+	// Targets of the shortcuts that are new and the ones that are gone.
+	added, removed := map[string][]string{}, map[string][]string{}
+	for id, record := range current {
+		if _, ok := previous[id]; !ok {
+			added[record.target()] = append(added[record.target()], id)
+		}
+	}
+	for id, record := range previous {
+		if _, ok := current[id]; !ok {
+			removed[record.target()] = append(removed[record.target()], id)
+		}
+	}
+
+	var targets []string
+	for target := range removed {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		// Only sure if exactly one shortcut with the target went and came.
+		if len(removed[target]) != 1 || len(added[target]) != 1 {
+			continue
+		}
+		oldID, newID := removed[target][0], added[target][0]
+		oldGame := &Game{ID: oldID, Name: previous[oldID].Name, Tags: []string{}}
+		if locks := loadGameLocks(gridDir); locks.hasAny(oldID) || locks.hasAny(newID) {
+			fmt.Printf("%v was renamed to %v, but its artwork is locked\n", oldGame.Name, games[newID].Name)
+			continue
+		}
+		err := relinkArtwork(gridDir, oldGame, games[newID], backupName)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		fmt.Printf("%v was renamed to %v, moved its artwork\n", oldGame.Name, games[newID].Name)
+	}
+
+	if len(current) == 0 {
+		// Keep the record if the shortcuts couldn't be read this time.
+		return
+	}
+	recordBytes, err := json.MarshalIndent(current, "", "\t")
+	if err == nil {
+		err = steamFS.WriteFile(filepath.Join(gridDir, shortcutsRecordName), recordBytes)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// Moves the grid images, backups and logo position of a game to another ID.
+// Artwork the new ID already has wins, the old one is removed.
+func relinkArtwork(gridDir string, oldGame *Game, newGame *Game, backupName string) error {
+	for _, artStyleExtensions := range getArtStyles(&Options{}) {
+		images, err := steamFS.Glob(filepath.Join(gridDir, oldGame.ID+artStyleExtensions[0]+".*"))
+		if err != nil {
+			return err
+		}
+		images = filterForImages(images)
+		existing, err := steamFS.Glob(filepath.Join(gridDir, newGame.ID+artStyleExtensions[0]+".*"))
+		if err != nil {
+			return err
+		}
+
+		if len(images) > 0 && len(filterForImages(existing)) == 0 {
+			imagePath := images[0]
+			imageBytes, err := steamFS.ReadFile(imagePath)
+			if err != nil {
+				return err
+			}
+			// The backup name has the hash of the image in the grid.
+			oldGame.ImageExt, newGame.ImageExt = filepath.Ext(imagePath), filepath.Ext(imagePath)
+			oldGame.OverlayImageBytes, newGame.OverlayImageBytes = imageBytes, imageBytes
+			oldBackup := getBackupPath(gridDir, oldGame, artStyleExtensions, backupName)
+			if _, err := steamFS.Stat(oldBackup); err == nil {
+				err = steamFS.Rename(oldBackup, getBackupPath(gridDir, newGame, artStyleExtensions, backupName))
+				if err != nil {
+					return err
+				}
+			}
+			err = steamFS.Rename(imagePath, filepath.Join(gridDir, newGame.ID+artStyleExtensions[0]+oldGame.ImageExt))
+			if err != nil {
+				return err
+			}
+			if tenfoot := tenfootID(newGame.ID); tenfoot != "" && artStyleExtensions[0] == "" {
+				err = steamFS.WriteFile(filepath.Join(gridDir, tenfoot+oldGame.ImageExt), imageBytes)
+				if err != nil {
+					return err
+				}
+			}
+			newGame.ImageExt, newGame.OverlayImageBytes = "", nil
+		}
+
+		// Whatever is left under the old ID.
+		err = RemoveExisting(gridDir, oldGame, artStyleExtensions, backupName)
+		if err != nil {
+			return err
+		}
+	}
+
+	oldPosition := filepath.Join(gridDir, oldGame.ID+".json")
+	newPosition := filepath.Join(gridDir, newGame.ID+".json")
+	if _, err := steamFS.Stat(oldPosition); err == nil {
+		if _, err := steamFS.Stat(newPosition); err == nil {
+			return steamFS.Remove(oldPosition)
+		}
+		return steamFS.Rename(oldPosition, newPosition)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/sftp"
+)
+
+// With the steam-ssh option, the Steam installation is on another machine,
+// like a living room PC or a Steam Deck, and read and written over SFTP:
+//
+//	steamgrid --steam-ssh deck@steamdeck:/home/deck/.local/share/Steam
+//
+// Only an SSH server is needed there. The connection is made by the ssh
+// program of this machine, so its config, keys, agent and known hosts all
+// apply, a port can be set in ~/.ssh/config. Downloads and compositing
+// happen here, only the images go over the connection.
+type sftpFS struct {
+	client *sftp.Client
+	cmd    *exec.Cmd
+	// Steam directory on the remote machine, absolute.
+	dir string
+}
+
+// Counts the temporary files, their names only have to be unique per run.
+var remoteTmpCounter uint64
+
+// Splits user@host:/path, like scp. Hosts with a colon go in brackets,
+// user@[::1]:/path.
+func parseSSHTarget(target string) (host string, dir string, err error) {
+	i := strings.Index(target, ":")
+	if end := strings.Index(target, "]:"); strings.Contains(target, "[") && end >= 0 {
+		i = end + 1
+	}
+	if i <= 0 || i == len(target)-1 {
+		return "", "", errors.New("Invalid steam-ssh " + target + ", must be like user@host:/path/to/Steam")
+	}
+	host = strings.Replace(strings.Replace(target[:i], "[", "", 1), "]", "", 1)
+	if strings.HasPrefix(host, "-") {
+		// ssh would read it as an option.
+		return "", "", errors.New("Invalid steam-ssh " + target + ", the host can't start with -")
+	}
+	return host, target[i+1:], nil
+}
+
+// Connects to the remote Steam directory and makes it the Steam file system
+// until closed.
+func connectSteamSSH(target string) (*sftpFS, error) {
+	host, dir, err := parseSSHTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("Connecting to " + host + "...")
+	cmd := exec.Command("ssh", "-s", "--", host, "sftp")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, errors.New("Could not start ssh, is it installed? " + err.Error())
+	}
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, errors.New("Could not connect to " + host + " over SFTP: " + err.Error())
+	}
+	// Relative to the home directory, like scp.
+	dir, err = client.RealPath(dir)
+	if err != nil {
+		client.Close()
+		cmd.Wait()
+		return nil, err
+	}
+	remote := &sftpFS{client: client, cmd: cmd, dir: dir}
+	steamFS = remote
+	return remote, nil
+}
+
+// The Steam directory in the local form, for filepath.Join and the options.
+func (r *sftpFS) steamDir() string {
+	return filepath.FromSlash(r.dir)
+}
+
+func (r *sftpFS) close() {
+	steamFS = diskFS{}
+	r.client.Close()
+	r.cmd.Wait()
+}
+
+// Paths are made with filepath, so with backslashes on Windows, but the
+// remote machine uses slashes.
+func remotePath(p string) string {
+	return filepath.ToSlash(p)
+}
+
+func (r *sftpFS) ReadFile(p string) ([]byte, error) {
+	file, err := r.client.Open(remotePath(p))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// Writes through a temporary file next to the file, like writeFileAtomic.
+func (r *sftpFS) WriteFile(p string, data []byte) error {
+	p = remotePath(p)
+	tmp := path.Join(path.Dir(p), fmt.Sprintf(".steamgrid-%v-%v.tmp", os.Getpid(), atomic.AddUint64(&remoteTmpCounter, 1)))
+	file, err := r.client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil && fileOptions.fsync {
+		err = remoteFile{file}.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = r.client.PosixRename(tmp, p)
+		if err != nil {
+			// Servers without the extension don't rename over files.
+			r.client.Remove(p)
+			err = r.client.Rename(tmp, p)
+		}
+	}
+	if err != nil {
+		r.client.Remove(tmp)
+	}
+	return err
+}
+
+func (r *sftpFS) ReadDir(p string) ([]os.FileInfo, error) {
+	infos, err := r.client.ReadDir(remotePath(p))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (r *sftpFS) Stat(p string) (os.FileInfo, error) {
+	return r.client.Stat(remotePath(p))
+}
+
+func (r *sftpFS) Glob(pattern string) ([]string, error) {
+	matches, err := r.client.Glob(remotePath(pattern))
+	for i, match := range matches {
+		matches[i] = filepath.FromSlash(match)
+	}
+	return matches, err
+}
+
+func (r *sftpFS) Remove(p string) error {
+	return r.client.Remove(remotePath(p))
+}
+
+func (r *sftpFS) Rename(from string, to string) error {
+	return r.client.PosixRename(remotePath(from), remotePath(to))
+}
+
+func (r *sftpFS) MkdirAll(p string) error {
+	return r.client.MkdirAll(remotePath(p))
+}
+
+func (r *sftpFS) Chmod(p string, mode os.FileMode) error {
+	return r.client.Chmod(remotePath(p), mode)
+}
+
+func (r *sftpFS) CreateExclusive(p string, data []byte) error {
+	file, err := r.client.OpenFile(remotePath(p), os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		// Most servers only answer with a generic failure.
+		if _, statErr := r.client.Stat(remotePath(p)); statErr == nil {
+			return &os.PathError{Op: "open", Path: p, Err: os.ErrExist}
+		}
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (r *sftpFS) OpenAppend(p string) (appendFile, error) {
+	file, err := r.client.OpenFile(remotePath(p), os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+	// Not all servers honor the append flag.
+	_, err = file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return remoteFile{file}, nil
+}
+
+type remoteFile struct {
+	*sftp.File
+}
+
+// Flushes the file if the server can, servers without the fsync extension
+// only get it to disk on their own.
+func (file remoteFile) Sync() error {
+	err := file.File.Sync()
+	if status, ok := err.(*sftp.StatusError); ok && status.FxCode() == sftp.ErrSSHFxOpUnsupported {
+		return nil
+	}
+	return err
+}
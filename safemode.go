@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Safe mode is for shared family machines. SteamGridDB images marked as NSFW
+// are never used, and with the skin check the images of sources nobody
+// moderates (search, URL sources and providers) are rejected if they show too
+// much skin. The check is a rough heuristic on the colors and rejects some
+// harmless images too, like close-up portraits.
+//
+// In the config file safe mode can't be turned off again: once a section or a
+// profile enables it, the more specific sections and the command line can't
+// disable it. See config.go.
+
+// The candidate was rejected by safe mode.
+var errCandidateUnsafe = errors.New("image rejected by safe mode")
+
+// Share of skin colored pixels above which an image is rejected.
+const maxSkinRatio = 0.4
+
+// Options that sections of the config file and the command line can't undo
+// once enabled.
+var enforcedOptions = map[string]string{
+	"safemode":  "true",
+	"skincheck": "true",
+}
+
+// Tells if SteamGridDB flags the image as not safe for work.
+func isNSFW(nsfw bool, tags []string) bool {
+	if nsfw {
+		return true
+	}
+	for _, tag := range tags {
+		if strings.EqualFold(tag, "nsfw") {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells if too much of the image is skin colored.
+func looksExplicit(img image.Image) bool {
+	bounds := img.Bounds()
+	// Sampling about 10000 pixels is enough for a ratio.
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > 10000 {
+		step++
+	}
+
+	skin, total := 0, 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			total++
+			if isSkinColor(uint8(r>>8), uint8(g>>8), uint8(b>>8)) {
+				skin++
+			}
+		}
+	}
+	return total > 0 && float64(skin)/float64(total) > maxSkinRatio
+}
+
+// Skin color rules in RGB and YCbCr, from the usual color based skin detection
+// papers.
+func isSkinColor(r, g, b uint8) bool {
+	if r <= 95 || g <= 40 || b <= 20 || r <= g || r <= b || int(r)-int(g) <= 15 {
+		return false
+	}
+	_, cb, cr := color.RGBToYCbCr(r, g, b)
+	return cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
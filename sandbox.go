@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// With the sandbox option, a run works on a copy of the Steam directory,
+// made on the first run with the sandbox, instead of the real one:
+//
+//	steamgrid --sandbox ~/steamgrid-sandbox           # copy, then run on the copy
+//	steamgrid --sandbox ~/steamgrid-sandbox           # run on the same copy again
+//	steamgrid --sandbox ~/steamgrid-sandbox --commit  # apply the changes to Steam
+//
+// The copy has what a run reads and writes: the config files of the users
+// with their grid directories, the app manifests and, with the library cache
+// option, Steam's library cache. The results can be looked at in the copy, or
+// shown by Steam after the commit. The commit only writes the files the runs
+// changed, and leaves alone the ones Steam or another program changed since
+// the copy was made. Delete the directory to start over.
+const sandboxRecordName = "steamgrid-sandbox.json"
+
+// What the sandbox was copied from. The hashes are of the files a run may
+// change, by path relative to the Steam directory, as they were copied or
+// last committed.
+type sandboxRecord struct {
+	Source  string            `json:"source"`
+	Created time.Time         `json:"created"`
+	Files   map[string]string `json:"files"`
+}
+
+func validateSandbox(opts *Options) error {
+	if opts.Commit && opts.Sandbox == "" {
+		return errors.New("The commit option needs the sandbox to commit, like --sandbox dir --commit")
+	}
+	if opts.Sandbox != "" && opts.Simulate {
+		return errors.New("The sandbox and simulate options can't be used together")
+	}
+	if opts.Sandbox != "" && opts.SteamSSH != "" {
+		return errors.New("The sandbox only works with a local Steam directory, not with steam-ssh")
+	}
+	return nil
+}
+
+// Files copied into the sandbox, as globs relative to the Steam directory.
+// Directories are copied with everything in them.
+var sandboxPatterns = []string{
+	"registry.vdf",
+	"steamapps/libraryfolders.vdf",
+	"steamapps/appmanifest_*.acf",
+	"steamapps/sourcemods/*/gameinfo.txt",
+	"userdata/*/config/localconfig.vdf",
+	"userdata/*/config/shortcuts.vdf",
+	"userdata/*/7/remote/sharedconfig.vdf",
+	"userdata/*/config/cloudstorage/" + collectionsFileName,
+	"userdata/*/config/grid",
+}
+
+// Whether a run may change the file, by its path relative to the Steam
+// directory. The journal of a stopped run stays in the sandbox.
+func isSandboxOutput(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if parts[len(parts)-1] == journalFileName {
+		return false
+	}
+	if len(parts) > 4 && parts[0] == "userdata" && parts[2] == "config" && parts[3] == "grid" {
+		return true
+	}
+	return len(parts) > 2 && parts[0] == "appcache" && parts[1] == "librarycache"
+}
+
+func loadSandboxRecord(dir string) (*sandboxRecord, error) {
+	recordBytes, err := steamFS.ReadFile(filepath.Join(dir, sandboxRecordName))
+	if err != nil {
+		return nil, err
+	}
+	var record sandboxRecord
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, errors.New("Could not read the sandbox " + dir + ": " + err.Error())
+	}
+	if record.Files == nil {
+		record.Files = map[string]string{}
+	}
+	return &record, nil
+}
+
+func (record *sandboxRecord) save(dir string) error {
+	recordBytes, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, sandboxRecordName), recordBytes)
+}
+
+// Makes the run work on the sandbox, copying the Steam directory into it if
+// this is the first run with it.
+func prepareSandbox(opts *Options) error {
+	dir, err := filepath.Abs(opts.Sandbox)
+	if err != nil {
+		return err
+	}
+	if record, err := loadSandboxRecord(dir); err == nil {
+		fmt.Println("Running on the sandbox " + dir + ", a copy of " + record.Source)
+		opts.SteamDir = dir
+		return nil
+	}
+	if files, _ := steamFS.ReadDir(dir); len(files) > 0 {
+		return errors.New("The sandbox " + dir + " isn't empty and wasn't made by steamgrid, pick another directory")
+	}
+
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
+	if err != nil {
+		return err
+	}
+	installationDir, err = filepath.Abs(installationDir)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Copying " + installationDir + " into the sandbox " + dir + "...")
+	patterns := sandboxPatterns
+	if opts.LibraryCache {
+		patterns = append(patterns, "appcache/librarycache")
+	}
+	record := &sandboxRecord{Source: installationDir, Created: time.Now(), Files: map[string]string{}}
+	for _, pattern := range patterns {
+		matches, err := steamFS.Glob(filepath.Join(installationDir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			files, err := listFiles(match)
+			if err != nil {
+				return err
+			}
+			for _, path := range files {
+				rel, _ := filepath.Rel(installationDir, path)
+				data, err := steamFS.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				err = writeFileAll(filepath.Join(dir, rel), data)
+				if err != nil {
+					return err
+				}
+				if isSandboxOutput(rel) {
+					record.Files[filepath.ToSlash(rel)] = imageHash(data)
+				}
+			}
+		}
+	}
+	err = record.save(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Copied %v grid files, running on the sandbox\n", len(record.Files))
+	opts.SteamDir = dir
+	return nil
+}
+
+// Writes the changes made in the sandbox to the Steam directory it was copied
+// from. A dry run only lists them.
+func commitSandbox(ctx context.Context, opts *Options, dryRun bool) error {
+	dir, err := filepath.Abs(opts.Sandbox)
+	if err != nil {
+		return err
+	}
+	record, err := loadSandboxRecord(dir)
+	if err != nil {
+		return errors.New("Nothing to commit at " + dir + ", run with --sandbox or \"steamgrid fetch\" first")
+	}
+	if !dryRun {
+		lock, err := acquireLock(ctx, record.Source, opts.LockWait)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+
+	current := map[string]string{}
+	for _, root := range []string{"userdata", "appcache"} {
+		files, err := listFiles(filepath.Join(dir, root))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, path := range files {
+			rel, _ := filepath.Rel(dir, path)
+			if !isSandboxOutput(rel) {
+				continue
+			}
+			data, err := steamFS.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			current[filepath.ToSlash(rel)] = imageHash(data)
+		}
+	}
+
+	var changed []string
+	for rel, hash := range current {
+		if record.Files[rel] != hash {
+			changed = append(changed, rel)
+		}
+	}
+	for rel := range record.Files {
+		if _, ok := current[rel]; !ok {
+			changed = append(changed, rel)
+		}
+	}
+	sort.Strings(changed)
+
+	written, removed, skipped := 0, 0, 0
+	for _, rel := range changed {
+		target := filepath.Join(record.Source, filepath.FromSlash(rel))
+		// Changed in Steam since the copy, by the client or another run.
+		if hashFile(target) != record.Files[rel] {
+			fmt.Println("Leaving " + target + " alone, it changed since the sandbox was made")
+			skipped++
+			continue
+		}
+		if dryRun {
+			if _, ok := current[rel]; ok {
+				fmt.Println("Would write " + target)
+				written++
+			} else {
+				fmt.Println("Would remove " + target)
+				removed++
+			}
+			continue
+		}
+		if _, ok := current[rel]; ok {
+			data, err := steamFS.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+			if err == nil {
+				err = writeFileAll(target, data)
+			}
+			if err != nil {
+				return err
+			}
+			record.Files[rel] = current[rel]
+			written++
+		} else {
+			err = steamFS.Remove(target)
+			if err != nil {
+				return err
+			}
+			delete(record.Files, rel)
+			removed++
+		}
+	}
+	if dryRun {
+		fmt.Printf("Committing would write %v files to %v and remove %v, %v left alone\n", written, record.Source, removed, skipped)
+		return nil
+	}
+	err = record.save(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Committed the sandbox to %v: %v files written, %v removed, %v left alone\n", record.Source, written, removed, skipped)
+	return nil
+}
+
+// All files in the directory and below it, or the file itself.
+func listFiles(path string) ([]string, error) {
+	info, err := steamFS.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := steamFS.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		below, err := listFiles(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, below...)
+	}
+	return files, nil
+}
+
+// Writes a file, making the directories it's in first.
+func writeFileAll(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// Hash of a file, empty if it doesn't exist.
+func hashFile(path string) string {
+	data, err := steamFS.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return imageHash(data)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The serve command answers to a small JSON API on localhost, for frontends
+// like a Decky Loader plugin on the Steam Deck:
+//
+//	GET  /api/users
+//	     [{"id": "1234", "name": "me"}]
+//	GET  /api/games?user=1234&missing=true
+//	     [{"id": "620", "name": "Portal 2", "missing": ["Cover"]}]
+//	GET  /api/candidates?user=1234&game=620&type=cover
+//	     [{"index": 0, "from": "SteamGridDB", "width": 600, "height": 900,
+//	       "score": 91.5, "thumbnail": "data:image/jpeg;base64,..."}]
+//	POST /api/apply {"user": "1234", "game": "620", "type": "cover", "index": 0}
+//	     {"source": "SteamGridDB"}
+//	POST /api/reload
+//
+// Pages of the Steam client, like Decky plugins, run at steamloopback.host and
+// are allowed to call the API. Other web pages are not. Browser extensions
+// have their own endpoint with a token, see extension.go.
+//
+// The candidates are downloaded from all sources, like with -bestpick, and
+// kept until they are applied or the next search. API requests go ahead of
+// a full run started from the GUI, which waits meanwhile. Errors are answered with
+// {"error": "message"}.
+const defaultServeAddress = "127.0.0.1:8765"
+
+type server struct {
+	ctx  context.Context
+	opts Options
+	// Options for full runs, without the changes for the API.
+	runOpts         Options
+	installationDir string
+	// Lock of the installation, shared by the full runs and the applies.
+	lock      *sharedLock
+	users     []User
+	artStyles map[string][]string
+	overlays  map[string]image.Image
+	exports   []export
+
+	mutex sync.Mutex
+	// Games by user ID, loaded on start and on reload.
+	games map[string]map[string]*Game
+	// Last candidates found, by user, game and art style.
+	candidates map[string][]*Candidate
+	// Full run started from the GUI, see gui.go.
+	run runState
+	// Token of the browser extension endpoint, see extension.go.
+	extensionToken string
+}
+
+type serveUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type serveGame struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Missing []string `json:"missing"`
+}
+
+type serveCandidate struct {
+	Index     int          `json:"index"`
+	From      string       `json:"from"`
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	Score     float64      `json:"score"`
+	Thumbnail template.URL `json:"thumbnail"`
+}
+
+type applyRequest struct {
+	User  string `json:"user"`
+	Game  string `json:"game"`
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+func runServeCommand(args []string) error {
+	return runServer("serve", args, false)
+}
+
+// Runs the API server, with the page of gui.go and opening it in the browser
+// if gui is set.
+func runServer(name string, args []string, gui bool) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	address := flags.String("listen", defaultServeAddress, "Address to listen on. Anyone who can reach it can change your artwork, keep it on localhost")
+	tokenPath := flags.String("extension-token", defaultExtensionTokenPath(), "File with the token browser extensions need to apply images, made if it doesn't exist")
+	flags.Parse(args)
+
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	if !isLoopbackHost(*address) {
+		fmt.Println("Warning: listening on " + *address + ", other computers may change your artwork")
+	}
+
+	ctx := interruptContext()
+	if err = servePprof(ctx, opts.Pprof); err != nil {
+		return err
+	}
+	s, err := newServer(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err = s.reload(ctx); err != nil {
+		return err
+	}
+	s.extensionToken, err = loadExtensionToken(*tokenPath)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/users", s.handleUsers)
+	mux.HandleFunc("/api/games", s.handleGames)
+	mux.HandleFunc("/api/candidates", s.handleCandidates)
+	mux.HandleFunc("/api/apply", s.handleApply)
+	mux.HandleFunc("/api/reload", s.handleReload)
+	mux.HandleFunc("/api/extension/apply", s.requireToken(s.handleExtensionApply))
+	if gui {
+		s.registerGUI(mux)
+	}
+	httpServer := &http.Server{Addr: *address, Handler: allowSteamOrigin(mux, *address), BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		return err
+	}
+	if gui {
+		fmt.Println("SteamGrid is running at http://" + *address + ", press Ctrl+C to stop.")
+		openBrowser("http://" + *address + "/")
+	} else {
+		fmt.Println("Serving the steamgrid API on http://" + *address)
+	}
+	err = httpServer.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func newServer(ctx context.Context, opts Options) (*server, error) {
+	runOpts := opts
+	artStyles, exports, err := prepareOptions(&opts)
+	if err != nil {
+		return nil, err
+	}
+	err = applyGlobalOptions(&opts)
+	if err != nil {
+		return nil, err
+	}
+	runOpts.globalsApplied = true
+	// Candidates come from all sources, to choose from.
+	opts.BestPick = true
+	overlays, err := loadOverlays(&opts, artStyles)
+	if err != nil {
+		return nil, err
+	}
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
+	if err != nil {
+		return nil, err
+	}
+	users, err := GetUsers(installationDir)
+	if err != nil {
+		return nil, err
+	}
+	opts.severalUsers = len(users) > 1
+	lock := newSharedLock(installationDir, opts.LockWait)
+	runOpts.lock = lock
+	return &server{
+		ctx:             ctx,
+		opts:            opts,
+		runOpts:         runOpts,
+		installationDir: installationDir,
+		lock:            lock,
+		users:           users,
+		artStyles:       artStyles,
+		overlays:        overlays,
+		exports:         exports,
+		candidates:      map[string][]*Candidate{},
+	}, nil
+}
+
+// Loads the games of all users again.
+func (s *server) reload(ctx context.Context) error {
+	games := make(map[string]map[string]*Game)
+	for _, user := range s.users {
+		fmt.Println("Loading games for " + user.Name)
+		games[user.SteamID32] = GetGames(ctx, user, s.installationDir, s.opts.NonSteamOnly)
+	}
+	s.mutex.Lock()
+	s.games = games
+	s.candidates = map[string][]*Candidate{}
+	s.mutex.Unlock()
+	return ctx.Err()
+}
+
+// Origin of the pages of the Steam client.
+const steamClientOrigin = "https://steamloopback.host"
+
+// Adds the CORS headers for the Steam client and answers its preflight
+// requests. Requests from other pages are refused, only the page of the GUI
+// and the Steam client may call the API, and browser extensions the
+// extension endpoint. Requests must be for a loopback host or the address
+// the server listens on: a page that points its own name at 127.0.0.1 is the
+// same origin as the server, and its GET requests have no Origin at all.
+func allowSteamOrigin(handler http.Handler, address string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) && (r.Host != address || strings.HasPrefix(address, ":")) {
+			writeError(w, http.StatusForbidden, errors.New("Requests for "+r.Host+" are not allowed"))
+			return
+		}
+		origin := r.Header.Get("Origin")
+		extension := strings.HasPrefix(r.URL.Path, "/api/extension/") && isExtensionOrigin(origin)
+		sameOrigin := origin == "http://"+r.Host
+		if origin != "" && origin != steamClientOrigin && !sameOrigin && !extension {
+			// Other web pages could change the artwork otherwise.
+			writeError(w, http.StatusForbidden, errors.New("Requests from "+origin+" are not allowed"))
+			return
+		}
+		if origin == steamClientOrigin || extension {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Whether a host and port is localhost or a loopback address, like
+// 127.0.0.1:8765 or [::1]:8765.
+func isLoopbackHost(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if strings.ToLower(host) == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *server) findUser(id string) (User, error) {
+	for _, user := range s.users {
+		if user.SteamID32 == id {
+			return user, nil
+		}
+	}
+	return User{}, errors.New("Unknown user " + id)
+}
+
+// Returns the user, a copy of the game and the art style of a request.
+func (s *server) findArtwork(userID string, gameID string, artType string) (User, *Game, string, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return user, nil, "", err
+	}
+	s.mutex.Lock()
+	game, ok := s.games[userID][gameID]
+	s.mutex.Unlock()
+	if !ok {
+		return user, nil, "", errors.New("Unknown game " + gameID)
+	}
+	artStyle, ok := artTypeNames[strings.ToLower(artType)]
+	if _, enabled := s.artStyles[artStyle]; !ok || !enabled {
+		return user, nil, "", errors.New("Unknown or disabled artwork type " + artType)
+	}
+	// Requests run concurrently, each one works on its own copy.
+	copied := *game
+	return user, &copied, artStyle, nil
+}
+
+func (s *server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	users := []serveUser{}
+	for _, user := range s.users {
+		users = append(users, serveUser{user.SteamID32, user.Name})
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *server) handleGames(w http.ResponseWriter, r *http.Request) {
+	user, err := s.findUser(r.FormValue("user"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	onlyMissing := r.FormValue("missing") == "true"
+	gridDir := filepath.Join(user.Dir, "config", "grid")
+
+	s.mutex.Lock()
+	games, err := sortGames(s.games[user.SteamID32], s.opts.Order)
+	s.mutex.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	list := []serveGame{}
+	for _, game := range games {
+		entry := serveGame{ID: game.ID, Name: game.Name, Missing: []string{}}
+		for artStyle, artStyleExtensions := range s.artStyles {
+			if readGridImage(gridDir, game, artStyleExtensions) == nil {
+				entry.Missing = append(entry.Missing, artStyle)
+			}
+		}
+		sort.Strings(entry.Missing)
+		if !onlyMissing || len(entry.Missing) > 0 {
+			list = append(list, entry)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) handleCandidates(w http.ResponseWriter, r *http.Request) {
+	user, game, artStyle, err := s.findArtwork(r.FormValue("user"), r.FormValue("game"), r.FormValue("type"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	artStyleExtensions := s.artStyles[artStyle]
+	// Ahead of a full run in the background.
+	ctx, done := withPriority(r.Context())
+	defer done()
+	candidates, err := findBestCandidates(ctx, getCandidateSources(ctx, game, artStyle, artStyleExtensions, &s.opts), artStyle, artStyleExtensions, &s.opts, nil)
+	if len(candidates) == 0 && err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	s.mutex.Lock()
+	s.candidates[user.SteamID32+"/"+game.ID+artStyleExtensions[0]] = candidates
+	s.mutex.Unlock()
+	list := []serveCandidate{}
+	for i, candidate := range candidates {
+		list = append(list, serveCandidate{i, candidate.From, candidate.Size.X, candidate.Size.Y, candidate.Score, thumbnail(candidate.ImageBytes)})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) handleApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Use POST"))
+		return
+	}
+	var request applyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	user, game, artStyle, err := s.findArtwork(request.User, request.Game, request.Type)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	artStyleExtensions := s.artStyles[artStyle]
+	s.mutex.Lock()
+	candidates := s.candidates[user.SteamID32+"/"+game.ID+artStyleExtensions[0]]
+	s.mutex.Unlock()
+	if request.Index < 0 || request.Index >= len(candidates) {
+		writeError(w, http.StatusNotFound, errors.New("No candidate "+strconv.Itoa(request.Index)+", search for candidates first"))
+		return
+	}
+
+	candidate := candidates[request.Index]
+	ctx, done := withPriority(r.Context())
+	defer done()
+	err = s.applyCandidate(ctx, user, game, artStyle, candidate)
+	if err == errGameLocked {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"source": candidate.From})
+}
+
+// Saves a downloaded candidate as the artwork of the game, with the overlays.
+// The game is a copy, see findArtwork.
+func (s *server) applyCandidate(ctx context.Context, user User, game *Game, artStyle string, candidate *Candidate) error {
+	artStyleExtensions := s.artStyles[artStyle]
+	s.mutex.Lock()
+	overlays := s.overlays
+	s.mutex.Unlock()
+	game.ImageExt = candidate.ImageExt
+	game.ImageSource = candidate.From
+	game.CleanImageBytes = candidate.ImageBytes
+	gridDir := filepath.Join(user.Dir, "config", "grid")
+	if isLocked(gridDir, game, artStyleExtensions) {
+		return errGameLocked
+	}
+	// Like a run, so a scheduled run and a link or extension don't write the
+	// grid at the same time. A full run of the server shares its lock, the
+	// apply goes ahead of it.
+	release, err := s.lock.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = steamFS.MkdirAll(filepath.Join(gridDir, "originals"))
+	if err == nil {
+		err = overlayAndSave(ctx, &s.opts, gridDir, game, artStyle, artStyleExtensions, overlays, s.exports, newResult(), nil)
+	}
+	return err
+}
+
+func (s *server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Use POST"))
+		return
+	}
+	if err := s.reload(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The service command starts the watch mode on its own, so it survives
+// reboots:
+//
+//	steamgrid service install --steamgriddb <api key>
+//	steamgrid service uninstall
+//	steamgrid service unit --steamgriddb <api key>
+//
+// The options after install are the options of the watch command. On Linux it
+// writes a systemd user unit and enables it, "unit" only prints it. On
+// Windows it creates a scheduled task that starts at logon. macOS is not
+// supported. Not a Windows
+// service: services don't run as the user, so they can't see the user's
+// registry, where Steam lists the installed games.
+func runServiceCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Usage: steamgrid service install|uninstall|unit [watch options]")
+	}
+	action, watchArgs := args[0], args[1:]
+	switch action {
+	case "install":
+		switch runtime.GOOS {
+		case "windows":
+			return installScheduledTask(watchArgs)
+		case "darwin":
+			return errMacService
+		}
+		return installSystemdUnit(watchArgs)
+	case "uninstall":
+		switch runtime.GOOS {
+		case "windows":
+			return uninstallScheduledTask()
+		case "darwin":
+			return errMacService
+		}
+		return uninstallSystemdUnit()
+	case "unit":
+		unit, err := systemdUnit(watchArgs)
+		if err != nil {
+			return err
+		}
+		fmt.Print(unit)
+		return nil
+	}
+	return errors.New("Unknown service action " + action + ", must be install, uninstall or unit")
+}
+
+// Services would be launchd agents on macOS, which aren't written yet.
+var errMacService = errors.New("steamgrid: services are not supported on macOS, run steamgrid watch from a login item instead")
+
+// Name of the systemd unit and the scheduled task.
+const serviceName = "steamgrid"
+
+// The command line of the service, with the absolute path of this executable.
+func serviceCommand(watchArgs []string) ([]string, error) {
+	return executableCommand("watch", watchArgs)
+}
+
+// A command line running the subcommand of this executable, by its absolute
+// path.
+func executableCommand(command string, args []string) ([]string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	executable, err = filepath.Abs(executable)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{executable, command}, args...), nil
+}
+
+// Returns a systemd user unit running the watch mode.
+func systemdUnit(watchArgs []string) (string, error) {
+	command, err := serviceCommand(watchArgs)
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		// systemd splits on spaces and expands % specifiers.
+		arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(arg)
+		quoted[i] = `"` + arg + `"`
+	}
+	return "[Unit]\n" +
+		"Description=SteamGrid, downloads artwork for new Steam games\n" +
+		"After=network-online.target\n" +
+		"\n" +
+		"[Service]\n" +
+		"ExecStart=" + strings.Join(quoted, " ") + "\n" +
+		"Restart=on-failure\n" +
+		"RestartSec=30\n" +
+		"\n" +
+		"[Install]\n" +
+		"WantedBy=default.target\n", nil
+}
+
+// Path of the unit in the systemd user directory.
+func systemdUnitPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user", serviceName+".service"), nil
+}
+
+// Runs a command, with its output in the error.
+func runServiceTool(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return errors.New(name + " " + strings.Join(args, " ") + " failed: " + err.Error() + " " + strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func installSystemdUnit(watchArgs []string) error {
+	unit, err := systemdUnit(watchArgs)
+	if err != nil {
+		return err
+	}
+	unitPath, err := systemdUnitPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(unitPath), 0777)
+	if err != nil {
+		return err
+	}
+	// The options may have API keys.
+	err = ioutil.WriteFile(unitPath, []byte(unit), 0600)
+	if err != nil {
+		return err
+	}
+	if err = runServiceTool("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	if err = runServiceTool("systemctl", "--user", "enable", "--now", serviceName+".service"); err != nil {
+		return err
+	}
+	fmt.Println("Installed " + unitPath + ", see its log with: journalctl --user -u " + serviceName)
+	fmt.Println("To keep it running while logged out: loginctl enable-linger")
+	return nil
+}
+
+func uninstallSystemdUnit() error {
+	unitPath, err := systemdUnitPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(unitPath); err != nil {
+		return errors.New("The service is not installed, " + unitPath + " doesn't exist")
+	}
+	if err = runServiceTool("systemctl", "--user", "disable", "--now", serviceName+".service"); err != nil {
+		// Remove the file anyway, a broken unit can't be disabled.
+		fmt.Println(err.Error())
+	}
+	err = os.Remove(unitPath)
+	if err != nil {
+		return err
+	}
+	runServiceTool("systemctl", "--user", "daemon-reload")
+	fmt.Println("Removed " + unitPath)
+	return nil
+}
+
+// Quotes an argument for the command line of a scheduled task, like the C
+// runtime parses it.
+func quoteWindowsArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	backslashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			quoted.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			quoted.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		quoted.WriteRune(c)
+	}
+	quoted.WriteString(strings.Repeat(`\`, 2*backslashes))
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+func installScheduledTask(watchArgs []string) error {
+	command, err := serviceCommand(watchArgs)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteWindowsArg(arg)
+	}
+	err = runServiceTool("schtasks", "/Create", "/TN", serviceName, "/TR", strings.Join(quoted, " "), "/SC", "ONLOGON", "/RL", "LIMITED", "/F")
+	if err != nil {
+		return err
+	}
+	if err = runServiceTool("schtasks", "/Run", "/TN", serviceName); err != nil {
+		return err
+	}
+	fmt.Println("Installed the scheduled task " + serviceName + ", it starts when you log in")
+	return nil
+}
+
+func uninstallScheduledTask() error {
+	// Not running is fine.
+	runServiceTool("schtasks", "/End", "/TN", serviceName)
+	err := runServiceTool("schtasks", "/Delete", "/TN", serviceName, "/F")
+	if err != nil {
+		return err
+	}
+	fmt.Println("Removed the scheduled task " + serviceName)
+	return nil
+}
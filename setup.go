@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The setup command asks for the usual options and writes them to the config
+// file, for people who would rather answer questions than edit it.
+func runSetupCommand(args []string) error {
+	flags := flag.NewFlagSet("setup", flag.ExitOnError)
+	configPath := registerConfigFlag(flags)
+	flags.Parse(args)
+	return runSetup(os.Stdin, os.Stdout, *configPath)
+}
+
+// A question of the wizard and the option it sets.
+type setupQuestion struct {
+	key      string
+	question string
+	// Default answer, or the value in the existing config.
+	answer string
+	yesNo  bool
+}
+
+func runSetup(input io.Reader, output io.Writer, configPath string) error {
+	reader := bufio.NewReader(input)
+	ask := func(question string, answer string) (string, error) {
+		if answer != "" {
+			fmt.Fprintf(output, "%v [%v]: ", question, answer)
+		} else {
+			fmt.Fprintf(output, "%v: ", question)
+		}
+		// The end of the input keeps the remaining answers.
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return answer, nil
+		}
+		return line, nil
+	}
+
+	fmt.Fprintln(output, "SteamGrid setup. Press enter to keep the answer in brackets.")
+	fmt.Fprintln(output)
+
+	// Previous answers, to change only some of them.
+	previous := map[string]string{}
+	var config *Config
+	if _, err := os.Stat(configPath); err == nil {
+		config, err = LoadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		for _, setting := range config.Global {
+			previous[setting.Key] = setting.Value
+		}
+		fmt.Fprintln(output, "Changing "+configPath+".")
+	}
+	defaults := DefaultOptions()
+	answer := func(key string, fallback string) string {
+		if value, ok := previous[key]; ok {
+			return value
+		}
+		return fallback
+	}
+	yes := func(key string) string {
+		if value, err := strconv.ParseBool(previous[key]); err == nil && value {
+			return "y"
+		}
+		return "n"
+	}
+
+	for source := range keyringSources {
+		if _, ok := previous[source]; !ok {
+			if key, err := keyringGet(source); err == nil && key != "" {
+				previous[source] = key
+			}
+		}
+	}
+
+	steamDir, err := GetSteamInstallation(previous["steamdir"])
+	if err != nil {
+		fmt.Fprintln(output, "Steam was not found automatically.")
+	} else {
+		fmt.Fprintln(output, "Found Steam at "+steamDir+".")
+	}
+
+	questions := []setupQuestion{
+		{"steamdir", "Steam directory, empty to detect it on every run", previous["steamdir"], false},
+		{"steamgriddb", "SteamGridDB API key, from https://www.steamgriddb.com/profile/preferences (optional)", previous["steamgriddb"], false},
+		{"igdb", "IGDB API key, from https://api.igdb.com/signup (optional)", previous["igdb"], false},
+		{"types", "Artwork types and SteamGridDB types, comma separated: banner, portrait, hero, logo, static, animated", answer("types", defaults.SteamGridTypes), false},
+		{"styles", "SteamGridDB styles, comma separated: alternate, blurred, white_logo, material, no_logo", answer("styles", defaults.SteamGridStyles), false},
+		{"bestpick", "Download all candidates and keep the best one? Slower, better results (y/n)", yes("bestpick"), true},
+		{"safemode", "Never use images marked as NSFW? (y/n)", yes("safemode"), true},
+		{"platformbadges", "Add platform badges to non-Steam games? (y/n)", yes("platformbadges"), true},
+	}
+
+	var settings []ConfigSetting
+	for _, question := range questions {
+		value, err := ask(question.question, question.answer)
+		if err != nil {
+			return err
+		}
+		if question.yesNo {
+			switch strings.ToLower(value) {
+			case "y", "yes", "true":
+				value = "true"
+			case "n", "no", "false":
+				value = ""
+			default:
+				fmt.Fprintln(output, "Please answer y or n, skipping this one.")
+				value = ""
+			}
+		}
+		if value != "" && keyringSources[question.key] != "" {
+			// Keep API keys out of the file when there's a keyring.
+			if err := keyringSet(question.key, value); err == nil {
+				fmt.Fprintln(output, "Saved the key to the keyring.")
+				continue
+			}
+		}
+		if value != "" {
+			settings = append(settings, ConfigSetting{question.key, value, 0})
+		}
+	}
+
+	// Keep the rest of the existing file, like profiles and other options.
+	if config == nil {
+		config = &Config{Path: configPath, Profiles: map[string][]ConfigSetting{}, Users: map[string][]ConfigSetting{}, Targets: map[string][]ConfigSetting{}}
+	}
+	asked := map[string]bool{}
+	for _, question := range questions {
+		asked[question.key] = true
+	}
+	for _, setting := range config.Global {
+		if !asked[setting.Key] {
+			settings = append(settings, setting)
+		}
+	}
+	config.Global = settings
+
+	// Check the answers with the real flags before writing them.
+	if err = config.Check(); err != nil {
+		return err
+	}
+	// Without a keyring the API keys are in the file.
+	if err = writePrivateFile(configPath, config.Format()); err != nil {
+		return err
+	}
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "Saved to "+configPath+". Run steamgrid to use it.")
+	return nil
+}
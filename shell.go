@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The integrate-shell command adds "Fetch Steam art for this shortcut" to the
+// context menu of files in the file manager, for a non-Steam game that was
+// just added:
+//
+//	steamgrid integrate-shell install --steamgriddb <api key>
+//	steamgrid integrate-shell uninstall
+//
+// The entry runs "steamgrid apply --exe <file>" with the options after
+// install, see apply.go. On Windows it's in the menu of .exe, .lnk and .bat
+// files in Explorer, on macOS a Quick Action of the Finder, and on Linux a
+// Dolphin service menu and a Nautilus script, for any file so ROMs of
+// emulator shortcuts work too.
+func runIntegrateShellCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Usage: steamgrid integrate-shell install|uninstall [apply options]")
+	}
+	action, applyArgs := args[0], args[1:]
+	switch action {
+	case "install":
+		switch runtime.GOOS {
+		case "windows":
+			return installExplorerEntries(applyArgs)
+		case "darwin":
+			return installFinderAction(applyArgs)
+		}
+		return installLinuxEntries(applyArgs)
+	case "uninstall":
+		switch runtime.GOOS {
+		case "windows":
+			return uninstallExplorerEntries()
+		case "darwin":
+			return uninstallFinderAction()
+		}
+		return uninstallLinuxEntries()
+	}
+	return errors.New("Unknown integrate-shell action " + action + ", must be install or uninstall")
+}
+
+// Name of the context menu entry.
+const shellEntryName = "Fetch Steam art for this shortcut"
+
+// Extensions that get the Explorer entry.
+var explorerExtensions = []string{".exe", ".lnk", ".bat"}
+
+// Registry key of the entry for an extension. SystemFileAssociations adds it
+// next to the entries of the program the files are opened with.
+func explorerKey(ext string) string {
+	return `HKCU\Software\Classes\SystemFileAssociations\` + ext + `\shell\SteamGrid`
+}
+
+func installExplorerEntries(applyArgs []string) error {
+	// Explorer starts it in a new console, which stays open for the results.
+	command, err := executableCommand("apply", append(append([]string{"--pause"}, applyArgs...), "--exe"))
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteWindowsArg(arg)
+	}
+	commandLine := strings.Join(quoted, " ") + ` "%1"`
+	for _, ext := range explorerExtensions {
+		key := explorerKey(ext)
+		if err = runServiceTool("reg", "add", key, "/ve", "/d", shellEntryName, "/f"); err != nil {
+			return err
+		}
+		if err = runServiceTool("reg", "add", key, "/v", "Icon", "/d", command[0], "/f"); err != nil {
+			return err
+		}
+		if err = runServiceTool("reg", "add", key+`\command`, "/ve", "/d", commandLine, "/f"); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Added \"" + shellEntryName + "\" to the context menu of " + strings.Join(explorerExtensions, ", ") + " files")
+	fmt.Println("On Windows 11 it's under \"Show more options\"")
+	return nil
+}
+
+func uninstallExplorerEntries() error {
+	removed := 0
+	for _, ext := range explorerExtensions {
+		if runServiceTool("reg", "delete", explorerKey(ext), "/f") == nil {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return errors.New("The shell integration is not installed")
+	}
+	fmt.Println("Removed \"" + shellEntryName + "\" from the context menu")
+	return nil
+}
+
+// Quotes an argument for sh.
+func quoteShellArg(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// A script running the command for every file given as argument, for the
+// Finder and Nautilus.
+func shellScript(applyArgs []string) (string, error) {
+	command, err := executableCommand("apply", append(applyArgs, "--exe"))
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteShellArg(arg)
+	}
+	return "for file in \"$@\"; do\n" +
+		"\t" + strings.Join(quoted, " ") + " \"$file\"\n" +
+		"done\n", nil
+}
+
+// The Quick Action is an Automator workflow running a shell script in the
+// user's Services directory.
+func finderActionPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Services", shellEntryName+".workflow"), nil
+}
+
+const finderInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSServices</key>
+	<array>
+		<dict>
+			<key>NSMenuItem</key>
+			<dict>
+				<key>default</key>
+				<string>` + shellEntryName + `</string>
+			</dict>
+			<key>NSMessage</key>
+			<string>runWorkflowAsService</string>
+			<key>NSRequiredContext</key>
+			<dict>
+				<key>NSApplicationIdentifier</key>
+				<string>com.apple.finder</string>
+			</dict>
+			<key>NSSendFileTypes</key>
+			<array>
+				<string>public.item</string>
+			</array>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+// The workflow with a single Run Shell Script action, getting the selected
+// files as arguments.
+const finderWorkflow = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AMApplicationBuild</key>
+	<string>523</string>
+	<key>AMApplicationVersion</key>
+	<string>2.10</string>
+	<key>AMDocumentVersion</key>
+	<string>2</string>
+	<key>actions</key>
+	<array>
+		<dict>
+			<key>action</key>
+			<dict>
+				<key>AMAccepts</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Optional</key>
+					<true/>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.path</string>
+					</array>
+				</dict>
+				<key>AMActionVersion</key>
+				<string>2.0.3</string>
+				<key>AMApplication</key>
+				<array>
+					<string>Automator</string>
+				</array>
+				<key>AMProvides</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>ActionBundlePath</key>
+				<string>/System/Library/Automator/Run Shell Script.action</string>
+				<key>ActionName</key>
+				<string>Run Shell Script</string>
+				<key>ActionParameters</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<string>%v</string>
+					<key>CheckedForUserDefaultShell</key>
+					<true/>
+					<key>inputMethod</key>
+					<integer>1</integer>
+					<key>shell</key>
+					<string>/bin/sh</string>
+					<key>source</key>
+					<string></string>
+				</dict>
+				<key>BundleIdentifier</key>
+				<string>com.apple.RunShellScript</string>
+				<key>CFBundleVersion</key>
+				<string>2.0.3</string>
+				<key>Class Name</key>
+				<string>RunShellScriptAction</string>
+			</dict>
+		</dict>
+	</array>
+	<key>connectors</key>
+	<dict/>
+	<key>workflowMetaData</key>
+	<dict>
+		<key>serviceInputTypeIdentifier</key>
+		<string>com.apple.Automator.fileSystemObject</string>
+		<key>serviceOutputTypeIdentifier</key>
+		<string>com.apple.Automator.nothing</string>
+		<key>serviceProcessesInput</key>
+		<integer>0</integer>
+		<key>workflowTypeIdentifier</key>
+		<string>com.apple.Automator.servicesMenu</string>
+	</dict>
+</dict>
+</plist>
+`
+
+func installFinderAction(applyArgs []string) error {
+	script, err := shellScript(applyArgs)
+	if err != nil {
+		return err
+	}
+	actionPath, err := finderActionPath()
+	if err != nil {
+		return err
+	}
+	contents := filepath.Join(actionPath, "Contents")
+	err = os.MkdirAll(contents, 0777)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(contents, "Info.plist"), []byte(finderInfoPlist), 0644)
+	if err != nil {
+		return err
+	}
+	// The options may have API keys.
+	err = ioutil.WriteFile(filepath.Join(contents, "document.wflow"), []byte(fmt.Sprintf(finderWorkflow, html.EscapeString(script))), 0600)
+	if err != nil {
+		return err
+	}
+	// Makes the Finder see the new Quick Action without logging out.
+	runServiceTool("/System/Library/CoreServices/pbs", "-update")
+	fmt.Println("Added the Quick Action \"" + shellEntryName + "\", it's in the context menu of the Finder under Quick Actions")
+	return nil
+}
+
+func uninstallFinderAction() error {
+	actionPath, err := finderActionPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(actionPath); err != nil {
+		return errors.New("The shell integration is not installed, " + actionPath + " doesn't exist")
+	}
+	err = os.RemoveAll(actionPath)
+	if err != nil {
+		return err
+	}
+	runServiceTool("/System/Library/CoreServices/pbs", "-update")
+	fmt.Println("Removed " + actionPath)
+	return nil
+}
+
+// Files of the Dolphin service menu and the Nautilus script.
+func linuxEntryPaths() (dolphin string, nautilus string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "kio", "servicemenus", serviceName+".desktop"),
+		filepath.Join(dataDir, "nautilus", "scripts", shellEntryName), nil
+}
+
+// Quotes an argument for the Exec key of a desktop file, which is quoted once
+// for the command line and once more as a string value.
+func quoteDesktopArg(arg string) string {
+	arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`).Replace(arg)
+	return strings.NewReplacer(`\`, `\\`, "%", "%%").Replace(`"` + arg + `"`)
+}
+
+func installLinuxEntries(applyArgs []string) error {
+	dolphinPath, nautilusPath, err := linuxEntryPaths()
+	if err != nil {
+		return err
+	}
+	command, err := executableCommand("apply", append(applyArgs, "--exe"))
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteDesktopArg(arg)
+	}
+	serviceMenu := "[Desktop Entry]\n" +
+		"Type=Service\n" +
+		"MimeType=all/allfiles;\n" +
+		"X-KDE-ServiceTypes=KonqPopupMenu/Plugin\n" +
+		"Actions=steamgrid;\n" +
+		"\n" +
+		"[Desktop Action steamgrid]\n" +
+		"Name=" + shellEntryName + "\n" +
+		"Icon=steam\n" +
+		"Exec=" + strings.Join(quoted, " ") + " %f\n"
+	script, err := shellScript(applyArgs)
+	if err != nil {
+		return err
+	}
+	script = "#!/bin/sh\n" + script
+
+	// Service menus in the home directory have to be executable, and the
+	// options may have API keys.
+	for path, contents := range map[string]string{dolphinPath: serviceMenu, nautilusPath: script} {
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(path, []byte(contents), 0700)
+		if err != nil {
+			return err
+		}
+		// WriteFile keeps the mode of an existing file.
+		err = os.Chmod(path, 0700)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("Added \"" + shellEntryName + "\" to the context menu of Dolphin, and to the scripts of Nautilus")
+	return nil
+}
+
+func uninstallLinuxEntries() error {
+	dolphinPath, nautilusPath, err := linuxEntryPaths()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, path := range []string{dolphinPath, nautilusPath} {
+		if os.Remove(path) == nil {
+			fmt.Println("Removed " + path)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return errors.New("The shell integration is not installed")
+	}
+	return nil
+}
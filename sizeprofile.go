@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Size profiles set the resolutions artwork is searched, scored and generated
+// at, for the screen the library is shown on. Without one, the sizes of Steam
+// are used: heroes for 4K, the rest for a desktop monitor.
+//
+// Each size is [widthHQ, heightHQ, widthLQ, heightLQ], like in getArtStyles.
+var sizeProfiles = map[string]map[string][4]string{
+	"1080p": {
+		"Banner": {"920", "430", "460", "215"},
+		"Cover":  {"600", "900", "300", "450"},
+		"Hero":   {"1920", "620", "1920", "620"},
+		"Logo":   {"640", "360", "640", "360"},
+	},
+	// The 1280 x 800 screen of the Steam Deck.
+	"deck": {
+		"Banner": {"460", "215", "460", "215"},
+		"Cover":  {"300", "450", "300", "450"},
+		"Hero":   {"1920", "620", "1920", "620"},
+		"Logo":   {"640", "360", "640", "360"},
+	},
+	// Big Picture on a TV, where everything is drawn larger.
+	"4k": {
+		"Banner": {"1840", "860", "920", "430"},
+		"Cover":  {"1200", "1800", "600", "900"},
+		"Hero":   {"3840", "1240", "1920", "620"},
+		"Logo":   {"1280", "720", "640", "360"},
+	},
+}
+
+func validateSizeProfile(opts *Options) error {
+	if opts.SizeProfile == "" {
+		return nil
+	}
+	if _, ok := sizeProfiles[strings.ToLower(opts.SizeProfile)]; !ok {
+		var names []string
+		for name := range sizeProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errors.New("Unknown size profile " + opts.SizeProfile + ", must be " + strings.Join(names, " or "))
+	}
+	return nil
+}
+
+// Replaces the sizes of the art styles with those of the size profile of the
+// options, if any.
+func applySizeProfile(artStyles map[string][]string, opts *Options) {
+	profile := sizeProfiles[strings.ToLower(opts.SizeProfile)]
+	for artStyle, sizes := range profile {
+		if artStyleExtensions, ok := artStyles[artStyle]; ok {
+			copy(artStyleExtensions[3:7], sizes[:])
+		}
+	}
+}
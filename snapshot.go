@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The snapshot command packs the settings and state of steamgrid into a zip,
+// without images, to move them to another computer or attach them to a bug
+// report:
+//
+//	config/steamgrid.conf         the config file, API keys redacted
+//	config/environment.txt        STEAMGRID_* variables, API keys redacted
+//	overlays.txt                  names of the overlays, which are the rules
+//	games/*.json                  logo positions chosen in the games folder
+//	users/<id>/steamgrid.json     manifest of the last run
+//	users/<id>/grid/*.json        logo positions in the grid
+//	info.txt                      system and Steam directory
+//
+// API keys are never included, use "steamgrid login" on the other computer.
+func runSnapshotCommand(args []string) error {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	configPath := registerConfigFlag(flags)
+	output := flags.String("o", "steamgrid-snapshot-"+time.Now().Format("20060102-150405")+".zip", "File to write")
+	steamDir := flags.String("steamdir", "", "Path to your steam installation")
+	flags.Parse(args)
+
+	snapshot, err := makeSnapshot(*configPath, *steamDir)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(*output, snapshot, 0666)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Saved the snapshot to " + *output)
+	return nil
+}
+
+// Text of redacted values.
+const redacted = "<redacted>"
+
+// Returns the config file with the API keys redacted. Comments are kept.
+// Every line with the key of an API key is redacted, in any section, so new
+// kinds of sections can't leak them.
+func redactConfig(configPath string, configBytes []byte) ([]byte, error) {
+	_, err := ParseConfig(configPath, configBytes)
+	if err != nil {
+		// Still useful for a bug report, but keys can't be found reliably.
+		return nil, errors.New("Can't redact " + configPath + ": " + err.Error())
+	}
+	lines := strings.Split(string(configBytes), "\n")
+	for i, line := range lines {
+		setting := strings.TrimSpace(stripConfigComment(line))
+		equals := strings.Index(setting, "=")
+		if equals == -1 || strings.HasPrefix(setting, "[") {
+			continue
+		}
+		if key := strings.TrimSpace(setting[:equals]); keyringSources[key] != "" {
+			lines[i] = key + " = \"" + redacted + "\""
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+func makeSnapshot(configPath string, steamDir string) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	add := func(name string, data []byte) error {
+		writer, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	}
+	addFiles := func(dir string, pattern string, prefix string) error {
+		paths, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err = add(prefix+filepath.Base(path), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if configBytes, err := ioutil.ReadFile(configPath); err == nil {
+		configBytes, err = redactConfig(configPath, configBytes)
+		if err != nil {
+			return nil, err
+		}
+		if err = add("config/"+filepath.Base(configPath), configBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	var environment []string
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, envPrefix) {
+			continue
+		}
+		parts := strings.SplitN(variable, "=", 2)
+		if keyringSources[envKey(strings.TrimPrefix(parts[0], envPrefix))] != "" {
+			variable = parts[0] + "=" + redacted
+		}
+		environment = append(environment, variable)
+	}
+	sort.Strings(environment)
+	if len(environment) > 0 {
+		if err := add("config/environment.txt", []byte(strings.Join(environment, "\n")+"\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	var overlayNames []string
+	if files, err := ioutil.ReadDir(overlaysDir()); err == nil {
+		for _, file := range files {
+			if !file.IsDir() {
+				overlayNames = append(overlayNames, file.Name())
+			}
+		}
+	}
+	if err := add("overlays.txt", []byte(strings.Join(overlayNames, "\n")+"\n")); err != nil {
+		return nil, err
+	}
+	if err := addFiles(filepath.Join(filepath.Dir(os.Args[0]), "games"), "*.json", "games/"); err != nil {
+		return nil, err
+	}
+
+	info := fmt.Sprintf("time: %v\nsystem: %v/%v\n", time.Now().Format(time.RFC3339), runtime.GOOS, runtime.GOARCH)
+	installationDir, err := GetSteamInstallation(steamDir)
+	if err != nil {
+		info += "steam: " + err.Error() + "\n"
+	} else {
+		info += "steam: " + installationDir + "\n"
+		users, err := GetUsers(installationDir)
+		if err != nil {
+			info += "users: " + err.Error() + "\n"
+		}
+		for _, user := range users {
+			gridDir := filepath.Join(user.Dir, "config", "grid")
+			prefix := "users/" + user.SteamID32 + "/"
+			info += "user: " + user.SteamID32 + "\n"
+			if err := addFiles(gridDir, manifestFileName, prefix); err != nil {
+				return nil, err
+			}
+			paths, _ := filepath.Glob(filepath.Join(gridDir, "*.json"))
+			for _, path := range paths {
+				if filepath.Base(path) == manifestFileName {
+					continue
+				}
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				if err = add(prefix+"grid/"+filepath.Base(path), data); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := add("info.txt", []byte(info)); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+)
+
+// What happened with each source while looking for an artwork, in order, so
+// "why did this game get that picture" has an answer. Printed in verbose mode
+// and kept in the manifest.
+type sourceAttempt struct {
+	Source string `json:"source"`
+	// One of the source results below.
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Source results.
+const (
+	sourceFound    = "found"
+	sourceChosen   = "chosen"
+	sourceFallback = "fallback"
+	sourceRejected = "rejected"
+	sourceNothing  = "nothing"
+	sourceFailed   = "failed"
+	sourceSkipped  = "skipped"
+)
+
+type sourceChain []sourceAttempt
+
+// The methods do nothing on a nil chain.
+
+func (chain *sourceChain) add(source string, result string, reason string) {
+	if chain == nil {
+		return
+	}
+	*chain = append(*chain, sourceAttempt{source, result, reason})
+}
+
+// Marks the sources after index as not asked, because the search was over.
+func (chain *sourceChain) skipRest(sources []candidateSource, index int, reason string) {
+	for _, source := range sources[index+1:] {
+		chain.add(source.name, sourceSkipped, reason)
+	}
+}
+
+func (chain sourceChain) String() string {
+	var parts []string
+	for _, attempt := range chain {
+		part := attempt.Source + ": " + attempt.Result
+		if attempt.Reason != "" {
+			part += " (" + attempt.Reason + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A run in two steps. "steamgrid fetch" does the slow part, the downloads and
+// compositing, on a copy of the Steam directory in a staging directory, like
+// the sandbox option. "steamgrid commit" then only copies the changed files
+// into Steam, which takes a moment and can be looked at first with -dryrun:
+//
+//	steamgrid fetch --corners 12
+//	steamgrid commit -dryrun
+//	steamgrid commit
+//
+// Every fetch starts from a new copy of Steam, so the staged artwork is never
+// older than the images it replaces.
+
+// Staging directory next to the executable, like the overlays.
+func defaultStagingDir() string {
+	return filepath.Join(filepath.Dir(os.Args[0]), "staging")
+}
+
+func runFetchCommand(args []string) error {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	staging := flags.String("staging", defaultStagingDir(), "Directory to stage the artwork in")
+	flags.Parse(args)
+	if flags.NArg() == 1 {
+		opts.SteamDir = flags.Arg(0)
+	} else if flags.NArg() > 1 {
+		return errors.New("Usage: steamgrid fetch [-staging dir] [options] [steamdir]")
+	}
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	if opts.Sandbox != "" || opts.Commit {
+		return errors.New("The fetch command stages in its own sandbox, set with -staging")
+	}
+
+	// Staged artwork of an earlier fetch, committed or not, is replaced.
+	if _, err := loadSandboxRecord(*staging); err == nil {
+		err = os.RemoveAll(*staging)
+		if err != nil {
+			return err
+		}
+	}
+	opts.Sandbox = *staging
+
+	result, err := Run(interruptContext(), opts)
+	if result != nil {
+		printReport(result)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Staged the artwork in " + *staging + ", run \"steamgrid commit\" to apply it to Steam")
+	return nil
+}
+
+func runCommitCommand(args []string) error {
+	flags := flag.NewFlagSet("commit", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	staging := flags.String("staging", defaultStagingDir(), "Directory the artwork was staged in by \"steamgrid fetch\"")
+	dryRun := flags.Bool("dryrun", false, "Only list the files that would be written and removed")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return errors.New("Usage: steamgrid commit [-staging dir] [-dryrun]")
+	}
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	opts.Sandbox = *staging
+
+	return commitSandbox(interruptContext(), &opts, *dryRun)
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reads and writes of the Steam installation, the images, backups and
+// manifests of the grid directories and the files Steam keeps the library in,
+// go through steamFS. Normally that's the disk, or another machine with the
+// steam-ssh option. With the simulate option it's a layer in memory over it:
+// everything is read from the real installation, but written and removed only
+// in memory, and the summary lists what a real run would have changed. Files
+// of the program itself, like the overlays and the config file, are always
+// read from the disk.
+type steamFileSystem interface {
+	ReadFile(path string) ([]byte, error)
+	// Writes the whole file at once, so readers never see half of it.
+	WriteFile(path string, data []byte) error
+	ReadDir(path string) ([]os.FileInfo, error)
+	Stat(path string) (os.FileInfo, error)
+	Glob(pattern string) ([]string, error)
+	Remove(path string) error
+	Rename(from string, to string) error
+	MkdirAll(path string) error
+	Chmod(path string, mode os.FileMode) error
+	// Creates the file only if it doesn't exist yet. Otherwise the error is
+	// one os.IsExist is true for.
+	CreateExclusive(path string, data []byte) error
+	// Opens the file to add to its end, creating it if needed.
+	OpenAppend(path string) (appendFile, error)
+}
+
+type appendFile interface {
+	io.WriteCloser
+	Sync() error
+}
+
+var steamFS steamFileSystem = diskFS{}
+
+type diskFS struct{}
+
+func (diskFS) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func (diskFS) WriteFile(path string, data []byte) error {
+	return writeFileAtomic(path, data)
+}
+
+func (diskFS) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+func (diskFS) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (diskFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (diskFS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (diskFS) Rename(from string, to string) error {
+	return os.Rename(from, to)
+}
+
+func (diskFS) MkdirAll(path string) error {
+	return os.MkdirAll(path, 0777)
+}
+
+func (diskFS) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (diskFS) CreateExclusive(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (diskFS) OpenAppend(path string) (appendFile, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+}
+
+// Files in memory over another file system, which is never changed. Files
+// removed from the one below are hidden. Safe for concurrent use, the CPU
+// workers save images at the same time.
+type memoryFS struct {
+	mutex sync.Mutex
+	base  steamFileSystem
+	// By clean path. Directories have no data.
+	files   map[string]*memoryFile
+	removed map[string]bool
+}
+
+type memoryFile struct {
+	data    []byte
+	dir     bool
+	modTime time.Time
+}
+
+func newMemoryFS(base steamFileSystem) *memoryFS {
+	return &memoryFS{base: base, files: map[string]*memoryFile{}, removed: map[string]bool{}}
+}
+
+func notExist(op string, path string) error {
+	return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+}
+
+func (m *memoryFS) ReadFile(path string) ([]byte, error) {
+	path = filepath.Clean(path)
+	m.mutex.Lock()
+	file, ok := m.files[path]
+	removed := m.removed[path]
+	m.mutex.Unlock()
+	if ok {
+		if file.dir {
+			return nil, errors.New(path + " is a directory")
+		}
+		return append([]byte{}, file.data...), nil
+	}
+	if removed {
+		return nil, notExist("open", path)
+	}
+	return m.base.ReadFile(path)
+}
+
+func (m *memoryFS) WriteFile(path string, data []byte) error {
+	path = filepath.Clean(path)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.files[path] = &memoryFile{data: append([]byte{}, data...), modTime: time.Now()}
+	delete(m.removed, path)
+	return nil
+}
+
+func (m *memoryFS) Stat(path string) (os.FileInfo, error) {
+	path = filepath.Clean(path)
+	m.mutex.Lock()
+	file, ok := m.files[path]
+	removed := m.removed[path]
+	implicitDir := m.hasChildren(path)
+	m.mutex.Unlock()
+	if ok {
+		return memoryFileInfo{filepath.Base(path), file}, nil
+	}
+	if implicitDir {
+		return memoryFileInfo{filepath.Base(path), &memoryFile{dir: true}}, nil
+	}
+	if removed {
+		return nil, notExist("stat", path)
+	}
+	return m.base.Stat(path)
+}
+
+// Whether files in memory are below the directory. Called with the mutex
+// held.
+func (m *memoryFS) hasChildren(dir string) bool {
+	prefix := dir + string(filepath.Separator)
+	for path := range m.files {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryFS) ReadDir(path string) ([]os.FileInfo, error) {
+	path = filepath.Clean(path)
+	entries := map[string]os.FileInfo{}
+	baseFiles, err := m.base.ReadDir(path)
+	for _, info := range baseFiles {
+		entries[info.Name()] = info
+	}
+
+	m.mutex.Lock()
+	found := err == nil
+	prefix := path + string(filepath.Separator)
+	for name := range m.removed {
+		if filepath.Dir(name) == path {
+			delete(entries, filepath.Base(name))
+		}
+	}
+	for name, file := range m.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		found = true
+		rest := strings.TrimPrefix(name, prefix)
+		if i := strings.IndexRune(rest, filepath.Separator); i >= 0 {
+			// Below a directory that may only be in memory.
+			if _, ok := entries[rest[:i]]; !ok {
+				entries[rest[:i]] = memoryFileInfo{rest[:i], &memoryFile{dir: true}}
+			}
+			continue
+		}
+		entries[rest] = memoryFileInfo{rest, file}
+	}
+	if file, ok := m.files[path]; ok && file.dir {
+		found = true
+	}
+	m.mutex.Unlock()
+	if !found {
+		return nil, err
+	}
+
+	var infos []os.FileInfo
+	for _, info := range entries {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (m *memoryFS) Glob(pattern string) ([]string, error) {
+	matches, err := m.base.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	m.mutex.Lock()
+	for _, match := range matches {
+		if !m.removed[filepath.Clean(match)] {
+			found[match] = true
+		}
+	}
+	for path := range m.files {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			found[path] = true
+		}
+	}
+	m.mutex.Unlock()
+
+	var paths []string
+	for path := range found {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (m *memoryFS) Remove(path string) error {
+	path = filepath.Clean(path)
+	_, baseErr := m.base.Stat(path)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, inMemory := m.files[path]
+	if !inMemory && (baseErr != nil || m.removed[path]) {
+		return notExist("remove", path)
+	}
+	delete(m.files, path)
+	if baseErr == nil {
+		m.removed[path] = true
+	}
+	return nil
+}
+
+func (m *memoryFS) Rename(from string, to string) error {
+	data, err := m.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	err = m.WriteFile(to, data)
+	if err != nil {
+		return err
+	}
+	return m.Remove(from)
+}
+
+func (m *memoryFS) MkdirAll(path string) error {
+	path = filepath.Clean(path)
+	if info, err := m.Stat(path); err == nil {
+		if !info.IsDir() {
+			return errors.New(path + " is not a directory")
+		}
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.files[path] = &memoryFile{dir: true, modTime: time.Now()}
+	delete(m.removed, path)
+	return nil
+}
+
+func (m *memoryFS) Chmod(path string, mode os.FileMode) error {
+	_, err := m.Stat(path)
+	return err
+}
+
+func (m *memoryFS) CreateExclusive(path string, data []byte) error {
+	if _, err := m.Stat(path); err == nil {
+		return &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+	}
+	return m.WriteFile(path, data)
+}
+
+func (m *memoryFS) OpenAppend(path string) (appendFile, error) {
+	data, err := m.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	err = m.WriteFile(path, data)
+	return memoryAppender{m, filepath.Clean(path)}, err
+}
+
+type memoryAppender struct {
+	m    *memoryFS
+	path string
+}
+
+func (a memoryAppender) Write(data []byte) (int, error) {
+	a.m.mutex.Lock()
+	defer a.m.mutex.Unlock()
+	file, ok := a.m.files[a.path]
+	if !ok {
+		// Removed while open.
+		file = &memoryFile{}
+		a.m.files[a.path] = file
+	}
+	file.data = append(file.data, data...)
+	file.modTime = time.Now()
+	return len(data), nil
+}
+
+func (memoryAppender) Sync() error  { return nil }
+func (memoryAppender) Close() error { return nil }
+
+// Paths of the files written and removed, sorted.
+func (m *memoryFS) changes() (written []string, removed []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for path, file := range m.files {
+		if !file.dir {
+			written = append(written, path)
+		}
+	}
+	for path := range m.removed {
+		removed = append(removed, path)
+	}
+	sort.Strings(written)
+	sort.Strings(removed)
+	return written, removed
+}
+
+type memoryFileInfo struct {
+	name string
+	file *memoryFile
+}
+
+func (info memoryFileInfo) Name() string       { return info.name }
+func (info memoryFileInfo) Size() int64        { return int64(len(info.file.data)) }
+func (info memoryFileInfo) ModTime() time.Time { return info.file.modTime }
+func (info memoryFileInfo) IsDir() bool        { return info.file.dir }
+func (info memoryFileInfo) Sys() interface{}   { return nil }
+
+func (info memoryFileInfo) Mode() os.FileMode {
+	if info.file.dir {
+		return os.ModeDir | 0777
+	}
+	return 0666
+}
+
+// Makes the Steam file system a layer in memory for a simulated run. Without
+// a Steam installation to simulate on, a synthetic one is used.
+func startSimulation(opts *Options) *memoryFS {
+	base := steamFS
+	if _, err := GetSteamInstallation(opts.SteamDir); err != nil && opts.SteamDir == "" {
+		fmt.Println("No Steam installation found, simulating on a synthetic one")
+		base = newFakeSteam()
+		opts.SteamDir = fakeSteamDir
+	}
+	simulation := newMemoryFS(base)
+	steamFS = simulation
+	return simulation
+}
+
+// Goes back to the previous file system and prints what the simulated run
+// would have changed.
+func stopSimulation(m *memoryFS, previous steamFileSystem) {
+	steamFS = previous
+	written, removed := m.changes()
+	fmt.Printf("Simulated run, nothing was changed. A real run would write %v files and remove %v:\n", len(written), len(removed))
+	for _, path := range written {
+		fmt.Printf("  write   %v (%v bytes)\n", path, len(m.files[path].data))
+	}
+	for _, path := range removed {
+		fmt.Println("  remove  " + path)
+	}
+}
+
+// Where the synthetic Steam installation is, only in memory.
+var fakeSteamDir = filepath.Join(os.TempDir(), "steamgrid-simulated-steam")
+
+// Files of a small Steam installation with a user that has three games in
+// categories, one of them a favorite. The user has ID 0, which has no public
+// profile, so the games come from these files only.
+var fakeSteamFiles = map[string]string{
+	"userdata/0/config/localconfig.vdf": `"UserLocalConfigStore"
+{
+	"friends"
+	{
+		"PersonaName"		"Simulated user"
+	}
+	"Software"
+	{
+		"Valve"
+		{
+			"Steam"
+			{
+				"apps"
+				{
+					"220"
+					{
+						"LastPlayed"		"1577836800"
+					}
+				}
+			}
+		}
+	}
+}
+`,
+	"userdata/0/7/remote/sharedconfig.vdf": `"UserRoamingConfigStore"
+{
+	"Software"
+	{
+		"Valve"
+		{
+			"Steam"
+			{
+				"apps"
+				{
+					"220"
+					{
+						"tags"
+						{
+							"0"		"favorite"
+						}
+					}
+					"620"
+					{
+						"tags"
+						{
+							"0"		"Puzzle"
+						}
+					}
+					"440"
+					{
+						"tags"
+						{
+							"0"		"Multiplayer"
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`,
+	"steamapps/appmanifest_220.acf": "\"AppState\"\n{\n\t\"appid\"\t\t\"220\"\n\t\"name\"\t\t\"Half-Life 2\"\n}\n",
+	"steamapps/appmanifest_440.acf": "\"AppState\"\n{\n\t\"appid\"\t\t\"440\"\n\t\"name\"\t\t\"Team Fortress 2\"\n}\n",
+	"steamapps/appmanifest_620.acf": "\"AppState\"\n{\n\t\"appid\"\t\t\"620\"\n\t\"name\"\t\t\"Portal 2\"\n}\n",
+}
+
+// A synthetic Steam installation over the disk, for simulated runs without
+// Steam installed. The simulation is another layer over it, so only the
+// changes of the run are listed.
+func newFakeSteam() *memoryFS {
+	m := newMemoryFS(diskFS{})
+	for name, contents := range fakeSteamFiles {
+		m.WriteFile(filepath.Join(fakeSteamDir, filepath.FromSlash(name)), []byte(contents))
+	}
+	return m
+}
@@ -4,30 +4,172 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"image"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 // Prints an error and quits.
 func errorAndExit(err error) {
 	fmt.Println(err.Error())
+	if !interactive() {
+		// Scripts and containers need the exit code.
+		os.Exit(1)
+	}
 	bufio.NewReader(os.Stdin).ReadBytes('\n')
 	os.Exit(0)
 }
 
+// Tells if someone is at the console to press enter. Started from a script,
+// a service or a container there's no terminal, and waiting would block
+// forever or read the piped input.
+func interactive() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
 func main() {
 	http.DefaultTransport.(*http.Transport).ResponseHeaderTimeout = time.Second * 10
 	startApplication()
 }
 
+// Subcommands, like "steamgrid alt 620 --next". Without one a full run starts.
+var commands = map[string]func(args []string) error{
+	"alt":             runAltCommand,
+	"apply":           runApplyCommand,
+	"watch":           runWatchCommand,
+	"serve":           runServeCommand,
+	"gui":             runGUICommand,
+	"tray":            runTrayCommand,
+	"setup":           runSetupCommand,
+	"service":         runServiceCommand,
+	"login":           runLoginCommand,
+	"overlays":        runOverlaysCommand,
+	"snapshot":        runSnapshotCommand,
+	"audit":           runAuditCommand,
+	"approve":         runApproveCommand,
+	"prune":           runPruneCommand,
+	"update":          runUpdateCommand,
+	"fetch":           runFetchCommand,
+	"commit":          runCommitCommand,
+	"run":             runRunCommand,
+	"integrate-shell": runIntegrateShellCommand,
+	"uri":             runURICommand,
+}
+
 func startApplication() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			err := command(os.Args[2:])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	var opts Options
+	opts.RegisterFlags(flag.CommandLine)
+	configPath := registerConfigFlag(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() == 1 {
+		opts.SteamDir = flag.Args()[0]
+	} else if flag.NArg() >= 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := applyConfigFile(&opts, flag.CommandLine, *configPath)
+	if err != nil {
+		errorAndExit(err)
+	}
+	if _, err := os.Stat(*configPath); err != nil && flag.NFlag() == 0 && opts.Config == nil {
+		fmt.Println("Tip: run \"steamgrid setup\" to pick your options and API keys once.")
+	}
+
+	ctx := interruptContext()
+	result, err := Run(ctx, opts)
+	if result != nil {
+		printReport(result)
+	}
+	if err != nil {
+		errorAndExit(err)
+	}
+
+	if !interactive() {
+		fmt.Println("Open Steam in grid view to see the results!")
+		return
+	}
+	fmt.Println("Open Steam in grid view to see the results!\n\nPress enter to close.")
+
+	bufio.NewReader(os.Stdin).ReadBytes('\n')
+}
+
+// Registers the -config flag, with the file next to the executable as default.
+func registerConfigFlag(flags *flag.FlagSet) *string {
+	configPath := os.Getenv(envPrefix + "CONFIG")
+	if configPath == "" {
+		configPath = filepath.Join(filepath.Dir(os.Args[0]), defaultConfigName)
+	}
+	return flags.String("config", configPath, "Config file with options and per-user profiles, used if it exists. Options can also be set with STEAMGRID_* environment variables")
+}
+
+// Loads the options from the keyring, the config file, if it exists, and the
+// STEAMGRID_* environment variables, with the flags set on the command line
+// over them.
+func applyConfigFile(opts *Options, flags *flag.FlagSet, configPath string) error {
+	config := &Config{Path: configPath}
+	_, err := os.Stat(configPath)
+	exists := err == nil
+	if exists {
+		config, err = LoadConfig(configPath)
+		if err != nil {
+			return err
+		}
+	}
+	config.LoadEnvironment(os.Environ())
+	config.Overrides = CommandLineSettings(flags)
+	if opts.SteamDir != "" {
+		config.Overrides = append(config.Overrides, ConfigSetting{"steamdir", opts.SteamDir, 0})
+	}
+	if config.LoadKeyring() == 0 && len(config.Environment) == 0 && !exists && opts.Theme == "" {
+		return nil
+	}
+	err = config.Check()
+	if err != nil {
+		return err
+	}
+	*opts, err = config.Options(nil)
+	return err
+}
+
+// Returns a context that is canceled on Ctrl+C, to stop the run cleanly.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	// SIGTERM is how services and containers are stopped.
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		fmt.Println("Interrupted, stopping...")
+		cancel()
+	}()
+	return ctx
+}
+
+// Art styles to process, depending on the options.
+func getArtStyles(opts *Options) map[string][]string {
 	artStyles := map[string][]string{
 		// BannerLQ: 460 x 215
 		// BannerHQ: 920 x 430
@@ -43,232 +185,895 @@ func startApplication() {
 		"Hero": []string{"_hero", ".hero", "library_hero.jpg" , "3840", "1240", "1920", "620"},
 		"Logo": []string{"_logo", ".logo", "logo.png", "1280", "720", "640", "360"},
 	}
+	applySizeProfile(artStyles, opts)
 
-	steamGridDBApiKey := flag.String("steamgriddb", "", "Your personal SteamGridDB api key, get one here: https://www.steamgriddb.com/profile/preferences")
-	IGDBApiKey := flag.String("igdb", "", "Your personal IGDB api key, get one here: https://api.igdb.com/signup")
-	steamDir := flag.String("steamdir", "", "Path to your steam installation")
-	// "alternate" "blurred" "white_logo" "material" "no_logo"
-	steamGridStyles := flag.String("styles", "alternate", "Comma seperated list of styles to download from SteamGridDB.\nExample: \"white_logo,material\"")
-	// "static" "animated"
-	steamGridTypes := flag.String("types", "static", "Comma seperated list of types to download from SteamGridDB.\nExample: \"static,animated\"")
-	skipSteam := flag.Bool("skipsteam", false, "Skip downloads from Steam servers")
-	skipGoogle := flag.Bool("skipgoogle", false, "Skip search and downloads from google")
-	skipBanner := flag.Bool("skipbanner", false, "Skip search and processing banner artwork")
-	skipCover := flag.Bool("skipcover", false, "Skip search and processing cover artwork")
-	skipHero := flag.Bool("skiphero", false, "Skip search and processing hero artwork")
-	skipLogo := flag.Bool("skiplogo", false, "Skip search and processing logo artwork")
-	nonSteamOnly := flag.Bool("nonsteamonly", false, "Only search artwork for Non-Steam-Games")
-	flag.Parse()
-	if flag.NArg() == 1 {
-		steamDir = &flag.Args()[0]
-	} else if flag.NArg() >= 2 {
-		flag.Usage()
-		os.Exit(1)
-	}
-
-	// Process command line flags
-	steamGridFilter := "?styles=" + *steamGridStyles + "&types=" + *steamGridTypes
-	if *skipBanner {
+	if opts.SkipBanner {
 		delete(artStyles, "Banner")
 	}
-	if *skipCover {
+	if opts.SkipCover {
 		delete(artStyles, "Cover")
 	}
-	if *skipHero {
+	if opts.SkipHero {
 		delete(artStyles, "Hero")
 	}
-	if *skipLogo {
+	if opts.SkipLogo {
 		delete(artStyles, "Logo")
 	}
-	if len(artStyles) == 0 {
-		errorAndExit(errors.New("No artStyes, nothing to do…"))
+	// Only the artwork types given in the types option, if any.
+	artTypes, _, _ := opts.splitTypes()
+	if len(artTypes) > 0 {
+		for artStyle := range artStyles {
+			if !artTypes[artStyle] {
+				delete(artStyles, artStyle)
+			}
+		}
+	}
+	return artStyles
+}
+
+// Result of a run. Games are grouped by art style.
+type Result struct {
+	Downloaded      int
+	OverlaysApplied int
+	// Images that may not be accurate, by where they were found.
+	SteamGridDB map[string][]*Game
+	IGDB        map[string][]*Game
+	Searched    map[string][]*Game
+	NotFound    map[string][]*Game
+	// Images that could not be overlaid, with the error of each.
+	Failed       map[string][]*Game
+	FailedErrors map[string][]string
+	// Entries skipped because of an invalid ID.
+	Invalid []*Game
+	// Soundtracks and videos skipped by the media option.
+	Media []*Game
+	// Games that took longer than the game timeout.
+	TimedOut []*Game
+	// Games left for the next run when the budget was used up.
+	Postponed []*Game
+	// Low-confidence images waiting for approval, by art style.
+	Quarantined map[string][]*Game
+	// Downloads, sources and time per stage.
+	Metrics *Metrics
+	// SteamGridDB requests left at the end, if the server tells.
+	SteamGridDBQuota string
+	// Changes compared to the previous run.
+	Changes []ManifestChange
+
+	// Budget of the run, nil for none.
+	budget *runBudget
+
+	// State of the artworks by grid directory, for the manifest.
+	artworks map[string]map[string]manifestEntry
+	// Artworks for the HTML report, by grid directory and file name.
+	report map[string]*reportEntry
+
+	// Artworks are saved by several workers.
+	mutex sync.Mutex
+}
+
+func newResult() *Result {
+	newGroups := func() map[string][]*Game {
+		return map[string][]*Game{
+			"Banner": []*Game{},
+			"Cover": []*Game{},
+			"Hero": []*Game{},
+			"Logo": []*Game{},
+		}
+	}
+	return &Result{
+		SteamGridDB: newGroups(),
+		IGDB: newGroups(),
+		Searched: newGroups(),
+		NotFound: newGroups(),
+		Failed: newGroups(),
+		Quarantined: newGroups(),
+		FailedErrors: map[string][]string{},
+		Metrics: newMetrics(),
+	}
+}
+
+// Run downloads and overlays the images of all users in the Steam
+// installation. Stops early if the context is canceled, returning the result
+// so far along with the context error.
+//
+// Run is not reentrant: settings like the frames, fonts, download workers,
+// cookies and the Steam file system are package variables, set up for the
+// options of the run. Runs of one process are serialized, a second one waits
+// for the first to finish.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+	artStyles, exports, err := prepareOptions(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.globalsApplied {
+		err = applyGlobalOptions(&opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = validateSandbox(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Commit {
+		return nil, commitSandbox(ctx, &opts, false)
+	}
+	var completion *completionList
+	if opts.Completion != "" {
+		completion, err = loadCompletion(opts.Completion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := newResult()
+	result.Metrics.Profile = opts.PerfProfile
+	result.budget, err = parseBudget(opts.Budget)
+	if err != nil {
+		return nil, err
 	}
+	opts.metrics = result.Metrics
+	countDownloads(result.Metrics)
+	defer countDownloads(nil)
 
+	start := time.Now()
 	fmt.Println("Loading overlays...")
-	overlays, err := LoadOverlays(filepath.Join(filepath.Dir(os.Args[0]), "overlays by category"), artStyles)
+	overlays, err := loadOverlays(&opts, artStyles)
 	if err != nil {
-		errorAndExit(err)
+		return nil, err
 	}
-	if len(overlays) == 0 {
-		fmt.Println("No category overlays found. You can put overlay images in the folder 'overlays by category', where the filename is the game category.\n\nYou can find many user-created overlays at https://www.reddit.com/r/steamgrid/wiki/overlays .\n\nContinuing without overlays...\n")
+	if len(overlays) == 0 && frameSettings.enabled {
+		fmt.Println("No category overlays found, drawing frames for the categories instead.")
+		fmt.Println()
+	} else if len(overlays) == 0 {
+		fmt.Println("No category overlays found. You can put overlay images in the folder 'overlays by category', where the filename is the game category.\n\nYou can find many user-created overlays at https://www.reddit.com/r/steamgrid/wiki/overlays .\n\nContinuing without overlays...")
+		fmt.Println()
 	} else {
 		fmt.Printf("Loaded %v overlays. \n\nYou can find many user-created overlays at https://www.reddit.com/r/steamgrid/wiki/overlays .\n\n", len(overlays))
 	}
 
 	fmt.Println("Looking for Steam directory...\nIf SteamGrid doesn´t find the directory automatically, launch it with an argument linking to the Steam directory.")
-	installationDir, err := GetSteamInstallation(*steamDir)
+	if opts.SteamSSH != "" {
+		remote, err := connectSteamSSH(opts.SteamSSH)
+		if err != nil {
+			return nil, err
+		}
+		defer remote.close()
+		opts.SteamDir = remote.steamDir()
+	}
+	if opts.Simulate {
+		previous := steamFS
+		simulation := startSimulation(&opts)
+		defer stopSimulation(simulation, previous)
+	}
+	if opts.Sandbox != "" {
+		err = prepareSandbox(&opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	installationDir, err := GetSteamInstallation(opts.SteamDir)
 	if err != nil {
-		errorAndExit(err)
+		return nil, err
+	}
+	// Simulated runs change nothing, so they don't get in the way of others.
+	if !opts.Simulate && opts.lock != nil {
+		release, err := opts.lock.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	} else if !opts.Simulate {
+		lock, err := acquireLock(ctx, installationDir, opts.LockWait)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.release()
 	}
 
 	fmt.Println("Loading users...")
 	users, err := GetUsers(installationDir)
 	if err != nil {
-		errorAndExit(err)
+		return nil, err
 	}
 	if len(users) == 0 {
-		errorAndExit(errors.New("No users found at Steam/userdata. Have you used Steam before in this computer?"))
-	}
-
-	nOverlaysApplied := 0
-	nDownloaded := 0
-	notFounds := map[string][]*Game{
-		"Banner": []*Game{},
-		"Cover": []*Game{},
-		"Hero": []*Game{},
-		"Logo": []*Game{},
-	}
-	steamGridDB := map[string][]*Game{
-		"Banner": []*Game{},
-		"Cover": []*Game{},
-		"Hero": []*Game{},
-		"Logo": []*Game{},
-	}
-	IGDB := map[string][]*Game{
-		"Banner": []*Game{},
-		"Cover": []*Game{},
-		"Hero": []*Game{},
-		"Logo": []*Game{},
-	}
-	searchedGames := map[string][]*Game{
-		"Banner": []*Game{},
-		"Cover": []*Game{},
-		"Hero": []*Game{},
-		"Logo": []*Game{},
-	}
-	failedGames := map[string][]*Game{
-		"Banner": []*Game{},
-		"Cover": []*Game{},
-		"Hero": []*Game{},
-		"Logo": []*Game{},
-	}
-	var errorMessages []string
+		return nil, errors.New("No users found at Steam/userdata. Have you used Steam before in this computer?")
+	}
+
+	result.Metrics.addStage("loading", start)
+	opts.severalUsers = len(users) > 1
 
 	for _, user := range users {
 		fmt.Println("Loading games for " + user.Name)
 		gridDir := filepath.Join(user.Dir, "config", "grid")
 
-		err = os.MkdirAll(filepath.Join(gridDir, "originals"), 0777)
+		err = steamFS.MkdirAll(filepath.Join(gridDir, "originals"))
 		if err != nil {
-			errorAndExit(err)
+			return result, err
 		}
 
-		games := GetGames(user, *nonSteamOnly)
-
-		fmt.Println("Loading existing images and backups...")
+		// Users with their own options in the config file.
+		userOpts, userArtStyles, userOverlays, userExports := &opts, artStyles, overlays, exports
+		ownGlobals := false
+		if opts.Config != nil && opts.Config.HasUser(user) {
+			options, err := opts.Config.Options(&user)
+			if err != nil {
+				return result, err
+			}
+			options.Hooks = opts.Hooks
+			options.GameIDs = opts.GameIDs
+			options.ShortcutTarget = opts.ShortcutTarget
+			options.Incremental = opts.Incremental
+			options.Simulate = opts.Simulate
+			options.metrics = opts.metrics
+			options.severalUsers = opts.severalUsers
+			userArtStyles, userExports, err = prepareOptions(&options)
+			if err != nil {
+				return result, err
+			}
+			// Settings kept by the package, like frames and fonts, are set
+			// for the user and back after it. A server keeps its own, its
+			// requests use them meanwhile.
+			if options.globalSettings() != opts.globalSettings() && opts.globalsApplied {
+				fmt.Println("Using the frames, fonts, badge strip, compositor and network settings of the server for " + user.Name + ", not the ones of the config file")
+			} else if options.globalSettings() != opts.globalSettings() {
+				err = applyGlobalOptions(&options)
+				if err != nil {
+					return result, err
+				}
+				ownGlobals = true
+			}
+			userOverlays, err = loadOverlays(&options, userArtStyles)
+			if err != nil {
+				return result, err
+			}
+			userOpts = &options
+		}
 
-		i := 0
-		for _, game := range games {
-			i++
+		if userOpts.LibraryCache && userOpts.severalUsers {
+			fmt.Println("Not writing the library cache for " + user.Name + ", it's shared by all users of this installation")
+		}
 
-			var name string
-			if game.Name == "" {
-				game.Name = GetGameName(game.ID)
+		start := time.Now()
+		games := GetGames(withStage(ctx, "loading games"), user, installationDir, userOpts.NonSteamOnly)
+		result.Metrics.addStage("loading games", start)
+		relinkShortcuts(gridDir, games, userOpts.BackupName)
+		if userOpts.Device != "" {
+			markRemovableStorage(installationDir, games)
+		}
+		if len(userOpts.GameIDs) > 0 {
+			filterGames(games, userOpts.GameIDs)
+		}
+		if userOpts.ShortcutTarget != "" {
+			filterShortcuts(games, userOpts.ShortcutTarget)
+			if len(games) == 0 {
+				fmt.Println("No non-Steam game of " + user.Name + " is started with " + userOpts.ShortcutTarget)
+			}
+		}
+		if completion != nil {
+			addCompletionTags(completion, games)
+		}
+		hashLibrary(games)
+		if userOpts.Incremental {
+			err = forgetRemovedGames(gridDir, games, userOpts)
+			if err != nil {
+				return result, err
 			}
+		}
 
-			if game.Name != "" {
-				name = game.Name
-			} else {
-				name = "unknown game with id " + game.ID
+		if userOpts.FamilyView || userOpts.FamilyViewTypes != "" {
+			view, err := getFamilyView(user)
+			if err != nil {
+				fmt.Println(err.Error())
 			}
-			fmt.Printf("Processing %v (%v/%v)\n", name, i, len(games))
-
-			for artStyle, artStyleExtensions := range artStyles {
-				// Clear for multiple runs:
-				game.ImageSource = ""
-				game.ImageExt = ""
-				game.CleanImageBytes = nil
-				game.OverlayImageBytes = nil
-
-				overridePath := filepath.Join(filepath.Dir(os.Args[0]), "games")
-				LoadExisting(overridePath, gridDir, game, artStyleExtensions)
-				// This cleans up unused backups and images for the same game but with different extensions.
-				err = RemoveExisting(gridDir, game.ID, artStyleExtensions)
+			if view != nil {
+				fmt.Println("Family View is enabled for " + user.Name + ", restricting games and artwork")
+				userOpts, userArtStyles, err = applyFamilyView(userOpts, view, userArtStyles, games)
 				if err != nil {
-					fmt.Println(err.Error())
+					return result, err
 				}
+			}
+		}
+		if userOpts.Incremental {
+			filterUnchangedGames(gridDir, games, userArtStyles)
+		}
+		if userOpts.SaleBadge {
+			userOpts.sale = loadSaleInfo(withStage(ctx, "store details"), user)
+		}
 
-				///////////////////////
-				// Download if missing.
-				///////////////////////
-				if game.ImageSource == "" {
-					from, err := DownloadImage(gridDir, game, artStyle, artStyleExtensions, *skipSteam, *steamGridDBApiKey, steamGridFilter, *IGDBApiKey, *skipGoogle)
-					if err != nil && err.Error() == "SteamGridDB authorization token is missing or invalid" {
-						// Wrong api key
-						*steamGridDBApiKey = ""
-						fmt.Println(err.Error())
-					} else if err != nil {
-						fmt.Println(err.Error())
-					}
-
-					if game.ImageSource == "" {
-						notFounds[artStyle] = append(notFounds[artStyle], game)
-						fmt.Printf("%v not found\n", artStyle)
-						// Game has no image, skip it.
-						continue
-					} else if err == nil {
-						nDownloaded++
-					}
-
-					switch from {
-					case "IGDB":
-						IGDB[artStyle] = append(IGDB[artStyle], game)
-					case "SteamGridDB":
-						steamGridDB[artStyle] = append(steamGridDB[artStyle], game)
-					case "search":
-						searchedGames[artStyle] = append(searchedGames[artStyle], game)
-					}
-				}
-				fmt.Printf("%v found from %v\n", artStyle, game.ImageSource)
-
-				///////////////////////
-				// Apply overlay.
-				//
-				// Expecting name.artExt.imgExt:
-				// Banner: favorites.png
-				// Cover: favorites.p.png
-				// Hero: favorites.hero.png
-				// Logo: favorites.logo.png
-				///////////////////////
-				err := ApplyOverlay(game, overlays, artStyleExtensions)
-				if err != nil {
-					print(err.Error(), "\n")
-					failedGames[artStyle] = append(failedGames[artStyle], game)
-					errorMessages = append(errorMessages, err.Error())
-				}
-				if game.OverlayImageBytes != nil {
-					nOverlaysApplied++
-				} else {
-					game.OverlayImageBytes = game.CleanImageBytes
-				}
+		fmt.Println("Loading existing images and backups...")
+		err = processGames(ctx, userOpts, gridDir, games, userArtStyles, userOverlays, userExports, result)
+		if err != nil {
+			return result, err
+		}
+		if ownGlobals {
+			err = applyGlobalOptions(&opts)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
 
-				///////////////////////
-				// Save result.
-				///////////////////////
-				err = BackupGame(gridDir, game, artStyleExtensions)
-				if err != nil {
-					errorAndExit(err)
-				}
+	if opts.MissingList != "" || opts.OpenMissing {
+		missing := collectMissing(result)
+		if opts.MissingList != "" {
+			err = writeMissingList(opts.MissingList, missing)
+			if err != nil {
+				return result, err
+			}
+			fmt.Printf("List of %v games with missing artwork written to %v\n", len(missing), opts.MissingList)
+		}
+		if opts.OpenMissing {
+			openMissing(missing)
+		}
+	}
+	if opts.HTMLReport != "" {
+		err = writeHTMLReport(opts.HTMLReport, result)
+		if err != nil {
+			return result, err
+		}
+		fmt.Println("HTML report written to " + opts.HTMLReport)
+	}
+	return result, nil
+}
 
-				imagePath := filepath.Join(gridDir, game.ID + artStyleExtensions[0] + game.ImageExt)
-				err = ioutil.WriteFile(imagePath, game.OverlayImageBytes, 0666)
+// Held by Run, see there.
+var runMutex sync.Mutex
 
-				// Copy with legacy naming for Big Picture mode
-				if artStyle == "Banner" {
-					id, err := strconv.ParseUint(game.ID, 10, 64)
-					if err == nil {
-						imagePath := filepath.Join(gridDir, strconv.FormatUint(id<<32|0x02000000, 10) + artStyleExtensions[0] + game.ImageExt)
-						err = ioutil.WriteFile(imagePath, game.OverlayImageBytes, 0666)
-					}
-				}
-				if err != nil {
-					fmt.Printf("Failed to write image for %v (%v) because: %v\n", game.Name, artStyle, err.Error())
-				}
+// Sets up the package for the options that are the same for all users, like
+// how files are written and the network settings. The settings are package
+// variables read by every download and overlay, so this must not run while
+// others are in progress: servers call it once at their start, and the runs
+// they start keep those settings.
+func applyGlobalOptions(opts *Options) error {
+	var err error
+	if opts.TmpDir != "" {
+		err = os.MkdirAll(opts.TmpDir, 0777)
+		if err != nil {
+			return err
+		}
+	}
+	fileOptions.tmpDir = opts.TmpDir
+	fileOptions.fsync = opts.Fsync
+	pngEncoder.CompressionLevel, err = getPNGCompression(opts)
+	if err != nil {
+		return err
+	}
+	err = validateCompositor(opts)
+	if err != nil {
+		return err
+	}
+	compositorBackend = opts.Compositor
+	err = validateBadgeStrip(opts)
+	if err != nil {
+		return err
+	}
+	badgeStrip.direction = strings.ToLower(opts.BadgeStrip)
+	badgeStrip.spacing = opts.BadgeSpacing
+	autoContrast = opts.AutoContrast
+	frameSettings.all, frameSettings.colors, err = parseFrames(opts.Frames)
+	if err != nil {
+		return err
+	}
+	frameSettings.enabled = opts.Frames != ""
+	err = loadTextFonts(opts)
+	if err != nil {
+		return err
+	}
+	politeMode = opts.Polite
+	err = validateWorkers(opts)
+	if err != nil {
+		return err
+	}
+	tuneDownloads(opts)
+	if opts.Cookies != "" {
+		http.DefaultClient.Jar, err = loadCookieFile(opts.Cookies)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The options applyGlobalOptions sets up the package for.
+type globalSettings struct {
+	tmpDir, pngCompression, compositor, badgeStrip string
+	fsync, autoContrast, polite, autotune          bool
+	badgeSpacing, downloadWorkers, cpuWorkers      int
+	frames, font, emojiFont, cookies               string
+}
+
+func (opts *Options) globalSettings() globalSettings {
+	return globalSettings{
+		opts.TmpDir, opts.PNGCompression, opts.Compositor, opts.BadgeStrip,
+		opts.Fsync, opts.AutoContrast, opts.Polite, opts.Autotune,
+		opts.BadgeSpacing, opts.DownloadWorkers, opts.CPUWorkers,
+		opts.Frames, opts.Font, opts.EmojiFont, opts.Cookies,
+	}
+}
+
+// Checks the options that can be different for every user, and returns the
+// art styles and exports to process.
+func prepareOptions(opts *Options) (map[string][]string, []export, error) {
+	if err := applyDeviceProfile(opts); err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := opts.splitTypes(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := sortGames(nil, opts.Order); err != nil {
+		return nil, nil, err
+	}
+	if err := validateSteamGridStyles(opts); err != nil {
+		return nil, nil, err
+	}
+	artStyles := getArtStyles(opts)
+	if len(artStyles) == 0 {
+		return nil, nil, errors.New("No artStyes, nothing to do…")
+	}
+	err := validateNameTemplates(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	exports, err := getExports(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := getURLSources(opts); err != nil {
+		return nil, nil, err
+	}
+	if _, err := getAliases(opts); err != nil {
+		return nil, nil, err
+	}
+	if _, err := familyViewArtStyles(opts, artStyles); err != nil {
+		return nil, nil, err
+	}
+	if err := validateMedia(opts); err != nil {
+		return nil, nil, err
+	}
+	if err := validateCardStyle(opts); err != nil {
+		return nil, nil, err
+	}
+	if err := validateAnimated(opts); err != nil {
+		return nil, nil, err
+	}
+	if err := validateSizeProfile(opts); err != nil {
+		return nil, nil, err
+	}
+	if _, err := getColorFilters(opts); err != nil {
+		return nil, nil, err
+	}
+	err = validateLogoPosition(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.fitModes, err = getFitModes(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return artStyles, exports, nil
+}
+
+// Loads the overlays for the art styles, with the built-in badges enabled in
+// the options.
+func loadOverlays(opts *Options, artStyles map[string][]string) (map[string]image.Image, error) {
+	clearPreparedOverlays()
+	overlays, err := LoadOverlays(themeOverlaysDir(opts), artStyles)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PlatformBadges {
+		addPlatformBadges(overlays, artStyles)
+	}
+	if opts.VRBadge {
+		addBadge(overlays, artStyles, "VR", "VR")
+	}
+	if opts.ReleaseState {
+		addBadge(overlays, artStyles, earlyAccessTag, earlyAccessTag)
+		addBadge(overlays, artStyles, comingSoonTag, comingSoonTag)
+	}
+	if opts.SaleBadge {
+		addBadge(overlays, artStyles, saleTag, "SALE")
+		addBadge(overlays, artStyles, dlcSaleTag, "DLC SALE")
+	}
+	return overlays, nil
+}
+
+// Downloads, overlays and saves the images of the given games into gridDir.
+func processGames(ctx context.Context, opts *Options, gridDir string, games map[string]*Game, artStyles map[string][]string, overlays map[string]image.Image, exports []export, result *Result) error {
+	order := opts.Order
+	if result.budget != nil {
+		order = "recent"
+	}
+	sorted, err := sortGames(games, order)
+	if err != nil {
+		return err
+	}
+	var journal *journal
+	if !opts.Simulate {
+		journal, err = openJournal(gridDir)
+		if err != nil {
+			return err
+		}
+	}
+	if journal != nil && journal.resumed {
+		fmt.Println("Resuming the previous run...")
+	}
+	pool := newCPUPool(opts.CPUWorkers, opts.Autotune)
+	language := getLanguage(opts)
+	locks := loadGameLocks(gridDir)
+	stop := func(err error) error {
+		pool.close()
+		journal.close(false)
+		return err
+	}
+
+	i := 0
+	started, postponed := 0, false
+	for _, game := range sorted {
+		i++
+		if ctx.Err() != nil {
+			return stop(ctx.Err())
+		}
+
+		finished := true
+		for _, artStyleExtensions := range artStyles {
+			finished = finished && (journal.isDone(game.ID+artStyleExtensions[0]) || locks.has(game.ID, artStyleExtensions))
+		}
+		if finished {
+			continue
+		}
+		// At least one game goes ahead, so every run gets somewhere.
+		if postponed || (started > 0 && result.budget.usedUp(result.Metrics)) {
+			result.Postponed = append(result.Postponed, game)
+			postponed = true
+			continue
+		}
+
+		started++
+
+		if !isValidGameID(game.ID) {
+			fmt.Printf("Skipping entry with invalid id %v (%v/%v)\n", game.ID, i, len(games))
+			result.Invalid = append(result.Invalid, game)
+			continue
+		}
+
+		var name string
+		if game.Name == "" && !game.Custom {
+			game.Name = GetGameName(withStage(ctx, "store details"), game.ID)
+		}
+
+		if game.Name != "" {
+			name = game.Name
+		} else {
+			name = "unknown game with id " + game.ID
+		}
+		fmt.Printf("Processing %v (%v/%v)\n", name, i, len(games))
+		// Bounds the downloads of the game, the run goes on after it.
+		gameCtx, cancel := ctx, context.CancelFunc(func() {})
+		if opts.GameTimeout > 0 {
+			gameCtx, cancel = context.WithTimeout(ctx, opts.GameTimeout)
+		}
+		err := addStoreTags(withStage(gameCtx, "store details"), opts, game)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		err = addLocalizedName(withStage(gameCtx, "store details"), game, language)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		if opts.Media != "" && game.MediaType == "" {
+			// Without store details, like for non-Steam games.
+			classifyMedia(game, "")
+		}
+		if game.MediaType != "" && opts.Media == mediaSkip {
+			fmt.Printf("Skipping %v, it's a %v\n", name, strings.ToLower(game.MediaType))
+			result.Media = append(result.Media, game)
+			cancel()
+			continue
+		}
+		opts.Hooks.game(game, i, len(games))
+
+		for artStyle, artStyleExtensions := range artStyles {
+			if journal.isDone(game.ID + artStyleExtensions[0]) || skippedByDevice(opts, game, artStyle) {
+				continue
+			}
+			if locks.has(game.ID, artStyleExtensions) {
+				fmt.Printf("%v is locked, leaving it alone\n", artStyle)
+				continue
+			}
+			if gameCtx.Err() != nil && ctx.Err() == nil {
+				// Out of time, the next run tries the rest again.
+				break
+			}
+			// The hook is called when the outcome is known, see
+			// processArtwork and overlayAndSave.
+			err := processArtwork(ctx, gameCtx, opts, gridDir, game, artStyle, artStyleExtensions, overlays, exports, result, journal, pool)
+			if err != nil {
+				cancel()
+				return stop(err)
+			}
+		}
+		if gameCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			fmt.Printf("Gave up on %v after %v\n", name, opts.GameTimeout)
+			result.TimedOut = append(result.TimedOut, game)
+		}
+		cancel()
+		if quota := steamGridDBQuota.String(); opts.Verbose && quota != "" {
+			fmt.Println("  SteamGridDB quota: " + quota)
+		}
+	}
+	result.SteamGridDBQuota = steamGridDBQuota.String()
+	if opts.Autotune && opts.Verbose {
+		fmt.Printf("Tuned to %v download and %v CPU workers\n", downloadWorkers.workers(), pool.size())
+	}
+	if err := pool.close(); err != nil {
+		journal.close(false)
+		return err
+	}
+	if err := result.updateManifest(gridDir); err != nil {
+		fmt.Println(err.Error())
+	}
+	// The journal stays for the next run to resume the postponed games.
+	return journal.close(!postponed)
+}
+
+// Finds, overlays and saves one artwork of a game. Only returns errors that
+// should stop the run. Downloads use gameCtx, which ends with the time of the
+// game.
+func processArtwork(ctx context.Context, gameCtx context.Context, opts *Options, gridDir string, game *Game, artStyle string, artStyleExtensions []string, overlays map[string]image.Image, exports []export, result *Result, journal *journal, pool *cpuPool) error {
+	// Clear for multiple runs:
+	game.ImageSource = ""
+	game.ImageExt = ""
+	game.CleanImageBytes = nil
+	game.OverlayImageBytes = nil
+	game.Candidates = nil
+	game.SourceChain = nil
+
+	overridePath := filepath.Join(filepath.Dir(os.Args[0]), "games")
+	start := time.Now()
+	if journal.isInterrupted(game.ID + artStyleExtensions[0]) {
+		// The grid image may be half written, start over from the backup.
+		recoverInterrupted(gridDir, game, artStyleExtensions, opts.BackupName)
+	}
+	LoadExisting(overridePath, gridDir, game, artStyleExtensions, opts.BackupName)
+	// Images from the games directory and manual customizations are kept.
+	if opts.ShuffleAlternates && (game.ImageSource == "" || game.ImageSource == "backup") {
+		_, err := shuffleAlternate(gridDir, game, artStyleExtensions)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+	if opts.HTMLReport != "" {
+		before := thumbnail(readGridImage(gridDir, game, artStyleExtensions))
+		result.reportArtwork(gridDir, game, artStyle, artStyleExtensions, func(entry *reportEntry) {
+			entry.Before = before
+		})
+	}
+	// Unused backups and images with other extensions are cleaned up after
+	// saving, see overlayAndSave.
+	opts.metrics.addStage("loading existing", start)
+	var err error
+
+	///////////////////////
+	// Download if missing.
+	///////////////////////
+	opts.metrics.addCache(game.ImageSource != "")
+	if opts.Quarantine && game.ImageSource == "" && findQuarantined(gridDir, game, artStyleExtensions) != "" {
+		result.addQuarantined(gridDir, game, artStyle, artStyleExtensions)
+		fmt.Printf("%v waits for approval in quarantine\n", artStyle)
+		opts.Hooks.artwork(game, artStyle, game.ImageSource, nil)
+		return journal.finish(game.ID + artStyleExtensions[0])
+	}
+	if game.ImageSource == "" {
+		start := time.Now()
+		from, err := DownloadImage(withStage(gameCtx, "downloading"), game, artStyle, artStyleExtensions, opts)
+		opts.metrics.addStage("downloading", start)
+		if opts.Verbose {
+			fmt.Printf("  Sources: %v\n", game.SourceChain)
+		}
+		if err != nil && err.Error() == "SteamGridDB authorization token is missing or invalid" {
+			// Wrong api key
+			opts.SteamGridDBApiKey = ""
+			fmt.Println(err.Error())
+		} else if err != nil {
+			fmt.Println(err.Error())
+		}
+
+		if game.ImageSource == "" {
+			// Nothing was loaded, only stale backups are left to clean up.
+			err = RemoveExisting(gridDir, game, artStyleExtensions, opts.BackupName)
+			if err != nil {
+				fmt.Println(err.Error())
 			}
+			result.NotFound[artStyle] = append(result.NotFound[artStyle], game)
+			result.recordArtwork(gridDir, game, artStyle, artStyleExtensions, artworkMissing)
+			fmt.Printf("%v not found\n", artStyle)
+			opts.Hooks.artwork(game, artStyle, "", ErrArtworkNotFound)
+			// Game has no image, skip it.
+			return journal.finish(game.ID + artStyleExtensions[0])
+		} else if err == nil {
+			result.Downloaded++
+		}
+
+		if opts.Quarantine && isLowConfidence(from) {
+			err = saveQuarantined(gridDir, game, artStyleExtensions)
+			if err != nil {
+				return err
+			}
+			result.addQuarantined(gridDir, game, artStyle, artStyleExtensions)
+			fmt.Printf("%v found from %v, put in quarantine\n", artStyle, game.ImageSource)
+			opts.Hooks.artwork(game, artStyle, game.ImageSource, nil)
+			return journal.finish(game.ID + artStyleExtensions[0])
+		}
+		if opts.HTMLReport != "" && isLowConfidence(from) {
+			result.reportArtwork(gridDir, game, artStyle, artStyleExtensions, func(entry *reportEntry) {
+				entry.LowConfidence = true
+			})
+		}
+		switch from {
+		case "IGDB":
+			result.IGDB[artStyle] = append(result.IGDB[artStyle], game)
+		case "SteamGridDB":
+			result.SteamGridDB[artStyle] = append(result.SteamGridDB[artStyle], game)
+		case "search":
+			result.Searched[artStyle] = append(result.Searched[artStyle], game)
 		}
 	}
+	fmt.Printf("%v found from %v\n", artStyle, game.ImageSource)
+
+	if opts.Alternates > 0 && len(game.Candidates) > 0 {
+		err = saveAlternates(gridDir, game, artStyleExtensions, opts.Alternates)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+
+	// The workers get a copy, the game is reused for the next artwork.
+	saved := *game
+	return pool.submit(func() error {
+		return overlayAndSave(ctx, opts, gridDir, &saved, artStyle, artStyleExtensions, overlays, exports, result, journal)
+	})
+}
+
+// Applies the overlays to the clean image of the game, backs it up and writes
+// the result to the grid. The journal is optional.
+func overlayAndSave(ctx context.Context, opts *Options, gridDir string, game *Game, artStyle string, artStyleExtensions []string, overlays map[string]image.Image, exports []export, result *Result, journal *journal) error {
+	var err error
+	overridePath := filepath.Join(filepath.Dir(os.Args[0]), "games")
+	start := time.Now()
+
+	///////////////////////
+	// Apply overlay.
+	//
+	// Expecting name.artExt.imgExt:
+	// Banner: favorites.png
+	// Cover: favorites.p.png
+	// Hero: favorites.hero.png
+	// Logo: favorites.logo.png
+	///////////////////////
+	err = shrinkForDevice(game, opts, artStyleExtensions)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	// Animated images are kept as they are if the options ask for it.
+	skipOverlays := opts.SkipAnimatedOverlays && isAnimated(game.CleanImageBytes)
+	if providers := getProviders(opts); len(providers) > 0 && !skipOverlays {
+		tags := game.Tags
+		game.Tags, err = getProviderOverlays(ctx, providers, game, artStyle)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		err = ApplyOverlay(game, overlays, artStyleExtensions)
+		game.Tags = tags
+	} else if !skipOverlays {
+		err = ApplyOverlay(game, overlays, artStyleExtensions)
+	}
+	// Still written without the overlays, but reported as failed.
+	overlayErr := err
+	if err != nil {
+		print(err.Error(), "\n")
+		result.mutex.Lock()
+		result.Failed[artStyle] = append(result.Failed[artStyle], game)
+		result.FailedErrors[artStyle] = append(result.FailedErrors[artStyle], err.Error())
+		result.mutex.Unlock()
+	}
+	if opts.LastPlayedStamp && (artStyle == "Banner" || artStyle == "Cover") {
+		err = applyLastPlayedStamp(game)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+	if game.OverlayImageBytes != nil {
+		result.mutex.Lock()
+		result.OverlaysApplied++
+		result.mutex.Unlock()
+	} else {
+		game.OverlayImageBytes = game.CleanImageBytes
+	}
+	err = applyColorFilters(game, opts, artStyle)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	err = applyCardStyle(game, opts, artStyle)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	if opts.Optimize && game.ImageExt == ".png" {
+		game.OverlayImageBytes = optimizePNG(game.OverlayImageBytes)
+	}
+
+	opts.metrics.addStage("compositing", start)
+
+	///////////////////////
+	// Save result.
+	///////////////////////
+	start = time.Now()
+	defer opts.metrics.addStage("saving", start)
+	err = journal.begin(game.ID + artStyleExtensions[0])
+	if err != nil {
+		return err
+	}
+	backupPath, err := BackupGame(gridDir, game, artStyleExtensions, opts.BackupName)
+	if err != nil {
+		return err
+	}
+
+	imagePath := filepath.Join(gridDir, game.ID + artStyleExtensions[0] + game.ImageExt)
+	err = steamFS.WriteFile(imagePath, game.OverlayImageBytes)
 
-	fmt.Printf("\n\n%v images downloaded and %v overlays applied.\n\n", nDownloaded, nOverlaysApplied)
+	// Copy with legacy naming for Big Picture mode and the Steam Deck
+	tenfootPath := ""
+	if tenfoot := tenfootID(game.ID); err == nil && artStyle == "Banner" && tenfoot != "" {
+		tenfootPath = filepath.Join(gridDir, tenfoot + artStyleExtensions[0] + game.ImageExt)
+		err = steamFS.WriteFile(tenfootPath, game.OverlayImageBytes)
+	}
+	// The old images and backups only go once the new ones are written.
+	if err == nil {
+		err = RemoveExisting(gridDir, game, artStyleExtensions, opts.BackupName, imagePath, tenfootPath, backupPath)
+	}
+	if err == nil {
+		err = writeOutputCopy(opts, game, artStyleExtensions)
+	}
+	if err == nil {
+		err = writeLibraryCache(opts, gridDir, game, artStyle)
+	}
+	if err == nil {
+		err = writeExports(exports, game, artStyleExtensions)
+	}
+	if err == nil && artStyle == "Logo" {
+		err = writeLogoPosition(opts, overridePath, gridDir, game)
+	}
+	if err != nil {
+		fmt.Printf("Failed to write image for %v (%v) because: %v\n", game.Name, artStyle, err.Error())
+		result.recordArtwork(gridDir, game, artStyle, artStyleExtensions, artworkFailed)
+	} else {
+		result.recordArtwork(gridDir, game, artStyle, artStyleExtensions, artworkOK)
+		err = overlayErr
+	}
+	opts.Hooks.artwork(game, artStyle, game.ImageSource, err)
+	if opts.HTMLReport != "" {
+		after := thumbnail(game.OverlayImageBytes)
+		result.reportArtwork(gridDir, game, artStyle, artStyleExtensions, func(entry *reportEntry) {
+			entry.Source = game.ImageSource
+			entry.After = after
+		})
+	}
+	return journal.finish(game.ID + artStyleExtensions[0])
+}
+
+// Prints the summary at the end of a run.
+func printReport(result *Result) {
+	searchedGames := result.Searched
+	IGDB := result.IGDB
+	steamGridDB := result.SteamGridDB
+	notFounds := result.NotFound
+	failedGames := result.Failed
+
+	fmt.Printf("\n\n%v images downloaded and %v overlays applied.\n\n", result.Downloaded, result.OverlaysApplied)
 	if len(searchedGames["Banner"]) + len(searchedGames["Cover"]) + len(searchedGames["Hero"]) + len(searchedGames["Logo"]) >= 1 {
 		fmt.Printf("%v images were found with a Google search and may not be accurate:\n", len(searchedGames["Banner"]) + len(searchedGames["Cover"]) + len(searchedGames["Hero"]) + len(searchedGames["Logo"]))
 		for artStyle, games := range searchedGames {
@@ -316,17 +1121,61 @@ func startApplication() {
 	if len(failedGames["Banner"]) + len(failedGames["Cover"]) + len(failedGames["Hero"]) + len(failedGames["Logo"]) >= 1 {
 		fmt.Printf("%v images were found but had errors and could not be overlaid:\n", len(failedGames["Banner"]) + len(failedGames["Cover"]) + len(failedGames["Hero"]) + len(failedGames["Logo"]))
 		for artStyle, games := range failedGames {
-			var i = 0
+			for i, game := range games {
+				fmt.Printf("- %v (id %v, %v) (%v)\n", game.Name, game.ID, artStyle, result.FailedErrors[artStyle][i])
+			}
+		}
+
+		fmt.Printf("\n\n")
+	}
+
+	if len(result.Invalid) >= 1 {
+		fmt.Printf("%v entries had invalid ids and were skipped:\n", len(result.Invalid))
+		for _, game := range result.Invalid {
+			fmt.Printf("- %v (id %v)\n", game.Name, game.ID)
+		}
+
+		fmt.Printf("\n\n")
+	}
+
+	if len(result.Media) >= 1 {
+		fmt.Printf("%v soundtracks and videos were skipped:\n", len(result.Media))
+		for _, game := range result.Media {
+			fmt.Printf("- %v (id %v, %v)\n", game.Name, game.ID, strings.ToLower(game.MediaType))
+		}
+
+		fmt.Printf("\n\n")
+	}
+
+	if len(result.TimedOut) >= 1 {
+		fmt.Printf("%v games took too long and were skipped, they are tried again next time:\n", len(result.TimedOut))
+		for _, game := range result.TimedOut {
+			fmt.Printf("- %v (id %v)\n", game.Name, game.ID)
+		}
+
+		fmt.Printf("\n\n")
+	}
+
+	if len(result.Postponed) >= 1 {
+		fmt.Printf("The budget was used up, %v games are left for the next run.\n\n\n", len(result.Postponed))
+	}
+
+	quarantined := result.Quarantined
+	if len(quarantined["Banner"]) + len(quarantined["Cover"]) + len(quarantined["Hero"]) + len(quarantined["Logo"]) >= 1 {
+		fmt.Printf("%v images may not be accurate and wait in quarantine, approve them with \"steamgrid approve\":\n", len(quarantined["Banner"]) + len(quarantined["Cover"]) + len(quarantined["Hero"]) + len(quarantined["Logo"]))
+		for artStyle, games := range quarantined {
 			for _, game := range games {
-				fmt.Printf("- %v (id %v, %v) (%v)\n", game.Name, game.ID, artStyle, errorMessages[i])
-				i++
+				fmt.Printf("? %v (id %v, %v)\n", game.Name, game.ID, artStyle)
 			}
 		}
 
 		fmt.Printf("\n\n")
 	}
 
-	fmt.Println("Open Steam in grid view to see the results!\n\nPress enter to close.")
+	if result.SteamGridDBQuota != "" {
+		fmt.Printf("SteamGridDB quota: %v\n\n", result.SteamGridDBQuota)
+	}
 
-	bufio.NewReader(os.Stdin).ReadBytes('\n')
+	printChanges(result.Changes)
+	printMetrics(result.Metrics)
 }
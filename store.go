@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Store details of a game, used for tags that don't come from the user
+// categories.
+const steamAppDetailsFormat = `https://store.steampowered.com/api/appdetails?appids=%v`
+
+// Store categories for VR support: "VR Support", "VR Supported" and "VR Only".
+var vrCategories = map[int]bool{31: true, 53: true, 54: true}
+
+// Store genre of Early Access games.
+const earlyAccessGenre = "70"
+
+// Tags for the release state, overlays are named after them.
+const (
+	earlyAccessTag = "Early Access"
+	comingSoonTag  = "Coming Soon"
+	saleTag        = "Sale"
+	dlcSaleTag     = "DLC Sale"
+)
+
+// Prices of several games at once, the store only allows this filter for
+// multiple IDs.
+const steamPricesFormat = `https://store.steampowered.com/api/appdetails?appids=%v&filters=price_overview`
+
+// Games asked for at once, longer URLs are refused.
+const storeBatchSize = 50
+
+// Apps on the wishlist of a user, if the wishlist is public.
+const steamWishlistFormat = `https://api.steampowered.com/IWishlistService/GetWishlist/v1/?steamid=%v`
+
+// Names of several apps at once, with the request as JSON.
+const steamStoreItemsFormat = `https://api.steampowered.com/IStoreBrowseService/GetItems/v1/?input_json=%v`
+
+// What the sale badge needs to know about a user: the games they own, whose
+// DLC may be on sale, and their wishlist, whose games may be on sale. Steam
+// takes games off the wishlist when they are bought, so all of them are
+// unowned.
+type saleInfo struct {
+	// Nil if the profile couldn't be loaded, no DLC is checked then.
+	owned map[string]*Game
+	// Name of each wishlisted app by ID.
+	wishlist map[string]string
+	// Wishlisted app IDs by lower case name, for non-Steam games.
+	wishlistNames map[string]string
+}
+
+type priceOverview struct {
+	DiscountPercent int `json:"discount_percent"`
+}
+
+type appDetails struct {
+	Type       string `json:"type"`
+	Categories []struct {
+		ID          int    `json:"id"`
+		Description string `json:"description"`
+	} `json:"categories"`
+	Genres []struct {
+		ID          string `json:"id"`
+		Description string `json:"description"`
+	} `json:"genres"`
+	ReleaseDate struct {
+		ComingSoon bool   `json:"coming_soon"`
+		Date       string `json:"date"`
+	} `json:"release_date"`
+	PriceOverview *priceOverview `json:"price_overview"`
+	DLC           []int          `json:"dlc"`
+}
+
+// Downloads the store details of a Steam game. Returns nil if the store has
+// none, like for removed games.
+func getAppDetails(ctx context.Context, gameID string) (*appDetails, error) {
+	response, err := tryDownload(ctx, fmt.Sprintf(steamAppDetailsFormat, gameID))
+	if err != nil || response == nil {
+		return nil, err
+	}
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonResponse map[string]struct {
+		Success bool       `json:"success"`
+		Data    appDetails `json:"data"`
+	}
+	err = json.Unmarshal(responseBytes, &jsonResponse)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := jsonResponse[gameID]
+	if !ok || !entry.Success {
+		return nil, nil
+	}
+	return &entry.Data, nil
+}
+
+// Returns the IDs of the given games that are discounted right now.
+func getDiscounted(ctx context.Context, gameIDs []int) ([]int, error) {
+	var discounted []int
+	for start := 0; start < len(gameIDs); start += storeBatchSize {
+		end := start + storeBatchSize
+		if end > len(gameIDs) {
+			end = len(gameIDs)
+		}
+		batch, err := getDiscountedBatch(ctx, gameIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		discounted = append(discounted, batch...)
+	}
+	return discounted, nil
+}
+
+func getDiscountedBatch(ctx context.Context, gameIDs []int) ([]int, error) {
+	ids := make([]string, len(gameIDs))
+	for i, id := range gameIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	response, err := tryDownload(ctx, fmt.Sprintf(steamPricesFormat, strings.Join(ids, ",")))
+	if err != nil || response == nil {
+		return nil, err
+	}
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries without price have an empty list as data instead of an object.
+	var jsonResponse map[string]struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	err = json.Unmarshal(responseBytes, &jsonResponse)
+	if err != nil {
+		return nil, err
+	}
+	var discounted []int
+	for _, id := range gameIDs {
+		entry := jsonResponse[strconv.Itoa(id)]
+		var prices struct {
+			PriceOverview *priceOverview `json:"price_overview"`
+		}
+		if !entry.Success || json.Unmarshal(entry.Data, &prices) != nil {
+			continue
+		}
+		if prices.PriceOverview != nil && prices.PriceOverview.DiscountPercent > 0 {
+			discounted = append(discounted, id)
+		}
+	}
+	return discounted, nil
+}
+
+// Loads what the sale badge needs to know about the user. Without the
+// profile only the wishlist is checked, without the wishlist only the DLC.
+func loadSaleInfo(ctx context.Context, user User) *saleInfo {
+	sale := &saleInfo{owned: map[string]*Game{}, wishlist: map[string]string{}, wishlistNames: map[string]string{}}
+	if err := addGamesFromProfile(ctx, user, sale.owned); err != nil || len(sale.owned) == 0 {
+		fmt.Println("Could not load the games of " + user.Name + " from the Steam profile, not checking DLC for sales")
+		sale.owned = nil
+	}
+	appIDs, err := getWishlist(ctx, user)
+	if err == nil {
+		err = getStoreNames(ctx, appIDs, sale.wishlist)
+	}
+	if err != nil {
+		fmt.Println("Could not load the wishlist of " + user.Name + ": " + err.Error())
+	}
+	for id, name := range sale.wishlist {
+		sale.wishlistNames[strings.ToLower(normalizeName(name, nil))] = id
+	}
+	return sale
+}
+
+// Downloads the IDs of the apps on the wishlist of the user. Private
+// wishlists are empty.
+func getWishlist(ctx context.Context, user User) ([]string, error) {
+	response, err := tryDownload(ctx, fmt.Sprintf(steamWishlistFormat, user.SteamID64))
+	if err != nil || response == nil {
+		return nil, err
+	}
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var jsonResponse struct {
+		Response struct {
+			Items []struct {
+				AppID int `json:"appid"`
+			} `json:"items"`
+		} `json:"response"`
+	}
+	err = json.Unmarshal(responseBytes, &jsonResponse)
+	if err != nil {
+		return nil, err
+	}
+	var appIDs []string
+	for _, item := range jsonResponse.Response.Items {
+		appIDs = append(appIDs, strconv.Itoa(item.AppID))
+	}
+	return appIDs, nil
+}
+
+type storeItemID struct {
+	AppID int `json:"appid"`
+}
+
+// Downloads the store names of the apps into names, by ID.
+func getStoreNames(ctx context.Context, appIDs []string, names map[string]string) error {
+	for start := 0; start < len(appIDs); start += storeBatchSize {
+		end := start + storeBatchSize
+		if end > len(appIDs) {
+			end = len(appIDs)
+		}
+		var request struct {
+			IDs     []storeItemID `json:"ids"`
+			Context struct {
+				Language string `json:"language"`
+			} `json:"context"`
+		}
+		for _, id := range appIDs[start:end] {
+			appID, _ := strconv.Atoi(id)
+			request.IDs = append(request.IDs, storeItemID{appID})
+		}
+		request.Context.Language = "english"
+		requestBytes, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		response, err := tryDownload(ctx, fmt.Sprintf(steamStoreItemsFormat, url.QueryEscape(string(requestBytes))))
+		if err != nil || response == nil {
+			return err
+		}
+		responseBytes, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+		var jsonResponse struct {
+			Response struct {
+				StoreItems []struct {
+					AppID int    `json:"appid"`
+					Name  string `json:"name"`
+				} `json:"store_items"`
+			} `json:"response"`
+		}
+		err = json.Unmarshal(responseBytes, &jsonResponse)
+		if err != nil {
+			return err
+		}
+		for _, item := range jsonResponse.Response.StoreItems {
+			if item.Name != "" {
+				names[strconv.Itoa(item.AppID)] = item.Name
+			}
+		}
+	}
+	return nil
+}
+
+// Tags a non-Steam game as on sale if a wishlisted app of the same name is
+// discounted, like the Steam version of a game bought elsewhere.
+func addShortcutSaleTag(ctx context.Context, opts *Options, game *Game) error {
+	if !opts.SaleBadge || opts.sale == nil || game.Name == "" {
+		return nil
+	}
+	id, ok := opts.sale.wishlistNames[strings.ToLower(normalizeName(game.Name, nil))]
+	if !ok {
+		return nil
+	}
+	appID, _ := strconv.Atoi(id)
+	discounted, err := getDiscounted(ctx, []int{appID})
+	if err != nil {
+		return err
+	}
+	if len(discounted) > 0 {
+		addTag(game, saleTag)
+	}
+	return nil
+}
+
+// Whether any of the store tag options is enabled.
+func needsStoreTags(opts *Options) bool {
+	return opts.VRBadge || opts.ReleaseState || opts.SaleBadge || opts.GenreTags || opts.Media != ""
+}
+
+// Adds a tag unless the game already has it, maybe as a category with the
+// same overlay name, so no overlay is drawn twice.
+func addTag(game *Game, tag string) {
+	for _, existing := range game.Tags {
+		if overlayName(existing) == overlayName(tag) {
+			return
+		}
+	}
+	game.Tags = append(game.Tags, tag)
+}
+
+// Adds tags from the store details of a Steam game, depending on the options.
+func addStoreTags(ctx context.Context, opts *Options, game *Game) error {
+	if game.Custom || isCustomID(game.ID) {
+		return addShortcutSaleTag(ctx, opts, game)
+	}
+	if !needsStoreTags(opts) {
+		return nil
+	}
+	details, err := getAppDetails(ctx, game.ID)
+	if err != nil || details == nil {
+		return err
+	}
+
+	if opts.Media != "" {
+		classifyMedia(game, details.Type)
+	}
+
+	if opts.VRBadge {
+		for _, category := range details.Categories {
+			if vrCategories[category.ID] {
+				game.Tags = append(game.Tags, "VR")
+				break
+			}
+		}
+	}
+
+	if opts.ReleaseState {
+		if details.ReleaseDate.ComingSoon {
+			game.Tags = append(game.Tags, comingSoonTag)
+		} else {
+			for _, genre := range details.Genres {
+				if genre.ID == earlyAccessGenre {
+					game.Tags = append(game.Tags, earlyAccessTag)
+					break
+				}
+			}
+		}
+	}
+
+	// Genres like "Action" or "RPG", in English, for overlays like
+	// "rpg.cover.png" without a category for them.
+	if opts.GenreTags {
+		for _, genre := range details.Genres {
+			addTag(game, genre.Description)
+		}
+	}
+
+	// The overlays are made from the clean backups on every run, so the
+	// badge is gone with the first run after the sale. Owned games are never
+	// on the wishlist, they are only tagged for their DLC.
+	if opts.SaleBadge && opts.sale != nil {
+		_, wishlisted := opts.sale.wishlist[game.ID]
+		if wishlisted && details.PriceOverview != nil && details.PriceOverview.DiscountPercent > 0 {
+			game.Tags = append(game.Tags, saleTag)
+		}
+		if _, owned := opts.sale.owned[game.ID]; owned && len(details.DLC) > 0 {
+			discounted, err := getDiscounted(ctx, details.DLC)
+			if err != nil {
+				return err
+			}
+			if len(discounted) > 0 {
+				game.Tags = append(game.Tags, dlcSaleTag)
+			}
+		}
+	}
+	return nil
+}
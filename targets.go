@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The run command does a run on several Steam installations of the config
+// file, like the PC, a Steam Deck and a living room PC, one after the other:
+//
+//	[target.pc]
+//
+//	[target.deck]
+//	steam-ssh = "deck@steamdeck:/home/deck/.local/share/Steam"
+//	device = "deck"
+//
+//	steamgrid run --target all
+//
+// A target section has options for its installation, over the global ones
+// and under the user sections. The downloads are kept until all targets are
+// done, so the same artwork is only downloaded once for the household.
+func runRunCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	targetList := flags.String("target", "all", "Targets of the config file to run on, separated by commas, or all")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return errors.New("Usage: steamgrid run [-target all|name,...] [options]")
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	config.LoadEnvironment(os.Environ())
+	config.Overrides = CommandLineSettings(flags)
+	config.LoadKeyring()
+	err = config.Check()
+	if err != nil {
+		return err
+	}
+	targets, err := selectTargets(config, *targetList)
+	if err != nil {
+		return err
+	}
+
+	cache, err := startHTTPCache()
+	if err != nil {
+		return err
+	}
+	defer cache.stop()
+
+	ctx := interruptContext()
+	var failed []string
+	for _, name := range targets {
+		fmt.Println("Target " + name + ":")
+		target := *config
+		target.Target = name
+		targetOpts, err := target.Options(nil)
+		if err == nil {
+			var result *Result
+			result, err = Run(ctx, targetOpts)
+			if result != nil {
+				printReport(result)
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Println("Target " + name + " failed: " + err.Error())
+			failed = append(failed, name)
+		}
+		fmt.Println()
+	}
+
+	requests, hits := cache.stats()
+	fmt.Printf("Ran on %v targets, %v of %v downloads came from the shared cache\n", len(targets), hits, requests)
+	if len(failed) > 0 {
+		return fmt.Errorf("%v of %v targets failed: %v", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Targets named in the list, in the order given, or all of them by name.
+func selectTargets(config *Config, list string) ([]string, error) {
+	if len(config.Targets) == 0 {
+		return nil, errors.New("No targets in " + config.Path + ", add sections like [target.deck]")
+	}
+	var targets []string
+	if list == "all" {
+		for name := range config.Targets {
+			targets = append(targets, name)
+		}
+		sort.Strings(targets)
+		return targets, nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := config.Targets[name]; !ok {
+			return nil, errors.New("Unknown target " + name + " in " + config.Path)
+		}
+		targets = append(targets, name)
+	}
+	return targets, nil
+}
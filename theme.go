@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// Themes restyle the whole library with one option, like --theme neon. A
+// theme is a directory in "themes" next to the executable, or any directory
+// given by its path:
+//
+//	themes/neon/theme.conf                 options, like in the config file
+//	themes/neon/overlays by category/      overlays, instead of the usual ones
+//	themes/neon/placeholder.cover.png      template for covers nobody has
+//	themes/neon/neon.ttf                   font, with font = "neon.ttf"
+//
+// All parts are optional. theme.conf can only set the style: filter, frames,
+// the fonts and the card style (corners, border, bordercolor and shadow). Its
+// options go below everything else: the config file, the environment and the
+// command line win over them. Font paths are relative to the theme. Placeholders are used when no source has an artwork, with the
+// name of the game written over them, except on heroes, where the logo goes.
+// They are kept by later runs like any image, delete them to search again.
+const themeFileName = "theme.conf"
+
+// Themes that come with the program, options only. A directory of the same
+// name is used instead.
+var builtinThemes = map[string]string{
+	"neon": `filter = "contrast=1.2,duotone=#1a0033:#00f5ff"
+frames = "all"
+border = 2
+bordercolor = "#ff2bd6"
+`,
+	"noir": `filter = "desaturate,contrast=1.3"
+border = 1
+bordercolor = "#ffffff60"
+`,
+}
+
+// Options keyed by flag name that are file paths, relative to the theme.
+var themePathOptions = map[string]bool{"font": true, "emojifont": true}
+
+// Options a theme may set: only how the artwork looks. A theme is shared like
+// overlays are, it must not change where files go, what is downloaded or the
+// API keys.
+var themeStyleOptions = map[string]bool{
+	"filter": true, "frames": true, "font": true, "emojifont": true,
+	"corners": true, "border": true, "bordercolor": true, "shadow": true,
+}
+
+type theme struct {
+	name string
+	// Empty for built-in themes.
+	dir      string
+	settings []ConfigSetting
+}
+
+// Directory of the themes, next to the executable like the overlays.
+func themesDir() string {
+	return filepath.Join(filepath.Dir(os.Args[0]), "themes")
+}
+
+// Loads a theme by name or path. Returns nil for an empty name.
+func loadTheme(name string) (*theme, error) {
+	if name == "" {
+		return nil, nil
+	}
+	dir := name
+	if !strings.ContainsAny(name, `/\`) {
+		dir = filepath.Join(themesDir(), name)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		builtin, ok := builtinThemes[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.New("Unknown theme " + name + ", must be a directory in " + themesDir() + " or one of " + strings.Join(builtinThemeNames(), ", "))
+		}
+		t := &theme{name: strings.ToLower(name)}
+		return t, t.parse("built-in theme "+t.name, []byte(builtin))
+	}
+
+	t := &theme{name: filepath.Base(dir), dir: dir}
+	path := filepath.Join(dir, themeFileName)
+	themeBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return t, t.parse(path, themeBytes)
+}
+
+// Reads the options of a theme, checking them like a config file would be.
+func (t *theme) parse(path string, themeBytes []byte) error {
+	config, err := ParseConfig(path, themeBytes)
+	if err != nil {
+		return err
+	}
+	if len(config.Profiles) > 0 || len(config.Users) > 0 || len(config.Targets) > 0 {
+		return errors.New(path + ": themes only have options, no sections")
+	}
+	for i, setting := range config.Global {
+		if !themeStyleOptions[setting.Key] {
+			return fmt.Errorf("%v line %v: a theme can't set %v, only %v", path, setting.Line, setting.Key, strings.Join(themeStyleOptionNames(), ", "))
+		}
+		if themePathOptions[setting.Key] && t.dir != "" && !filepath.IsAbs(setting.Value) {
+			config.Global[i].Value = filepath.Join(t.dir, setting.Value)
+		}
+	}
+	if _, err = config.options(nil); err != nil {
+		return err
+	}
+	t.settings = config.Global
+	return nil
+}
+
+func themeStyleOptionNames() []string {
+	var names []string
+	for name := range themeStyleOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func builtinThemeNames() []string {
+	var names []string
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Overlay directory of the run: the one of the theme if it has one.
+func themeOverlaysDir(opts *Options) string {
+	if opts.themeDir != "" {
+		dir := filepath.Join(opts.themeDir, "overlays by category")
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return overlaysDir()
+}
+
+// Decoded placeholder templates by path, nil if there is none.
+var placeholderTemplates sync.Map
+
+func loadPlaceholderTemplate(path string) image.Image {
+	if cached, ok := placeholderTemplates.Load(path); ok {
+		template, _ := cached.(image.Image)
+		return template
+	}
+	var template image.Image
+	templateBytes, err := ioutil.ReadFile(path)
+	if err == nil {
+		template, _, err = image.Decode(bytes.NewBuffer(templateBytes))
+		if err != nil {
+			fmt.Println("Could not read the placeholder " + path + ": " + err.Error())
+		}
+	}
+	placeholderTemplates.Store(path, template)
+	return template
+}
+
+// The placeholder of the theme for an artwork no source has, or nil.
+func themePlaceholder(game *Game, artStyle string, artStyleExtensions []string, opts *Options) *Candidate {
+	if opts.themeDir == "" {
+		return nil
+	}
+	var template image.Image
+	for _, ext := range []string{".png", ".jpg"} {
+		template = loadPlaceholderTemplate(filepath.Join(opts.themeDir, "placeholder"+artStyleExtensions[1]+ext))
+		if template != nil {
+			break
+		}
+	}
+	if template == nil {
+		return nil
+	}
+
+	width, _ := strconv.Atoi(artStyleExtensions[3])
+	height, _ := strconv.Atoi(artStyleExtensions[4])
+	placeholder := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(placeholder, placeholder.Bounds(), template, template.Bounds(), draw.Src, nil)
+	// Like the generated covers of media.go: the name in the lower part of
+	// covers, in the middle of banners and logos.
+	switch artStyle {
+	case "Cover":
+		drawCenteredText(placeholder, templateName(game), width/2, height*2/3, width*9/10, height/10, color.White)
+	case "Banner", "Logo":
+		drawCenteredText(placeholder, templateName(game), width/2, height*2/5, width*9/10, height/5, color.White)
+	}
+	imageBytes, err := encodeImage(placeholder, ".png")
+	if err != nil {
+		return nil
+	}
+	return &Candidate{ImageBytes: imageBytes, From: "placeholder of theme " + filepath.Base(opts.themeDir), Trust: 0}
+}
@@ -0,0 +1,120 @@
+//go:build tray
+// +build tray
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"runtime"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// The tray command runs the watch mode with an icon in the system tray, with
+// "Run now", "Pause watching" and the summary of the last run. It needs the
+// systray package, so it's only built with "go build -tags tray".
+func runTrayCommand(args []string) error {
+	flags := flag.NewFlagSet("tray", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	interval := flags.Duration("interval", 5*time.Second, "How often to check for new installs")
+	flags.Parse(args)
+
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx := interruptContext()
+	w := newWatcher(opts, *interval)
+	var watchErr error
+	systray.Run(func() {
+		systray.SetIcon(trayIcon())
+		systray.SetTooltip("SteamGrid")
+		runNow := systray.AddMenuItem("Run now", "Process the whole library")
+		pause := systray.AddMenuItem("Pause watching", "Stop processing new installs")
+		summary := systray.AddMenuItem("No run yet", "")
+		summary.Disable()
+		systray.AddSeparator()
+		quit := systray.AddMenuItem("Quit", "")
+
+		w.onRun = func(result *Result, err error) {
+			text := "Last run " + time.Now().Format("15:04") + ": "
+			if err != nil {
+				text += err.Error()
+			} else if result != nil {
+				notFound := 0
+				for _, games := range result.NotFound {
+					notFound += len(games)
+				}
+				text += fmt.Sprintf("%v downloaded, %v not found", result.Downloaded, notFound)
+			}
+			summary.SetTitle(text)
+		}
+		go func() {
+			watchErr = w.watch(ctx)
+			systray.Quit()
+		}()
+
+		go func() {
+			paused := false
+			for {
+				select {
+				case <-runNow.ClickedCh:
+					summary.SetTitle("Running...")
+					w.requestRun()
+				case <-pause.ClickedCh:
+					paused = !paused
+					w.setPaused(paused)
+					if paused {
+						pause.SetTitle("Resume watching")
+					} else {
+						pause.SetTitle("Pause watching")
+					}
+				case <-quit.ClickedCh:
+					systray.Quit()
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}, nil)
+	return watchErr
+}
+
+// Draws the tray icon: a small grid of covers. Windows wants an ICO file,
+// which can hold a PNG.
+func trayIcon() []byte {
+	const size = 32
+	icon := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x%11 < 9 && y%16 < 14 {
+				icon.Set(x, y, color.RGBA{102, 192, 244, 255})
+			}
+		}
+	}
+	var pngBuffer bytes.Buffer
+	png.Encode(&pngBuffer, icon)
+	if runtime.GOOS != "windows" {
+		return pngBuffer.Bytes()
+	}
+
+	// ICONDIR and a single ICONDIRENTRY pointing to the PNG.
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, []uint16{0, 1, 1})
+	ico.Write([]byte{size, size, 0, 0})
+	binary.Write(&ico, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&ico, binary.LittleEndian, []uint32{uint32(pngBuffer.Len()), 22})
+	ico.Write(pngBuffer.Bytes())
+	return ico.Bytes()
+}
@@ -0,0 +1,11 @@
+//go:build !tray
+// +build !tray
+
+package main
+
+import "errors"
+
+// The tray mode needs the systray package, see tray.go.
+func runTrayCommand(args []string) error {
+	return errors.New("This steamgrid was built without the tray mode. Build it with \"go build -tags tray\", or use \"steamgrid watch\".")
+}
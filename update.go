@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The update command only processes the games that changed in the library
+// since the last run, by the manifest of each grid directory:
+//
+//	added    no artwork in the manifest yet, or a new artwork type
+//	changed  renamed, or different categories, so different overlays
+//	damaged  the grid image of a finished artwork is gone
+//
+// Games removed from the library are dropped from the manifest, their files
+// are left for "steamgrid prune". Artworks that weren't found last time are
+// not tried again, a full run does that. All the options of a full run work.
+func runUpdateCommand(args []string) error {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	flags.Parse(args)
+
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	opts.Incremental = true
+
+	result, err := Run(interruptContext(), opts)
+	if result != nil {
+		printReport(result)
+	}
+	return err
+}
+
+// Sets the library hash of the games, from what is known before the run adds
+// tags from the store.
+func hashLibrary(games map[string]*Game) {
+	for _, game := range games {
+		tags := append([]string{}, game.Tags...)
+		sort.Strings(tags)
+		hash := sha256.Sum256([]byte(game.Name + "\x00" + strings.Join(tags, "\x00")))
+		game.LibraryHash = hex.EncodeToString(hash[:8])
+	}
+}
+
+// Drops the games that are no longer in the library from the manifest.
+func forgetRemovedGames(gridDir string, games map[string]*Game, opts *Options) error {
+	// Without Steam games or with a list of games, the others are still in
+	// the library.
+	if opts.NonSteamOnly || len(opts.GameIDs) > 0 {
+		return nil
+	}
+	previous := loadManifest(gridDir)
+	removed := map[string]bool{}
+	for key, entry := range previous.Artworks {
+		if _, ok := games[entry.ID]; !ok && !entry.Locked {
+			removed[entry.ID] = true
+			delete(previous.Artworks, key)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	fmt.Printf("%v games were removed from the library since the last run, \"steamgrid prune\" removes their files\n", len(removed))
+	return previous.save(gridDir)
+}
+
+// Removes the games that didn't change since the last run.
+func filterUnchangedGames(gridDir string, games map[string]*Game, artStyles map[string][]string) {
+	previous := loadManifest(gridDir)
+	for id, game := range games {
+		changed := false
+		for _, artStyleExtensions := range artStyles {
+			entry, ok := previous.Artworks[id+artStyleExtensions[0]]
+			if !ok || entry.Library != game.LibraryHash || (entry.Status == artworkOK && readGridImage(gridDir, game, artStyleExtensions) == nil) {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			delete(games, id)
+		}
+	}
+
+	fmt.Printf("%v games were added or changed since the last run\n", len(games))
+}
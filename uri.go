@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The uri command lets web pages, like a SteamGridDB browser extension, apply
+// the image they show with a link:
+//
+//	steamgrid://apply?appid=620&type=cover&url=https://cdn.example/620.png
+//
+//	steamgrid uri install --steamgriddb <api key>
+//	steamgrid uri uninstall
+//
+// Install registers the steamgrid: scheme for this user, on Windows and on
+// Linux desktops, to run "steamgrid uri open" with the options after install.
+// The type is banner, cover, hero or logo, and user=<id or name> picks the
+// Steam user, by default every user with the game gets the image. The browser
+// asks before opening such a link, and SteamGrid asks again, with the game and
+// the image, since any page can make one.
+func runURICommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Usage: steamgrid uri install|uninstall|open [options]")
+	}
+	action, actionArgs := args[0], args[1:]
+	switch action {
+	case "install":
+		switch runtime.GOOS {
+		case "windows":
+			return installURIKey(actionArgs)
+		case "darwin":
+			return errors.New("steamgrid: links need an application bundle on macOS, which is not supported")
+		}
+		return installURIDesktopFile(actionArgs)
+	case "uninstall":
+		if runtime.GOOS == "windows" {
+			return uninstallURIKey()
+		}
+		return uninstallURIDesktopFile()
+	case "open":
+		return openURI(actionArgs)
+	}
+	return errors.New("Unknown uri action " + action + ", must be install, uninstall or open")
+}
+
+// An apply link, see runURICommand.
+type applyLink struct {
+	appID    string
+	artType  string
+	imageURL string
+	user     string
+}
+
+func parseApplyLink(link string) (applyLink, error) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "steamgrid" {
+		return applyLink{}, errors.New("Invalid link " + link + ", must be like steamgrid://apply?appid=620&type=cover&url=...")
+	}
+	// Some browsers drop the slashes, or add one after the action.
+	action := u.Host + strings.Trim(u.Opaque, "/") + strings.Trim(u.Path, "/")
+	if action != "apply" {
+		return applyLink{}, errors.New("Unknown action " + action + " in " + link + ", only apply is supported")
+	}
+	query := u.Query()
+	parsed := applyLink{query.Get("appid"), query.Get("type"), query.Get("url"), query.Get("user")}
+	if err := parsed.check(); err != nil {
+		return parsed, errors.New(err.Error() + ", in " + link)
+	}
+	return parsed, nil
+}
+
+func (link applyLink) check() error {
+	if !isValidGameID(link.appID) {
+		return errors.New("Invalid app ID " + link.appID)
+	}
+	if _, ok := artTypeNames[strings.ToLower(link.artType)]; !ok {
+		return errors.New("Invalid artwork type " + link.artType + ", must be banner, cover, hero or logo")
+	}
+	imageURL, err := url.Parse(link.imageURL)
+	if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+		return errors.New("Invalid image URL " + link.imageURL + ", must start with http:// or https://")
+	}
+	return nil
+}
+
+// The users with the game of the link, a copy of the game for each and the
+// art style.
+func (s *server) linkTargets(link applyLink) ([]User, []*Game, string, error) {
+	var users []User
+	var games []*Game
+	artStyle := ""
+	for _, user := range s.users {
+		if link.user != "" && link.user != user.SteamID32 && link.user != user.Name {
+			continue
+		}
+		s.mutex.Lock()
+		_, owned := s.games[user.SteamID32][link.appID]
+		s.mutex.Unlock()
+		if !owned {
+			continue
+		}
+		_, game, style, err := s.findArtwork(user.SteamID32, link.appID, link.artType)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		users, games, artStyle = append(users, user), append(games, game), style
+	}
+	if len(users) == 0 {
+		if link.user != "" {
+			return nil, nil, "", errors.New("The user " + link.user + " doesn't have the game " + link.appID)
+		}
+		return nil, nil, "", errors.New("No user has the game " + link.appID)
+	}
+	return users, games, artStyle, nil
+}
+
+// Downloads the image of the link, checking that it fits the art style.
+func (s *server) downloadLinkImage(ctx context.Context, link applyLink, artStyle string) (*Candidate, error) {
+	imageURL, _ := url.Parse(link.imageURL)
+	candidate := &Candidate{URLs: []string{link.imageURL}, From: imageURL.Host, Unmoderated: true}
+	err := downloadCandidate(ctx, candidate, artStyle, s.artStyles[artStyle], &s.opts)
+	if err != nil {
+		return nil, errors.New("Could not use " + link.imageURL + ": " + err.Error())
+	}
+	return candidate, nil
+}
+
+// Applies the image of a link, after asking.
+func openURI(args []string) error {
+	flags := flag.NewFlagSet("uri open", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	yes := flags.Bool("yes", false, "Apply the image without asking")
+	pause := flags.Bool("pause", false, "Wait for enter before closing, for the window opened by the browser")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("Usage: steamgrid uri open [options] steamgrid://apply?...")
+	}
+	err := openApplyLink(flags, &opts, *configPath, flags.Arg(0), *yes)
+	if *pause {
+		if err != nil {
+			errorAndExit(err)
+		}
+		if interactive() {
+			fmt.Println("\nPress enter to close.")
+			bufio.NewReader(os.Stdin).ReadBytes('\n')
+		}
+	}
+	return err
+}
+
+func openApplyLink(flags *flag.FlagSet, opts *Options, configPath string, rawLink string, yes bool) error {
+	link, err := parseApplyLink(rawLink)
+	if err != nil {
+		return err
+	}
+	err = applyConfigFile(opts, flags, configPath)
+	if err != nil {
+		return err
+	}
+	ctx := interruptContext()
+	s, err := newServer(ctx, *opts)
+	if err != nil {
+		return err
+	}
+	if err = s.reload(ctx); err != nil {
+		return err
+	}
+
+	users, games, artStyle, err := s.linkTargets(link)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Downloading " + link.imageURL + "...")
+	candidate, err := s.downloadLinkImage(ctx, link, artStyle)
+	if err != nil {
+		return err
+	}
+
+	title := games[0].Name
+	if title == "" && !games[0].Custom {
+		title = GetGameName(ctx, link.appID)
+	}
+	if title == "" {
+		title = "the game with id " + link.appID
+	}
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.Name
+	}
+	question := fmt.Sprintf("Apply the %vx%v image from %v as the %v of %v for %v?", candidate.Size.X, candidate.Size.Y, candidate.From, artStyle, title, strings.Join(names, ", "))
+	if !yes {
+		if !interactive() {
+			return errors.New(question + " Nobody is at the console to answer, not applied")
+		}
+		fmt.Print(question + " [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("Not applied")
+			return nil
+		}
+	}
+
+	for i, user := range users {
+		err = s.applyCandidate(ctx, user, games[i], artStyle, candidate)
+		if err != nil {
+			return errors.New("Could not apply the image for " + user.Name + ": " + err.Error())
+		}
+		fmt.Println("Applied the " + artStyle + " of " + title + " for " + user.Name)
+	}
+	return nil
+}
+
+// Name of the scheme, and of its registry key.
+const uriScheme = "steamgrid"
+
+// The command line of the handler, with the link added at the end.
+func uriHandlerCommand(installArgs []string) ([]string, error) {
+	return executableCommand("uri", append([]string{"open", "--pause"}, installArgs...))
+}
+
+func installURIKey(installArgs []string) error {
+	command, err := uriHandlerCommand(installArgs)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteWindowsArg(arg)
+	}
+	key := `HKCU\Software\Classes\` + uriScheme
+	if err = runServiceTool("reg", "add", key, "/ve", "/d", "URL:SteamGrid", "/f"); err != nil {
+		return err
+	}
+	if err = runServiceTool("reg", "add", key, "/v", "URL Protocol", "/d", "", "/f"); err != nil {
+		return err
+	}
+	if err = runServiceTool("reg", "add", key+`\shell\open\command`, "/ve", "/d", strings.Join(quoted, " ")+` "%1"`, "/f"); err != nil {
+		return err
+	}
+	fmt.Println("Registered the " + uriScheme + ": links for this user")
+	return nil
+}
+
+func uninstallURIKey() error {
+	if err := runServiceTool("reg", "delete", `HKCU\Software\Classes\`+uriScheme, "/f"); err != nil {
+		return errors.New("The " + uriScheme + ": links are not registered")
+	}
+	fmt.Println("Removed the " + uriScheme + ": links")
+	return nil
+}
+
+// Desktop file of the handler, in the applications of the user.
+func uriDesktopFilePath() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "applications", serviceName+"-uri.desktop"), nil
+}
+
+func installURIDesktopFile(installArgs []string) error {
+	command, err := uriHandlerCommand(installArgs)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteDesktopArg(arg)
+	}
+	desktopPath, err := uriDesktopFilePath()
+	if err != nil {
+		return err
+	}
+	// A terminal, to ask before applying.
+	desktopFile := "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=SteamGrid\n" +
+		"Comment=Applies artwork from web pages to Steam games\n" +
+		"Exec=" + strings.Join(quoted, " ") + " %u\n" +
+		"Terminal=true\n" +
+		"NoDisplay=true\n" +
+		"MimeType=x-scheme-handler/" + uriScheme + ";\n"
+	err = os.MkdirAll(filepath.Dir(desktopPath), 0777)
+	if err != nil {
+		return err
+	}
+	// The options may have API keys.
+	err = ioutil.WriteFile(desktopPath, []byte(desktopFile), 0600)
+	if err != nil {
+		return err
+	}
+	if err = runServiceTool("xdg-mime", "default", filepath.Base(desktopPath), "x-scheme-handler/"+uriScheme); err != nil {
+		return err
+	}
+	runServiceTool("update-desktop-database", filepath.Dir(desktopPath))
+	fmt.Println("Registered the " + uriScheme + ": links with " + desktopPath)
+	return nil
+}
+
+func uninstallURIDesktopFile() error {
+	desktopPath, err := uriDesktopFilePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(desktopPath); err != nil {
+		return errors.New("The " + uriScheme + ": links are not registered, " + desktopPath + " doesn't exist")
+	}
+	err = os.Remove(desktopPath)
+	if err != nil {
+		return err
+	}
+	runServiceTool("update-desktop-database", filepath.Dir(desktopPath))
+	fmt.Println("Removed " + desktopPath)
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Custom sources are URL templates, so community sites can be used without
+// changing the code. Several sources are separated by semicolons. The
+// placeholders are:
+//
+//	{appid}  the game ID
+//	{name}   the game name, escaped for URLs
+//	{type}   banner, cover, hero or logo
+//	{suffix} "", "p", "_hero" or "_logo"
+//	{width} {height} the size of the artwork
+//
+// A template pointing at an image is used as it is:
+//
+//	https://mycdn.example/{appid}{suffix}.png
+//
+// For web pages, add a selector after a space. It picks the first element
+// matching tag, tag.class or tag#id, and takes the image URL from the
+// attribute after the @ (src by default):
+//
+//	https://art.example/search?q={name} img.result@data-src
+type urlSource struct {
+	template string
+	selector string
+}
+
+// Parses the URL sources option.
+func getURLSources(opts *Options) ([]urlSource, error) {
+	var sources []urlSource
+	for _, entry := range strings.Split(opts.URLSources, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, errors.New("Invalid URL source " + entry + ", must be a template and an optional selector")
+		}
+		if !strings.HasPrefix(fields[0], "http://") && !strings.HasPrefix(fields[0], "https://") {
+			return nil, errors.New("Invalid URL source " + fields[0] + ", must start with http:// or https://")
+		}
+		source := urlSource{template: fields[0]}
+		if len(fields) == 2 {
+			source.selector = fields[1]
+			if _, _, err := compileSelector(source.selector); err != nil {
+				return nil, err
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+func expandURLTemplate(template string, game *Game, artStyleExtensions []string) string {
+	return strings.NewReplacer(
+		"{appid}", url.PathEscape(game.ID),
+		"{name}", url.QueryEscape(game.Name),
+		"{type}", strings.TrimPrefix(artStyleExtensions[1], "."),
+		"{suffix}", artStyleExtensions[0],
+		"{width}", artStyleExtensions[3],
+		"{height}", artStyleExtensions[4],
+	).Replace(template)
+}
+
+// Compiles a selector like "img.cover@src" to a pattern matching the opening
+// tag, and the attribute to take.
+func compileSelector(selector string) (*regexp.Regexp, string, error) {
+	attribute := "src"
+	if at := strings.Index(selector, "@"); at != -1 {
+		selector, attribute = selector[:at], selector[at+1:]
+	}
+	match := regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*)(?:([.#])([\w-]+))?$`).FindStringSubmatch(selector)
+	if match == nil || attribute == "" {
+		return nil, "", errors.New("Invalid selector " + selector + ", must be tag, tag.class or tag#id, optionally followed by @attribute")
+	}
+
+	pattern := `(?is)<` + match[1] + `\b[^>]*`
+	switch match[2] {
+	case ".":
+		pattern += `\bclass\s*=\s*["'](?:[^"']*\s)?` + regexp.QuoteMeta(match[3]) + `(?:\s[^"']*)?["'][^>]*`
+	case "#":
+		pattern += `\bid\s*=\s*["']` + regexp.QuoteMeta(match[3]) + `["'][^>]*`
+	}
+	pattern += `>`
+	return regexp.MustCompile(pattern), attribute, nil
+}
+
+// Returns the image URL of a custom source for the game, or "" if the page
+// has no matching element.
+func getURLSourceImage(ctx context.Context, source urlSource, game *Game, artStyleExtensions []string) (string, error) {
+	if game.Name == "" && strings.Contains(source.template, "{name}") {
+		return "", nil
+	}
+	pageURL := expandURLTemplate(source.template, game, artStyleExtensions)
+	if source.selector == "" {
+		return pageURL, nil
+	}
+
+	response, err := scrapeDownload(ctx, pageURL)
+	if err != nil || response == nil {
+		return "", err
+	}
+	page, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	tagPattern, attribute, err := compileSelector(source.selector)
+	if err != nil {
+		return "", err
+	}
+	tag := tagPattern.Find(page)
+	if tag == nil {
+		return "", nil
+	}
+	attributePattern := regexp.MustCompile(`(?i)\s` + regexp.QuoteMeta(attribute) + `\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	match := attributePattern.FindSubmatch(tag)
+	if match == nil {
+		return "", nil
+	}
+	imageURL := string(match[1]) + string(match[2])
+	imageURL = strings.Replace(imageURL, "&amp;", "&", -1)
+
+	// Relative to the page.
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := base.Parse(imageURL)
+	if err != nil {
+		return "", err
+	}
+	return resolved.String(), nil
+}
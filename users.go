@@ -1,14 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -27,8 +26,17 @@ const idConversionConstant = 0x110000100000000
 // GetUsers given the Steam installation dir (NOT the library!), returns all users in
 // this computer.
 func GetUsers(installationDir string) ([]User, error) {
+	return findUsers(installationDir, true)
+}
+
+// Like GetUsers, but doesn't touch the grid directories, for the audit.
+func GetUsersReadOnly(installationDir string) ([]User, error) {
+	return findUsers(installationDir, false)
+}
+
+func findUsers(installationDir string, prepareGrid bool) ([]User, error) {
 	userdataDir := filepath.Join(installationDir, "userdata")
-	files, err := ioutil.ReadDir(userdataDir)
+	files, err := steamFS.ReadDir(userdataDir)
 	if err != nil {
 		return nil, err
 	}
@@ -42,30 +50,39 @@ func GetUsers(installationDir string) ([]User, error) {
 		configFile := filepath.Join(userDir, "config", "localconfig.vdf")
 		// Malformed user directory. Without the localconfig file we can't get
 		// the username and the game list, so we skip it.
-		if _, err := os.Stat(configFile); err != nil {
+		if _, err := steamFS.Stat(configFile); err != nil {
 			continue
 		}
 
-		configBytes, err := ioutil.ReadFile(configFile)
+		configBytes, err := steamFS.ReadFile(configFile)
 		if err != nil {
 			return nil, err
 		}
 
-		// Makes sure the grid directory exists.
-		gridDir := filepath.Join(userDir, "config", "grid")
-		err = os.MkdirAll(gridDir, 0777)
-		if err != nil {
-			return nil, err
+		if prepareGrid {
+			// Makes sure the grid directory exists.
+			gridDir := filepath.Join(userDir, "config", "grid")
+			err = steamFS.MkdirAll(gridDir)
+			if err != nil {
+				return nil, err
+			}
+
+			// The Linux version of Steam ships with the "grid" dir without executable bit.
+			// This in turn denies permission to everything inside the folder. This line is
+			// here to ensure we have the correct permission.
+			fmt.Println("Setting permission...")
+			steamFS.Chmod(gridDir, 0777)
 		}
 
-		// The Linux version of Steam ships with the "grid" dir without executable bit.
-		// This in turn denies permission to everything inside the folder. This line is
-		// here to ensure we have the correct permission.
-		fmt.Println("Setting permission...")
-		os.Chmod(gridDir, 0777)
-
-		pattern := regexp.MustCompile(`"PersonaName"\s*"(.+?)"`)
-		username := pattern.FindStringSubmatch(string(configBytes))[1]
+		// The user name is at "UserLocalConfigStore" { "friends" { "PersonaName" } }.
+		username := userID
+		if localConfig, err := ParseTextVDF(configBytes); err == nil {
+			if personaName := localConfig.Find("PersonaName"); personaName != nil && personaName.Value != "" {
+				username = personaName.Value
+			}
+		} else {
+			fmt.Printf("Could not read %v: %v\n", configFile, err.Error())
+		}
 
 		steamID32, err := strconv.ParseInt(userID, 10, 64)
 		steamID64 := steamID32 + idConversionConstant
@@ -86,8 +103,8 @@ const profilePermalinkFormat = `http://steamcommunity.com/profiles/%v/games?tab=
 const steamProfileErrorMessage = `The specified profile could not be found.`
 
 // GetProfile returns the HTML profile from a user from their SteamId32.
-func GetProfile(user User) (string, error) {
-	response, err := http.Get(fmt.Sprintf(profilePermalinkFormat, user.SteamID64))
+func GetProfile(ctx context.Context, user User) (string, error) {
+	response, err := httpGet(ctx, fmt.Sprintf(profilePermalinkFormat, user.SteamID64))
 	if err != nil {
 		return "", err
 	}
@@ -115,40 +132,51 @@ func GetProfile(user User) (string, error) {
 // ProgramFiles folder. If a folder is given by program parameter, uses that.
 func GetSteamInstallation(steamDir string) (path string, err error) {
 	if steamDir != "" {
-		_, err := os.Stat(steamDir)
+		_, err := steamFS.Stat(steamDir)
 		if err == nil {
 			return steamDir, nil
 		}
 		return "", errors.New("Argument must be a valid Steam directory, or empty for auto detection. Got: " + steamDir)
 	}
 
-	currentUser, err := user.Current()
-	if err == nil {
-		linuxSteamDir := filepath.Join(currentUser.HomeDir, ".local", "share", "Steam")
-		if _, err = os.Stat(linuxSteamDir); err == nil {
+	if home := homeDir(); home != "" {
+		linuxSteamDir := filepath.Join(home, ".local", "share", "Steam")
+		if _, err = steamFS.Stat(linuxSteamDir); err == nil {
 			return linuxSteamDir, nil
 		}
 
-		linuxSteamDir = filepath.Join(currentUser.HomeDir, ".steam", "steam")
-		if _, err = os.Stat(linuxSteamDir); err == nil {
+		linuxSteamDir = filepath.Join(home, ".steam", "steam")
+		if _, err = steamFS.Stat(linuxSteamDir); err == nil {
 			return linuxSteamDir, nil
 		}
 
-		macSteamDir := filepath.Join(currentUser.HomeDir, "Library", "Application Support", "Steam")
-		if _, err = os.Stat(macSteamDir); err == nil {
+		macSteamDir := filepath.Join(home, "Library", "Application Support", "Steam")
+		if _, err = steamFS.Stat(macSteamDir); err == nil {
 			return macSteamDir, nil
 		}
 	}
 
 	programFiles86Dir := filepath.Join(os.Getenv("ProgramFiles(x86)"), "Steam")
-	if _, err = os.Stat(programFiles86Dir); err == nil {
+	if _, err = steamFS.Stat(programFiles86Dir); err == nil {
 		return programFiles86Dir, nil
 	}
 
 	programFilesDir := filepath.Join(os.Getenv("ProgramFiles"), "Steam")
-	if _, err = os.Stat(programFilesDir); err == nil {
+	if _, err = steamFS.Stat(programFilesDir); err == nil {
 		return programFilesDir, nil
 	}
 
-	return "", errors.New("Could not find Steam installation folder. You can drag and drop the Steam folder into `steamgrid.exe` or call `steamgrid STEAMPATH` for a manual override.")
+	return "", errors.New("Could not find Steam installation folder. You can drag and drop the Steam folder into `steamgrid.exe` or call `steamgrid STEAMPATH` for a manual override. In containers, mount it and set STEAMGRID_STEAM_DIR.")
+}
+
+// Home directory of the current user, or "" if unknown. Containers often run
+// as a user without a passwd entry, or without $HOME.
+func homeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
+	if currentUser, err := user.Current(); err == nil {
+		return currentUser.HomeDir
+	}
+	return ""
 }
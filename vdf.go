@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VDFNode is an entry of a Valve KeyValues (VDF) file. Leaf entries have a
+// Value, sections have Children. Steam isn't consistent with the casing of
+// keys, so all lookups are case-insensitive.
+type VDFNode struct {
+	Key      string
+	Value    string
+	Children []*VDFNode
+}
+
+// Get follows the given path of keys, returning nil if any is missing.
+func (node *VDFNode) Get(path ...string) *VDFNode {
+	current := node
+	for _, key := range path {
+		if current == nil {
+			return nil
+		}
+		var next *VDFNode
+		for _, child := range current.Children {
+			if strings.EqualFold(child.Key, key) {
+				next = child
+				break
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// String returns the value at the given path, or "" if it doesn't exist.
+func (node *VDFNode) String(path ...string) string {
+	found := node.Get(path...)
+	if found == nil {
+		return ""
+	}
+	return found.Value
+}
+
+// Find returns the first entry with the given key anywhere below this node,
+// searching depth first.
+func (node *VDFNode) Find(key string) *VDFNode {
+	for _, child := range node.Children {
+		if strings.EqualFold(child.Key, key) {
+			return child
+		}
+		if found := child.Find(key); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Values returns the values of all leaf children, in file order. Used for
+// lists like tags, which are stored as "0" "a", "1" "b"...
+func (node *VDFNode) Values() []string {
+	var values []string
+	if node == nil {
+		return values
+	}
+	for _, child := range node.Children {
+		if child.Children == nil {
+			values = append(values, child.Value)
+		}
+	}
+	return values
+}
+
+type vdfTokenKind int
+
+const (
+	vdfString vdfTokenKind = iota
+	vdfOpen
+	vdfClose
+	vdfEOF
+)
+
+type vdfToken struct {
+	kind  vdfTokenKind
+	value string
+	line  int
+}
+
+// Splits a text VDF into strings and braces. Handles quoted strings with
+// escapes, unquoted strings, comments and the [$PLATFORM] conditionals, which
+// are ignored.
+type vdfTokenizer struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (t *vdfTokenizer) next() (vdfToken, error) {
+	for t.pos < len(t.data) {
+		c := t.data[t.pos]
+		switch {
+		case c == '\n':
+			t.line++
+			t.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			t.pos++
+		case c == '/' && t.pos+1 < len(t.data) && t.data[t.pos+1] == '/':
+			for t.pos < len(t.data) && t.data[t.pos] != '\n' {
+				t.pos++
+			}
+		case c == '[':
+			end := bytes.IndexByte(t.data[t.pos:], ']')
+			if end == -1 {
+				return vdfToken{}, fmt.Errorf("line %v: unterminated conditional", t.line)
+			}
+			t.pos += end + 1
+		case c == '{':
+			t.pos++
+			return vdfToken{vdfOpen, "{", t.line}, nil
+		case c == '}':
+			t.pos++
+			return vdfToken{vdfClose, "}", t.line}, nil
+		case c == '"':
+			return t.quoted()
+		default:
+			start := t.pos
+			for t.pos < len(t.data) && !strings.ContainsRune(" \t\r\n{}\"", rune(t.data[t.pos])) {
+				t.pos++
+			}
+			return vdfToken{vdfString, string(t.data[start:t.pos]), t.line}, nil
+		}
+	}
+	return vdfToken{vdfEOF, "", t.line}, nil
+}
+
+func (t *vdfTokenizer) quoted() (vdfToken, error) {
+	line := t.line
+	t.pos++
+	var value strings.Builder
+	for t.pos < len(t.data) {
+		c := t.data[t.pos]
+		t.pos++
+		switch c {
+		case '"':
+			return vdfToken{vdfString, value.String(), line}, nil
+		case '\n':
+			t.line++
+			value.WriteByte(c)
+		case '\\':
+			if t.pos >= len(t.data) {
+				break
+			}
+			escaped := t.data[t.pos]
+			t.pos++
+			switch escaped {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case '"', '\\':
+				value.WriteByte(escaped)
+			default:
+				// Windows paths aren't always escaped, keep them as they are.
+				value.WriteByte('\\')
+				value.WriteByte(escaped)
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return vdfToken{}, fmt.Errorf("line %v: unterminated string", line)
+}
+
+// ParseTextVDF parses a text KeyValues file like localconfig.vdf or an
+// appmanifest. The returned root node has the top level entries as children.
+func ParseTextVDF(data []byte) (*VDFNode, error) {
+	// Some files start with an UTF-8 BOM.
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	tokenizer := &vdfTokenizer{data: data, line: 1}
+	root := &VDFNode{Children: []*VDFNode{}}
+	stack := []*VDFNode{root}
+
+	for {
+		token, err := tokenizer.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.kind {
+		case vdfEOF:
+			if len(stack) > 1 {
+				return nil, fmt.Errorf("line %v: missing closing brace", token.line)
+			}
+			return root, nil
+		case vdfClose:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %v: unexpected closing brace", token.line)
+			}
+			stack = stack[:len(stack)-1]
+		case vdfOpen:
+			return nil, fmt.Errorf("line %v: section without a name", token.line)
+		case vdfString:
+			// Lines like #include and #base reference other files, skip them.
+			if strings.HasPrefix(token.value, "#") {
+				if _, err := tokenizer.next(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			value, err := tokenizer.next()
+			if err != nil {
+				return nil, err
+			}
+			parent := stack[len(stack)-1]
+			switch value.kind {
+			case vdfString:
+				parent.Children = append(parent.Children, &VDFNode{Key: token.value, Value: value.value})
+			case vdfOpen:
+				section := &VDFNode{Key: token.value, Children: []*VDFNode{}}
+				parent.Children = append(parent.Children, section)
+				stack = append(stack, section)
+			default:
+				return nil, fmt.Errorf("line %v: key %q without a value", token.line, token.value)
+			}
+		}
+	}
+}
+
+// Type markers of the binary KeyValues format used by shortcuts.vdf.
+const (
+	binaryVDFSection = 0x00
+	binaryVDFString  = 0x01
+	binaryVDFInt32   = 0x02
+	binaryVDFFloat32 = 0x03
+	binaryVDFUint64  = 0x07
+	binaryVDFEnd     = 0x08
+	binaryVDFInt64   = 0x0A
+	binaryVDFEndAlt  = 0x0B
+)
+
+// ParseBinaryVDF parses a binary KeyValues file like shortcuts.vdf. Numbers
+// are converted to their decimal string representation.
+func ParseBinaryVDF(data []byte) (*VDFNode, error) {
+	root := &VDFNode{Children: []*VDFNode{}}
+	pos := 0
+
+	readString := func() (string, error) {
+		end := bytes.IndexByte(data[pos:], 0)
+		if end == -1 {
+			return "", fmt.Errorf("offset %v: unterminated string", pos)
+		}
+		value := string(data[pos : pos+end])
+		pos += end + 1
+		return value, nil
+	}
+	readBytes := func(n int) ([]byte, error) {
+		if pos+n > len(data) {
+			return nil, fmt.Errorf("offset %v: unexpected end of file", pos)
+		}
+		value := data[pos : pos+n]
+		pos += n
+		return value, nil
+	}
+
+	stack := []*VDFNode{root}
+	for pos < len(data) {
+		kind := data[pos]
+		pos++
+		if kind == binaryVDFEnd || kind == binaryVDFEndAlt {
+			if len(stack) == 1 {
+				// Trailing end marker of the root.
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		key, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		node := &VDFNode{Key: key}
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, node)
+
+		switch kind {
+		case binaryVDFSection:
+			node.Children = []*VDFNode{}
+			stack = append(stack, node)
+		case binaryVDFString:
+			node.Value, err = readString()
+		case binaryVDFInt32:
+			var raw []byte
+			raw, err = readBytes(4)
+			if err == nil {
+				node.Value = strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(raw))), 10)
+			}
+		case binaryVDFFloat32:
+			var raw []byte
+			raw, err = readBytes(4)
+			if err == nil {
+				node.Value = strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(raw))), 'f', -1, 32)
+			}
+		case binaryVDFUint64:
+			var raw []byte
+			raw, err = readBytes(8)
+			if err == nil {
+				node.Value = strconv.FormatUint(binary.LittleEndian.Uint64(raw), 10)
+			}
+		case binaryVDFInt64:
+			var raw []byte
+			raw, err = readBytes(8)
+			if err == nil {
+				node.Value = strconv.FormatInt(int64(binary.LittleEndian.Uint64(raw)), 10)
+			}
+		default:
+			return nil, fmt.Errorf("offset %v: unknown type 0x%02x for key %q", pos, kind, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(stack) > 1 {
+		return nil, errors.New("unexpected end of file inside section " + stack[len(stack)-1].Key)
+	}
+	return root, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Like userdata/<user>/7/remote/sharedconfig.vdf, with the categories of the
+// games.
+const sharedConfigSample = `"UserRoamingConfigStore"
+{
+	"Software"
+	{
+		"Valve"
+		{
+			"Steam"
+			{
+				"apps"
+				{
+					"620"
+					{
+						"tags"
+						{
+							"0"		"favorite"
+							"1"		"co-op"
+						}
+						"Hidden"		"0"
+					}
+					"440"
+					{
+						"tags"
+						{
+							"0"		"Team \"Fortress\""
+						}
+						"LaunchOptions"		"-novid -console"
+					}
+				}
+				"LastPlayedTimesSyncTime"		"1700000000"
+			}
+		}
+	}
+	"WebStorage"
+	{
+		"user-collections"		"{\"uc-1\":{\"id\":\"uc-1\",\"name\":\"Backlog\"}}"
+	}
+}
+`
+
+// Like appmanifest_620.acf, with a Windows path and conditionals.
+const appManifestSample = `"AppState"
+{
+	"appid"		"620"
+	"name"		"Portal 2"
+	"installdir"		"Portal 2"
+	"LauncherPath"		"C:\Program Files (x86)\Steam\steam.exe"
+	"UserConfig"
+	{
+		"language"		"english" [$WIN32]
+	}
+	// Comment
+	#base "other.acf"
+}
+`
+
+// Like userdata/<user>/config/shortcuts.vdf, with two non-Steam games.
+var shortcutsSample = []byte("\x00shortcuts\x00" +
+	"\x000\x00" +
+	"\x02appid\x00\x39\x30\x00\x80" +
+	"\x01AppName\x00Minecraft\x00" +
+	"\x01Exe\x00\"C:\\Games\\Minecraft\\launcher.exe\"\x00" +
+	"\x01StartDir\x00\"C:\\Games\\Minecraft\\\"\x00" +
+	"\x01icon\x00\x00" +
+	"\x02IsHidden\x00\x00\x00\x00\x00" +
+	"\x02LastPlayTime\x00\x10\x20\x30\x40" +
+	"\x00tags\x00\x010\x00favorite\x00\x08" +
+	"\x08" +
+	"\x001\x00" +
+	"\x02appid\x00\xff\xff\xff\xff" +
+	"\x01AppName\x00Emulator \xe2\x84\xa2\x00" +
+	"\x01Exe\x00/usr/bin/retroarch\x00" +
+	"\x03Scale\x00\x00\x00\x80\x3f" +
+	"\x07Size\x00\x01\x02\x03\x04\x05\x06\x07\x08" +
+	"\x0aOffset\x00\xff\xff\xff\xff\xff\xff\xff\xff" +
+	"\x00tags\x00\x08" +
+	"\x08" +
+	"\x08\x08")
+
+// Writes a node as text VDF, quoting and escaping every string.
+func formatTextVDF(buffer *bytes.Buffer, node *VDFNode) {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	for _, child := range node.Children {
+		buffer.WriteString(`"` + escaper.Replace(child.Key) + `"`)
+		if child.Children == nil {
+			buffer.WriteString(` "` + escaper.Replace(child.Value) + "\"\n")
+			continue
+		}
+		buffer.WriteString("\n{\n")
+		formatTextVDF(buffer, child)
+		buffer.WriteString("}\n")
+	}
+}
+
+// Writes a node as binary VDF. Numbers were turned into strings by the
+// parser, so every value is written as a string.
+func formatBinaryVDF(buffer *bytes.Buffer, node *VDFNode) {
+	for _, child := range node.Children {
+		if child.Children == nil {
+			buffer.WriteByte(binaryVDFString)
+			buffer.WriteString(child.Key + "\x00" + child.Value + "\x00")
+			continue
+		}
+		buffer.WriteByte(binaryVDFSection)
+		buffer.WriteString(child.Key + "\x00")
+		formatBinaryVDF(buffer, child)
+		buffer.WriteByte(binaryVDFEnd)
+	}
+}
+
+func FuzzParseTextVDF(f *testing.F) {
+	f.Add([]byte(sharedConfigSample))
+	f.Add([]byte(appManifestSample))
+	f.Add([]byte("\xEF\xBB\xBF\"a\" { b c }"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root, err := ParseTextVDF(data)
+		if err != nil {
+			return
+		}
+		var formatted bytes.Buffer
+		formatTextVDF(&formatted, root)
+		again, err := ParseTextVDF(formatted.Bytes())
+		if err != nil {
+			t.Fatalf("Could not parse the formatted VDF %q: %v", formatted.String(), err)
+		}
+		if !reflect.DeepEqual(root, again) {
+			t.Fatalf("Parsing the formatted VDF %q gave another result", formatted.String())
+		}
+	})
+}
+
+func FuzzParseBinaryVDF(f *testing.F) {
+	f.Add(shortcutsSample)
+	f.Add([]byte("\x00shortcuts\x00\x08\x08"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root, err := ParseBinaryVDF(data)
+		if err != nil {
+			return
+		}
+		var formatted bytes.Buffer
+		formatBinaryVDF(&formatted, root)
+		again, err := ParseBinaryVDF(formatted.Bytes())
+		if err != nil {
+			t.Fatalf("Could not parse the formatted VDF %q: %v", formatted.String(), err)
+		}
+		if !reflect.DeepEqual(root, again) {
+			t.Fatalf("Parsing the formatted VDF %q gave another result", formatted.String())
+		}
+	})
+}
+
+func TestParseSamples(t *testing.T) {
+	sharedConfig, err := ParseTextVDF([]byte(sharedConfigSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := sharedConfig.Get("UserRoamingConfigStore", "Software", "Valve", "Steam", "apps", "440", "tags").Values(); len(tags) != 1 || tags[0] != `Team "Fortress"` {
+		t.Errorf("Wrong tags %q", tags)
+	}
+	manifest, err := ParseTextVDF([]byte(appManifestSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := manifest.String("AppState", "LauncherPath"); path != `C:\Program Files (x86)\Steam\steam.exe` {
+		t.Errorf("Wrong path %q", path)
+	}
+	shortcuts, err := ParseBinaryVDF(shortcutsSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appID := shortcuts.String("shortcuts", "0", "appid"); appID != "-2147471303" {
+		t.Errorf("Wrong app ID %q", appID)
+	}
+	if name := shortcuts.String("shortcuts", "1", "AppName"); name != "Emulator ™" {
+		t.Errorf("Wrong name %q", name)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The watch command keeps running and processes games right after Steam
+// installs them:
+//
+//	steamgrid watch --steamgriddb <api key>
+//
+// It polls the installed apps of the Steam registry (registry.vdf outside of
+// Windows), which Steam updates as soon as an install starts, or the app
+// manifests if there's no registry. Games moved between categories or
+// collections, like added to the favorites, get their overlays again right
+// away, see collections.go. Stop it with Ctrl+C.
+//
+// In a container, mount the Steam directory and give it explicitly, with
+// -healthcheck for the container health check:
+//
+//	STEAMGRID_STEAM_DIR=/steam steamgrid watch --healthcheck :8766
+//
+// GET /healthz answers 200 with the state of the watcher as JSON, or 503 if
+// the library can't be read, like when the volume went away.
+func runWatchCommand(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	var opts Options
+	opts.RegisterFlags(flags)
+	configPath := registerConfigFlag(flags)
+	interval := flags.Duration("interval", 5*time.Second, "How often to check for new installs")
+	healthcheck := flags.String("healthcheck", "", "Address to answer health checks on at /healthz, like :8766. Off by default")
+	flags.Parse(args)
+
+	err := applyConfigFile(&opts, flags, *configPath)
+	if err != nil {
+		return err
+	}
+	ctx := interruptContext()
+	if err = servePprof(ctx, opts.Pprof); err != nil {
+		return err
+	}
+	w := newWatcher(opts, *interval)
+	if *healthcheck != "" {
+		if err = w.serveHealth(ctx, *healthcheck); err != nil {
+			return err
+		}
+	}
+	return w.watch(ctx)
+}
+
+// Watches for new installs. The tray mode can pause it and ask for full runs.
+type watcher struct {
+	opts     Options
+	interval time.Duration
+	paused   int32
+	runNow   chan struct{}
+	// Called after every run, optional.
+	onRun func(result *Result, err error)
+
+	// For the health check.
+	mutex     sync.Mutex
+	health    watcherHealth
+	pollError error
+}
+
+// State of the watcher reported by the health check.
+type watcherHealth struct {
+	Status    string    `json:"status"`
+	Paused    bool      `json:"paused"`
+	Installed int       `json:"installed"`
+	LastPoll  time.Time `json:"lastPoll"`
+	LastRun   time.Time `json:"lastRun"`
+	Error     string    `json:"error,omitempty"`
+	RunError  string    `json:"runError,omitempty"`
+}
+
+func newWatcher(opts Options, interval time.Duration) *watcher {
+	return &watcher{opts: opts, interval: interval, runNow: make(chan struct{}, 1)}
+}
+
+// Pauses or resumes watching. New installs while paused are processed on
+// resume.
+func (w *watcher) setPaused(paused bool) {
+	value := int32(0)
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&w.paused, value)
+}
+
+// Asks for a run on the whole library, even while paused.
+func (w *watcher) requestRun() {
+	select {
+	case w.runNow <- struct{}{}:
+	default:
+		// Already requested.
+	}
+}
+
+func (w *watcher) watch(ctx context.Context) error {
+	steamDir, _ := GetSteamInstallation(w.opts.SteamDir)
+	known, err := installedApps(steamDir)
+	w.polled(known, err)
+	if err != nil {
+		return err
+	}
+	// Unreadable tags only miss the changes until they can be read again.
+	knownTags, tagsErr := libraryTags(steamDir)
+	fmt.Printf("Watching for new installs, %v games are installed. Press Ctrl+C to stop.\n", len(known))
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.runNow:
+			w.run(ctx, nil)
+			continue
+		case <-ticker.C:
+		}
+		if atomic.LoadInt32(&w.paused) == 1 {
+			continue
+		}
+
+		installed, err := installedApps(steamDir)
+		w.polled(installed, err)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		var added []string
+		for id := range installed {
+			if !known[id] {
+				added = append(added, id)
+			}
+		}
+		// Uninstalled games are forgotten, to process them again if they
+		// come back.
+		known = installed
+		sort.Strings(added)
+		if len(added) > 0 {
+			fmt.Printf("New installs: %v\n", added)
+		}
+
+		tags, err := libraryTags(steamDir)
+		if err == nil && tagsErr == nil {
+			if moved := changedTags(knownTags, tags); len(moved) > 0 {
+				fmt.Printf("Changed categories or collections: %v\n", moved)
+				added = mergeIDs(added, moved)
+			}
+		}
+		if err == nil {
+			knownTags = tags
+		}
+		tagsErr = err
+		if len(added) == 0 {
+			continue
+		}
+		w.run(ctx, added)
+	}
+}
+
+// Sorted IDs of both lists, once each.
+func mergeIDs(a []string, b []string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, id := range append(append([]string{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// Runs on the given games, or all if nil.
+func (w *watcher) run(ctx context.Context, gameIDs []string) {
+	runOpts := w.opts
+	runOpts.GameIDs = gameIDs
+	result, err := Run(ctx, runOpts)
+	if result != nil {
+		printReport(result)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	w.mutex.Lock()
+	w.health.LastRun = time.Now()
+	w.health.RunError = ""
+	if err != nil {
+		w.health.RunError = err.Error()
+	}
+	w.mutex.Unlock()
+	if w.onRun != nil {
+		w.onRun(result, err)
+	}
+}
+
+// Records a poll of the installed games for the health check.
+func (w *watcher) polled(installed map[string]bool, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.health.LastPoll = time.Now()
+	w.pollError = err
+	if err == nil {
+		w.health.Installed = len(installed)
+	}
+}
+
+// Answers health checks on the address until the context ends.
+func (w *watcher) serveHealth(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		w.mutex.Lock()
+		health := w.health
+		health.Paused = atomic.LoadInt32(&w.paused) == 1
+		health.Status = "ok"
+		status := http.StatusOK
+		if w.pollError != nil {
+			health.Status = "error"
+			health.Error = w.pollError.Error()
+			status = http.StatusServiceUnavailable
+		}
+		w.mutex.Unlock()
+		writeJSON(rw, status, health)
+	})
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	go httpServer.Serve(listener)
+	fmt.Println("Answering health checks on http://" + listener.Addr().String() + "/healthz")
+	return nil
+}